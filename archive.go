@@ -0,0 +1,304 @@
+package git
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/archive"
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const (
+	exportIgnoreAttr = "export-ignore"
+	exportSubstAttr  = "export-subst"
+)
+
+// Archive writes an archive of a tree to w, the equivalent to `git
+// archive`. The files with the export-ignore gitattribute are left out of
+// the archive, while the placeholders of the files with the export-subst
+// gitattribute are expanded when archiving a commit. The gitattributes are
+// read from the tree archived.
+func (r *Repository) Archive(w io.Writer, o *ArchiveOptions) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	a := &archiver{o: o, mtime: time.Now()}
+	tree, err := a.resolveTree(r)
+	if err != nil {
+		return err
+	}
+
+	a.attrs = &treeAttributes{
+		tree: tree,
+		dirs: make(map[string][]gitattributes.MatchAttribute),
+	}
+
+	if a.enc, err = archive.NewEncoder(w, o.Format); err != nil {
+		return err
+	}
+
+	if a.commit != nil {
+		if err := a.enc.SetCommitID(a.commit.Hash); err != nil {
+			return err
+		}
+	}
+
+	if strings.HasSuffix(o.Prefix, "/") {
+		err := a.enc.Encode(&archive.File{
+			Name:    strings.TrimSuffix(o.Prefix, "/"),
+			Mode:    filemode.Dir,
+			ModTime: a.mtime,
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := a.writeTree(tree, ""); err != nil {
+		return err
+	}
+
+	return a.enc.Close()
+}
+
+// archiver writes the files of a tree to an archive.
+type archiver struct {
+	o     *ArchiveOptions
+	enc   *archive.Encoder
+	attrs *treeAttributes
+	// commit is the commit archived, nil if the tree-ish isn't a commit
+	commit *object.Commit
+	mtime  time.Time
+	// pending are the directories not written yet, written before the
+	// first file inside them when a pathspec is given
+	pending []string
+}
+
+// resolveTree returns the tree of the tree-ish archived.
+func (a *archiver) resolveTree(r *Repository) (*object.Tree, error) {
+	h, err := r.ResolveRevision(a.o.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := r.Object(plumbing.AnyObject, *h)
+	if err != nil {
+		return nil, err
+	}
+
+	if tag, ok := obj.(*object.Tag); ok {
+		if obj, err = tag.Object(); err != nil {
+			return nil, err
+		}
+	}
+
+	switch obj := obj.(type) {
+	case *object.Commit:
+		a.commit = obj
+		a.mtime = obj.Committer.When
+		return obj.Tree()
+	case *object.Tree:
+		return obj, nil
+	}
+
+	return nil, plumbing.ErrInvalidType
+}
+
+func (a *archiver) writeTree(t *object.Tree, dir string) error {
+	for _, e := range t.Entries {
+		name := path.Join(dir, e.Name)
+		attrs, err := a.attrs.attributes(name)
+		if err != nil {
+			return err
+		}
+
+		if attr, ok := attrs[exportIgnoreAttr]; ok && attr.IsSet() {
+			continue
+		}
+
+		switch e.Mode {
+		case filemode.Dir:
+			err = a.writeSubtree(t, e, name)
+		case filemode.Submodule:
+			if a.matches(name) {
+				err = a.writeDir(name, e.Mode)
+			}
+		default:
+			if a.matches(name) {
+				attr, ok := attrs[exportSubstAttr]
+				err = a.writeFile(t, e, name, ok && attr.IsSet())
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// matches returns whether the given path matches the pathspec, if any.
+func (a *archiver) matches(name string) bool {
+	return matchPathspec(a.o.Paths, name)
+}
+
+func (a *archiver) writeSubtree(parent *object.Tree, e object.TreeEntry, name string) error {
+	if !a.matches(name) && !pathspecMayMatch(a.o.Paths, name) {
+		return nil
+	}
+
+	subtree, err := parent.Tree(e.Name)
+	if err != nil {
+		return err
+	}
+
+	if len(a.o.Paths) == 0 {
+		if err := a.writeDir(name, e.Mode); err != nil {
+			return err
+		}
+
+		return a.writeTree(subtree, name)
+	}
+
+	a.pending = append(a.pending, name)
+	if err := a.writeTree(subtree, name); err != nil {
+		return err
+	}
+
+	if n := len(a.pending); n != 0 && a.pending[n-1] == name {
+		a.pending = a.pending[:n-1]
+	}
+
+	return nil
+}
+
+// writeDir writes a directory, after the pending directories containing
+// it.
+func (a *archiver) writeDir(name string, mode filemode.FileMode) error {
+	if err := a.writePending(); err != nil {
+		return err
+	}
+
+	return a.enc.Encode(&archive.File{
+		Name:    a.o.Prefix + name,
+		Mode:    mode,
+		ModTime: a.mtime,
+	})
+}
+
+func (a *archiver) writePending() error {
+	for _, dir := range a.pending {
+		err := a.enc.Encode(&archive.File{
+			Name:    a.o.Prefix + dir,
+			Mode:    filemode.Dir,
+			ModTime: a.mtime,
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	a.pending = a.pending[:0]
+	return nil
+}
+
+func (a *archiver) writeFile(t *object.Tree, e object.TreeEntry, name string, subst bool) error {
+	if err := a.writePending(); err != nil {
+		return err
+	}
+
+	file, err := t.TreeEntryFile(&e)
+	if err != nil {
+		return err
+	}
+
+	r, err := file.Reader()
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	f := &archive.File{
+		Name:    a.o.Prefix + name,
+		Mode:    e.Mode,
+		ModTime: a.mtime,
+		Size:    file.Size,
+		Content: r,
+	}
+
+	if subst && a.commit != nil && e.Mode != filemode.Symlink {
+		content, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		content = archive.Substitute(content, a.commit)
+		f.Size = int64(len(content))
+		f.Content = bytes.NewReader(content)
+	}
+
+	return a.enc.Encode(f)
+}
+
+// treeAttributes reads the gitattributes of the paths of a tree from the
+// .gitattributes files of the tree.
+type treeAttributes struct {
+	tree *object.Tree
+	// dirs caches the gitattributes read from each directory
+	dirs map[string][]gitattributes.MatchAttribute
+}
+
+// attributes returns the gitattributes of the given path.
+func (t *treeAttributes) attributes(name string) (map[string]gitattributes.Attribute, error) {
+	path := strings.Split(name, "/")
+	stack := []gitattributes.MatchAttribute{binaryMacro}
+	for i := range path {
+		dir := strings.Join(path[:i], "/")
+		attrs, ok := t.dirs[dir]
+		if !ok {
+			var err error
+			if attrs, err = t.read(path[:i:i]); err != nil {
+				return nil, err
+			}
+
+			t.dirs[dir] = attrs
+		}
+
+		stack = append(stack, attrs...)
+	}
+
+	results, _ := gitattributes.NewMatcher(stack).Match(path, nil)
+	return results, nil
+}
+
+// read reads the .gitattributes file of the given directory, if any.
+func (t *treeAttributes) read(dir []string) ([]gitattributes.MatchAttribute, error) {
+	f, err := t.tree.File(path.Join(append(dir, gitattributesFile)...))
+	if err == object.ErrFileNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := f.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+	return gitattributes.ReadAttributes(r, dir, len(dir) == 0)
+}
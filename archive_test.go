@@ -0,0 +1,137 @@
+package git
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/archive"
+	"github.com/go-git/go-git/v5/storage/memory"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	. "gopkg.in/check.v1"
+)
+
+type ArchiveSuite struct {
+	BaseSuite
+	r    *Repository
+	head plumbing.Hash
+}
+
+var _ = Suite(&ArchiveSuite{})
+
+func (s *ArchiveSuite) SetUpTest(c *C) {
+	var err error
+	s.r, err = Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+
+	w, err := s.r.Worktree()
+	c.Assert(err, IsNil)
+
+	c.Assert(w.Filesystem.Symlink("foo", "link"), IsNil)
+	_, err = w.Add("link")
+	c.Assert(err, IsNil)
+
+	s.head = commitFiles(c, w, "foo", map[string]string{
+		".gitattributes":  "*.log export-ignore\nversion export-subst\n",
+		"foo":             "foo",
+		"dir/bar":         "bar",
+		"dir/debug.log":   "debug",
+		"version":         "$Format:%H$",
+		"other/qux":       "qux",
+		"other/debug.log": "debug",
+	})
+}
+
+// readTar returns the contents of the files of a tar archive by name, and
+// the pax global header comment.
+func readTar(c *C, content []byte) (map[string]string, string) {
+	files := make(map[string]string)
+	var comment string
+
+	tr := tar.NewReader(bytes.NewReader(content))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			comment = hdr.PAXRecords["comment"]
+			continue
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		c.Assert(err, IsNil)
+		files[hdr.Name] = string(data) + hdr.Linkname
+	}
+
+	return files, comment
+}
+
+func (s *ArchiveSuite) TestArchive(c *C) {
+	var buf bytes.Buffer
+	err := s.r.Archive(&buf, &ArchiveOptions{Prefix: "project/"})
+	c.Assert(err, IsNil)
+
+	files, comment := readTar(c, buf.Bytes())
+	c.Assert(comment, Equals, s.head.String())
+	c.Assert(files, DeepEquals, map[string]string{
+		"project/":               "",
+		"project/.gitattributes": "*.log export-ignore\nversion export-subst\n",
+		"project/dir/":           "",
+		"project/dir/bar":        "bar",
+		"project/foo":            "foo",
+		"project/link":           "foo",
+		"project/other/":         "",
+		"project/other/qux":      "qux",
+		"project/version":        s.head.String(),
+	})
+}
+
+func (s *ArchiveSuite) TestArchiveTree(c *C) {
+	var buf bytes.Buffer
+	err := s.r.Archive(&buf, &ArchiveOptions{Revision: "HEAD:dir"})
+	c.Assert(err, IsNil)
+
+	files, comment := readTar(c, buf.Bytes())
+	c.Assert(comment, Equals, "")
+	c.Assert(files, DeepEquals, map[string]string{"bar": "bar", "debug.log": "debug"})
+}
+
+func (s *ArchiveSuite) TestArchivePaths(c *C) {
+	var buf bytes.Buffer
+	err := s.r.Archive(&buf, &ArchiveOptions{Paths: []string{"other", "*/bar"}})
+	c.Assert(err, IsNil)
+
+	files, _ := readTar(c, buf.Bytes())
+	c.Assert(files, DeepEquals, map[string]string{
+		"dir/":      "",
+		"dir/bar":   "bar",
+		"other/":    "",
+		"other/qux": "qux",
+	})
+}
+
+func (s *ArchiveSuite) TestArchiveZip(c *C) {
+	var buf bytes.Buffer
+	err := s.r.Archive(&buf, &ArchiveOptions{Format: archive.Zip, Paths: []string{"foo"}})
+	c.Assert(err, IsNil)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Assert(err, IsNil)
+	c.Assert(zr.Comment, Equals, s.head.String())
+	c.Assert(zr.File, HasLen, 1)
+	c.Assert(zr.File[0].Name, Equals, "foo")
+
+	commit, err := s.r.CommitObject(s.head)
+	c.Assert(err, IsNil)
+	c.Assert(zr.File[0].Modified.Unix(), Equals, commit.Committer.When.Unix())
+
+	err = s.r.Archive(&buf, &ArchiveOptions{Format: "rar"})
+	c.Assert(err, Equals, archive.ErrUnknownFormat)
+}
@@ -1,19 +1,36 @@
 package git
 
 import (
-	"bytes"
+	"context"
 	"errors"
-	"fmt"
-	"strconv"
+	"io"
+	"path"
+	"sort"
 	"strings"
 	"time"
-	"unicode/utf8"
+	"unicode"
+
+	"github.com/emirpasic/gods/trees/binaryheap"
 
 	"github.com/go-git/go-git/v5/plumbing"
+	commitgraphfmt "github.com/go-git/go-git/v5/plumbing/format/commitgraph"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/object/commitgraph"
 	"github.com/go-git/go-git/v5/utils/diff"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+var (
+	// ErrInvalidLineRange is returned blaming a range of lines out of the
+	// lines of the file.
+	ErrInvalidLineRange = errors.New("invalid line range")
 )
 
+// moveScore is the number of alphanumeric characters the lines moved or
+// copied must have to be detected, the same as git's default.
+const moveScore = 20
+
 // BlameResult represents the result of a Blame operation.
 type BlameResult struct {
 	// Path is the path of the File that we're blaming.
@@ -22,6 +39,34 @@ type BlameResult struct {
 	Rev plumbing.Hash
 	// Lines contains every line with its authorship.
 	Lines []*Line
+	// Entries are the ranges of consecutive lines blamed to the same
+	// commit, in the order they were found.
+	Entries []*BlameEntry
+}
+
+// BlameEntry is a range of consecutive lines of a file blamed to the same
+// commit.
+type BlameEntry struct {
+	// Commit is the commit blamed for the lines.
+	Commit *object.Commit
+	// Path is the path of the file in the commit, which is different from
+	// the path blamed if the file was renamed or the lines were copied.
+	Path string
+	// SourceLine is the number of the first line in the file of the
+	// commit, counted from 1.
+	SourceLine int
+	// FinalLine is the number of the first line in the file blamed,
+	// counted from 1.
+	FinalLine int
+	// NumLines is the number of lines.
+	NumLines int
+	// Previous is the first parent of the commit with the file, nil if
+	// there is none, and PreviousPath the path of the file in it.
+	Previous     *object.Commit
+	PreviousPath string
+	// Boundary is set if the commit is a root commit, or its parents are
+	// missing in a shallow repository.
+	Boundary bool
 }
 
 // Blame returns a BlameResult with the information about the last author of
@@ -31,80 +76,89 @@ func Blame(c *object.Commit, path string) (*BlameResult, error) {
 	// commit and path. commit is a Commit object obtained from a Repository. Path
 	// represents a path to a specific file contained into the repository.
 	//
-	// Blaming a file is a two step process:
-	//
-	// 1. Create a linear history of the commits affecting a file. We use
-	// revlist.New for that.
-	//
-	// 2. Then build a graph with a node for every line in every file in
-	// the history of the file.
-	//
-	// Each node is assigned a commit: Start by the nodes in the first
-	// commit. Assign that commit as the creator of all its lines.
+	// Blaming a file starts by blaming all of its lines to the commit,
+	// then walking the history in committer time order. The lines blamed
+	// to each commit which are unchanged in a parent are passed to it,
+	// diffing the file in the commit and the parent, while the rest of the
+	// lines are blamed to the commit. The file is followed through the
+	// renames, and optionally the lines moved within the file or copied
+	// from other files are passed too.
 	//
-	// Then jump to the nodes in the next commit, and calculate the diff
-	// between the two files. Newly created lines get
-	// assigned the new commit as its origin. Modified lines also get
-	// this new commit. Untouched lines retain the old commit.
-	//
-	// All this work is done in the assignOrigin function which holds all
-	// the internal relevant data in a "blame" struct, that is not
-	// exported.
-	//
-	// TODO: ways to improve the efficiency of this function:
-	// 1. Improve revlist
-	// 2. Improve how to traverse the history (example a backward traversal will
-	// be much more efficient)
-	//
-	// TODO: ways to improve the function in general:
-	// 1. Add memoization between revlist and assign.
-	// 2. It is using much more memory than needed, see the TODOs below.
+	// Only the lines not blamed yet are passed, so the history is walked
+	// only while there are lines left, and only the versions of the file
+	// still needed are kept in memory.
+	return blame(&objectBlameCommit{c}, path, &BlameOptions{})
+}
 
-	b := new(blame)
-	b.fRev = c
-	b.path = path
+// Blame returns a BlameResult with the information about the last author of
+// each line from file `path` at commit `c`, the same as Blame, using the
+// given options. The commit-graph of the repository is used to walk the
+// history, if any.
+func (r *Repository) Blame(c *object.Commit, path string, o *BlameOptions) (*BlameResult, error) {
+	index, closer := r.commitNodeIndex()
+	if closer != nil {
+		defer closer.Close()
+	}
 
-	// get all the file revisions
-	if err := b.fillRevs(); err != nil {
+	node, err := index.Get(c.Hash)
+	if err != nil {
 		return nil, err
 	}
 
-	// calculate the line tracking graph and fill in
-	// file contents in data.
-	if err := b.fillGraphAndData(); err != nil {
-		return nil, err
+	result, err := blame(&nodeBlameCommit{node}, path, o)
+	if err != nil || !o.UseMailmap {
+		return result, err
 	}
 
-	file, err := b.fRev.File(b.path)
+	m, err := r.Mailmap()
 	if err != nil {
 		return nil, err
 	}
-	finalLines, err := file.Lines()
+
+	for _, l := range result.Lines {
+		l.AuthorName, l.Author = m.Resolve(l.AuthorName, l.Author)
+	}
+
+	mapped := make(map[plumbing.Hash]*object.Commit)
+	for _, e := range result.Entries {
+		commit, ok := mapped[e.Commit.Hash]
+		if !ok {
+			copied := *e.Commit
+			copied.Author = *m.ResolveSignature(&e.Commit.Author)
+			copied.Committer = *m.ResolveSignature(&e.Commit.Committer)
+			commit = &copied
+			mapped[commit.Hash] = commit
+		}
+
+		e.Commit = commit
+	}
+
+	return result, nil
+}
+
+// commitNodeIndex returns the index of the commit nodes of the repository,
+// using the commit-graph if there is any, and the file to close once done.
+func (r *Repository) commitNodeIndex() (commitgraph.CommitNodeIndex, io.Closer) {
+	f, err := r.dotGitFilesystem().Open(path.Join("objects", "info", "commit-graph"))
 	if err != nil {
-		return nil, err
+		return commitgraph.NewObjectCommitNodeIndex(r.Storer), nil
 	}
 
-	// Each node (line) holds the commit where it was introduced or
-	// last modified. To achieve that we use the FORWARD algorithm
-	// described in Zimmermann, et al. "Mining Version Archives for
-	// Co-changed Lines", in proceedings of the Mining Software
-	// Repositories workshop, Shanghai, May 22-23, 2006.
-	lines, err := newLines(finalLines, b.sliceGraph(len(b.graph)-1))
+	index, err := commitgraphfmt.OpenFileIndex(f)
 	if err != nil {
-		return nil, err
+		_ = f.Close()
+		return commitgraph.NewObjectCommitNodeIndex(r.Storer), nil
 	}
 
-	return &BlameResult{
-		Path:  path,
-		Rev:   c.Hash,
-		Lines: lines,
-	}, nil
+	return commitgraph.NewGraphCommitNodeIndex(index, r.Storer), f
 }
 
 // Line values represent the contents and author of a line in BlamedResult values.
 type Line struct {
 	// Author is the email address of the last author that modified the line.
 	Author string
+	// AuthorName is the name of the last author that modified the line.
+	AuthorName string
 	// Text is the original text of the line.
 	Text string
 	// Date is when the original text of the line was introduced
@@ -113,12 +167,13 @@ type Line struct {
 	Hash plumbing.Hash
 }
 
-func newLine(author, text string, date time.Time, hash plumbing.Hash) *Line {
+func newLine(author, authorName, text string, date time.Time, hash plumbing.Hash) *Line {
 	return &Line{
-		Author: author,
-		Text:   text,
-		Hash:   hash,
-		Date:   date,
+		Author:     author,
+		AuthorName: authorName,
+		Text:       text,
+		Hash:       hash,
+		Date:       date,
 	}
 }
 
@@ -137,7 +192,7 @@ func newLines(contents []string, commits []*object.Commit) ([]*Line, error) {
 	result := make([]*Line, 0, lcontents)
 	for i := range contents {
 		result = append(result, newLine(
-			commits[i].Author.Email, contents[i],
+			commits[i].Author.Email, commits[i].Author.Name, contents[i],
 			commits[i].Author.When, commits[i].Hash,
 		))
 	}
@@ -145,157 +200,783 @@ func newLines(contents []string, commits []*object.Commit) ([]*Line, error) {
 	return result, nil
 }
 
-// this struct is internally used by the blame function to hold its
-// inputs, outputs and state.
-type blame struct {
-	// the path of the file to blame
-	path string
-	// the commit of the final revision of the file to blame
-	fRev *object.Commit
-	// the chain of revisions affecting the the file to blame
-	revs []*object.Commit
-	// the contents of the file across all its revisions
-	data []string
-	// the graph of the lines in the file across all the revisions
-	graph [][]*object.Commit
+// blameCommit is a commit walked by blame, either a commit object or a node
+// of the commit-graph.
+type blameCommit interface {
+	ID() plumbing.Hash
+	Tree() (*object.Tree, error)
+	CommitTime() time.Time
+	NumParents() int
+	Commit() (*object.Commit, error)
+	parent(i int) (blameCommit, error)
 }
 
-// calculate the history of a file "path", starting from commit "from", sorted by commit date.
-func (b *blame) fillRevs() error {
-	var err error
+type objectBlameCommit struct {
+	c *object.Commit
+}
+
+func (c *objectBlameCommit) ID() plumbing.Hash {
+	return c.c.Hash
+}
+
+func (c *objectBlameCommit) Tree() (*object.Tree, error) {
+	return c.c.Tree()
+}
+
+func (c *objectBlameCommit) CommitTime() time.Time {
+	return c.c.Committer.When
+}
+
+func (c *objectBlameCommit) NumParents() int {
+	return c.c.NumParents()
+}
+
+func (c *objectBlameCommit) Commit() (*object.Commit, error) {
+	return c.c, nil
+}
+
+func (c *objectBlameCommit) parent(i int) (blameCommit, error) {
+	p, err := c.c.Parent(i)
+	if err != nil {
+		return nil, err
+	}
+
+	return &objectBlameCommit{p}, nil
+}
+
+type nodeBlameCommit struct {
+	commitgraph.CommitNode
+}
+
+func (c *nodeBlameCommit) parent(i int) (blameCommit, error) {
+	p, err := c.ParentNode(i)
+	if err != nil {
+		return nil, err
+	}
+
+	return &nodeBlameCommit{p}, nil
+}
+
+// blameOrigin is a version of the file blamed, the file at a path of a
+// commit, with the entries blamed to it which aren't passed to its parents
+// yet.
+type blameOrigin struct {
+	commit blameCommit
+	path   string
+	file   *object.File
+	// lines are the lines of the file, with their line endings, loaded
+	// when needed
+	lines []string
+	// index are the positions of each line, used to detect the moves
+	index map[string][]int
+	// previous is the origin in the first parent with the file
+	previous *blameOrigin
+	entries  []*blameEntry
+	queued   bool
+}
+
+func (o *blameOrigin) loadLines() ([]string, error) {
+	if o.lines != nil {
+		return o.lines, nil
+	}
+
+	content, err := o.file.Contents()
+	if err != nil {
+		return nil, err
+	}
+
+	o.lines = splitLines(content)
+	return o.lines, nil
+}
+
+// splitLines splits the content in lines, keeping their line endings.
+func splitLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// blameEntry is a range of lines of the file blamed, blamed to an origin.
+type blameEntry struct {
+	// final is the first line in the file blamed
+	final int
+	// source is the first line in the file of the origin
+	source int
+	n      int
+	origin *blameOrigin
+}
+
+// lineChunk is a range of lines unchanged between a parent and a child.
+type lineChunk struct {
+	parent, child, n int
+}
+
+// lineHunk is a range of lines changed between a parent and a child.
+type lineHunk struct {
+	parent, parentN int
+	child, childN   int
+}
+
+// blamer blames the lines of a file, walking the history in committer time
+// order.
+type blamer struct {
+	opts    *BlameOptions
+	ignore  map[plumbing.Hash]bool
+	origins map[string]*blameOrigin
+	queue   *binaryheap.Heap
+	// found are the entries blamed to their origin, in the order found
+	found   []*blameEntry
+	commits map[plumbing.Hash]*object.Commit
+}
+
+func blame(c blameCommit, path string, o *BlameOptions) (*BlameResult, error) {
+	b := &blamer{
+		opts:    o,
+		ignore:  make(map[plumbing.Hash]bool),
+		origins: make(map[string]*blameOrigin),
+		commits: make(map[plumbing.Hash]*object.Commit),
+		queue: binaryheap.NewWith(func(a, b interface{}) int {
+			if a.(*blameOrigin).commit.CommitTime().Before(b.(*blameOrigin).commit.CommitTime()) {
+				return 1
+			}
+			return -1
+		}),
+	}
+
+	for _, h := range o.IgnoreRevs {
+		b.ignore[h] = true
+	}
+
+	final, err := b.origin(c, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if final == nil {
+		return nil, object.ErrFileNotFound
+	}
+
+	// the lines are kept, as the origin is released once processed
+	lines, err := final.loadLines()
+	if err != nil {
+		return nil, err
+	}
+
+	ranges, err := blameRanges(o.LineRanges, len(lines))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range ranges {
+		b.pass(final, &blameEntry{final: r.Start - 1, source: r.Start - 1, n: r.End - r.Start + 1})
+	}
+
+	for !b.queue.Empty() {
+		v, _ := b.queue.Pop()
+		if err := b.passBlame(v.(*blameOrigin)); err != nil {
+			return nil, err
+		}
+	}
+
+	return b.result(c, path, lines, ranges)
+}
+
+// blameRanges returns the given ranges sorted and merged, the whole file if
+// there are none.
+func blameRanges(ranges []LineRange, n int) ([]LineRange, error) {
+	if len(ranges) == 0 {
+		if n == 0 {
+			return nil, nil
+		}
+
+		return []LineRange{{Start: 1, End: n}}, nil
+	}
 
-	b.revs, err = references(b.fRev, b.path)
-	return err
+	sorted := make([]LineRange, 0, len(ranges))
+	for _, r := range ranges {
+		if r.End == 0 {
+			r.End = n
+		}
+
+		if r.Start < 1 || r.End < r.Start || r.End > n {
+			return nil, ErrInvalidLineRange
+		}
+
+		sorted = append(sorted, r)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	merged := sorted[:1]
+	for _, r := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start <= last.End+1 {
+			if r.End > last.End {
+				last.End = r.End
+			}
+
+			continue
+		}
+
+		merged = append(merged, r)
+	}
+
+	return merged, nil
 }
 
-// build graph of a file from its revision history
-func (b *blame) fillGraphAndData() error {
-	//TODO: not all commits are needed, only the current rev and the prev
-	b.graph = make([][]*object.Commit, len(b.revs))
-	b.data = make([]string, len(b.revs)) // file contents in all the revisions
-	// for every revision of the file, starting with the first
-	// one...
-	for i, rev := range b.revs {
-		// get the contents of the file
-		file, err := rev.File(b.path)
+// origin returns the origin of the file at the given path of the commit,
+// nil if the commit doesn't have the file.
+func (b *blamer) origin(c blameCommit, path string) (*blameOrigin, error) {
+	key := c.ID().String() + path
+	if o, ok := b.origins[key]; ok {
+		return o, nil
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := tree.FindEntry(path)
+	if err != nil || !e.Mode.IsFile() {
+		return nil, nil
+	}
+
+	f, err := tree.TreeEntryFile(e)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &blameOrigin{commit: c, path: path, file: f}
+	b.origins[key] = o
+	return o, nil
+}
+
+// pass passes the entry to the origin, queueing it if needed.
+func (b *blamer) pass(o *blameOrigin, e *blameEntry) {
+	e.origin = o
+	o.entries = append(o.entries, e)
+	if !o.queued {
+		o.queued = true
+		b.queue.Push(o)
+	}
+}
+
+// passBlame passes the entries of the origin unchanged in its parents to
+// them, blaming the rest of the entries to the origin.
+func (b *blamer) passBlame(o *blameOrigin) error {
+	entries := o.entries
+	o.entries, o.queued = nil, false
+
+	var parents []blameCommit
+	var porigins []*blameOrigin
+	for i := 0; i < o.commit.NumParents(); i++ {
+		p, err := o.commit.parent(i)
+		if err == plumbing.ErrObjectNotFound {
+			// the history of shallow clones ends at the missing parents
+			continue
+		}
+
 		if err != nil {
-			return nil
+			return err
 		}
-		b.data[i], err = file.Contents()
+
+		po, err := b.parentOrigin(o, p)
 		if err != nil {
 			return err
 		}
-		nLines := countLines(b.data[i])
-		// create a node for each line
-		b.graph[i] = make([]*object.Commit, nLines)
-		// assign a commit to each node
-		// if this is the first revision, then the node is assigned to
-		// this first commit.
-		if i == 0 {
-			for j := 0; j < nLines; j++ {
-				b.graph[i][j] = b.revs[i]
+
+		if po != nil && o.previous == nil {
+			o.previous = po
+		}
+
+		parents = append(parents, p)
+		porigins = append(porigins, po)
+	}
+
+	// the whole blame is passed to a parent with the same file
+	for _, po := range porigins {
+		if po != nil && po.file.Hash == o.file.Hash {
+			for _, e := range entries {
+				b.pass(po, e)
+			}
+
+			return b.release(o)
+		}
+	}
+
+	diffs := make([]lineDiff, len(porigins))
+	for i, po := range porigins {
+		if po == nil || len(entries) == 0 {
+			continue
+		}
+
+		var err error
+		if diffs[i], err = diffOrigins(po, o); err != nil {
+			return err
+		}
+
+		entries = b.passUnchanged(po, entries, diffs[i].unchanged)
+	}
+
+	if b.opts.DetectMoves {
+		for _, po := range porigins {
+			if po == nil || len(entries) == 0 {
+				continue
+			}
+
+			var err error
+			if entries, err = b.passMoved(o, po, entries); err != nil {
+				return err
+			}
+		}
+	}
+
+	if b.opts.DetectCopies {
+		for _, p := range parents {
+			if len(entries) == 0 {
+				break
+			}
+
+			var err error
+			if entries, err = b.passCopied(o, p, entries); err != nil {
+				return err
+			}
+		}
+	}
+
+	if b.ignore[o.commit.ID()] {
+		for i, po := range porigins {
+			if po != nil && len(entries) != 0 {
+				entries = b.passIgnored(po, entries, diffs[i].changed)
 			}
-		} else {
-			// if this is not the first commit, then assign to the old
-			// commit or to the new one, depending on what the diff
-			// says.
-			b.assignOrigin(i, i-1)
 		}
 	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].final < entries[j].final })
+	b.found = append(b.found, entries...)
+	return b.release(o)
+}
+
+// release releases the contents of the origin once processed, unless more
+// entries were passed to it.
+func (b *blamer) release(o *blameOrigin) error {
+	if !o.queued {
+		o.lines, o.index = nil, nil
+	}
+
 	return nil
 }
 
-// sliceGraph returns a slice of commits (one per line) for a particular
-// revision of a file (0=first revision).
-func (b *blame) sliceGraph(i int) []*object.Commit {
-	fVs := b.graph[i]
-	result := make([]*object.Commit, 0, len(fVs))
-	for _, v := range fVs {
-		c := *v
-		result = append(result, &c)
-	}
-	return result
-}
-
-// Assigns origin to vertexes in current (c) rev from data in its previous (p)
-// revision
-func (b *blame) assignOrigin(c, p int) {
-	// assign origin based on diff info
-	hunks := diff.Do(b.data[p], b.data[c])
-	sl := -1 // source line
-	dl := -1 // destination line
-	for h := range hunks {
-		hLines := countLines(hunks[h].Text)
-		for hl := 0; hl < hLines; hl++ {
-			switch {
-			case hunks[h].Type == 0:
-				sl++
-				dl++
-				b.graph[c][dl] = b.graph[p][sl]
-			case hunks[h].Type == 1:
-				dl++
-				b.graph[c][dl] = b.revs[c]
-			case hunks[h].Type == -1:
-				sl++
-			default:
-				panic("unreachable")
+// parentOrigin returns the origin of the file of o in the parent, following
+// the renames.
+func (b *blamer) parentOrigin(o *blameOrigin, p blameCommit) (*blameOrigin, error) {
+	po, err := b.origin(p, o.path)
+	if po != nil || err != nil {
+		return po, err
+	}
+
+	tree, err := o.commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	ptree, err := p.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTreeWithOptions(context.Background(), ptree, tree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ch := range changes {
+		if ch.To.Name == o.path && ch.From.Name != "" {
+			return b.origin(p, ch.From.Name)
+		}
+	}
+
+	return nil, nil
+}
+
+// lineDiff is the diff of the lines of a parent and a child.
+type lineDiff struct {
+	unchanged []lineChunk
+	changed   []lineHunk
+}
+
+func diffOrigins(parent, child *blameOrigin) (lineDiff, error) {
+	var d lineDiff
+	plines, err := parent.loadLines()
+	if err != nil {
+		return d, err
+	}
+
+	clines, err := child.loadLines()
+	if err != nil {
+		return d, err
+	}
+
+	var p, c int
+	var hunk *lineHunk
+	for _, h := range diff.Do(strings.Join(plines, ""), strings.Join(clines, "")) {
+		n := countLines(h.Text)
+		if h.Type == diffmatchpatch.DiffEqual {
+			d.unchanged = append(d.unchanged, lineChunk{parent: p, child: c, n: n})
+			p, c, hunk = p+n, c+n, nil
+			continue
+		}
+
+		if hunk == nil {
+			d.changed = append(d.changed, lineHunk{parent: p, child: c})
+			hunk = &d.changed[len(d.changed)-1]
+		}
+
+		if h.Type == diffmatchpatch.DiffDelete {
+			hunk.parentN += n
+			p += n
+		} else {
+			hunk.childN += n
+			c += n
+		}
+	}
+
+	return d, nil
+}
+
+// passUnchanged passes the parts of the entries in the unchanged chunks to
+// the parent, returning the rest.
+func (b *blamer) passUnchanged(po *blameOrigin, entries []*blameEntry, chunks []lineChunk) []*blameEntry {
+	var rest []*blameEntry
+	for _, e := range entries {
+		pos, end := e.source, e.source+e.n
+		for _, ch := range chunks {
+			if ch.child+ch.n <= pos {
+				continue
+			}
+
+			if ch.child >= end {
+				break
 			}
+
+			if ch.child > pos {
+				rest = append(rest, e.slice(pos, ch.child))
+				pos = ch.child
+			}
+
+			to := min(end, ch.child+ch.n)
+			passed := e.slice(pos, to)
+			passed.source = ch.parent + pos - ch.child
+			b.pass(po, passed)
+			pos = to
+		}
+
+		if pos < end {
+			rest = append(rest, e.slice(pos, end))
 		}
 	}
+
+	return rest
 }
 
-// GoString prints the results of a Blame using git-blame's style.
-func (b *blame) GoString() string {
-	var buf bytes.Buffer
+// slice returns the part of the entry from the source line start to end.
+func (e *blameEntry) slice(start, end int) *blameEntry {
+	return &blameEntry{
+		final:  e.final + start - e.source,
+		source: start,
+		n:      end - start,
+		origin: e.origin,
+	}
+}
 
-	file, err := b.fRev.File(b.path)
+// passMoved passes the lines of the entries moved within the file to the
+// parent.
+func (b *blamer) passMoved(o, po *blameOrigin, entries []*blameEntry) ([]*blameEntry, error) {
+	lines, err := o.loadLines()
 	if err != nil {
-		panic("PrettyPrint: internal error in repo.Data")
+		return nil, err
+	}
+
+	var rest []*blameEntry
+	for _, e := range entries {
+		r, err := b.passBlocks(lines, po, e)
+		if err != nil {
+			return nil, err
+		}
+
+		rest = append(rest, r...)
+	}
+
+	return rest, nil
+}
+
+// passCopied passes the lines of the entries copied from the files changed
+// by the commit of the origin to the versions of the files in the parent.
+func (b *blamer) passCopied(o *blameOrigin, p blameCommit, entries []*blameEntry) ([]*blameEntry, error) {
+	lines, err := o.loadLines()
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := o.commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	ptree, err := p.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTree(ptree, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ch := range changes {
+		if ch.From.Name == "" || ch.From.Name == o.path {
+			continue
+		}
+
+		po, err := b.origin(p, ch.From.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		if po == nil {
+			continue
+		}
+
+		var rest []*blameEntry
+		for _, e := range entries {
+			r, err := b.passBlocks(lines, po, e)
+			if err != nil {
+				return nil, err
+			}
+
+			rest = append(rest, r...)
+		}
+
+		if entries = rest; len(entries) == 0 {
+			break
+		}
 	}
-	contents, err := file.Contents()
+
+	return entries, nil
+}
+
+// passBlocks passes the longest block of lines of the entry found in the
+// file of the origin, if it scores enough, repeating it with the lines left
+// before and after the block.
+func (b *blamer) passBlocks(lines []string, po *blameOrigin, e *blameEntry) ([]*blameEntry, error) {
+	plines, err := po.loadLines()
 	if err != nil {
-		panic("PrettyPrint: internal error in repo.Data")
+		return nil, err
+	}
+
+	if po.index == nil {
+		po.index = make(map[string][]int)
+		for i, l := range plines {
+			po.index[l] = append(po.index[l], i)
+		}
+	}
+
+	start, pstart, n := 0, 0, 0
+	for i := e.source; i < e.source+e.n; i++ {
+		for _, p := range po.index[lines[i]] {
+			k := 0
+			for i+k < e.source+e.n && p+k < len(plines) && lines[i+k] == plines[p+k] {
+				k++
+			}
+
+			if k > n {
+				start, pstart, n = i, p, k
+			}
+		}
+	}
+
+	if n == 0 || score(lines[start:start+n]) < moveScore {
+		return []*blameEntry{e}, nil
 	}
 
-	lines := strings.Split(contents, "\n")
-	// max line number length
-	mlnl := len(strconv.Itoa(len(lines)))
-	// max author length
-	mal := b.maxAuthorLength()
-	format := fmt.Sprintf("%%s (%%-%ds %%%dd) %%s\n",
-		mal, mlnl)
+	moved := e.slice(start, start+n)
+	moved.source = pstart
+	b.pass(po, moved)
 
-	fVs := b.graph[len(b.graph)-1]
-	for ln, v := range fVs {
-		fmt.Fprintf(&buf, format, v.Hash.String()[:8],
-			prettyPrintAuthor(fVs[ln]), ln+1, lines[ln])
+	var rest []*blameEntry
+	for _, part := range []*blameEntry{e.slice(e.source, start), e.slice(start+n, e.source+e.n)} {
+		if part.n == 0 {
+			continue
+		}
+
+		r, err := b.passBlocks(lines, po, part)
+		if err != nil {
+			return nil, err
+		}
+
+		rest = append(rest, r...)
 	}
-	return buf.String()
+
+	return rest, nil
 }
 
-// utility function to pretty print the author.
-func prettyPrintAuthor(c *object.Commit) string {
-	return fmt.Sprintf("%s %s", c.Author.Name, c.Author.When.Format("2006-01-02"))
+// score returns the number of alphanumeric characters of the lines.
+func score(lines []string) int {
+	n := 0
+	for _, l := range lines {
+		for _, r := range l {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				n++
+			}
+		}
+	}
+
+	return n
 }
 
-// utility function to calculate the number of runes needed
-// to print the longest author name in the blame of a file.
-func (b *blame) maxAuthorLength() int {
-	memo := make(map[plumbing.Hash]struct{}, len(b.graph)-1)
-	fVs := b.graph[len(b.graph)-1]
-	m := 0
-	for ln := range fVs {
-		if _, ok := memo[fVs[ln].Hash]; ok {
+// passIgnored passes the lines of the entries changed by an ignored commit
+// to the parent, guessing each line comes from the line at the same offset
+// of the changed hunk in the parent. The lines which don't have one are
+// kept.
+func (b *blamer) passIgnored(po *blameOrigin, entries []*blameEntry, hunks []lineHunk) []*blameEntry {
+	var rest []*blameEntry
+	for _, e := range entries {
+		var run *blameEntry
+		for i := e.source; i < e.source+e.n; i++ {
+			parent, ok := guessLine(hunks, i)
+			switch {
+			case !ok:
+				if run != nil {
+					b.pass(po, run)
+					run = nil
+				}
+
+				rest = append(rest, e.slice(i, i+1))
+			case run != nil && run.source+run.n == parent:
+				run.n++
+			default:
+				if run != nil {
+					b.pass(po, run)
+				}
+
+				run = e.slice(i, i+1)
+				run.source = parent
+			}
+		}
+
+		if run != nil {
+			b.pass(po, run)
+		}
+	}
+
+	return coalesceEntries(rest)
+}
+
+// guessLine returns the line of the parent a changed line of the child
+// comes from.
+func guessLine(hunks []lineHunk, line int) (int, bool) {
+	for _, h := range hunks {
+		if line < h.child || line >= h.child+h.childN {
 			continue
 		}
-		memo[fVs[ln].Hash] = struct{}{}
-		m = max(m, utf8.RuneCountInString(prettyPrintAuthor(fVs[ln])))
+
+		if offset := line - h.child; offset < h.parentN {
+			return h.parent + offset, true
+		}
+
+		break
+	}
+
+	return 0, false
+}
+
+// coalesceEntries merges the consecutive entries of the same origin.
+func coalesceEntries(entries []*blameEntry) []*blameEntry {
+	var merged []*blameEntry
+	for _, e := range entries {
+		if n := len(merged); n != 0 {
+			last := merged[n-1]
+			if last.origin == e.origin && last.final+last.n == e.final && last.source+last.n == e.source {
+				last.n += e.n
+				continue
+			}
+		}
+
+		copied := *e
+		merged = append(merged, &copied)
 	}
-	return m
+
+	return merged
+}
+
+// commit returns the object of the given commit.
+func (b *blamer) commit(c blameCommit) (*object.Commit, error) {
+	if commit, ok := b.commits[c.ID()]; ok {
+		return commit, nil
+	}
+
+	commit, err := c.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	b.commits[commit.Hash] = commit
+	return commit, nil
+}
+
+func (b *blamer) result(c blameCommit, path string, lines []string, ranges []LineRange) (*BlameResult, error) {
+	result := &BlameResult{Path: path, Rev: c.ID()}
+	blamed := make([]*object.Commit, len(lines))
+	for _, e := range b.found {
+		commit, err := b.commit(e.origin.commit)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := &BlameEntry{
+			Commit:     commit,
+			Path:       e.origin.path,
+			SourceLine: e.source + 1,
+			FinalLine:  e.final + 1,
+			NumLines:   e.n,
+			Boundary:   e.origin.commit.NumParents() == 0,
+		}
+
+		if prev := e.origin.previous; prev != nil {
+			if entry.Previous, err = b.commit(prev.commit); err != nil {
+				return nil, err
+			}
+
+			entry.PreviousPath = prev.path
+		}
+
+		for i := e.final; i < e.final+e.n; i++ {
+			blamed[i] = commit
+		}
+
+		result.Entries = append(result.Entries, entry)
+	}
+
+	var contents []string
+	var commits []*object.Commit
+	for _, r := range ranges {
+		for i := r.Start - 1; i < r.End; i++ {
+			contents = append(contents, strings.TrimSuffix(lines[i], "\n"))
+			commits = append(commits, blamed[i])
+		}
+	}
+
+	var err error
+	result.Lines, err = newLines(contents, commits)
+	return result, err
 }
 
-func max(a, b int) int {
-	if a > b {
+func min(a, b int) int {
+	if a < b {
 		return a
 	}
 	return b
@@ -0,0 +1,149 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// WritePorcelain writes the result in the format of git blame --porcelain,
+// or --line-porcelain if linePorcelain is set, repeating the details of the
+// commit for every line.
+func (b *BlameResult) WritePorcelain(w io.Writer, linePorcelain bool) error {
+	p := newBlamePrinter(w, b)
+
+	entries := make([]*BlameEntry, len(b.Entries))
+	copy(entries, b.Entries)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].FinalLine < entries[j].FinalLine })
+
+	line := 0
+	for _, e := range coalesceBlameEntries(entries) {
+		hash := e.Commit.Hash.String()
+		fmt.Fprintf(p.w, "%s %d %d %d\n", hash, e.SourceLine, e.FinalLine, e.NumLines)
+		p.details(e, linePorcelain)
+
+		for i := 0; i < e.NumLines; i++ {
+			if i != 0 {
+				fmt.Fprintf(p.w, "%s %d %d\n", hash, e.SourceLine+i, e.FinalLine+i)
+				if linePorcelain {
+					p.details(e, true)
+				}
+			}
+
+			if line < len(b.Lines) {
+				fmt.Fprintf(p.w, "\t%s\n", b.Lines[line].Text)
+				line++
+			}
+		}
+	}
+
+	return p.w.Flush()
+}
+
+// WriteIncremental writes the result in the format of git blame
+// --incremental, the entries in the order they were found.
+func (b *BlameResult) WriteIncremental(w io.Writer) error {
+	p := newBlamePrinter(w, b)
+	for _, e := range b.Entries {
+		fmt.Fprintf(p.w, "%s %d %d %d\n", e.Commit.Hash, e.SourceLine, e.FinalLine, e.NumLines)
+		p.commitDetails(e, false)
+		p.filename(e)
+	}
+
+	return p.w.Flush()
+}
+
+// coalesceBlameEntries merges the consecutive entries of the same commit
+// and path, given the entries sorted by final line.
+func coalesceBlameEntries(entries []*BlameEntry) []*BlameEntry {
+	var merged []*BlameEntry
+	for _, e := range entries {
+		if n := len(merged); n != 0 {
+			last := merged[n-1]
+			if last.Commit.Hash == e.Commit.Hash && last.Path == e.Path &&
+				last.SourceLine+last.NumLines == e.SourceLine &&
+				last.FinalLine+last.NumLines == e.FinalLine {
+				last.NumLines += e.NumLines
+				continue
+			}
+		}
+
+		copied := *e
+		merged = append(merged, &copied)
+	}
+
+	return merged
+}
+
+type blamePrinter struct {
+	w *bufio.Writer
+	// shown are the commits whose details were written
+	shown map[plumbing.Hash]bool
+	// paths are the commits blamed with more than one path
+	paths map[plumbing.Hash]bool
+}
+
+func newBlamePrinter(w io.Writer, b *BlameResult) *blamePrinter {
+	p := &blamePrinter{
+		w:     bufio.NewWriter(w),
+		shown: make(map[plumbing.Hash]bool),
+		paths: make(map[plumbing.Hash]bool),
+	}
+
+	seen := make(map[plumbing.Hash]string)
+	for _, e := range b.Entries {
+		if path, ok := seen[e.Commit.Hash]; ok && path != e.Path {
+			p.paths[e.Commit.Hash] = true
+		}
+
+		seen[e.Commit.Hash] = e.Path
+	}
+
+	return p
+}
+
+// details writes the details of the commit of the entry, unless already
+// written and not repeated, followed by its filename.
+func (p *blamePrinter) details(e *BlameEntry, repeat bool) {
+	if p.commitDetails(e, repeat) || p.paths[e.Commit.Hash] {
+		p.filename(e)
+	}
+}
+
+// commitDetails writes the details of the commit of the entry, returning
+// whether they were written.
+func (p *blamePrinter) commitDetails(e *BlameEntry, repeat bool) bool {
+	c := e.Commit
+	if !repeat && p.shown[c.Hash] {
+		return false
+	}
+
+	p.shown[c.Hash] = true
+	p.signature("author", &c.Author)
+	p.signature("committer", &c.Committer)
+	fmt.Fprintf(p.w, "summary %s\n", commitSubject(c.Message))
+	if e.Boundary {
+		fmt.Fprintln(p.w, "boundary")
+	}
+
+	return true
+}
+
+func (p *blamePrinter) signature(role string, s *object.Signature) {
+	fmt.Fprintf(p.w, "%s %s\n", role, s.Name)
+	fmt.Fprintf(p.w, "%s-mail <%s>\n", role, s.Email)
+	fmt.Fprintf(p.w, "%s-time %d\n", role, s.When.Unix())
+	fmt.Fprintf(p.w, "%s-tz %s\n", role, s.When.Format("-0700"))
+}
+
+func (p *blamePrinter) filename(e *BlameEntry) {
+	if e.Previous != nil {
+		fmt.Fprintf(p.w, "previous %s %s\n", e.Previous.Hash, e.PreviousPath)
+	}
+
+	fmt.Fprintf(p.w, "filename %s\n", e.Path)
+}
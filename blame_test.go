@@ -1,6 +1,9 @@
 package git
 
 import (
+	"bytes"
+	"strings"
+
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 
@@ -57,11 +60,17 @@ func (s *BlameSuite) TestBlame(c *C) {
 
 		obt, err := Blame(commit, t.path)
 		c.Assert(err, IsNil)
-		c.Assert(obt, DeepEquals, exp)
+		c.Assert(obt.Path, Equals, exp.Path)
+		c.Assert(obt.Rev, Equals, exp.Rev)
+		c.Assert(obt.Lines, DeepEquals, exp.Lines)
 
 		for i, l := range obt.Lines {
 			c.Assert(l.Hash.String(), Equals, t.blames[i])
 		}
+
+		obt, err = r.Blame(commit, t.path, &BlameOptions{})
+		c.Assert(err, IsNil)
+		c.Assert(obt.Lines, DeepEquals, exp.Lines)
 	}
 }
 
@@ -81,10 +90,11 @@ func (s *BlameSuite) mockBlame(c *C, t blameTest, r *Repository) (blame *BlameRe
 		commit, err := r.CommitObject(plumbing.NewHash(t.blames[i]))
 		c.Assert(err, IsNil)
 		l := &Line{
-			Author: commit.Author.Email,
-			Text:   lines[i],
-			Date:   commit.Author.When,
-			Hash:   commit.Hash,
+			Author:     commit.Author.Email,
+			AuthorName: commit.Author.Name,
+			Text:       lines[i],
+			Date:       commit.Author.When,
+			Hash:       commit.Hash,
 		}
 		blamedLines = append(blamedLines, l)
 	}
@@ -549,3 +559,155 @@ var blameTests = [...]blameTest{
 		)},
 	*/
 }
+
+// blameHashes returns the commits blamed for each line of the result.
+func blameHashes(result *BlameResult) []plumbing.Hash {
+	hashes := make([]plumbing.Hash, 0, len(result.Lines))
+	for _, l := range result.Lines {
+		hashes = append(hashes, l.Hash)
+	}
+
+	return hashes
+}
+
+func (s *BlameSuite) TestBlameChangedLines(c *C) {
+	r, w := newMemoryWorktree(c)
+	first := commitFiles(c, w, "first", map[string]string{"foo": "a\nb\nc\nd\n"})
+	second := commitFiles(c, w, "second", map[string]string{"foo": "a\nB\nc\nd\ne\n"})
+
+	head, err := r.CommitObject(second)
+	c.Assert(err, IsNil)
+
+	result, err := r.Blame(head, "foo", &BlameOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(blameHashes(result), DeepEquals, []plumbing.Hash{first, second, first, first, second})
+	c.Assert(result.Lines[1].Text, Equals, "B")
+
+	result, err = r.Blame(head, "foo", &BlameOptions{LineRanges: []LineRange{{Start: 4}, {Start: 1, End: 2}}})
+	c.Assert(err, IsNil)
+	c.Assert(blameHashes(result), DeepEquals, []plumbing.Hash{first, second, first, second})
+	c.Assert(result.Lines[2].Text, Equals, "d")
+
+	_, err = r.Blame(head, "foo", &BlameOptions{LineRanges: []LineRange{{Start: 2, End: 6}}})
+	c.Assert(err, Equals, ErrInvalidLineRange)
+
+	_, err = r.Blame(head, "bar", &BlameOptions{})
+	c.Assert(err, Equals, object.ErrFileNotFound)
+}
+
+func (s *BlameSuite) TestBlameIgnoreRevs(c *C) {
+	r, w := newMemoryWorktree(c)
+	first := commitFiles(c, w, "first", map[string]string{"foo": "a\nb\nc\n"})
+	second := commitFiles(c, w, "second", map[string]string{"foo": "a\nB\nc\nd\n"})
+
+	head, err := r.CommitObject(second)
+	c.Assert(err, IsNil)
+
+	result, err := r.Blame(head, "foo", &BlameOptions{IgnoreRevs: []plumbing.Hash{second}})
+	c.Assert(err, IsNil)
+	// the lines added by the ignored commit are still blamed to it
+	c.Assert(blameHashes(result), DeepEquals, []plumbing.Hash{first, first, first, second})
+}
+
+func (s *BlameSuite) TestBlameRename(c *C) {
+	r, w := newMemoryWorktree(c)
+	first := commitFiles(c, w, "first", map[string]string{"foo": "a\nb\nc\n"})
+
+	_, err := w.Move("foo", "bar")
+	c.Assert(err, IsNil)
+	second := commitFiles(c, w, "second", map[string]string{"bar": "a\nb\nc\nd\n"})
+
+	head, err := r.CommitObject(second)
+	c.Assert(err, IsNil)
+
+	result, err := Blame(head, "bar")
+	c.Assert(err, IsNil)
+	c.Assert(blameHashes(result), DeepEquals, []plumbing.Hash{first, first, first, second})
+
+	c.Assert(result.Entries, HasLen, 2)
+	c.Assert(result.Entries[0].Commit.Hash, Equals, second)
+	c.Assert(result.Entries[0].Previous.Hash, Equals, first)
+	c.Assert(result.Entries[0].PreviousPath, Equals, "foo")
+	c.Assert(result.Entries[1].Commit.Hash, Equals, first)
+	c.Assert(result.Entries[1].Path, Equals, "foo")
+	c.Assert(result.Entries[1].Boundary, Equals, true)
+}
+
+const (
+	blameBlockA = "first line of the first block\nsecond line of the first block\n"
+	blameBlockB = "first line of the second block\nsecond line of the second block\n"
+)
+
+func (s *BlameSuite) TestBlameDetectMoves(c *C) {
+	r, w := newMemoryWorktree(c)
+	first := commitFiles(c, w, "first", map[string]string{"foo": blameBlockA + blameBlockB})
+	second := commitFiles(c, w, "second", map[string]string{"foo": blameBlockB + blameBlockA})
+
+	head, err := r.CommitObject(second)
+	c.Assert(err, IsNil)
+
+	result, err := r.Blame(head, "foo", &BlameOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(blameHashes(result), Not(DeepEquals), []plumbing.Hash{first, first, first, first})
+
+	result, err = r.Blame(head, "foo", &BlameOptions{DetectMoves: true})
+	c.Assert(err, IsNil)
+	c.Assert(blameHashes(result), DeepEquals, []plumbing.Hash{first, first, first, first})
+}
+
+func (s *BlameSuite) TestBlameDetectCopies(c *C) {
+	r, w := newMemoryWorktree(c)
+	first := commitFiles(c, w, "first", map[string]string{"foo": blameBlockA + blameBlockB})
+	second := commitFiles(c, w, "second", map[string]string{
+		"foo": blameBlockA,
+		"bar": "bar\n" + blameBlockB,
+	})
+
+	head, err := r.CommitObject(second)
+	c.Assert(err, IsNil)
+
+	result, err := r.Blame(head, "bar", &BlameOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(blameHashes(result), DeepEquals, []plumbing.Hash{second, second, second})
+
+	result, err = r.Blame(head, "bar", &BlameOptions{DetectCopies: true})
+	c.Assert(err, IsNil)
+	c.Assert(blameHashes(result), DeepEquals, []plumbing.Hash{second, first, first})
+	c.Assert(result.Entries[1].Path, Equals, "foo")
+	c.Assert(result.Entries[1].SourceLine, Equals, 3)
+}
+
+func (s *BlameSuite) TestBlamePorcelain(c *C) {
+	r, w := newMemoryWorktree(c)
+	first := commitFiles(c, w, "first", map[string]string{"foo": "a\nb\n"})
+	second := commitFiles(c, w, "second", map[string]string{"foo": "a\nB\nc\n"})
+
+	head, err := r.CommitObject(second)
+	c.Assert(err, IsNil)
+
+	result, err := r.Blame(head, "foo", &BlameOptions{})
+	c.Assert(err, IsNil)
+
+	details := func(summary string) string {
+		return "author foo\nauthor-mail <foo@foo.foo>\nauthor-time 1493849023\nauthor-tz +0200\n" +
+			"committer foo\ncommitter-mail <foo@foo.foo>\ncommitter-time 1493849023\ncommitter-tz +0200\n" +
+			"summary " + summary + "\n"
+	}
+
+	buf := bytes.NewBuffer(nil)
+	c.Assert(result.WritePorcelain(buf, false), IsNil)
+	c.Assert(buf.String(), Equals, ""+
+		first.String()+" 1 1 1\n"+details("first")+"boundary\nfilename foo\n\ta\n"+
+		second.String()+" 2 2 2\n"+details("second")+"previous "+first.String()+" foo\nfilename foo\n\tB\n"+
+		second.String()+" 3 3\n\tc\n")
+
+	buf.Reset()
+	c.Assert(result.WritePorcelain(buf, true), IsNil)
+	c.Assert(strings.Count(buf.String(), "summary second\n"), Equals, 2)
+
+	buf.Reset()
+	c.Assert(result.WriteIncremental(buf), IsNil)
+	c.Assert(buf.String(), Equals, ""+
+		second.String()+" 2 2 2\n"+details("second")+"previous "+first.String()+" foo\nfilename foo\n"+
+		first.String()+" 1 1 1\n"+details("first")+"boundary\nfilename foo\n")
+}
@@ -204,3 +204,30 @@ func AssertReferencesMissing(c *C, r *Repository, expected []string) {
 		c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
 	}
 }
+
+// newMemoryWorktree returns a new repository with its worktree, both stored
+// in memory.
+func newMemoryWorktree(c *C) (*Repository, *Worktree) {
+	r, err := Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+	return r, w
+}
+
+// commitFiles writes the given files to the worktree, adds them and commits
+// them with the given message.
+func commitFiles(c *C, w *Worktree, msg string, files map[string]string) plumbing.Hash {
+	for name, content := range files {
+		err := util.WriteFile(w.Filesystem, name, []byte(content), 0644)
+		c.Assert(err, IsNil)
+
+		_, err = w.Add(name)
+		c.Assert(err, IsNil)
+	}
+
+	h, err := w.Commit(msg, &CommitOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+	return h
+}
@@ -59,6 +59,39 @@ type Config struct {
 		// CommentChar is the character indicating the start of a
 		// comment for commands like commit and tag
 		CommentChar string
+		// SparseCheckout if true the skip-worktree bits of the index are
+		// computed from the patterns of the sparse-checkout file.
+		SparseCheckout bool
+		// SparseCheckoutCone if true the sparse-checkout file is read as a
+		// list of directories instead of as gitignore-like patterns.
+		SparseCheckoutCone bool
+		// FSMonitor is the path of the hook queried for the files changed
+		// since the previous status, following the core.fsmonitor hook
+		// protocol.
+		FSMonitor string
+		// UntrackedCache if true the untracked files of the directories are
+		// cached in the index.
+		UntrackedCache bool
+		// AutoCRLF if "true" the line endings of the text files are
+		// converted to CRLF in the worktree and to LF in the repository, if
+		// "input" they are only converted to LF in the repository.
+		AutoCRLF string
+		// EOL is the line ending of the text files in the worktree, "lf",
+		// "crlf" or "native", used when AutoCRLF is not set.
+		EOL string
+		// SafeCRLF if "true" the files whose line endings would not be
+		// restored by a checkout after being added are refused.
+		SafeCRLF string
+		// HooksPath is the directory of the hooks, by default the hooks
+		// directory of the git directory. A relative path is relative to the
+		// root of the working tree.
+		HooksPath string
+		// LogAllRefUpdates defines which reference updates are logged in
+		// their reflogs, besides the ones of references already having one:
+		// "true" logs HEAD, the branches, the remote-tracking branches and
+		// the notes, "always" logs any reference and "false" none. When
+		// empty it is "true" for non-bare repositories, "false" otherwise.
+		LogAllRefUpdates string
 	}
 
 	User struct {
@@ -89,6 +122,19 @@ type Config struct {
 		Window uint
 	}
 
+	Pull struct {
+		// Rebase when true, pull rebases the current branch on top of the
+		// fetched branch instead of merging it. Valid values are "true",
+		// "false", "merges" and "interactive", being "merges" and
+		// "interactive" handled as "true". It can be overridden per branch
+		// with Branch.Rebase.
+		Rebase string
+		// FastForward controls how pull merges the fetched branch. When
+		// "only" only fast-forwards are allowed, when "false" a merge commit
+		// is always created.
+		FastForward string
+	}
+
 	Init struct {
 		// DefaultBranch Allows overriding the default branch name
 		// e.g. when initializing a new repository or when cloning
@@ -226,28 +272,39 @@ func (c *Config) Validate() error {
 }
 
 const (
-	remoteSection    = "remote"
-	submoduleSection = "submodule"
-	branchSection    = "branch"
-	coreSection      = "core"
-	packSection      = "pack"
-	userSection      = "user"
-	authorSection    = "author"
-	committerSection = "committer"
-	initSection      = "init"
-	urlSection       = "url"
-	fetchKey         = "fetch"
-	urlKey           = "url"
-	bareKey          = "bare"
-	worktreeKey      = "worktree"
-	commentCharKey   = "commentChar"
-	windowKey        = "window"
-	mergeKey         = "merge"
-	rebaseKey        = "rebase"
-	nameKey          = "name"
-	emailKey         = "email"
-	descriptionKey   = "description"
-	defaultBranchKey = "defaultBranch"
+	remoteSection         = "remote"
+	submoduleSection      = "submodule"
+	branchSection         = "branch"
+	coreSection           = "core"
+	packSection           = "pack"
+	userSection           = "user"
+	authorSection         = "author"
+	committerSection      = "committer"
+	initSection           = "init"
+	pullSection           = "pull"
+	urlSection            = "url"
+	fetchKey              = "fetch"
+	urlKey                = "url"
+	bareKey               = "bare"
+	worktreeKey           = "worktree"
+	commentCharKey        = "commentChar"
+	sparseCheckoutKey     = "sparseCheckout"
+	sparseCheckoutConeKey = "sparseCheckoutCone"
+	fsMonitorKey          = "fsmonitor"
+	untrackedCacheKey     = "untrackedCache"
+	autoCRLFKey           = "autocrlf"
+	eolKey                = "eol"
+	safeCRLFKey           = "safecrlf"
+	hooksPathKey          = "hooksPath"
+	logAllRefUpdatesKey   = "logAllRefUpdates"
+	windowKey             = "window"
+	mergeKey              = "merge"
+	rebaseKey             = "rebase"
+	ffKey                 = "ff"
+	nameKey               = "name"
+	emailKey              = "email"
+	descriptionKey        = "description"
+	defaultBranchKey      = "defaultBranch"
 
 	// DefaultPackWindow holds the number of previous objects used to
 	// generate deltas. The value 10 is the same used by git command.
@@ -267,6 +324,7 @@ func (c *Config) Unmarshal(b []byte) error {
 	c.unmarshalCore()
 	c.unmarshalUser()
 	c.unmarshalInit()
+	c.unmarshalPull()
 	if err := c.unmarshalPack(); err != nil {
 		return err
 	}
@@ -291,6 +349,15 @@ func (c *Config) unmarshalCore() {
 
 	c.Core.Worktree = s.Options.Get(worktreeKey)
 	c.Core.CommentChar = s.Options.Get(commentCharKey)
+	c.Core.SparseCheckout = s.Options.Get(sparseCheckoutKey) == "true"
+	c.Core.SparseCheckoutCone = s.Options.Get(sparseCheckoutConeKey) == "true"
+	c.Core.FSMonitor = s.Options.Get(fsMonitorKey)
+	c.Core.UntrackedCache = s.Options.Get(untrackedCacheKey) == "true"
+	c.Core.AutoCRLF = s.Options.Get(autoCRLFKey)
+	c.Core.EOL = s.Options.Get(eolKey)
+	c.Core.SafeCRLF = s.Options.Get(safeCRLFKey)
+	c.Core.HooksPath = s.Options.Get(hooksPathKey)
+	c.Core.LogAllRefUpdates = s.Options.Get(logAllRefUpdatesKey)
 }
 
 func (c *Config) unmarshalUser() {
@@ -388,6 +455,12 @@ func (c *Config) unmarshalInit() {
 	c.Init.DefaultBranch = s.Options.Get(defaultBranchKey)
 }
 
+func (c *Config) unmarshalPull() {
+	s := c.Raw.Section(pullSection)
+	c.Pull.Rebase = s.Options.Get(rebaseKey)
+	c.Pull.FastForward = s.Options.Get(ffKey)
+}
+
 // Marshal returns Config encoded as a git-config file.
 func (c *Config) Marshal() ([]byte, error) {
 	c.marshalCore()
@@ -398,6 +471,7 @@ func (c *Config) Marshal() ([]byte, error) {
 	c.marshalBranches()
 	c.marshalURLs()
 	c.marshalInit()
+	c.marshalPull()
 
 	buf := bytes.NewBuffer(nil)
 	if err := format.NewEncoder(buf).Encode(c.Raw); err != nil {
@@ -414,6 +488,42 @@ func (c *Config) marshalCore() {
 	if c.Core.Worktree != "" {
 		s.SetOption(worktreeKey, c.Core.Worktree)
 	}
+
+	if c.Core.SparseCheckout || s.Options.Has(sparseCheckoutKey) {
+		s.SetOption(sparseCheckoutKey, fmt.Sprintf("%t", c.Core.SparseCheckout))
+	}
+
+	if c.Core.SparseCheckoutCone || s.Options.Has(sparseCheckoutConeKey) {
+		s.SetOption(sparseCheckoutConeKey, fmt.Sprintf("%t", c.Core.SparseCheckoutCone))
+	}
+
+	if c.Core.FSMonitor != "" {
+		s.SetOption(fsMonitorKey, c.Core.FSMonitor)
+	}
+
+	if c.Core.UntrackedCache || s.Options.Has(untrackedCacheKey) {
+		s.SetOption(untrackedCacheKey, fmt.Sprintf("%t", c.Core.UntrackedCache))
+	}
+
+	if c.Core.AutoCRLF != "" {
+		s.SetOption(autoCRLFKey, c.Core.AutoCRLF)
+	}
+
+	if c.Core.EOL != "" {
+		s.SetOption(eolKey, c.Core.EOL)
+	}
+
+	if c.Core.SafeCRLF != "" {
+		s.SetOption(safeCRLFKey, c.Core.SafeCRLF)
+	}
+
+	if c.Core.HooksPath != "" {
+		s.SetOption(hooksPathKey, c.Core.HooksPath)
+	}
+
+	if c.Core.LogAllRefUpdates != "" {
+		s.SetOption(logAllRefUpdatesKey, c.Core.LogAllRefUpdates)
+	}
 }
 
 func (c *Config) marshalUser() {
@@ -542,6 +652,17 @@ func (c *Config) marshalInit() {
 	}
 }
 
+func (c *Config) marshalPull() {
+	s := c.Raw.Section(pullSection)
+	if c.Pull.Rebase != "" {
+		s.SetOption(rebaseKey, c.Pull.Rebase)
+	}
+
+	if c.Pull.FastForward != "" {
+		s.SetOption(ffKey, c.Pull.FastForward)
+	}
+}
+
 // RemoteConfig contains the configuration for a given remote repository.
 type RemoteConfig struct {
 	// Name of the remote
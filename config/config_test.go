@@ -20,6 +20,15 @@ func (s *ConfigSuite) TestUnmarshal(c *C) {
 		bare = true
 		worktree = foo
 		commentchar = bar
+		sparseCheckout = true
+		sparseCheckoutCone = true
+		fsmonitor = .git/hooks/fsmonitor-watchman
+		untrackedCache = true
+		autocrlf = input
+		eol = crlf
+		safecrlf = true
+		hooksPath = .githooks
+		logAllRefUpdates = always
 [user]
 		name = John Doe
 		email = john@example.com
@@ -53,6 +62,9 @@ func (s *ConfigSuite) TestUnmarshal(c *C) {
 		description = "Add support for branch description.\\n\\nEdit branch description: git branch --edit-description\\n"
 [init]
 		defaultBranch = main
+[pull]
+		rebase = true
+		ff = only
 [url "ssh://git@github.com/"]
 	insteadOf = https://github.com/
 `)
@@ -64,6 +76,15 @@ func (s *ConfigSuite) TestUnmarshal(c *C) {
 	c.Assert(cfg.Core.IsBare, Equals, true)
 	c.Assert(cfg.Core.Worktree, Equals, "foo")
 	c.Assert(cfg.Core.CommentChar, Equals, "bar")
+	c.Assert(cfg.Core.SparseCheckout, Equals, true)
+	c.Assert(cfg.Core.SparseCheckoutCone, Equals, true)
+	c.Assert(cfg.Core.FSMonitor, Equals, ".git/hooks/fsmonitor-watchman")
+	c.Assert(cfg.Core.UntrackedCache, Equals, true)
+	c.Assert(cfg.Core.AutoCRLF, Equals, "input")
+	c.Assert(cfg.Core.EOL, Equals, "crlf")
+	c.Assert(cfg.Core.SafeCRLF, Equals, "true")
+	c.Assert(cfg.Core.HooksPath, Equals, ".githooks")
+	c.Assert(cfg.Core.LogAllRefUpdates, Equals, "always")
 	c.Assert(cfg.User.Name, Equals, "John Doe")
 	c.Assert(cfg.User.Email, Equals, "john@example.com")
 	c.Assert(cfg.Author.Name, Equals, "Jane Roe")
@@ -89,12 +110,15 @@ func (s *ConfigSuite) TestUnmarshal(c *C) {
 	c.Assert(cfg.Branches["master"].Merge, Equals, plumbing.ReferenceName("refs/heads/master"))
 	c.Assert(cfg.Branches["master"].Description, Equals, "Add support for branch description.\n\nEdit branch description: git branch --edit-description\n")
 	c.Assert(cfg.Init.DefaultBranch, Equals, "main")
+	c.Assert(cfg.Pull.Rebase, Equals, "true")
+	c.Assert(cfg.Pull.FastForward, Equals, "only")
 }
 
 func (s *ConfigSuite) TestMarshal(c *C) {
 	output := []byte(`[core]
 	bare = true
 	worktree = bar
+	sparseCheckout = true
 [pack]
 	window = 20
 [remote "alt"]
@@ -118,13 +142,17 @@ func (s *ConfigSuite) TestMarshal(c *C) {
 	insteadOf = https://github.com/
 [init]
 	defaultBranch = main
+[pull]
+	ff = false
 `)
 
 	cfg := NewConfig()
 	cfg.Core.IsBare = true
 	cfg.Core.Worktree = "bar"
+	cfg.Core.SparseCheckout = true
 	cfg.Pack.Window = 20
 	cfg.Init.DefaultBranch = "main"
+	cfg.Pull.FastForward = "false"
 	cfg.Remotes["origin"] = &RemoteConfig{
 		Name: "origin",
 		URLs: []string{"git@github.com:mcuadros/go-git.git"},
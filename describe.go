@@ -0,0 +1,392 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/emirpasic/gods/trees/binaryheap"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var (
+	// ErrNoDescribeTags occurs when no tag can describe a commit and
+	// DescribeOptions.Always isn't set.
+	ErrNoDescribeTags = errors.New("no tags can describe the commit")
+)
+
+// DescribeResult is the description of a commit, given by the nearest tag
+// reachable from it.
+type DescribeResult struct {
+	// Tag is the reference of the tag describing the commit, nil if no tag
+	// can describe it and DescribeOptions.Always is set.
+	Tag *plumbing.Reference
+	// Distance is the number of commits reachable from the commit which
+	// aren't reachable from the tag.
+	Distance int
+	// Commit is the hash of the commit described.
+	Commit plumbing.Hash
+	// Dirty is true if the worktree has changes, only checked when
+	// DescribeOptions.Dirty is set.
+	Dirty bool
+
+	abbrev    int
+	long      bool
+	dirtyMark string
+}
+
+// String returns the description in the format of `git describe`, the name
+// of the tag, followed by the distance and the abbreviated hash of the
+// commit prefixed by "g" unless the commit is the tagged one, such as
+// v1.0.0-3-g1a2b3c4.
+func (d *DescribeResult) String() string {
+	hash := d.Commit.String()
+	if d.abbrev < len(hash) {
+		hash = hash[:d.abbrev]
+	}
+
+	var s string
+	switch {
+	case d.Tag == nil:
+		s = hash
+	case d.Distance == 0 && !d.long:
+		s = d.Tag.Name().Short()
+	default:
+		s = fmt.Sprintf("%s-%d-g%s", d.Tag.Name().Short(), d.Distance, hash)
+	}
+
+	if d.Dirty {
+		s += d.dirtyMark
+	}
+
+	return s
+}
+
+// describeTag is a tag which can describe the commits it's reachable from.
+type describeTag struct {
+	ref       *plumbing.Reference
+	annotated bool
+	// when is the date of the tagger of an annotated tag
+	when int64
+}
+
+// better returns whether the tag is preferred to describe the commit it
+// points to over the given one, the annotated tags over the lightweight
+// ones and the most recent annotated tags over the older ones.
+func (t *describeTag) better(other *describeTag) bool {
+	switch {
+	case t.annotated != other.annotated:
+		return t.annotated
+	case t.annotated && t.when != other.when:
+		return t.when > other.when
+	}
+
+	return t.ref.Name() < other.ref.Name()
+}
+
+// describeCandidate is a tag found walking the history from the commit to
+// describe, with the number of commits walked not reachable from it.
+type describeCandidate struct {
+	tag   *describeTag
+	depth int
+	flag  uint64
+}
+
+// Describe describes a commit by the nearest tag reachable from it, the
+// equivalent to `git describe`. The tags are found walking the history
+// from the commit in committer time order, the tag chosen being the one
+// with the fewest commits reachable from the commit not reachable from it.
+func (r *Repository) Describe(o *DescribeOptions) (*DescribeResult, error) {
+	if err := o.Validate(r); err != nil {
+		return nil, err
+	}
+
+	commit := o.Commit
+	if commit.IsZero() {
+		head, err := r.Head()
+		if err != nil {
+			return nil, err
+		}
+
+		commit = head.Hash()
+	}
+
+	tags, err := r.describeTags(o)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DescribeResult{
+		Commit:    commit,
+		abbrev:    o.Abbrev,
+		long:      o.Long,
+		dirtyMark: o.DirtyMark,
+	}
+
+	exactMatch := o.ExactMatch || o.Candidates < 0
+	if t, ok := tags[commit]; ok {
+		result.Tag = t.ref
+	} else if !exactMatch {
+		if err := r.describeWalk(o, tags, result); err != nil {
+			return nil, err
+		}
+	}
+
+	if result.Tag == nil && (exactMatch || !o.Always) {
+		return nil, ErrNoDescribeTags
+	}
+
+	if o.Dirty {
+		if result.Dirty, err = r.isDirty(); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// describeTags returns the tags which can describe the commits by the hash
+// of the commit they point to.
+func (r *Repository) describeTags(o *DescribeOptions) (map[plumbing.Hash]*describeTag, error) {
+	iter, err := r.Tags()
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[plumbing.Hash]*describeTag)
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if !matchDescribeTag(o, ref.Name().Short()) {
+			return nil
+		}
+
+		t := &describeTag{ref: ref}
+		commit := ref.Hash()
+
+		tag, err := r.TagObject(ref.Hash())
+		switch err {
+		case nil:
+			c, err := tag.Commit()
+			if err != nil {
+				// the tags of objects other than commits are ignored
+				return nil
+			}
+
+			t.annotated = true
+			t.when = tag.Tagger.When.Unix()
+			commit = c.Hash
+		case plumbing.ErrObjectNotFound:
+			if !o.Tags {
+				return nil
+			}
+		default:
+			return err
+		}
+
+		if other, ok := tags[commit]; !ok || t.better(other) {
+			tags[commit] = t
+		}
+
+		return nil
+	})
+
+	return tags, err
+}
+
+// matchDescribeTag returns whether the tag with the given name matches any
+// of the Match patterns, if any, and none of the Exclude ones.
+func matchDescribeTag(o *DescribeOptions, name string) bool {
+	for _, pattern := range o.Exclude {
+		if matchTagPattern(pattern, name) {
+			return false
+		}
+	}
+
+	if len(o.Match) == 0 {
+		return true
+	}
+
+	for _, pattern := range o.Match {
+		if matchTagPattern(pattern, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchTagPattern matches a tag name with a glob pattern, where the
+// wildcards match the slashes too, as git does.
+func matchTagPattern(pattern, name string) bool {
+	const sep = "\x00"
+	ok, _ := path.Match(
+		strings.Replace(pattern, "/", sep, -1),
+		strings.Replace(name, "/", sep, -1),
+	)
+
+	return ok
+}
+
+// describeWalk walks the history from the commit to describe, finding the
+// candidate tags and the number of commits not reachable from them. Each
+// commit walked carries the flags of the candidates it's reachable from.
+func (r *Repository) describeWalk(o *DescribeOptions, tags map[plumbing.Hash]*describeTag, result *DescribeResult) error {
+	commit, err := r.CommitObject(result.Commit)
+	if err != nil {
+		return err
+	}
+
+	flags := map[plumbing.Hash]uint64{commit.Hash: 0}
+	queue := binaryheap.NewWith(func(a, b interface{}) int {
+		if a.(*object.Commit).Committer.When.Before(b.(*object.Commit).Committer.When) {
+			return 1
+		}
+		return -1
+	})
+	queue.Push(commit)
+
+	var candidates []*describeCandidate
+	annotated, seen := 0, 0
+	gaveUp := false
+	for !queue.Empty() {
+		v, _ := queue.Pop()
+		c := v.(*object.Commit)
+		seen++
+
+		if t, ok := tags[c.Hash]; ok {
+			if len(candidates) == o.Candidates {
+				// the depth of the best candidate is computed afterwards
+				queue.Push(c)
+				gaveUp = true
+				break
+			}
+
+			candidate := &describeCandidate{
+				tag:   t,
+				depth: seen - 1,
+				flag:  1 << uint(len(candidates)),
+			}
+
+			flags[c.Hash] |= candidate.flag
+			candidates = append(candidates, candidate)
+			if t.annotated {
+				annotated++
+			}
+		}
+
+		for _, candidate := range candidates {
+			if flags[c.Hash]&candidate.flag == 0 {
+				candidate.depth++
+			}
+		}
+
+		if annotated != 0 && queue.Empty() {
+			break
+		}
+
+		if err := r.describeParents(c, flags, queue); err != nil {
+			return err
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].depth < candidates[j].depth
+	})
+
+	best := candidates[0]
+	if gaveUp {
+		if err := r.describeFinishDepth(best, flags, queue); err != nil {
+			return err
+		}
+	}
+
+	result.Tag = best.tag.ref
+	result.Distance = best.depth
+	return nil
+}
+
+// describeFinishDepth walks the rest of the history until every commit
+// left is reachable from the best candidate, counting the ones which
+// aren't.
+func (r *Repository) describeFinishDepth(best *describeCandidate, flags map[plumbing.Hash]uint64, queue *binaryheap.Heap) error {
+	for !queue.Empty() {
+		v, _ := queue.Pop()
+		c := v.(*object.Commit)
+
+		if flags[c.Hash]&best.flag != 0 {
+			reachable := true
+			for _, v := range queue.Values() {
+				if flags[v.(*object.Commit).Hash]&best.flag == 0 {
+					reachable = false
+					break
+				}
+			}
+
+			if reachable {
+				return nil
+			}
+		} else {
+			best.depth++
+		}
+
+		if err := r.describeParents(c, flags, queue); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// describeParents queues the parents of the commit not walked yet, passing
+// them its flags.
+func (r *Repository) describeParents(c *object.Commit, flags map[plumbing.Hash]uint64, queue *binaryheap.Heap) error {
+	for _, h := range c.ParentHashes {
+		if _, ok := flags[h]; !ok {
+			parent, err := r.CommitObject(h)
+			if err == plumbing.ErrObjectNotFound {
+				// the history of shallow clones ends at the missing parents
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			queue.Push(parent)
+		}
+
+		flags[h] |= flags[c.Hash]
+	}
+
+	return nil
+}
+
+// isDirty returns whether the worktree has changes in the tracked files,
+// ignoring the untracked ones.
+func (r *Repository) isDirty() (bool, error) {
+	w, err := r.Worktree()
+	if err != nil {
+		return false, err
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return false, err
+	}
+
+	for _, s := range status {
+		if s.Staging != Unmodified && s.Staging != Untracked ||
+			s.Worktree != Unmodified && s.Worktree != Untracked {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,164 @@
+package git
+
+import (
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+type DescribeSuite struct {
+	BaseSuite
+	r *Repository
+	w *Worktree
+	// commits is the number of commits created, each one an hour after the
+	// previous one
+	commits int
+}
+
+var _ = Suite(&DescribeSuite{})
+
+func (s *DescribeSuite) SetUpTest(c *C) {
+	var err error
+	s.r, err = Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+
+	s.w, err = s.r.Worktree()
+	c.Assert(err, IsNil)
+	s.commits = 0
+}
+
+func (s *DescribeSuite) commit(c *C, name string) plumbing.Hash {
+	err := util.WriteFile(s.w.Filesystem, name, []byte(name), 0644)
+	c.Assert(err, IsNil)
+	_, err = s.w.Add(name)
+	c.Assert(err, IsNil)
+
+	s.commits++
+	sig := defaultSignature()
+	sig.When = sig.When.Add(time.Duration(s.commits) * time.Hour)
+
+	h, err := s.w.Commit(name, &CommitOptions{Author: sig})
+	c.Assert(err, IsNil)
+	return h
+}
+
+func (s *DescribeSuite) tag(c *C, name string, h plumbing.Hash, annotated bool) {
+	var opts *CreateTagOptions
+	if annotated {
+		opts = &CreateTagOptions{Tagger: defaultSignature(), Message: name}
+	}
+
+	_, err := s.r.CreateTag(name, h, opts)
+	c.Assert(err, IsNil)
+}
+
+func (s *DescribeSuite) describe(c *C, o *DescribeOptions) string {
+	d, err := s.r.Describe(o)
+	c.Assert(err, IsNil)
+	return d.String()
+}
+
+func (s *DescribeSuite) TestDescribe(c *C) {
+	first := s.commit(c, "foo")
+	second := s.commit(c, "bar")
+	head := s.commit(c, "qux")
+	abbrev := head.String()[:7]
+
+	s.tag(c, "v1.0.0", first, true)
+	s.tag(c, "light", second, false)
+
+	c.Assert(s.describe(c, &DescribeOptions{}), Equals, "v1.0.0-2-g"+abbrev)
+	c.Assert(s.describe(c, &DescribeOptions{Tags: true}), Equals, "light-1-g"+abbrev)
+	c.Assert(s.describe(c, &DescribeOptions{Tags: true, Match: []string{"v*"}}), Equals, "v1.0.0-2-g"+abbrev)
+	c.Assert(s.describe(c, &DescribeOptions{Tags: true, Exclude: []string{"l*"}}), Equals, "v1.0.0-2-g"+abbrev)
+	c.Assert(s.describe(c, &DescribeOptions{Abbrev: 10}), Equals, "v1.0.0-2-g"+head.String()[:10])
+
+	c.Assert(s.describe(c, &DescribeOptions{Commit: first}), Equals, "v1.0.0")
+	c.Assert(s.describe(c, &DescribeOptions{Commit: first, Long: true}), Equals, "v1.0.0-0-g"+first.String()[:7])
+	c.Assert(s.describe(c, &DescribeOptions{Commit: second, Tags: true, ExactMatch: true}), Equals, "light")
+
+	d, err := s.r.Describe(&DescribeOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(d.Tag.Name(), Equals, plumbing.NewTagReferenceName("v1.0.0"))
+	c.Assert(d.Distance, Equals, 2)
+	c.Assert(d.Commit, Equals, head)
+
+	_, err = s.r.Describe(&DescribeOptions{ExactMatch: true})
+	c.Assert(err, Equals, ErrNoDescribeTags)
+
+	// no tag is considered without candidates, only a tagged commit
+	_, err = s.r.Describe(&DescribeOptions{Candidates: -1, Always: true})
+	c.Assert(err, Equals, ErrNoDescribeTags)
+	c.Assert(s.describe(c, &DescribeOptions{Commit: first, Candidates: -1}), Equals, "v1.0.0")
+}
+
+func (s *DescribeSuite) TestDescribeNoTags(c *C) {
+	head := s.commit(c, "foo")
+
+	_, err := s.r.Describe(&DescribeOptions{})
+	c.Assert(err, Equals, ErrNoDescribeTags)
+
+	// the lightweight tags are only used with Tags
+	s.tag(c, "light", head, false)
+	_, err = s.r.Describe(&DescribeOptions{})
+	c.Assert(err, Equals, ErrNoDescribeTags)
+
+	c.Assert(s.describe(c, &DescribeOptions{Always: true}), Equals, head.String()[:7])
+}
+
+func (s *DescribeSuite) TestDescribeMerge(c *C) {
+	base := s.commit(c, "foo")
+	s.tag(c, "v1", base, true)
+
+	err := s.w.Checkout(&CheckoutOptions{Branch: "refs/heads/feature", Create: true})
+	c.Assert(err, IsNil)
+	feature := s.commit(c, "bar")
+	s.tag(c, "v2", feature, true)
+
+	err = s.w.Checkout(&CheckoutOptions{Branch: plumbing.Master})
+	c.Assert(err, IsNil)
+	s.commit(c, "qux")
+
+	_, err = s.w.Merge(&MergeOptions{Reference: "refs/heads/feature", Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	head, err := s.r.Head()
+	c.Assert(err, IsNil)
+	abbrev := head.Hash().String()[:7]
+
+	// the merge and qux aren't reachable from v2
+	c.Assert(s.describe(c, &DescribeOptions{}), Equals, "v2-2-g"+abbrev)
+	// the depth of v2 is computed after giving up on finding more tags
+	c.Assert(s.describe(c, &DescribeOptions{Candidates: 1}), Equals, "v2-2-g"+abbrev)
+}
+
+func (s *DescribeSuite) TestDescribeDirty(c *C) {
+	head := s.commit(c, "foo")
+	s.tag(c, "v1", head, true)
+
+	c.Assert(s.describe(c, &DescribeOptions{Dirty: true}), Equals, "v1")
+
+	// the untracked files don't make the worktree dirty
+	err := util.WriteFile(s.w.Filesystem, "bar", []byte("bar"), 0644)
+	c.Assert(err, IsNil)
+	c.Assert(s.describe(c, &DescribeOptions{Dirty: true}), Equals, "v1")
+
+	err = util.WriteFile(s.w.Filesystem, "foo", []byte("bar"), 0644)
+	c.Assert(err, IsNil)
+	c.Assert(s.describe(c, &DescribeOptions{Dirty: true}), Equals, "v1-dirty")
+	c.Assert(s.describe(c, &DescribeOptions{Dirty: true, DirtyMark: "+"}), Equals, "v1+")
+
+	// the options can be used again, HEAD being described each time
+	o := &DescribeOptions{Dirty: true}
+	c.Assert(s.describe(c, o), Equals, "v1-dirty")
+	c.Assert(s.describe(c, o), Equals, "v1-dirty")
+	c.Assert(o.Commit.IsZero(), Equals, true)
+
+	_, err = s.r.Describe(&DescribeOptions{Dirty: true, Commit: head})
+	c.Assert(err, ErrorMatches, "fields Dirty and Commit are mutual exclusive")
+}
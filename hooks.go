@@ -0,0 +1,222 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/storage"
+)
+
+// The names of the hooks run by the operations of a repository.
+const (
+	PreCommitHook        = "pre-commit"
+	PrepareCommitMsgHook = "prepare-commit-msg"
+	CommitMsgHook        = "commit-msg"
+	PostCommitHook       = "post-commit"
+	PreMergeCommitHook   = "pre-merge-commit"
+	PostMergeHook        = "post-merge"
+	PostCheckoutHook     = "post-checkout"
+	PrePushHook          = "pre-push"
+)
+
+const (
+	hooksDir          = "hooks"
+	commitEditMsgFile = "COMMIT_EDITMSG"
+)
+
+// Hook is a hook run by an operation of a repository.
+type Hook struct {
+	// Name is the name of the hook, such as pre-commit.
+	Name string
+	// Args are the arguments of the hook, the same given to the executable
+	// hooks. The message hooks get the path of the message file.
+	Args []string
+	// Stdin is the standard input of the hook, such as the references
+	// given to pre-push, nil if it has none.
+	Stdin io.Reader
+	// Message is the commit message given to the prepare-commit-msg and
+	// commit-msg hooks, which can change it in place of the message file.
+	Message string
+}
+
+// HookFunc is an in-process hook, the operation fails if it returns an error
+// as it does when a hook exits with a non-zero status.
+type HookFunc func(h *Hook) error
+
+// Hooks are in-process hooks by name, run in place of the executables of the
+// hooks directory with the same names.
+type Hooks map[string]HookFunc
+
+// hookRunner runs the hooks of a repository, the in-process ones or else the
+// executables of the hooks directory, core.hooksPath or the hooks directory
+// of the git directory.
+type hookRunner struct {
+	hooks Hooks
+	// path is the hooks directory, empty if the git directory isn't on disk
+	path string
+	// dir is the working directory of the executable hooks
+	dir string
+	// dotgit is where the message file given to the message hooks is written
+	dotgit billy.Filesystem
+	// gitDir is the path of the git directory, empty if it isn't on disk
+	gitDir string
+}
+
+func newHookRunner(s storage.Storer, wt billy.Filesystem, hooks Hooks) (*hookRunner, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	h := &hookRunner{hooks: hooks}
+	if fs, ok := s.(interface{ Filesystem() billy.Filesystem }); ok {
+		h.dotgit = fs.Filesystem()
+		h.gitDir = h.dotgit.Root()
+	}
+
+	h.dir = h.gitDir
+	if wt != nil {
+		h.dir = wt.Root()
+	}
+
+	switch {
+	case cfg.Core.HooksPath != "" && filepath.IsAbs(cfg.Core.HooksPath):
+		h.path = cfg.Core.HooksPath
+	case cfg.Core.HooksPath != "":
+		h.path = filepath.Join(h.dir, cfg.Core.HooksPath)
+	case h.gitDir != "":
+		h.path = filepath.Join(h.gitDir, hooksDir)
+	}
+
+	return h, nil
+}
+
+// hooks returns the runner of the hooks of the repository, given the
+// in-process hooks of an operation.
+func (r *Repository) hooks(hooks Hooks) (*hookRunner, error) {
+	h, err := newHookRunner(r.Storer, r.wt, hooks)
+	if err != nil {
+		return nil, err
+	}
+
+	h.dotgit = r.dotGitFilesystem()
+	return h, nil
+}
+
+// run runs the hook with the given name, if it exists.
+func (h *hookRunner) run(name string, stdin io.Reader, args ...string) error {
+	hook := &Hook{Name: name, Args: args, Stdin: stdin}
+	if f, ok := h.hooks[name]; ok {
+		return h.runFunc(f, hook)
+	}
+
+	if path, ok := h.executable(name); ok {
+		return h.runExecutable(path, hook)
+	}
+
+	return nil
+}
+
+// runMessage runs the given message hook, returning the message it leaves.
+// The message is written to the message file given to the executables.
+func (h *hookRunner) runMessage(name, msg string, args ...string) (string, error) {
+	msgFile := commitEditMsgFile
+	if h.gitDir != "" {
+		msgFile = filepath.Join(h.gitDir, commitEditMsgFile)
+	}
+
+	hook := &Hook{
+		Name:    name,
+		Args:    append([]string{msgFile}, args...),
+		Message: msg,
+	}
+
+	if f, ok := h.hooks[name]; ok {
+		err := h.runFunc(f, hook)
+		return hook.Message, err
+	}
+
+	path, ok := h.executable(name)
+	if !ok {
+		return msg, nil
+	}
+
+	if err := util.WriteFile(h.dotgit, commitEditMsgFile, []byte(msg), 0644); err != nil {
+		return "", err
+	}
+
+	if err := h.runExecutable(path, hook); err != nil {
+		return "", err
+	}
+
+	content, err := util.ReadFile(h.dotgit, commitEditMsgFile)
+	return string(content), err
+}
+
+func (h *hookRunner) runFunc(f HookFunc, hook *Hook) error {
+	if err := f(hook); err != nil {
+		return fmt.Errorf("%s hook failed: %w", hook.Name, err)
+	}
+
+	return nil
+}
+
+func (h *hookRunner) runExecutable(path string, hook *Hook) error {
+	cmd := exec.Command(path, hook.Args...)
+	cmd.Dir = h.dir
+	cmd.Stdin = hook.Stdin
+
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+
+	if out = bytes.TrimSpace(out); len(out) != 0 {
+		return fmt.Errorf("%s hook failed: %w: %s", hook.Name, err, out)
+	}
+
+	return fmt.Errorf("%s hook failed: %w", hook.Name, err)
+}
+
+// executable returns the path of the executable of the given hook, git
+// ignores the hooks which aren't executable.
+func (h *hookRunner) executable(name string) (string, bool) {
+	if h.path == "" {
+		return "", false
+	}
+
+	path := filepath.Join(h.path, name)
+	fi, err := os.Stat(path)
+	if err != nil || fi.IsDir() {
+		return "", false
+	}
+
+	if runtime.GOOS != "windows" && fi.Mode()&0111 == 0 {
+		return "", false
+	}
+
+	return path, true
+}
+
+// commitMessageHooks runs the prepare-commit-msg hook and, unless noVerify
+// is set, the commit-msg hook, returning the message they leave.
+func (h *hookRunner) commitMessageHooks(msg, source string, noVerify bool) (string, error) {
+	var args []string
+	if source != "" {
+		args = append(args, source)
+	}
+
+	msg, err := h.runMessage(PrepareCommitMsgHook, msg, args...)
+	if err != nil || noVerify {
+		return msg, err
+	}
+
+	return h.runMessage(CommitMsgHook, msg)
+}
@@ -0,0 +1,237 @@
+package git
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+type HooksSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&HooksSuite{})
+
+// recordHooks returns in-process hooks for the given names, recording the
+// hooks run.
+func recordHooks(ran *[]*Hook, names ...string) Hooks {
+	hooks := make(Hooks)
+	for _, name := range names {
+		hooks[name] = func(h *Hook) error {
+			*ran = append(*ran, h)
+			return nil
+		}
+	}
+
+	return hooks
+}
+
+func (s *HooksSuite) TestCommitHooks(c *C) {
+	r, w := newMemoryWorktree(c)
+
+	err := util.WriteFile(w.Filesystem, "foo", []byte("foo"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo")
+	c.Assert(err, IsNil)
+
+	var ran []*Hook
+	hooks := recordHooks(&ran, PreCommitHook, PrepareCommitMsgHook, PostCommitHook)
+	hooks[CommitMsgHook] = func(h *Hook) error {
+		ran = append(ran, h)
+		h.Message += "\n\nSigned-off-by: foo"
+		return nil
+	}
+
+	h, err := w.Commit("foo", &CommitOptions{Author: defaultSignature(), Hooks: hooks})
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	c.Assert(commit.Message, Equals, "foo\n\nSigned-off-by: foo")
+
+	c.Assert(ran, HasLen, 4)
+	c.Assert(ran[0].Name, Equals, PreCommitHook)
+	c.Assert(ran[1].Name, Equals, PrepareCommitMsgHook)
+	c.Assert(ran[1].Args, DeepEquals, []string{commitEditMsgFile, "message"})
+	c.Assert(ran[2].Name, Equals, CommitMsgHook)
+	c.Assert(ran[3].Name, Equals, PostCommitHook)
+}
+
+func (s *HooksSuite) TestCommitHooksNoVerify(c *C) {
+	r, w := newMemoryWorktree(c)
+
+	err := util.WriteFile(w.Filesystem, "foo", []byte("foo"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo")
+	c.Assert(err, IsNil)
+
+	var ran []*Hook
+	hooks := recordHooks(&ran, PrepareCommitMsgHook)
+	hooks[PreCommitHook] = func(h *Hook) error { return errors.New("rejected") }
+	hooks[CommitMsgHook] = hooks[PreCommitHook]
+
+	_, err = w.Commit("foo", &CommitOptions{Author: defaultSignature(), Hooks: hooks})
+	c.Assert(err, ErrorMatches, "pre-commit hook failed: rejected")
+
+	_, err = r.Head()
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+	c.Assert(ran, HasLen, 0)
+
+	_, err = w.Commit("foo", &CommitOptions{
+		Author:   defaultSignature(),
+		Hooks:    hooks,
+		NoVerify: true,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(ran, HasLen, 1)
+}
+
+func (s *HooksSuite) TestCheckoutHook(c *C) {
+	_, w := newMemoryWorktree(c)
+
+	first := commitFiles(c, w, "first", map[string]string{"foo": "foo"})
+	second := commitFiles(c, w, "second", map[string]string{"foo": "bar"})
+
+	var ran []*Hook
+	err := w.Checkout(&CheckoutOptions{Hash: first, Hooks: recordHooks(&ran, PostCheckoutHook)})
+	c.Assert(err, IsNil)
+
+	c.Assert(ran, HasLen, 1)
+	c.Assert(ran[0].Args, DeepEquals, []string{second.String(), first.String(), "1"})
+}
+
+func (s *HooksSuite) TestMergeHooks(c *C) {
+	_, w := newMemoryWorktree(c)
+
+	commitFiles(c, w, "base", map[string]string{"foo": "foo"})
+	err := w.Checkout(&CheckoutOptions{Branch: "refs/heads/feature", Create: true})
+	c.Assert(err, IsNil)
+	commitFiles(c, w, "feature", map[string]string{"bar": "bar"})
+	err = w.Checkout(&CheckoutOptions{Branch: plumbing.Master})
+	c.Assert(err, IsNil)
+	commitFiles(c, w, "master", map[string]string{"qux": "qux"})
+
+	var ran []*Hook
+	hooks := recordHooks(&ran, PreMergeCommitHook, PrepareCommitMsgHook, CommitMsgHook, PostMergeHook)
+	_, err = w.Merge(&MergeOptions{
+		Reference: "refs/heads/feature",
+		Author:    defaultSignature(),
+		Hooks:     hooks,
+	})
+	c.Assert(err, IsNil)
+
+	c.Assert(ran, HasLen, 4)
+	c.Assert(ran[0].Name, Equals, PreMergeCommitHook)
+	c.Assert(ran[1].Name, Equals, PrepareCommitMsgHook)
+	c.Assert(ran[1].Args[1:], DeepEquals, []string{"merge"})
+	c.Assert(ran[1].Message, Equals, "Merge branch 'feature'")
+	c.Assert(ran[2].Name, Equals, CommitMsgHook)
+	c.Assert(ran[3].Name, Equals, PostMergeHook)
+	c.Assert(ran[3].Args, DeepEquals, []string{"0"})
+}
+
+func (s *HooksSuite) TestPushHook(c *C) {
+	url, clean := s.TemporalDir()
+	defer clean()
+
+	_, err := PlainInit(url, true)
+	c.Assert(err, IsNil)
+
+	r, err := Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+
+	_, err = r.CreateRemote(&config.RemoteConfig{Name: DefaultRemoteName, URLs: []string{url}})
+	c.Assert(err, IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+	h := commitFiles(c, w, "foo", map[string]string{"foo": "foo"})
+
+	var input []byte
+	hooks := Hooks{PrePushHook: func(h *Hook) error {
+		c.Assert(h.Args, DeepEquals, []string{DefaultRemoteName, url})
+
+		var err error
+		input, err = ioutil.ReadAll(h.Stdin)
+		c.Assert(err, IsNil)
+		return errors.New("rejected")
+	}}
+
+	err = r.Push(&PushOptions{Hooks: hooks})
+	c.Assert(err, ErrorMatches, "pre-push hook failed: rejected")
+	c.Assert(string(input), Equals, strings.Join([]string{
+		"refs/heads/master", h.String(), "refs/heads/master", plumbing.ZeroHash.String(),
+	}, " ")+"\n")
+
+	server, err := PlainOpen(url)
+	c.Assert(err, IsNil)
+	_, err = server.Reference(plumbing.Master, false)
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+
+	err = r.Push(&PushOptions{Hooks: hooks, NoVerify: true})
+	c.Assert(err, IsNil)
+
+	ref, err := server.Reference(plumbing.Master, false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, h)
+}
+
+func (s *HooksSuite) TestExecutableHooks(c *C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("shell hooks are not supported on windows")
+	}
+
+	dir, clean := s.TemporalDir()
+	defer clean()
+
+	r, err := PlainInit(dir, false)
+	c.Assert(err, IsNil)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Core.HooksPath = ".githooks"
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	hooksPath := filepath.Join(dir, ".githooks")
+	c.Assert(os.MkdirAll(hooksPath, 0755), IsNil)
+
+	writeHook := func(name, script string, mode os.FileMode) {
+		path := filepath.Join(hooksPath, name)
+		c.Assert(ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), mode), IsNil)
+		c.Assert(os.Chmod(path, mode), IsNil)
+	}
+
+	writeHook(CommitMsgHook, "echo 'Signed-off-by: foo' >> \"$1\"\n", 0755)
+	writeHook(PostCommitHook, "pwd > post-commit\n", 0755)
+	// the hooks which aren't executable are ignored
+	writeHook(PreCommitHook, "exit 1\n", 0644)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+	h := commitFiles(c, w, "foo\n", map[string]string{"foo": "foo"})
+
+	commit, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	c.Assert(commit.Message, Equals, "foo\nSigned-off-by: foo\n")
+
+	out, err := util.ReadFile(w.Filesystem, "post-commit")
+	c.Assert(err, IsNil)
+	wd, err := filepath.EvalSymlinks(dir)
+	c.Assert(err, IsNil)
+	c.Assert(strings.TrimSpace(string(out)), Equals, wd)
+
+	writeHook(PreCommitHook, "echo 'not allowed' >&2\nexit 1\n", 0755)
+	_, err = w.Commit("bar", &CommitOptions{Author: defaultSignature(), AllowEmptyCommits: true})
+	c.Assert(err, ErrorMatches, "pre-commit hook failed: exit status 1: not allowed")
+}
@@ -8,7 +8,9 @@ import (
 	"io"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
+	"unicode"
 )
 
 // ErrInvalidRevision is emitted if string doesn't match valid revision
@@ -47,7 +49,7 @@ type CaretReg struct {
 	Negate bool
 }
 
-// CaretType represents ^{commit}
+// CaretType represents ^{commit}, ObjectType is empty for ^{}
 type CaretType struct {
 	ObjectType string
 }
@@ -315,7 +317,7 @@ func (p *Parser) parseAt() (Revisioner, error) {
 
 			switch {
 			case tok == cbrace:
-				t, err := time.Parse("2006-01-02T15:04:05Z", date)
+				t, err := parseDate(date, time.Now())
 
 				if err != nil {
 					return nil, &ErrInvalidRevision{fmt.Sprintf(`wrong date "%s" must fit ISO-8601 format : 2006-01-02T15:04:05Z`, date)}
@@ -415,7 +417,8 @@ func (p *Parser) parseCaretBraces() (Revisioner, error) {
 		case tok == word && nextTok == cbrace && (lit == "commit" || lit == "tree" || lit == "blob" || lit == "tag" || lit == "object"):
 			return CaretType{lit}, nil
 		case re == "" && tok == cbrace:
-			return CaretType{"tag"}, nil
+			p.unscan()
+			return CaretType{""}, nil
 		case re == "" && tok == emark && nextTok == emark:
 			re += lit
 		case re == "" && tok == emark && nextTok == minus:
@@ -624,3 +627,56 @@ func (p *Parser) checkRefFormat(token token, literal string, previousToken token
 
 	return nil
 }
+
+// dateUnits are the units accepted in relative dates, such as 2.weeks.ago.
+var dateUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+}
+
+// parseDate parses the date of a @{<date>} statement, being either an
+// ISO-8601 date, `now`, `yesterday`, or a date relative to now such as
+// `3.days.ago` or `1 hour ago`.
+func parseDate(date string, now time.Time) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02T15:04:05Z", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t, nil
+		}
+	}
+
+	fields := strings.FieldsFunc(strings.ToLower(date), func(r rune) bool {
+		return r == '.' || unicode.IsSpace(r)
+	})
+
+	switch {
+	case len(fields) == 1 && fields[0] == "now":
+		return now, nil
+	case len(fields) == 1 && fields[0] == "yesterday":
+		return now.AddDate(0, 0, -1), nil
+	case len(fields) != 3 || fields[2] != "ago":
+		return time.Time{}, fmt.Errorf("invalid date %q", date)
+	}
+
+	n, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	unit := strings.TrimSuffix(fields[1], "s")
+	switch unit {
+	case "month":
+		return now.AddDate(0, -n, 0), nil
+	case "year":
+		return now.AddDate(-n, 0, 0), nil
+	}
+
+	d, ok := dateUnits[unit]
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid date unit %q", fields[1])
+	}
+
+	return now.Add(-time.Duration(n) * d), nil
+}
@@ -130,7 +130,12 @@ func (s *ParserSuite) TestParseWithValidExpression(c *C) {
 		},
 		"v0.99.8^{}": []Revisioner{
 			Ref("v0.99.8"),
-			CaretType{"tag"},
+			CaretType{""},
+		},
+		"v0.99.8^{}~1": []Revisioner{
+			Ref("v0.99.8"),
+			CaretType{""},
+			TildePath{1},
 		},
 		"HEAD^{/fix nasty bug}": []Revisioner{
 			Ref("HEAD"),
@@ -248,11 +253,38 @@ func (s *ParserSuite) TestParseAtWithInvalidExpression(c *C) {
 	}
 }
 
+func (s *ParserSuite) TestParseDate(c *C) {
+	now, _ := time.Parse("2006-01-02T15:04:05Z", "2016-12-16T21:42:47Z")
+
+	datas := map[string]string{
+		"2016-12-16T21:42:47Z": "2016-12-16T21:42:47Z",
+		"2016-12-10":           "2016-12-10T00:00:00Z",
+		"2016-12-10 10:00:00":  "2016-12-10T10:00:00Z",
+		"now":                  "2016-12-16T21:42:47Z",
+		"yesterday":            "2016-12-15T21:42:47Z",
+		"2.days.ago":           "2016-12-14T21:42:47Z",
+		"1 hour ago":           "2016-12-16T20:42:47Z",
+		"3.weeks.ago":          "2016-11-25T21:42:47Z",
+		"1.month.ago":          "2016-11-16T21:42:47Z",
+	}
+
+	for date, expected := range datas {
+		t, err := parseDate(date, now)
+		c.Assert(err, IsNil, Commentf("date: %s", date))
+		c.Assert(t.Format(time.RFC3339), Equals, expected, Commentf("date: %s", date))
+	}
+
+	for _, date := range []string{"test", "2.days", "two.days.ago", "2.fortnights.ago"} {
+		_, err := parseDate(date, now)
+		c.Assert(err, NotNil, Commentf("date: %s", date))
+	}
+}
+
 func (s *ParserSuite) TestParseCaretWithValidExpression(c *C) {
 	datas := map[string]Revisioner{
 		"":                    CaretPath{1},
 		"2":                   CaretPath{2},
-		"{}":                  CaretType{"tag"},
+		"{}":                  CaretType{""},
 		"{commit}":            CaretType{"commit"},
 		"{tree}":              CaretType{"tree"},
 		"{blob}":              CaretType{"blob"},
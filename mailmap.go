@@ -0,0 +1,148 @@
+package git
+
+import (
+	"io"
+	"os"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/mailmap"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+const (
+	mailmapFile        = ".mailmap"
+	mailmapSection     = "mailmap"
+	mailmapFileKey     = "file"
+	mailmapBlobKey     = "blob"
+	defaultMailmapBlob = "HEAD:" + mailmapFile
+)
+
+// Mailmap returns the mailmap of the repository, used to map the names and
+// emails of authors and committers to their canonical ones. It is read from
+// the .mailmap file of the worktree, the blob given by mailmap.blob and the
+// file given by mailmap.file, in this order, the latter overriding the
+// mappings of the former ones. In bare repositories mailmap.blob defaults to
+// HEAD:.mailmap.
+func (r *Repository) Mailmap() (*mailmap.Mailmap, error) {
+	cfg, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	m := mailmap.New()
+	if r.wt != nil {
+		f, err := r.wt.Open(mailmapFile)
+		if err := readMailmapFile(m, f, err); err != nil {
+			return nil, err
+		}
+	}
+
+	blob := cfg.Raw.Section(mailmapSection).Option(mailmapBlobKey)
+	if blob == "" && r.wt == nil {
+		blob = defaultMailmapBlob
+	}
+
+	if blob != "" {
+		if err := r.readMailmapBlob(m, blob); err != nil {
+			return nil, err
+		}
+	}
+
+	if file := cfg.Raw.Section(mailmapSection).Option(mailmapFileKey); file != "" {
+		f, err := os.Open(file)
+		if err := readMailmapFile(m, f, err); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// readMailmapFile reads the mailmap file opened with the given error,
+// ignoring it if it doesn't exist.
+func readMailmapFile(m *mailmap.Mailmap, f io.ReadCloser, err error) error {
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+	return m.Read(f)
+}
+
+// readMailmapBlob reads the mailmap blob given by the revision, ignoring it
+// if it can't be resolved, as git does.
+func (r *Repository) readMailmapBlob(m *mailmap.Mailmap, rev string) error {
+	h, err := r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil
+	}
+
+	blob, err := r.BlobObject(*h)
+	if err != nil {
+		return err
+	}
+
+	reader, err := blob.Reader()
+	if err != nil {
+		return err
+	}
+
+	defer reader.Close()
+	return m.Read(reader)
+}
+
+// mappedCommitIter is a CommitIter returning the commits of another one,
+// mapped by the given function.
+type mappedCommitIter struct {
+	fn   func(*object.Commit) (*object.Commit, error)
+	iter object.CommitIter
+}
+
+func newMailmapCommitIter(m *mailmap.Mailmap, iter object.CommitIter) object.CommitIter {
+	return &mappedCommitIter{iter: iter, fn: func(c *object.Commit) (*object.Commit, error) {
+		// the commit is copied, the walkers may keep the original one
+		mapped := *c
+		mapped.Author = *m.ResolveSignature(&c.Author)
+		mapped.Committer = *m.ResolveSignature(&c.Committer)
+		return &mapped, nil
+	}}
+}
+
+func (i *mappedCommitIter) Next() (*object.Commit, error) {
+	c, err := i.iter.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	return i.fn(c)
+}
+
+func (i *mappedCommitIter) ForEach(cb func(*object.Commit) error) error {
+	for {
+		c, err := i.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := cb(c); err != nil {
+			if err == storer.ErrStop {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
+func (i *mappedCommitIter) Close() {
+	i.iter.Close()
+}
@@ -0,0 +1,116 @@
+package git
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	. "gopkg.in/check.v1"
+)
+
+type MailmapSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&MailmapSuite{})
+
+func (s *MailmapSuite) TestMailmap(c *C) {
+	r, w := newMemoryWorktree(c)
+	commitFiles(c, w, "foo", map[string]string{
+		".mailmap": "Foo <foo@foo.foo>\nBar <bar@bar.bar>\n",
+	})
+
+	dir, clean := s.TemporalDir()
+	defer clean()
+
+	file := filepath.Join(dir, "mailmap")
+	err := ioutil.WriteFile(file, []byte("Qux <bar@bar.bar>\n"), 0644)
+	c.Assert(err, IsNil)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Raw.Section("mailmap").SetOption("file", file)
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	m, err := r.Mailmap()
+	c.Assert(err, IsNil)
+
+	name, _ := m.Resolve("foo", "foo@foo.foo")
+	c.Assert(name, Equals, "Foo")
+	// mailmap.file overrides the .mailmap file
+	name, _ = m.Resolve("bar", "bar@bar.bar")
+	c.Assert(name, Equals, "Qux")
+}
+
+func (s *MailmapSuite) TestMailmapBlob(c *C) {
+	r, w := newMemoryWorktree(c)
+	commitFiles(c, w, "foo", map[string]string{".mailmap": "Foo <foo@foo.foo>\n"})
+
+	bare, err := Open(r.Storer, nil)
+	c.Assert(err, IsNil)
+
+	// HEAD:.mailmap is read by default in bare repositories
+	m, err := bare.Mailmap()
+	c.Assert(err, IsNil)
+	name, _ := m.Resolve("foo", "foo@foo.foo")
+	c.Assert(name, Equals, "Foo")
+
+	commitFiles(c, w, "bar", map[string]string{"mailmap": "Bar <foo@foo.foo>\n"})
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Raw.Section("mailmap").SetOption("blob", "HEAD:mailmap")
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	m, err = bare.Mailmap()
+	c.Assert(err, IsNil)
+	name, _ = m.Resolve("foo", "foo@foo.foo")
+	c.Assert(name, Equals, "Bar")
+
+	// the blobs which can't be resolved are ignored
+	cfg.Raw.Section("mailmap").SetOption("blob", "HEAD:missing")
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	m, err = bare.Mailmap()
+	c.Assert(err, IsNil)
+	name, _ = m.Resolve("foo", "foo@foo.foo")
+	c.Assert(name, Equals, "foo")
+}
+
+func (s *MailmapSuite) TestLogAndBlame(c *C) {
+	r, w := newMemoryWorktree(c)
+
+	author := defaultSignature()
+	commitFiles(c, w, "foo", map[string]string{
+		".mailmap": "Proper <proper@foo.foo> <" + author.Email + ">\n",
+		"foo":      "foo\n",
+	})
+
+	iter, err := r.Log(&LogOptions{UseMailmap: true})
+	c.Assert(err, IsNil)
+
+	var commits []*object.Commit
+	err = iter.ForEach(func(c *object.Commit) error {
+		commits = append(commits, c)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(commits, HasLen, 1)
+	c.Assert(commits[0].Author.Name, Equals, "Proper")
+	c.Assert(commits[0].Author.Email, Equals, "proper@foo.foo")
+	c.Assert(commits[0].Committer.Email, Equals, "proper@foo.foo")
+
+	commit, err := r.CommitObject(commits[0].Hash)
+	c.Assert(err, IsNil)
+	c.Assert(commit.Author.Email, Equals, author.Email)
+
+	result, err := r.Blame(commit, "foo", &BlameOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(result.Lines[0].Author, Equals, author.Email)
+	c.Assert(result.Lines[0].AuthorName, Equals, author.Name)
+
+	result, err = r.Blame(commit, "foo", &BlameOptions{UseMailmap: true})
+	c.Assert(err, IsNil)
+	c.Assert(result.Lines[0].Author, Equals, "proper@foo.foo")
+	c.Assert(result.Lines[0].AuthorName, Equals, "Proper")
+}
@@ -0,0 +1,679 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/binary"
+	"github.com/go-git/go-git/v5/utils/ioutil"
+	"github.com/go-git/go-git/v5/utils/merge"
+)
+
+var (
+	// ErrMissingMergeCommit is returned by MergeCommits when any of the
+	// given commits is nil.
+	ErrMissingMergeCommit = errors.New("ours and theirs commits are required")
+)
+
+// MergeConflictType defines the kind of a MergeConflict.
+type MergeConflictType int8
+
+const (
+	// ContentConflict the file was modified on both sides and the changes
+	// overlap, or the file can't be merged by content (e.g. binary files,
+	// symlinks or mode changes).
+	ContentConflict MergeConflictType = iota
+	// AddAddConflict the file was added on both sides with different content.
+	AddAddConflict
+	// ModifyDeleteConflict the file was modified (or renamed) on one side
+	// and deleted on the other.
+	ModifyDeleteConflict
+	// RenameRenameConflict the file was renamed to different paths on each
+	// side.
+	RenameRenameConflict
+	// FileDirectoryConflict a file on one side is a directory on the other.
+	FileDirectoryConflict
+)
+
+func (t MergeConflictType) String() string {
+	switch t {
+	case ContentConflict:
+		return "content"
+	case AddAddConflict:
+		return "add/add"
+	case ModifyDeleteConflict:
+		return "modify/delete"
+	case RenameRenameConflict:
+		return "rename/rename"
+	case FileDirectoryConflict:
+		return "file/directory"
+	}
+
+	return "unknown"
+}
+
+// MergeEntry is a version of a file taking part in a merge.
+type MergeEntry struct {
+	// Path of the file in the tree it belongs to.
+	Path string
+	// Mode of the file.
+	Mode filemode.FileMode
+	// Hash of the blob of the file.
+	Hash plumbing.Hash
+}
+
+// MergeConflict is a path that can't be merged automatically.
+type MergeConflict struct {
+	// Type of conflict.
+	Type MergeConflictType
+	// Path where the conflict is stored in the resulting tree.
+	Path string
+	// Ancestor is the version of the file in the merge base, nil if the file
+	// doesn't exist on it.
+	Ancestor *MergeEntry
+	// Ours is our version of the file, nil if the file doesn't exist on our
+	// side.
+	Ours *MergeEntry
+	// Theirs is their version of the file, nil if the file doesn't exist on
+	// their side.
+	Theirs *MergeEntry
+}
+
+func (c *MergeConflict) String() string {
+	return fmt.Sprintf("CONFLICT (%s): %s", c.Type, c.Path)
+}
+
+// MergeTreesResult is the outcome of a three-way tree merge.
+type MergeTreesResult struct {
+	// Tree is the hash of the resulting tree, already stored in the
+	// repository. Files with content conflicts are stored with conflict
+	// markers, just like `git merge-tree --write-tree` does.
+	Tree plumbing.Hash
+	// Conflicts sorted by path, empty if the merge is clean.
+	Conflicts []*MergeConflict
+}
+
+// IsClean returns true if the merge doesn't have any conflict.
+func (r *MergeTreesResult) IsClean() bool {
+	return len(r.Conflicts) == 0
+}
+
+// MergeCommits performs a three-way merge of the trees of the given commits,
+// using their merge base as ancestor, without touching the worktree or the
+// index, so it can be used on bare repositories. When the commits have
+// several merge bases they are merged recursively into a virtual ancestor, as
+// the recursive strategy of git does, and when they don't have any, an empty
+// tree is used as ancestor.
+func (r *Repository) MergeCommits(ours, theirs *object.Commit, opts *MergeTreesOptions) (*MergeTreesResult, error) {
+	if ours == nil || theirs == nil {
+		return nil, ErrMissingMergeCommit
+	}
+
+	bases, err := ours.MergeBase(theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.mergeCommits(bases, ours, theirs, opts)
+}
+
+// mergeCommits merges the trees of ours and theirs using the tree resulting
+// of merging the given bases as ancestor.
+func (r *Repository) mergeCommits(bases []*object.Commit, ours, theirs *object.Commit, opts *MergeTreesOptions) (*MergeTreesResult, error) {
+	base, err := r.mergeBaseTree(bases, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	oursTree, err := ours.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	theirsTree, err := theirs.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.MergeTrees(base, oursTree, theirsTree, opts)
+}
+
+// mergeBaseTree returns the tree of the given merge bases, nil if there
+// isn't any. Several bases are merged one by one into a virtual ancestor,
+// using as ancestor of each of these merges the tree of their own merge
+// bases, so the result doesn't depend on the order of the bases. The
+// conflicts found are kept in the virtual ancestor with their markers.
+func (r *Repository) mergeBaseTree(bases []*object.Commit, opts *MergeTreesOptions) (*object.Tree, error) {
+	if len(bases) == 0 {
+		return nil, nil
+	}
+
+	virtual, err := bases[0].Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, next := range bases[1:] {
+		// the merge bases of the virtual ancestor and next are the most
+		// recent of the merge bases of next with any of the merged bases
+		var ancestors []*object.Commit
+		for _, merged := range bases[:i+1] {
+			mb, err := merged.MergeBase(next)
+			if err != nil {
+				return nil, err
+			}
+
+			ancestors = append(ancestors, mb...)
+		}
+
+		if len(ancestors) > 1 {
+			if ancestors, err = object.Independents(ancestors); err != nil {
+				return nil, err
+			}
+		}
+
+		ancestor, err := r.mergeBaseTree(ancestors, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		nextTree, err := next.Tree()
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := r.MergeTrees(ancestor, virtual, nextTree, &MergeTreesOptions{
+			OursLabel:   "Temporary merge branch 1",
+			TheirsLabel: "Temporary merge branch 2",
+			NoRenames:   opts != nil && opts.NoRenames,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if virtual, err = r.TreeObject(res.Tree); err != nil {
+			return nil, err
+		}
+	}
+
+	return virtual, nil
+}
+
+// MergeTrees performs a content-level three-way merge of ours and theirs,
+// using base as ancestor, a nil base is handled as an empty tree. The
+// resulting tree and the blobs resulting of merging the files are stored in
+// the repository, while the conflicts found are returned in the result.
+func (r *Repository) MergeTrees(base, ours, theirs *object.Tree, opts *MergeTreesOptions) (*MergeTreesResult, error) {
+	if opts == nil {
+		opts = &MergeTreesOptions{}
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	m := &treeMerger{r: r, opts: opts, result: make(map[string]*MergeEntry)}
+	return m.merge(base, ours, theirs)
+}
+
+type treeMerger struct {
+	r    *Repository
+	opts *MergeTreesOptions
+
+	base, ours, theirs map[string]*MergeEntry
+	result             map[string]*MergeEntry
+	conflicts          []*MergeConflict
+}
+
+func (m *treeMerger) merge(base, ours, theirs *object.Tree) (*MergeTreesResult, error) {
+	var err error
+	for _, t := range []struct {
+		tree  *object.Tree
+		files *map[string]*MergeEntry
+	}{
+		{base, &m.base}, {ours, &m.ours}, {theirs, &m.theirs},
+	} {
+		if *t.files, err = mergeEntries(t.tree); err != nil {
+			return nil, err
+		}
+	}
+
+	handled := make(map[string]bool)
+	if !m.opts.NoRenames {
+		if err := m.mergeRenames(base, ours, theirs, handled); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, path := range m.paths() {
+		if handled[path] {
+			continue
+		}
+
+		if err := m.mergeEntry(path, m.base[path], m.ours[path], m.theirs[path]); err != nil {
+			return nil, err
+		}
+	}
+
+	m.resolveFileDirectory()
+
+	tree, err := m.buildTree()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(m.conflicts, func(i, j int) bool {
+		return m.conflicts[i].Path < m.conflicts[j].Path
+	})
+
+	return &MergeTreesResult{Tree: tree, Conflicts: m.conflicts}, nil
+}
+
+// mergeRenames merges the files renamed on any of the sides, marking as
+// handled all the paths involved.
+func (m *treeMerger) mergeRenames(base, ours, theirs *object.Tree, handled map[string]bool) error {
+	oursRenames, err := mergeRenames(base, ours)
+	if err != nil {
+		return err
+	}
+
+	theirsRenames, err := mergeRenames(base, theirs)
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	for path := range m.base {
+		if oursRenames[path] != "" || theirsRenames[path] != "" {
+			paths = append(paths, path)
+		}
+	}
+
+	sort.Strings(paths)
+	for _, path := range paths {
+		a, b := oursRenames[path], theirsRenames[path]
+		base := m.base[path]
+
+		switch {
+		case a != "" && b != "":
+			handled[path], handled[a], handled[b] = true, true, true
+			if a == b {
+				if err := m.mergeEntry(a, base, m.ours[a], m.theirs[b]); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			m.result[a], m.result[b] = m.ours[a], m.theirs[b]
+			m.conflict(RenameRenameConflict, path, base, m.ours[a], m.theirs[b])
+		case a != "":
+			if m.theirs[a] != nil {
+				continue
+			}
+
+			handled[path], handled[a] = true, true
+			if err := m.mergeEntry(a, base, m.ours[a], m.theirs[path]); err != nil {
+				return err
+			}
+		case b != "":
+			if m.ours[b] != nil {
+				continue
+			}
+
+			handled[path], handled[b] = true, true
+			if err := m.mergeEntry(b, base, m.ours[path], m.theirs[b]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *treeMerger) paths() []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, files := range []map[string]*MergeEntry{m.base, m.ours, m.theirs} {
+		for path := range files {
+			if seen[path] {
+				continue
+			}
+
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	sort.Strings(paths)
+	return paths
+}
+
+// mergeEntry merges the three versions of a file into the given path.
+func (m *treeMerger) mergeEntry(path string, base, ours, theirs *MergeEntry) error {
+	switch {
+	case sameMergeEntry(ours, theirs):
+		m.set(path, ours)
+		return nil
+	case sameMergeEntry(base, ours):
+		m.set(path, theirs)
+		return nil
+	case sameMergeEntry(base, theirs):
+		m.set(path, ours)
+		return nil
+	case ours == nil || theirs == nil:
+		if ours == nil {
+			m.set(path, theirs)
+		} else {
+			m.set(path, ours)
+		}
+
+		m.conflict(ModifyDeleteConflict, path, base, ours, theirs)
+		return nil
+	}
+
+	e, conflict, err := m.mergeFile(path, base, ours, theirs)
+	if err != nil {
+		return err
+	}
+
+	m.set(path, e)
+	if !conflict {
+		return nil
+	}
+
+	if base == nil {
+		m.conflict(AddAddConflict, path, base, ours, theirs)
+	} else {
+		m.conflict(ContentConflict, path, base, ours, theirs)
+	}
+
+	return nil
+}
+
+// mergeFile merges the mode and the content of a file modified on both sides,
+// conflict is true if the file can't be merged cleanly.
+func (m *treeMerger) mergeFile(path string, base, ours, theirs *MergeEntry) (e *MergeEntry, conflict bool, err error) {
+	e = &MergeEntry{Path: path}
+
+	switch {
+	case ours.Mode == theirs.Mode:
+		e.Mode = ours.Mode
+	case base != nil && base.Mode == ours.Mode:
+		e.Mode = theirs.Mode
+	case base != nil && base.Mode == theirs.Mode:
+		e.Mode = ours.Mode
+	default:
+		e.Mode = m.favor(ours, theirs).Mode
+		conflict = true
+	}
+
+	switch {
+	case ours.Hash == theirs.Hash:
+		e.Hash = ours.Hash
+		return
+	case base != nil && base.Hash == ours.Hash:
+		e.Hash = theirs.Hash
+		return
+	case base != nil && base.Hash == theirs.Hash:
+		e.Hash = ours.Hash
+		return
+	}
+
+	if !isMergeableMode(ours.Mode) || !isMergeableMode(theirs.Mode) {
+		e.Hash = m.favor(ours, theirs).Hash
+		return e, true, nil
+	}
+
+	var contents [3][]byte
+	for i, entry := range []*MergeEntry{base, ours, theirs} {
+		if entry == nil {
+			continue
+		}
+
+		contents[i], err = m.readBlob(entry.Hash)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	for _, content := range contents {
+		isBinary, err := binary.IsBinary(bytes.NewReader(content))
+		if err != nil {
+			return nil, false, err
+		}
+
+		if isBinary {
+			e.Hash = m.favor(ours, theirs).Hash
+			return e, m.opts.StrategyOption == DefaultStrategyOption, nil
+		}
+	}
+
+	res := merge.Merge(contents[0], contents[1], contents[2], &merge.Options{
+		OursLabel:   m.opts.OursLabel,
+		TheirsLabel: m.opts.TheirsLabel,
+		BaseLabel:   m.opts.BaseLabel,
+		Favor:       m.opts.StrategyOption.favor(),
+		Style:       m.opts.ConflictStyle,
+	})
+
+	e.Hash, err = m.r.writeBlob(res.Content)
+	return e, conflict || res.HasConflicts(), err
+}
+
+// favor returns the entry to be used when a conflict can't be represented
+// with conflict markers, by default our side is kept.
+func (m *treeMerger) favor(ours, theirs *MergeEntry) *MergeEntry {
+	if m.opts.StrategyOption == TheirsStrategyOption {
+		return theirs
+	}
+
+	return ours
+}
+
+// resolveFileDirectory finds the files that are a directory on the other side,
+// renaming the file to `<path>~<label>`, like git does.
+func (m *treeMerger) resolveFileDirectory() {
+	dirs := make(map[string]bool)
+	for path := range m.result {
+		for dir := parentDir(path); dir != ""; dir = parentDir(dir) {
+			dirs[dir] = true
+		}
+	}
+
+	var paths []string
+	for path := range m.result {
+		if dirs[path] {
+			paths = append(paths, path)
+		}
+	}
+
+	sort.Strings(paths)
+	for _, path := range paths {
+		e := m.result[path]
+		delete(m.result, path)
+
+		label := m.opts.OursLabel
+		var ours, theirs *MergeEntry
+		if sameMergeEntry(e, m.ours[path]) {
+			ours = m.ours[path]
+		} else {
+			label = m.opts.TheirsLabel
+			theirs = m.theirs[path]
+		}
+
+		newPath := path + "~" + strings.Replace(label, "/", "_", -1)
+		m.set(newPath, e)
+		m.conflict(FileDirectoryConflict, newPath, m.base[path], ours, theirs)
+	}
+}
+
+func (m *treeMerger) buildTree() (plumbing.Hash, error) {
+	return m.r.buildEntriesTree(m.result)
+}
+
+// buildEntriesTree stores the tree, and its subtrees, holding the given
+// entries indexed by path, returning its hash.
+func (r *Repository) buildEntriesTree(entries map[string]*MergeEntry) (plumbing.Hash, error) {
+	idx := &index.Index{}
+	for path, e := range entries {
+		idx.Entries = append(idx.Entries, &index.Entry{
+			Name: path,
+			Mode: e.Mode,
+			Hash: e.Hash,
+		})
+	}
+
+	sort.Slice(idx.Entries, func(i, j int) bool {
+		return idx.Entries[i].Name < idx.Entries[j].Name
+	})
+
+	h := &buildTreeHelper{s: r.Storer}
+	return h.BuildTree(idx, &CommitOptions{AllowEmptyCommits: true})
+}
+
+func (m *treeMerger) set(path string, e *MergeEntry) {
+	if e == nil {
+		delete(m.result, path)
+		return
+	}
+
+	m.result[path] = &MergeEntry{Path: path, Mode: e.Mode, Hash: e.Hash}
+}
+
+func (m *treeMerger) conflict(t MergeConflictType, path string, base, ours, theirs *MergeEntry) {
+	m.conflicts = append(m.conflicts, &MergeConflict{
+		Type:     t,
+		Path:     path,
+		Ancestor: base,
+		Ours:     ours,
+		Theirs:   theirs,
+	})
+}
+
+func (m *treeMerger) readBlob(h plumbing.Hash) (content []byte, err error) {
+	b, err := m.r.BlobObject(h)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := b.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(r, &err)
+
+	buf := bytes.NewBuffer(nil)
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeBlob stores a blob with the given content, returning its hash.
+func (r *Repository) writeBlob(content []byte) (h plumbing.Hash, err error) {
+	obj := r.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	obj.SetSize(int64(len(content)))
+
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if _, err := w.Write(content); err != nil {
+		_ = w.Close()
+		return plumbing.ZeroHash, err
+	}
+
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return r.Storer.SetEncodedObject(obj)
+}
+
+// mergeEntries returns all the non-directory entries of a tree, recursively,
+// indexed by their path.
+func mergeEntries(t *object.Tree) (map[string]*MergeEntry, error) {
+	entries := make(map[string]*MergeEntry)
+	if t == nil {
+		return entries, nil
+	}
+
+	w := object.NewTreeWalker(t, true, nil)
+	defer w.Close()
+
+	for {
+		name, e, err := w.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if e.Mode == filemode.Dir {
+			continue
+		}
+
+		entries[name] = &MergeEntry{Path: name, Mode: e.Mode, Hash: e.Hash}
+	}
+}
+
+// mergeRenames returns the renames done from base to other, indexed by the
+// path in base.
+func mergeRenames(base, other *object.Tree) (map[string]string, error) {
+	renames := make(map[string]string)
+	if base == nil || other == nil {
+		return renames, nil
+	}
+
+	changes, err := object.DiffTreeWithOptions(
+		context.Background(), base, other, object.DefaultDiffTreeOptions,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ch := range changes {
+		if ch.From.Name != "" && ch.To.Name != "" && ch.From.Name != ch.To.Name {
+			renames[ch.From.Name] = ch.To.Name
+		}
+	}
+
+	return renames, nil
+}
+
+func sameMergeEntry(a, b *MergeEntry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Hash == b.Hash && a.Mode == b.Mode
+}
+
+func isMergeableMode(m filemode.FileMode) bool {
+	return m == filemode.Regular || m == filemode.Executable || m == filemode.Deprecated
+}
+
+func parentDir(path string) string {
+	i := strings.LastIndexByte(path, '/')
+	if i < 0 {
+		return ""
+	}
+
+	return path[:i]
+}
@@ -0,0 +1,315 @@
+package git
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+type MergeSuite struct{}
+
+var _ = Suite(&MergeSuite{})
+
+// mergeSide describes the changes made by one of the sides of a merge.
+type mergeSide struct {
+	files   map[string]string
+	removed []string
+}
+
+// prepareMerge creates a repository with a commit containing the base files
+// in master, followed by a commit with the changes of ours, and a branch
+// called `theirs` starting at the same base, with the changes of theirs.
+func (s *MergeSuite) prepareMerge(c *C, base map[string]string, ours, theirs mergeSide) (*Repository, *object.Commit, *object.Commit) {
+	r, w := newMemoryWorktree(c)
+
+	baseCommit := commitMergeSide(c, w, mergeSide{files: base})
+	err := r.Storer.SetReference(plumbing.NewHashReference("refs/heads/theirs", baseCommit))
+	c.Assert(err, IsNil)
+
+	oursCommit := commitMergeSide(c, w, ours)
+
+	err = w.Checkout(&CheckoutOptions{Branch: "refs/heads/theirs", Force: true})
+	c.Assert(err, IsNil)
+	theirsCommit := commitMergeSide(c, w, theirs)
+
+	err = w.Checkout(&CheckoutOptions{Branch: plumbing.Master, Force: true})
+	c.Assert(err, IsNil)
+
+	oc, err := r.CommitObject(oursCommit)
+	c.Assert(err, IsNil)
+	tc, err := r.CommitObject(theirsCommit)
+	c.Assert(err, IsNil)
+
+	return r, oc, tc
+}
+
+func commitMergeSide(c *C, w *Worktree, side mergeSide) plumbing.Hash {
+	for name, content := range side.files {
+		err := util.WriteFile(w.Filesystem, name, []byte(content), 0644)
+		c.Assert(err, IsNil)
+
+		_, err = w.Add(name)
+		c.Assert(err, IsNil)
+	}
+
+	for _, name := range side.removed {
+		_, err := w.Remove(name)
+		c.Assert(err, IsNil)
+	}
+
+	h, err := w.Commit("commit", &CommitOptions{
+		Author:            defaultSignature(),
+		AllowEmptyCommits: true,
+	})
+	c.Assert(err, IsNil)
+	return h
+}
+
+func assertTreeFiles(c *C, r *Repository, tree plumbing.Hash, expected map[string]string) {
+	t, err := r.TreeObject(tree)
+	c.Assert(err, IsNil)
+
+	files := make(map[string]string)
+	err = t.Files().ForEach(func(f *object.File) error {
+		content, err := f.Contents()
+		files[f.Name] = content
+		return err
+	})
+	c.Assert(err, IsNil)
+	c.Assert(files, DeepEquals, expected)
+}
+
+func (s *MergeSuite) TestMergeCommitsClean(c *C) {
+	r, ours, theirs := s.prepareMerge(c,
+		map[string]string{"a": "1\n2\n3\n", "b": "b\n", "c": "c\n"},
+		mergeSide{files: map[string]string{"a": "one\n2\n3\n", "d": "d\n"}},
+		mergeSide{files: map[string]string{"a": "1\n2\nthree\n"}, removed: []string{"c"}},
+	)
+
+	res, err := r.MergeCommits(ours, theirs, nil)
+	c.Assert(err, IsNil)
+	c.Assert(res.IsClean(), Equals, true)
+
+	assertTreeFiles(c, r, res.Tree, map[string]string{
+		"a": "one\n2\nthree\n",
+		"b": "b\n",
+		"d": "d\n",
+	})
+}
+
+func (s *MergeSuite) TestMergeCommitsContentConflict(c *C) {
+	r, ours, theirs := s.prepareMerge(c,
+		map[string]string{"a": "1\n2\n3\n"},
+		mergeSide{files: map[string]string{"a": "1\nours\n3\n"}},
+		mergeSide{files: map[string]string{"a": "1\ntheirs\n3\n"}},
+	)
+
+	res, err := r.MergeCommits(ours, theirs, &MergeTreesOptions{
+		OursLabel:   "HEAD",
+		TheirsLabel: "theirs",
+	})
+	c.Assert(err, IsNil)
+	c.Assert(res.Conflicts, HasLen, 1)
+
+	conflict := res.Conflicts[0]
+	c.Assert(conflict.Type, Equals, ContentConflict)
+	c.Assert(conflict.Path, Equals, "a")
+	c.Assert(conflict.Ancestor, NotNil)
+	c.Assert(conflict.Ours, NotNil)
+	c.Assert(conflict.Theirs, NotNil)
+	c.Assert(conflict.String(), Equals, "CONFLICT (content): a")
+
+	assertTreeFiles(c, r, res.Tree, map[string]string{
+		"a": "1\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> theirs\n3\n",
+	})
+}
+
+func (s *MergeSuite) TestMergeCommitsStrategyOption(c *C) {
+	r, ours, theirs := s.prepareMerge(c,
+		map[string]string{"a": "1\n2\n3\n"},
+		mergeSide{files: map[string]string{"a": "1\nours\n3\n"}},
+		mergeSide{files: map[string]string{"a": "1\ntheirs\n3\n"}},
+	)
+
+	res, err := r.MergeCommits(ours, theirs, &MergeTreesOptions{
+		StrategyOption: TheirsStrategyOption,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(res.IsClean(), Equals, true)
+	assertTreeFiles(c, r, res.Tree, map[string]string{"a": "1\ntheirs\n3\n"})
+}
+
+func (s *MergeSuite) TestMergeCommitsAddAdd(c *C) {
+	r, ours, theirs := s.prepareMerge(c,
+		map[string]string{"a": "a\n"},
+		mergeSide{files: map[string]string{"b": "ours\n"}},
+		mergeSide{files: map[string]string{"b": "theirs\n"}},
+	)
+
+	res, err := r.MergeCommits(ours, theirs, nil)
+	c.Assert(err, IsNil)
+	c.Assert(res.Conflicts, HasLen, 1)
+	c.Assert(res.Conflicts[0].Type, Equals, AddAddConflict)
+	c.Assert(res.Conflicts[0].Ancestor, IsNil)
+
+	assertTreeFiles(c, r, res.Tree, map[string]string{
+		"a": "a\n",
+		"b": "<<<<<<< ours\nours\n=======\ntheirs\n>>>>>>> theirs\n",
+	})
+}
+
+func (s *MergeSuite) TestMergeCommitsModifyDelete(c *C) {
+	r, ours, theirs := s.prepareMerge(c,
+		map[string]string{"a": "a\n", "b": "b\n"},
+		mergeSide{removed: []string{"a"}},
+		mergeSide{files: map[string]string{"a": "modified\n"}},
+	)
+
+	res, err := r.MergeCommits(ours, theirs, nil)
+	c.Assert(err, IsNil)
+	c.Assert(res.Conflicts, HasLen, 1)
+	c.Assert(res.Conflicts[0].Type, Equals, ModifyDeleteConflict)
+	c.Assert(res.Conflicts[0].Ours, IsNil)
+	c.Assert(res.Conflicts[0].Theirs, NotNil)
+
+	assertTreeFiles(c, r, res.Tree, map[string]string{
+		"a": "modified\n",
+		"b": "b\n",
+	})
+}
+
+func (s *MergeSuite) TestMergeCommitsRenameAndModify(c *C) {
+	content := "1\n2\n3\n4\n5\n6\n7\n8\n9\n"
+	r, ours, theirs := s.prepareMerge(c,
+		map[string]string{"a": content},
+		mergeSide{files: map[string]string{"renamed": content}, removed: []string{"a"}},
+		mergeSide{files: map[string]string{"a": "1\n2\n3\n4\n5\n6\n7\n8\nnine\n"}},
+	)
+
+	res, err := r.MergeCommits(ours, theirs, nil)
+	c.Assert(err, IsNil)
+	c.Assert(res.IsClean(), Equals, true)
+	assertTreeFiles(c, r, res.Tree, map[string]string{
+		"renamed": "1\n2\n3\n4\n5\n6\n7\n8\nnine\n",
+	})
+}
+
+func (s *MergeSuite) TestMergeCommitsRenameRename(c *C) {
+	content := "1\n2\n3\n4\n5\n6\n7\n8\n9\n"
+	r, ours, theirs := s.prepareMerge(c,
+		map[string]string{"a": content},
+		mergeSide{files: map[string]string{"b": content}, removed: []string{"a"}},
+		mergeSide{files: map[string]string{"c": content}, removed: []string{"a"}},
+	)
+
+	res, err := r.MergeCommits(ours, theirs, nil)
+	c.Assert(err, IsNil)
+	c.Assert(res.Conflicts, HasLen, 1)
+	c.Assert(res.Conflicts[0].Type, Equals, RenameRenameConflict)
+	c.Assert(res.Conflicts[0].Path, Equals, "a")
+	c.Assert(res.Conflicts[0].Ours.Path, Equals, "b")
+	c.Assert(res.Conflicts[0].Theirs.Path, Equals, "c")
+
+	assertTreeFiles(c, r, res.Tree, map[string]string{"b": content, "c": content})
+}
+
+func (s *MergeSuite) TestMergeCommitsFileDirectory(c *C) {
+	r, ours, theirs := s.prepareMerge(c,
+		map[string]string{"a": "a\n"},
+		mergeSide{files: map[string]string{"b": "file\n"}},
+		mergeSide{files: map[string]string{"b/c": "dir\n"}},
+	)
+
+	res, err := r.MergeCommits(ours, theirs, &MergeTreesOptions{OursLabel: "HEAD"})
+	c.Assert(err, IsNil)
+	c.Assert(res.Conflicts, HasLen, 1)
+	c.Assert(res.Conflicts[0].Type, Equals, FileDirectoryConflict)
+	c.Assert(res.Conflicts[0].Path, Equals, "b~HEAD")
+
+	assertTreeFiles(c, r, res.Tree, map[string]string{
+		"a":      "a\n",
+		"b~HEAD": "file\n",
+		"b/c":    "dir\n",
+	})
+}
+
+func (s *MergeSuite) TestMergeCommitsCrissCross(c *C) {
+	r, w := newMemoryWorktree(c)
+
+	base := commitFiles(c, w, "base", map[string]string{"foo": "1\n2\n3\n"})
+	a := commitFiles(c, w, "a", map[string]string{"foo": "a\n2\n3\n"})
+
+	err := w.Reset(&ResetOptions{Commit: base, Mode: HardReset})
+	c.Assert(err, IsNil)
+	b := commitFiles(c, w, "b", map[string]string{"foo": "1\n2\nb\n"})
+
+	// each side merges the other one, so a and b are both merge bases
+	merged := []byte("a\n2\nb\n")
+	commitMerge := func(parents ...plumbing.Hash) plumbing.Hash {
+		err := w.Reset(&ResetOptions{Commit: parents[0], Mode: HardReset})
+		c.Assert(err, IsNil)
+		err = util.WriteFile(w.Filesystem, "foo", merged, 0644)
+		c.Assert(err, IsNil)
+		_, err = w.Add("foo")
+		c.Assert(err, IsNil)
+
+		h, err := w.Commit("merge", &CommitOptions{Author: defaultSignature(), Parents: parents})
+		c.Assert(err, IsNil)
+		return h
+	}
+
+	commitMerge(a, b)
+	oursHash := commitFiles(c, w, "ours", map[string]string{"foo": "a\nours\nb\n"})
+
+	commitMerge(b, a)
+	theirsHash := commitFiles(c, w, "theirs", map[string]string{"bar": "bar\n"})
+
+	ours, err := r.CommitObject(oursHash)
+	c.Assert(err, IsNil)
+	theirs, err := r.CommitObject(theirsHash)
+	c.Assert(err, IsNil)
+
+	bases, err := ours.MergeBase(theirs)
+	c.Assert(err, IsNil)
+	c.Assert(bases, HasLen, 2)
+
+	for _, sides := range [][]*object.Commit{{ours, theirs}, {theirs, ours}} {
+		res, err := r.MergeCommits(sides[0], sides[1], nil)
+		c.Assert(err, IsNil)
+		c.Assert(res.IsClean(), Equals, true)
+
+		assertTreeFiles(c, r, res.Tree, map[string]string{
+			"foo": "a\nours\nb\n",
+			"bar": "bar\n",
+		})
+	}
+}
+
+func (s *MergeSuite) TestMergeTreesWithoutBase(c *C) {
+	r, ours, theirs := s.prepareMerge(c,
+		map[string]string{"a": "a\n"},
+		mergeSide{files: map[string]string{"b": "b\n"}},
+		mergeSide{files: map[string]string{"c": "c\n"}},
+	)
+
+	oursTree, err := ours.Tree()
+	c.Assert(err, IsNil)
+	theirsTree, err := theirs.Tree()
+	c.Assert(err, IsNil)
+
+	res, err := r.MergeTrees(nil, oursTree, theirsTree, nil)
+	c.Assert(err, IsNil)
+	c.Assert(res.IsClean(), Equals, true)
+	assertTreeFiles(c, r, res.Tree, map[string]string{
+		"a": "a\n", "b": "b\n", "c": "c\n",
+	})
+}
+
+func (s *MergeSuite) TestMergeCommitsMissingCommit(c *C) {
+	r, ours, _ := s.prepareMerge(c, map[string]string{"a": "a\n"}, mergeSide{}, mergeSide{})
+
+	_, err := r.MergeCommits(ours, nil, nil)
+	c.Assert(err, Equals, ErrMissingMergeCommit)
+}
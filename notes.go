@@ -0,0 +1,464 @@
+package git
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const (
+	// DefaultNotesRef is the notes reference used when none is given and
+	// the core.notesRef config is not set.
+	DefaultNotesRef plumbing.ReferenceName = "refs/notes/commits"
+
+	coreSection = "core"
+	notesRefKey = "notesRef"
+	// notesPerDirectory is the number of notes in each directory of the
+	// notes tree above which they are fanned out by another level.
+	notesPerDirectory = 256
+)
+
+var (
+	// ErrNoteNotFound is returned when the object has no note in the notes
+	// reference.
+	ErrNoteNotFound = errors.New("note not found")
+	// ErrNoteExists is returned adding or copying a note to an object that
+	// already has one, unless forced.
+	ErrNoteExists = errors.New("note already exists")
+)
+
+// Note is a note attached to an object. For more information:
+// https://git-scm.com/docs/git-notes
+type Note struct {
+	// Ref is the notes reference holding the note.
+	Ref plumbing.ReferenceName
+	// Object is the object annotated.
+	Object plumbing.Hash
+	// Blob is the blob holding the message of the note.
+	Blob plumbing.Hash
+	// Message is the message of the note.
+	Message string
+}
+
+// Note returns the note of the object with the given hash in the given notes
+// reference, see AddNoteOptions.Ref. If the object has no note,
+// ErrNoteNotFound is returned.
+func (r *Repository) Note(ref plumbing.ReferenceName, h plumbing.Hash) (*Note, error) {
+	name, err := r.notesReference(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	_, commit, err := r.notesCommit(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if commit == nil {
+		return nil, ErrNoteNotFound
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	note, err := r.findNote(tree, h)
+	if err != nil {
+		return nil, err
+	}
+
+	note.Ref = name
+	return note, nil
+}
+
+// AddNote adds a note to an object, committing it to the notes reference,
+// and returns the hash of the commit.
+func (r *Repository) AddNote(o *AddNoteOptions) (plumbing.Hash, error) {
+	if err := o.Validate(r); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	msg := "Notes added by 'git notes add'\n"
+	if o.Append {
+		msg = "Notes added by 'git notes append'\n"
+	}
+
+	return r.updateNotes(o.Ref, msg, o.Author, o.Committer, func(notes map[plumbing.Hash]plumbing.Hash) error {
+		content := o.Message
+		if blob, ok := notes[o.Object]; ok {
+			switch {
+			case o.Append:
+				b, err := r.BlobObject(blob)
+				if err != nil {
+					return err
+				}
+
+				current, err := blobContent(b)
+				if err != nil {
+					return err
+				}
+
+				content = strings.TrimRight(current, "\n") + "\n\n" + content
+			case !o.Force:
+				return ErrNoteExists
+			}
+		}
+
+		blob, err := r.writeBlob([]byte(content))
+		if err != nil {
+			return err
+		}
+
+		notes[o.Object] = blob
+		return nil
+	})
+}
+
+// RemoveNote removes the note of an object, committing it to the notes
+// reference, and returns the hash of the commit. If the object has no note,
+// ErrNoteNotFound is returned unless IgnoreMissing is set.
+func (r *Repository) RemoveNote(o *RemoveNoteOptions) (plumbing.Hash, error) {
+	if err := o.Validate(r); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if o.IgnoreMissing {
+		if _, err := r.Note(o.Ref, o.Object); err == ErrNoteNotFound {
+			return plumbing.ZeroHash, nil
+		}
+	}
+
+	msg := "Notes removed by 'git notes remove'\n"
+	return r.updateNotes(o.Ref, msg, o.Author, o.Committer, func(notes map[plumbing.Hash]plumbing.Hash) error {
+		if _, ok := notes[o.Object]; !ok {
+			return ErrNoteNotFound
+		}
+
+		delete(notes, o.Object)
+		return nil
+	})
+}
+
+// CopyNotes copies the note of an object to another one, committing it to
+// the notes reference, and returns the hash of the commit.
+func (r *Repository) CopyNotes(o *CopyNotesOptions) (plumbing.Hash, error) {
+	if err := o.Validate(r); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	msg := "Notes added by 'git notes copy'\n"
+	return r.updateNotes(o.Ref, msg, o.Author, o.Committer, func(notes map[plumbing.Hash]plumbing.Hash) error {
+		blob, ok := notes[o.From]
+		if !ok {
+			return ErrNoteNotFound
+		}
+
+		if _, ok := notes[o.To]; ok && !o.Force {
+			return ErrNoteExists
+		}
+
+		notes[o.To] = blob
+		return nil
+	})
+}
+
+// notesReference returns the full name of the given notes reference, the
+// default one if empty.
+func (r *Repository) notesReference(name plumbing.ReferenceName) (plumbing.ReferenceName, error) {
+	if name == "" {
+		cfg, err := r.Config()
+		if err != nil {
+			return "", err
+		}
+
+		name = plumbing.ReferenceName(cfg.Raw.Section(coreSection).Option(notesRefKey))
+	}
+
+	if name == "" {
+		return DefaultNotesRef, nil
+	}
+
+	if !strings.HasPrefix(name.String(), "refs/") {
+		name = plumbing.NewNoteReferenceName(name.String())
+	}
+
+	return name, nil
+}
+
+// notesCommit returns the given notes reference and its commit, nil if it
+// doesn't exist.
+func (r *Repository) notesCommit(name plumbing.ReferenceName) (*plumbing.Reference, *object.Commit, error) {
+	ref, err := r.Storer.Reference(name)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, nil, nil
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	commit, err := r.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ref, commit, nil
+}
+
+// findNote returns the note of the given object in a notes tree, looking for
+// it at every level of fan-out, as git does.
+func (r *Repository) findNote(tree *object.Tree, h plumbing.Hash) (*Note, error) {
+	name := h.String()
+	for {
+		for _, e := range tree.Entries {
+			if e.Name != name || !e.Mode.IsFile() {
+				continue
+			}
+
+			b, err := r.BlobObject(e.Hash)
+			if err != nil {
+				return nil, err
+			}
+
+			msg, err := blobContent(b)
+			if err != nil {
+				return nil, err
+			}
+
+			return &Note{Object: h, Blob: e.Hash, Message: msg}, nil
+		}
+
+		if len(name) <= 2 {
+			return nil, ErrNoteNotFound
+		}
+
+		subtree, err := tree.Tree(name[:2])
+		if err == object.ErrDirectoryNotFound {
+			return nil, ErrNoteNotFound
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		tree, name = subtree, name[2:]
+	}
+}
+
+// updateNotes changes the notes of the given notes reference with fn, given
+// the blobs of the notes by object, and commits the notes tree with the
+// given message, returning the hash of the commit.
+func (r *Repository) updateNotes(
+	name plumbing.ReferenceName, msg string, author, committer *object.Signature,
+	fn func(notes map[plumbing.Hash]plumbing.Hash) error,
+) (plumbing.Hash, error) {
+	ref, commit, err := r.notesCommit(name)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	var tree *object.Tree
+	var parents []plumbing.Hash
+	if commit != nil {
+		if tree, err = commit.Tree(); err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		parents = append(parents, commit.Hash)
+	}
+
+	entries, err := mergeEntries(tree)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	// the files of the notes tree which aren't notes are kept as they are
+	notes := make(map[plumbing.Hash]plumbing.Hash)
+	for path, e := range entries {
+		if h, ok := notePathObject(path); ok && e.Mode.IsFile() {
+			notes[h] = e.Hash
+			delete(entries, path)
+		}
+	}
+
+	if err := fn(notes); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	fanout := notesFanout(len(notes))
+	for h, blob := range notes {
+		path := notePath(h, fanout)
+		entries[path] = &MergeEntry{Path: path, Mode: filemode.Regular, Hash: blob}
+	}
+
+	treeHash, err := r.buildEntriesTree(entries)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	c := &object.Commit{
+		Author:       *author,
+		Committer:    *committer,
+		Message:      msg,
+		TreeHash:     treeHash,
+		ParentHashes: parents,
+	}
+
+	obj := r.Storer.NewEncodedObject()
+	if err := c.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	h, err := r.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	reflogMsg := "notes: " + strings.TrimSuffix(msg, "\n")
+	return h, updateReference(r.Storer, plumbing.NewHashReference(name, h), ref, reflogMsg, committer)
+}
+
+// notePathObject returns the object of the note at the given path of a notes
+// tree, if it is a note, its hash split by the directories of the fan-out.
+func notePathObject(path string) (plumbing.Hash, bool) {
+	parts := strings.Split(path, "/")
+	for _, dir := range parts[:len(parts)-1] {
+		if len(dir) != 2 {
+			return plumbing.ZeroHash, false
+		}
+	}
+
+	name := strings.Join(parts, "")
+	if !plumbing.IsHash(name) {
+		return plumbing.ZeroHash, false
+	}
+
+	return plumbing.NewHash(name), true
+}
+
+// notesFanout returns the number of levels of directories the given number
+// of notes are fanned out by, each one named after the next two hex digits
+// of the objects.
+func notesFanout(n int) int {
+	fanout := 0
+	for perDirectory := n; perDirectory > notesPerDirectory; perDirectory /= 256 {
+		fanout++
+	}
+
+	return fanout
+}
+
+func notePath(h plumbing.Hash, fanout int) string {
+	name := h.String()
+	var path strings.Builder
+	for i := 0; i < fanout; i++ {
+		path.WriteString(name[i*2 : i*2+2])
+		path.WriteByte('/')
+	}
+
+	path.WriteString(name[fanout*2:])
+	return path.String()
+}
+
+func blobContent(b *object.Blob) (string, error) {
+	r, err := b.Reader()
+	if err != nil {
+		return "", err
+	}
+
+	defer r.Close()
+
+	buf := new(strings.Builder)
+	if _, err := io.Copy(buf, r); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// newNotesCommitIter returns a CommitIter returning the commits of another
+// one, calling fn with each commit and its notes in the given notes
+// references, the default one if none is given.
+func (r *Repository) newNotesCommitIter(refs []plumbing.ReferenceName,
+	fn func(*object.Commit, []*Note) error, iter object.CommitIter,
+) (object.CommitIter, error) {
+	if len(refs) == 0 {
+		refs = []plumbing.ReferenceName{""}
+	}
+
+	var names []plumbing.ReferenceName
+	var trees []*object.Tree
+	for _, ref := range refs {
+		name, err := r.notesReference(ref)
+		if err != nil {
+			return nil, err
+		}
+
+		_, commit, err := r.notesCommit(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if commit == nil {
+			continue
+		}
+
+		tree, err := commit.Tree()
+		if err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+		trees = append(trees, tree)
+	}
+
+	return &mappedCommitIter{iter: iter, fn: func(c *object.Commit) (*object.Commit, error) {
+		var notes []*Note
+		for i, tree := range trees {
+			note, err := r.findNote(tree, c.Hash)
+			if err == ErrNoteNotFound {
+				continue
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			note.Ref = names[i]
+			notes = append(notes, note)
+		}
+
+		if err := fn(c, notes); err != nil {
+			return nil, err
+		}
+
+		return c, nil
+	}}, nil
+}
+
+// String returns the note the same way git log shows it after the message of
+// a commit, under a "Notes:" header naming the notes reference unless it is
+// the default one.
+func (n *Note) String() string {
+	header := "Notes:"
+	if n.Ref != "" && n.Ref != DefaultNotesRef {
+		header = "Notes (" + strings.TrimPrefix(n.Ref.String(), "refs/notes/") + "):"
+	}
+
+	var b strings.Builder
+	b.WriteString("\n" + header + "\n")
+	for _, line := range strings.Split(strings.TrimRight(n.Message, "\n"), "\n") {
+		if line != "" {
+			b.WriteString("    " + line)
+		}
+
+		b.WriteByte('\n')
+	}
+
+	return b.String()
+}
@@ -0,0 +1,236 @@
+package git
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	. "gopkg.in/check.v1"
+)
+
+type NotesSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&NotesSuite{})
+
+func (s *NotesSuite) TestAddNote(c *C) {
+	r, w := newMemoryWorktree(c)
+	head := commitFiles(c, w, "foo", map[string]string{"foo": "foo"})
+
+	_, err := r.Note("", head)
+	c.Assert(err, Equals, ErrNoteNotFound)
+
+	h, err := r.AddNote(&AddNoteOptions{Message: "foo", Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	ref, err := r.Reference(DefaultNotesRef, false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, h)
+
+	commit, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	c.Assert(commit.Message, Equals, "Notes added by 'git notes add'\n")
+
+	note, err := r.Note("", head)
+	c.Assert(err, IsNil)
+	c.Assert(note.Object, Equals, head)
+	c.Assert(note.Message, Equals, "foo\n")
+
+	_, err = r.AddNote(&AddNoteOptions{Object: head, Message: "bar", Author: defaultSignature()})
+	c.Assert(err, Equals, ErrNoteExists)
+
+	_, err = r.AddNote(&AddNoteOptions{Message: "bar", Force: true, Author: defaultSignature()})
+	c.Assert(err, IsNil)
+	_, err = r.AddNote(&AddNoteOptions{Message: "qux", Append: true, Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	note, err = r.Note(DefaultNotesRef, head)
+	c.Assert(err, IsNil)
+	c.Assert(note.Message, Equals, "bar\n\nqux\n")
+
+	_, err = r.AddNote(&AddNoteOptions{Author: defaultSignature()})
+	c.Assert(err, Equals, ErrMissingMessage)
+}
+
+func (s *NotesSuite) TestAddNoteRef(c *C) {
+	r, w := newMemoryWorktree(c)
+	head := commitFiles(c, w, "foo", map[string]string{"foo": "foo"})
+
+	_, err := r.AddNote(&AddNoteOptions{Ref: "review", Message: "foo", Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Raw.Section("core").SetOption("notesRef", "refs/notes/review")
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	note, err := r.Note("", head)
+	c.Assert(err, IsNil)
+	c.Assert(note.Message, Equals, "foo\n")
+
+	_, err = r.Note(DefaultNotesRef, head)
+	c.Assert(err, Equals, ErrNoteNotFound)
+}
+
+func (s *NotesSuite) TestRemoveNote(c *C) {
+	r, w := newMemoryWorktree(c)
+	first := commitFiles(c, w, "foo", map[string]string{"foo": "foo"})
+	second := commitFiles(c, w, "bar", map[string]string{"foo": "bar"})
+
+	for _, h := range []plumbing.Hash{first, second} {
+		_, err := r.AddNote(&AddNoteOptions{Object: h, Message: h.String(), Author: defaultSignature()})
+		c.Assert(err, IsNil)
+	}
+
+	h, err := r.RemoveNote(&RemoveNoteOptions{Object: first, Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	c.Assert(commit.Message, Equals, "Notes removed by 'git notes remove'\n")
+
+	_, err = r.Note("", first)
+	c.Assert(err, Equals, ErrNoteNotFound)
+	_, err = r.Note("", second)
+	c.Assert(err, IsNil)
+
+	_, err = r.RemoveNote(&RemoveNoteOptions{Object: first, Author: defaultSignature()})
+	c.Assert(err, Equals, ErrNoteNotFound)
+
+	h, err = r.RemoveNote(&RemoveNoteOptions{Object: first, IgnoreMissing: true, Author: defaultSignature()})
+	c.Assert(err, IsNil)
+	c.Assert(h.IsZero(), Equals, true)
+}
+
+func (s *NotesSuite) TestCopyNotes(c *C) {
+	r, w := newMemoryWorktree(c)
+	first := commitFiles(c, w, "foo", map[string]string{"foo": "foo"})
+	second := commitFiles(c, w, "bar", map[string]string{"foo": "bar"})
+
+	_, err := r.CopyNotes(&CopyNotesOptions{From: first, Author: defaultSignature()})
+	c.Assert(err, Equals, ErrNoteNotFound)
+
+	_, err = r.AddNote(&AddNoteOptions{Object: first, Message: "foo", Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	_, err = r.CopyNotes(&CopyNotesOptions{From: first, Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	note, err := r.Note("", second)
+	c.Assert(err, IsNil)
+	c.Assert(note.Message, Equals, "foo\n")
+
+	_, err = r.CopyNotes(&CopyNotesOptions{From: first, To: second, Author: defaultSignature()})
+	c.Assert(err, Equals, ErrNoteExists)
+
+	_, err = r.CopyNotes(&CopyNotesOptions{To: second, Author: defaultSignature()})
+	c.Assert(err, Equals, ErrMissingNoteObject)
+}
+
+func (s *NotesSuite) TestNotesFanout(c *C) {
+	r, w := newMemoryWorktree(c)
+	head := commitFiles(c, w, "foo", map[string]string{"foo": "foo"})
+
+	blob, err := r.writeBlob([]byte("foo\n"))
+	c.Assert(err, IsNil)
+
+	// a notes tree fanned out by git, with a file which isn't a note
+	name := head.String()
+	fanned := name[:2] + "/" + name[2:4] + "/" + name[4:]
+	tree, err := r.buildEntriesTree(map[string]*MergeEntry{
+		fanned:   {Mode: filemode.Regular, Hash: blob},
+		"README": {Mode: filemode.Regular, Hash: blob},
+	})
+	c.Assert(err, IsNil)
+
+	commit := &object.Commit{
+		Author:    *defaultSignature(),
+		Committer: *defaultSignature(),
+		Message:   "foo\n",
+		TreeHash:  tree,
+	}
+
+	obj := r.Storer.NewEncodedObject()
+	c.Assert(commit.Encode(obj), IsNil)
+	h, err := r.Storer.SetEncodedObject(obj)
+	c.Assert(err, IsNil)
+	c.Assert(r.Storer.SetReference(plumbing.NewHashReference(DefaultNotesRef, h)), IsNil)
+
+	note, err := r.Note("", head)
+	c.Assert(err, IsNil)
+	c.Assert(note.Message, Equals, "foo\n")
+
+	// the notes are written with the fan-out of their number
+	other := plumbing.NewHash("1111111111111111111111111111111111111111")
+	h, err = r.AddNote(&AddNoteOptions{Object: other, Message: "bar", Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	commit, err = r.CommitObject(h)
+	c.Assert(err, IsNil)
+	notesTree, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	var names []string
+	for _, e := range notesTree.Entries {
+		names = append(names, e.Name)
+	}
+	c.Assert(names, DeepEquals, []string{other.String(), name, "README"})
+
+	c.Assert(notesFanout(256), Equals, 0)
+	c.Assert(notesFanout(257), Equals, 1)
+	c.Assert(notesFanout(256*256), Equals, 1)
+	c.Assert(notesFanout(256*257+1), Equals, 2)
+	c.Assert(notePath(other, 2), Equals, "11/11/"+other.String()[4:])
+}
+
+func (s *NotesSuite) TestLogNotes(c *C) {
+	r, w := newMemoryWorktree(c)
+	first := commitFiles(c, w, "foo\n", map[string]string{"foo": "foo"})
+	commitFiles(c, w, "bar\n", map[string]string{"foo": "bar"})
+
+	_, err := r.AddNote(&AddNoteOptions{Object: first, Message: "foo\n\nbar", Author: defaultSignature()})
+	c.Assert(err, IsNil)
+	_, err = r.AddNote(&AddNoteOptions{Ref: "review", Object: first, Message: "qux", Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	var shown []string
+	iter, err := r.Log(&LogOptions{
+		Notes: []plumbing.ReferenceName{"", "review", "missing"},
+		NotesFunc: func(c *object.Commit, notes []*Note) error {
+			msg := c.Message
+			for _, n := range notes {
+				msg += n.String()
+			}
+
+			shown = append(shown, msg)
+			return nil
+		},
+	})
+	c.Assert(err, IsNil)
+
+	var msgs []string
+	err = iter.ForEach(func(commit *object.Commit) error {
+		msgs = append(msgs, commit.Message)
+		return nil
+	})
+	c.Assert(err, IsNil)
+
+	c.Assert(msgs, DeepEquals, []string{"bar\n", "foo\n"})
+	c.Assert(shown, DeepEquals, []string{
+		"bar\n",
+		"foo\n\nNotes:\n    foo\n\n    bar\n\nNotes (review):\n    qux\n",
+	})
+
+	var refs []plumbing.ReferenceName
+	iter, err = r.Log(&LogOptions{NotesFunc: func(c *object.Commit, notes []*Note) error {
+		for _, n := range notes {
+			refs = append(refs, n.Ref)
+		}
+
+		return nil
+	}})
+	c.Assert(err, IsNil)
+	c.Assert(iter.ForEach(func(*object.Commit) error { return nil }), IsNil)
+	c.Assert(refs, DeepEquals, []plumbing.ReferenceName{DefaultNotesRef})
+}
@@ -3,6 +3,7 @@ package git
 import (
 	"errors"
 	"fmt"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
@@ -10,9 +11,11 @@ import (
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/archive"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp/sideband"
 	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/utils/merge"
 )
 
 // SubmoduleRescursivity defines how depth will affect any submodule recursive
@@ -30,7 +33,8 @@ const (
 )
 
 var (
-	ErrMissingURL = errors.New("URL field is required")
+	ErrMissingURL      = errors.New("URL field is required")
+	ErrInvalidPullMode = errors.New("invalid pull mode")
 )
 
 // CloneOptions describes how a clone should be performed.
@@ -115,8 +119,39 @@ type PullOptions struct {
 	InsecureSkipTLS bool
 	// CABundle specify additional ca bundle with system cert pool
 	CABundle []byte
+	// Mode defines how the fetched branch is incorporated into the current
+	// branch when they diverged. By default it is read from the repository
+	// configuration.
+	Mode PullMode
+	// StrategyOption used to resolve the conflicting hunks while merging or
+	// rebasing.
+	StrategyOption MergeStrategyOption
+	// Author of the merge commit, or committer of the rebased commits. If
+	// empty it is read from the config, as it happens with CommitOptions.
+	Author *object.Signature
+	// Committer of the merge commit or the rebased commits, if empty Author
+	// is used.
+	Committer *object.Signature
 }
 
+// PullMode defines how Pull incorporates the fetched changes.
+type PullMode int
+
+const (
+	// DefaultPull reads the mode from the branch.<name>.rebase, pull.rebase
+	// and pull.ff options of the repository config. If none of them is set,
+	// only fast-forwards are allowed.
+	DefaultPull PullMode = iota
+	// FastForwardOnlyPull fails with ErrNonFastForwardUpdate if the current
+	// branch can't be fast-forwarded to the fetched branch.
+	FastForwardOnlyPull
+	// MergePull merges the fetched branch into the current branch, creating
+	// a merge commit when a fast-forward isn't possible.
+	MergePull
+	// RebasePull replays the local commits on top of the fetched branch.
+	RebasePull
+)
+
 // Validate validates the fields and sets the default values.
 func (o *PullOptions) Validate() error {
 	if o.RemoteName == "" {
@@ -127,6 +162,14 @@ func (o *PullOptions) Validate() error {
 		o.ReferenceName = plumbing.HEAD
 	}
 
+	if o.Mode < DefaultPull || o.Mode > RebasePull {
+		return ErrInvalidPullMode
+	}
+
+	if o.StrategyOption < DefaultStrategyOption || o.StrategyOption > TheirsStrategyOption {
+		return ErrInvalidStrategyOption
+	}
+
 	return nil
 }
 
@@ -234,6 +277,12 @@ type PushOptions struct {
 	Options map[string]string
 	// Atomic sets option to be an atomic push
 	Atomic bool
+	// NoVerify skips the pre-push hook, the equivalent to
+	// `git push --no-verify`.
+	NoVerify bool
+	// Hooks are in-process hooks, run in place of the executable hooks with
+	// the same names.
+	Hooks Hooks
 }
 
 // ForceWithLease sets fields on the lease
@@ -308,8 +357,13 @@ type CheckoutOptions struct {
 	// target branch. Force and Keep are mutually exclusive, should not be both
 	// set to true.
 	Keep bool
-	// SparseCheckoutDirectories
+	// SparseCheckoutDirectories, if set, only the files inside the given
+	// directories are checked out. The directories aren't persisted, use
+	// Worktree.SparseCheckoutSet to keep them across checkouts.
 	SparseCheckoutDirectories []string
+	// Hooks are in-process hooks, run in place of the executable hooks with
+	// the same names.
+	Hooks Hooks
 }
 
 // Validate validates the fields and sets the default values.
@@ -416,6 +470,12 @@ type LogOptions struct {
 	// If set on true, the From option will be ignored.
 	All bool
 
+	// Range limits the log to the commits reachable from the commits the
+	// range includes but not from the ones it excludes, as returned by
+	// Repository.ResolveRange. It is equivalent to running
+	// `git log <rev1>..<rev2>`. If set, the From and All options are ignored.
+	Range *RevisionRange
+
 	// Show commits more recent than a specific date.
 	// It is equivalent to running `git log --since <date>` or `git log --after <date>`.
 	Since *time.Time
@@ -423,6 +483,52 @@ type LogOptions struct {
 	// Show commits older than a specific date.
 	// It is equivalent to running `git log --until <date>` or `git log --before <date>`.
 	Until *time.Time
+
+	// UseMailmap maps the authors and committers of the commits to their
+	// canonical names and emails, using the mailmap of the repository.
+	// It is equivalent to running `git log --use-mailmap`.
+	UseMailmap bool
+
+	// Notes are the notes references whose notes are passed to NotesFunc,
+	// the default notes reference if empty, as is an empty name, see
+	// AddNoteOptions.Ref.
+	// It is equivalent to running `git log --notes=<ref>`.
+	Notes []plumbing.ReferenceName
+
+	// NotesFunc, if not nil, is called with each commit returned and its
+	// notes in the Notes references, in their order, as git log shows them
+	// alongside the commits. The commits are left unchanged, Note.String
+	// formats a note the way git log does.
+	NotesFunc func(c *object.Commit, notes []*Note) error
+}
+
+// LineRange is a range of lines of a file, from Start to End, both included
+// and counted from 1. An End of zero is the last line of the file.
+type LineRange struct {
+	Start int
+	End   int
+}
+
+// BlameOptions describes how a blame operation should be performed.
+type BlameOptions struct {
+	// UseMailmap maps the authors of the lines to their canonical names and
+	// emails, using the mailmap of the repository.
+	UseMailmap bool
+	// LineRanges limits the blame to the given ranges of lines, by default
+	// every line is blamed. It is equivalent to running `git blame -L`.
+	LineRanges []LineRange
+	// IgnoreRevs are the commits whose changes are ignored, the lines they
+	// changed are blamed to the commits which changed them before, guessing
+	// the line each one comes from. It is equivalent to running `git blame
+	// --ignore-rev`.
+	IgnoreRevs []plumbing.Hash
+	// DetectMoves blames the lines moved within the file to the commits
+	// which wrote them, the equivalent to `git blame -M`.
+	DetectMoves bool
+	// DetectCopies blames the lines moved or copied from the other files
+	// changed by the same commit to the commits which wrote them, the
+	// equivalent to `git blame -C`.
+	DetectCopies bool
 }
 
 var (
@@ -453,6 +559,25 @@ func (o *AddOptions) Validate(r *Repository) error {
 	return nil
 }
 
+// CleanupMode defines how the message of a commit is cleaned up.
+type CleanupMode int8
+
+const (
+	// CleanupVerbatim doesn't change the message at all. This is the
+	// default mode.
+	CleanupVerbatim CleanupMode = iota
+	// CleanupWhitespace strips the leading and trailing empty lines, the
+	// trailing whitespace of every line and collapses consecutive empty
+	// lines.
+	CleanupWhitespace
+	// CleanupStrip is the same as CleanupWhitespace, but also strips the
+	// lines starting with the comment character, core.commentChar or '#'.
+	CleanupStrip
+	// CleanupScissors is the same as CleanupWhitespace, but everything from
+	// the scissors line on is truncated.
+	CleanupScissors
+)
+
 // CommitOptions describes how a commit operation should be performed.
 type CommitOptions struct {
 	// All automatically stage files that have been modified and deleted, but
@@ -469,16 +594,57 @@ type CommitOptions struct {
 	// nil the Author signature is used.
 	Committer *object.Signature
 	// Parents are the parents commits for the new commit, by default when
-	// len(Parents) is zero, the hash of HEAD reference is used.
+	// len(Parents) is zero, the hash of HEAD reference is used, followed by
+	// the hash of MERGE_HEAD if a merge is in progress.
 	Parents []plumbing.Hash
 	// SignKey denotes a key to sign the commit with. A nil value here means the
 	// commit will not be signed. The private key must be present and already
 	// decrypted.
 	SignKey *openpgp.Entity
+	// NoVerify skips the pre-commit and commit-msg hooks, the equivalent to
+	// `git commit --no-verify`.
+	NoVerify bool
+	// Hooks are in-process hooks, run in place of the executable hooks with
+	// the same names.
+	Hooks Hooks
+	// Amend replaces the commit of HEAD instead of creating a child of it,
+	// the equivalent to `git commit --amend`. The new commit keeps the
+	// parents of HEAD, and its author unless Author is given. When msg is
+	// empty, the message of HEAD is used.
+	Amend bool
+	// Fixup creates a commit to be squashed into the given commit by an
+	// autosquash rebase, its message being "fixup! " followed by the subject
+	// of the given commit. It is the equivalent to `git commit --fixup`.
+	Fixup plumbing.Hash
+	// Squash is the same as Fixup, but the message is "squash! " followed by
+	// the subject of the given commit, and msg after a blank line. It is the
+	// equivalent to `git commit --squash`.
+	Squash plumbing.Hash
+	// Cleanup defines how the message is cleaned up before committing it,
+	// the equivalent to `git commit --cleanup`. By default the message is
+	// committed as it is.
+	Cleanup CleanupMode
 }
 
 // Validate validates the fields and sets the default values.
 func (o *CommitOptions) Validate(r *Repository) error {
+	exclusive := 0
+	for _, set := range []bool{o.Amend, !o.Fixup.IsZero(), !o.Squash.IsZero()} {
+		if set {
+			exclusive++
+		}
+	}
+
+	if exclusive > 1 {
+		return fmt.Errorf("fields Amend, Fixup and Squash are mutual exclusive")
+	}
+
+	if o.Amend {
+		if err := o.loadAmendedCommit(r); err != nil {
+			return err
+		}
+	}
+
 	if o.Author == nil {
 		if err := o.loadConfigAuthorAndCommitter(r); err != nil {
 			return err
@@ -489,7 +655,7 @@ func (o *CommitOptions) Validate(r *Repository) error {
 		o.Committer = o.Author
 	}
 
-	if len(o.Parents) == 0 {
+	if len(o.Parents) == 0 && !o.Amend {
 		head, err := r.Head()
 		if err != nil && err != plumbing.ErrReferenceNotFound {
 			return err
@@ -498,8 +664,56 @@ func (o *CommitOptions) Validate(r *Repository) error {
 		if head != nil {
 			o.Parents = []plumbing.Hash{head.Hash()}
 		}
+
+		// concluding a merge in progress
+		mergeHead, err := r.Storer.Reference(plumbing.MergeHead)
+		if err != nil && err != plumbing.ErrReferenceNotFound {
+			return err
+		}
+
+		if mergeHead != nil {
+			o.Parents = append(o.Parents, mergeHead.Hash())
+		}
+	}
+
+	return nil
+}
+
+// loadAmendedCommit sets the parents and the author of the commit of HEAD.
+// The committer is read from the config, as it is when not amending.
+func (o *CommitOptions) loadAmendedCommit(r *Repository) error {
+	head, err := r.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		return ErrNothingToAmend
+	}
+
+	if err != nil {
+		return err
+	}
+
+	commit, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+
+	if len(o.Parents) == 0 {
+		o.Parents = append([]plumbing.Hash(nil), commit.ParentHashes...)
+	}
+
+	if o.Author != nil {
+		return nil
+	}
+
+	if err := o.loadConfigAuthorAndCommitter(r); err != nil {
+		return err
+	}
+
+	if o.Committer == nil {
+		o.Committer = o.Author
 	}
 
+	author := commit.Author
+	o.Author = &author
 	return nil
 }
 
@@ -672,3 +886,902 @@ type PlainOpenOptions struct {
 
 // Validate validates the fields and sets the default values.
 func (o *PlainOpenOptions) Validate() error { return nil }
+
+// MergeStrategyOption defines how the conflicting hunks of a file are
+// resolved during a merge, like the `-X` option of `git merge`.
+type MergeStrategyOption int8
+
+const (
+	// DefaultStrategyOption reports the conflicting hunks as conflicts.
+	DefaultStrategyOption MergeStrategyOption = iota
+	// OursStrategyOption resolves the conflicting hunks using our side, it
+	// is the equivalent to `git merge -X ours`.
+	OursStrategyOption
+	// TheirsStrategyOption resolves the conflicting hunks using their side,
+	// it is the equivalent to `git merge -X theirs`.
+	TheirsStrategyOption
+)
+
+func (o MergeStrategyOption) favor() merge.Favor {
+	switch o {
+	case OursStrategyOption:
+		return merge.FavorOurs
+	case TheirsStrategyOption:
+		return merge.FavorTheirs
+	}
+
+	return merge.FavorNone
+}
+
+var (
+	ErrInvalidStrategyOption = errors.New("invalid merge strategy option")
+)
+
+// MergeTreesOptions describes how a three-way tree merge should be performed.
+type MergeTreesOptions struct {
+	// OursLabel is the label of our side used in the conflict markers, by
+	// default `ours`.
+	OursLabel string
+	// TheirsLabel is the label of their side used in the conflict markers,
+	// by default `theirs`.
+	TheirsLabel string
+	// BaseLabel is the label of the ancestor used in the conflict markers
+	// when ConflictStyle is merge.Diff3Style, by default `base`.
+	BaseLabel string
+	// StrategyOption defines how the conflicting hunks are resolved, by
+	// default they are reported as conflicts.
+	StrategyOption MergeStrategyOption
+	// ConflictStyle defines how the conflicting hunks are written.
+	ConflictStyle merge.ConflictStyle
+	// NoRenames disables the rename detection between the ancestor and each
+	// side.
+	NoRenames bool
+}
+
+// Validate validates the fields and sets the default values.
+func (o *MergeTreesOptions) Validate() error {
+	if o.StrategyOption < DefaultStrategyOption || o.StrategyOption > TheirsStrategyOption {
+		return ErrInvalidStrategyOption
+	}
+
+	if o.OursLabel == "" {
+		o.OursLabel = merge.DefaultOursLabel
+	}
+
+	if o.TheirsLabel == "" {
+		o.TheirsLabel = merge.DefaultTheirsLabel
+	}
+
+	if o.BaseLabel == "" {
+		o.BaseLabel = merge.DefaultBaseLabel
+	}
+
+	return nil
+}
+
+var (
+	ErrFastForwardExclusive = errors.New("NoFastForward and FastForwardOnly are mutually exclusive")
+	ErrSquashNoFastForward  = errors.New("Squash and NoFastForward are mutually exclusive")
+	ErrMissingMergeSource   = errors.New("Commit or Reference is required")
+)
+
+// MergeOptions describes how a merge should be performed.
+type MergeOptions struct {
+	// Commit is the hash of the commit to be merged into HEAD. Commit and
+	// Reference are mutually exclusive.
+	Commit plumbing.Hash
+	// Reference is the name of the reference (e.g. a branch) to be merged
+	// into HEAD. Commit and Reference are mutually exclusive.
+	Reference plumbing.ReferenceName
+	// Message is the message of the merge commit, by default a message like
+	// `Merge branch 'feature'` is generated.
+	Message string
+	// NoFastForward creates a merge commit even when the merge resolves as
+	// a fast-forward, it is the equivalent to `git merge --no-ff`.
+	NoFastForward bool
+	// FastForwardOnly refuses to merge unless the merge resolves as a
+	// fast-forward, it is the equivalent to `git merge --ff-only`.
+	FastForwardOnly bool
+	// Squash updates the index and the worktree as a real merge would, but
+	// doesn't create a merge commit nor records MERGE_HEAD, so the next
+	// Worktree.Commit creates a regular commit. It is the equivalent to
+	// `git merge --squash`.
+	Squash bool
+	// Abort aborts the merge in progress, restoring the index and the
+	// worktree to HEAD. All the other fields are ignored.
+	Abort bool
+	// StrategyOption defines how the conflicting hunks are resolved, by
+	// default they are reported as conflicts.
+	StrategyOption MergeStrategyOption
+	// AllowUnrelatedHistories allows merging commits without a common
+	// ancestor.
+	AllowUnrelatedHistories bool
+	// Author is the author's signature of the merge commit. If Author is
+	// empty the Name and Email is read from the config, and time.Now it's
+	// used as When.
+	Author *object.Signature
+	// Committer is the committer's signature of the merge commit. If
+	// Committer is nil the Author signature is used.
+	Committer *object.Signature
+	// NoVerify skips the pre-merge-commit and commit-msg hooks, the
+	// equivalent to `git merge --no-verify`.
+	NoVerify bool
+	// Hooks are in-process hooks, run in place of the executable hooks with
+	// the same names.
+	Hooks Hooks
+}
+
+// Validate validates the fields and sets the default values.
+func (o *MergeOptions) Validate() error {
+	if o.Abort {
+		return nil
+	}
+
+	if o.NoFastForward && o.FastForwardOnly {
+		return ErrFastForwardExclusive
+	}
+
+	if o.Squash && o.NoFastForward {
+		return ErrSquashNoFastForward
+	}
+
+	if !o.Commit.IsZero() && o.Reference != "" {
+		return ErrHashOrReference
+	}
+
+	if o.Commit.IsZero() && o.Reference == "" {
+		return ErrMissingMergeSource
+	}
+
+	if o.StrategyOption < DefaultStrategyOption || o.StrategyOption > TheirsStrategyOption {
+		return ErrInvalidStrategyOption
+	}
+
+	return nil
+}
+
+var (
+	ErrResumeActionExclusive = errors.New("only one of Continue, Skip and Abort can be used")
+	ErrMissingUpstream       = errors.New("Upstream is required")
+	ErrInvalidRebaseTodo     = errors.New("invalid rebase todo entry")
+	// ErrRebaseTodoNoPrevious is returned when a squash or fixup entry of
+	// the todo list isn't preceded by any commit picked by the rebase.
+	ErrRebaseTodoNoPrevious = errors.New("cannot squash or fixup without a previous commit")
+)
+
+// RebaseAction is the action performed by an entry of the todo list of a
+// rebase.
+type RebaseAction int
+
+const (
+	// PickRebaseAction replays the commit.
+	PickRebaseAction RebaseAction = iota
+	// RewordRebaseAction replays the commit, replacing its message with the
+	// one of the RebaseTodo.
+	RewordRebaseAction
+	// SquashRebaseAction melds the commit into the previous one, joining
+	// both messages unless the RebaseTodo has its own message.
+	SquashRebaseAction
+	// FixupRebaseAction melds the commit into the previous one, keeping the
+	// message of the previous one.
+	FixupRebaseAction
+	// DropRebaseAction removes the commit.
+	DropRebaseAction
+	// ExecRebaseAction calls RebaseOptions.Exec with the command of the
+	// RebaseTodo.
+	ExecRebaseAction
+)
+
+var (
+	rebaseActionNames      = []string{"pick", "reword", "squash", "fixup", "drop", "exec"}
+	rebaseActionShortNames = []string{"p", "r", "s", "f", "d", "x"}
+)
+
+func (a RebaseAction) String() string {
+	if a < PickRebaseAction || a > ExecRebaseAction {
+		return ""
+	}
+
+	return rebaseActionNames[a]
+}
+
+// RebaseTodo is an entry of the todo list of a rebase, the equivalent to a
+// line of the file edited during `git rebase --interactive`.
+type RebaseTodo struct {
+	// Action to perform.
+	Action RebaseAction
+	// Commit the action is applied to, it is ignored by ExecRebaseAction.
+	Commit plumbing.Hash
+	// Message replaces the message of the resulting commit, it is used by
+	// RewordRebaseAction, SquashRebaseAction and FixupRebaseAction.
+	Message string
+	// Command given to RebaseOptions.Exec by ExecRebaseAction.
+	Command string
+}
+
+// String returns the entry as a line of the todo list, e.g. `pick 8ab686e...`.
+func (t RebaseTodo) String() string {
+	if t.Action == ExecRebaseAction {
+		return fmt.Sprintf("%s %s", t.Action, t.Command)
+	}
+
+	return fmt.Sprintf("%s %s", t.Action, t.Commit)
+}
+
+// Validate validates the fields of the entry.
+func (t *RebaseTodo) Validate() error {
+	if t.Action < PickRebaseAction || t.Action > ExecRebaseAction {
+		return ErrInvalidRebaseTodo
+	}
+
+	if t.Action == ExecRebaseAction {
+		if t.Command == "" || strings.Contains(t.Command, "\n") {
+			return ErrInvalidRebaseTodo
+		}
+
+		return nil
+	}
+
+	if t.Commit.IsZero() {
+		return ErrInvalidRebaseTodo
+	}
+
+	return nil
+}
+
+// checkRebaseTodoPrevious checks that every squash and fixup entry of todo
+// comes after a pick or a reword one, picked tells if a commit was already
+// picked before the first entry.
+func checkRebaseTodoPrevious(todo []RebaseTodo, picked bool) error {
+	for _, t := range todo {
+		switch t.Action {
+		case PickRebaseAction, RewordRebaseAction:
+			picked = true
+		case SquashRebaseAction, FixupRebaseAction:
+			if !picked {
+				return ErrRebaseTodoNoPrevious
+			}
+		}
+	}
+
+	return nil
+}
+
+// RebaseOptions describes how a rebase should be performed.
+type RebaseOptions struct {
+	// Upstream is the commit used to compute the commits to be replayed,
+	// the ones reachable from HEAD but not from Upstream.
+	Upstream plumbing.Hash
+	// Onto is the commit on top of which the commits are replayed, by
+	// default Upstream. It is the equivalent to `git rebase --onto`.
+	Onto plumbing.Hash
+	// Todo is the list of actions to be performed, by default every commit
+	// to be replayed is picked. The default list can be obtained with
+	// Worktree.RebaseTodo, edited and given back, as `git rebase -i` does.
+	Todo []RebaseTodo
+	// Autosquash moves the commits whose subject starts with "fixup! " or
+	// "squash! " right after the commit they refer to, changing its action
+	// accordingly. It only applies to the default todo list.
+	Autosquash bool
+	// Exec is called by every ExecRebaseAction entry with its command. If it
+	// returns an error the rebase stops, returning the error, and it can be
+	// resumed with Continue.
+	Exec func(w *Worktree, command string) error
+	// StrategyOption defines how the conflicting hunks are resolved, by
+	// default they are reported as conflicts.
+	StrategyOption MergeStrategyOption
+	// Committer is the committer's signature of the replayed commits, the
+	// authors are preserved. If empty the Name and Email is read from the
+	// config, and time.Now it's used as When.
+	Committer *object.Signature
+	// Continue resumes a stopped rebase, committing the content of the
+	// index if it stopped because of conflicts. Exec, StrategyOption and
+	// Committer apply to the rest of the rebase, other fields are ignored.
+	Continue bool
+	// Skip resumes a rebase stopped because of conflicts, dropping the
+	// commit that couldn't be applied.
+	Skip bool
+	// Abort aborts the rebase in progress, restoring the original branch.
+	Abort bool
+}
+
+// Validate validates the fields and sets the default values.
+func (o *RebaseOptions) Validate() error {
+	var n int
+	for _, set := range []bool{o.Continue, o.Skip, o.Abort} {
+		if set {
+			n++
+		}
+	}
+
+	if n > 1 {
+		return ErrResumeActionExclusive
+	}
+
+	if n == 0 {
+		if o.Upstream.IsZero() {
+			return ErrMissingUpstream
+		}
+
+		if o.Onto.IsZero() {
+			o.Onto = o.Upstream
+		}
+
+		for i := range o.Todo {
+			if err := o.Todo[i].Validate(); err != nil {
+				return err
+			}
+		}
+
+		if err := checkRebaseTodoPrevious(o.Todo, false); err != nil {
+			return err
+		}
+	}
+
+	if o.StrategyOption < DefaultStrategyOption || o.StrategyOption > TheirsStrategyOption {
+		return ErrInvalidStrategyOption
+	}
+
+	return nil
+}
+
+var (
+	ErrMissingCommits  = errors.New("at least one commit is required")
+	ErrInvalidMainline = errors.New("mainline must be a positive parent number")
+)
+
+// CherryPickOptions describes how a cherry-pick should be performed.
+type CherryPickOptions struct {
+	// Commits to be applied on top of HEAD, in order.
+	Commits []plumbing.Hash
+	// Mainline is the number, starting from 1, of the parent used as base
+	// when a merge commit is cherry-picked. It is required to cherry-pick
+	// merge commits, and not allowed otherwise.
+	Mainline int
+	// StrategyOption defines how the conflicting hunks are resolved, by
+	// default they are reported as conflicts.
+	StrategyOption MergeStrategyOption
+	// Committer is the committer's signature of the new commits, the authors
+	// are preserved. If empty the Name and Email is read from the config,
+	// and time.Now it's used as When.
+	Committer *object.Signature
+	// KeepRedundantCommits commits as empty commits the commits whose
+	// changes are already in HEAD, instead of stopping at them. It is the
+	// equivalent to `git cherry-pick --keep-redundant-commits`.
+	KeepRedundantCommits bool
+	// Continue resumes a cherry-pick stopped because of conflicts, committing
+	// the content of the index, and applies the rest of the commits.
+	Continue bool
+	// Skip resumes a cherry-pick stopped because of conflicts, dropping the
+	// commit that couldn't be applied.
+	Skip bool
+	// Abort aborts the cherry-pick in progress, restoring HEAD, the index
+	// and the worktree to the state previous to it.
+	Abort bool
+}
+
+// Validate validates the fields and sets the default values.
+func (o *CherryPickOptions) Validate() error {
+	return validateSequencerOptions(o.Commits, o.Mainline, o.StrategyOption, o.Continue, o.Skip, o.Abort)
+}
+
+// RevertOptions describes how a revert should be performed.
+type RevertOptions struct {
+	// Commits to be reverted, in order.
+	Commits []plumbing.Hash
+	// Mainline is the number, starting from 1, of the parent the merge
+	// commits are reverted to. It is required to revert merge commits, and
+	// not allowed otherwise.
+	Mainline int
+	// StrategyOption defines how the conflicting hunks are resolved, by
+	// default they are reported as conflicts.
+	StrategyOption MergeStrategyOption
+	// Author is the author's signature of the new commits. If empty the Name
+	// and Email is read from the config, and time.Now it's used as When.
+	Author *object.Signature
+	// Committer is the committer's signature of the new commits. If nil the
+	// Author signature is used.
+	Committer *object.Signature
+	// Continue resumes a revert stopped because of conflicts, committing the
+	// content of the index, and reverts the rest of the commits.
+	Continue bool
+	// Skip resumes a revert stopped because of conflicts, dropping the
+	// commit that couldn't be reverted.
+	Skip bool
+	// Abort aborts the revert in progress, restoring HEAD, the index and the
+	// worktree to the state previous to it.
+	Abort bool
+}
+
+// Validate validates the fields and sets the default values.
+func (o *RevertOptions) Validate() error {
+	return validateSequencerOptions(o.Commits, o.Mainline, o.StrategyOption, o.Continue, o.Skip, o.Abort)
+}
+
+func validateSequencerOptions(commits []plumbing.Hash, mainline int, strategy MergeStrategyOption, cont, skip, abort bool) error {
+	var n int
+	for _, set := range []bool{cont, skip, abort} {
+		if set {
+			n++
+		}
+	}
+
+	if n > 1 {
+		return ErrResumeActionExclusive
+	}
+
+	if n == 0 && len(commits) == 0 {
+		return ErrMissingCommits
+	}
+
+	if mainline < 0 {
+		return ErrInvalidMainline
+	}
+
+	if strategy < DefaultStrategyOption || strategy > TheirsStrategyOption {
+		return ErrInvalidStrategyOption
+	}
+
+	return nil
+}
+
+var (
+	ErrInvalidStashIndex = errors.New("stash index must not be negative")
+)
+
+// StashOptions describes how the local changes should be stashed.
+type StashOptions struct {
+	// Message is the description of the stash, by default it is made of
+	// the branch name and the subject of the HEAD commit.
+	Message string
+	// IncludeUntracked also stashes the untracked files, removing them from
+	// the worktree. Ignored files are not stashed.
+	IncludeUntracked bool
+	// KeepIndex keeps the changes already added to the index, in the index
+	// and in the worktree.
+	KeepIndex bool
+	// Paths limits the stash to the files matching the given pathspecs,
+	// paths or directories relative to the root of the worktree which may
+	// contain glob patterns. The rest of the changes are kept.
+	Paths []string
+	// Committer is the author and committer's signature of the stash
+	// commits. If empty the Name and Email is read from the config, and
+	// time.Now it's used as When.
+	Committer *object.Signature
+}
+
+// Validate validates the fields and sets the default values.
+func (o *StashOptions) Validate() error {
+	for _, p := range o.Paths {
+		if filepath.IsAbs(p) {
+			return fmt.Errorf("pathspec %q is outside the worktree", p)
+		}
+	}
+
+	return nil
+}
+
+// StashApplyOptions describes how a stash should be applied.
+type StashApplyOptions struct {
+	// Stash is the position of the stash in the list returned by
+	// Worktree.StashList, being 0 the most recent one.
+	Stash int
+	// Index also restores the changes that were added to the index when the
+	// stash was created, by default only the worktree is updated.
+	Index bool
+}
+
+// Validate validates the fields and sets the default values.
+func (o *StashApplyOptions) Validate() error {
+	if o.Stash < 0 {
+		return ErrInvalidStashIndex
+	}
+
+	return nil
+}
+
+var (
+	ErrWorktreeDetachedBranch = errors.New("Branch and Detach are mutually exclusive")
+	ErrWorktreeInvalidBranch  = errors.New("Branch must be a branch reference, refs/heads/<name>")
+)
+
+// AddWorktreeOptions describes how a linked worktree should be added.
+type AddWorktreeOptions struct {
+	// Name is the name of the worktree, used for its directory inside
+	// .git/worktrees. By default the base name of the path is used.
+	Name string
+	// Branch is the branch to check out in the worktree. If empty, and
+	// Detach is false, a branch named after the base name of the path is
+	// checked out, being created at Commit if it doesn't exist.
+	Branch plumbing.ReferenceName
+	// Create creates Branch at Commit, it fails if the branch already
+	// exists.
+	Create bool
+	// Commit is the commit to create the branch at, or to detach HEAD at,
+	// by default the HEAD of the repository.
+	Commit plumbing.Hash
+	// Detach checks out Commit with a detached HEAD.
+	Detach bool
+	// Force allows to check out a branch already checked out in another
+	// worktree.
+	Force bool
+	// Lock locks the worktree once added, see Repository.LockWorktree.
+	Lock bool
+	// LockReason is the reason of the lock, if Lock is true.
+	LockReason string
+}
+
+// Validate validates the fields and sets the default values.
+func (o *AddWorktreeOptions) Validate() error {
+	if o.Branch != "" && o.Detach {
+		return ErrWorktreeDetachedBranch
+	}
+
+	if o.Create && o.Branch == "" {
+		return ErrCreateRequiresBranch
+	}
+
+	if o.Branch != "" && !o.Branch.IsBranch() {
+		return ErrWorktreeInvalidBranch
+	}
+
+	return nil
+}
+
+// RemoveWorktreeOptions describes how a linked worktree should be removed.
+type RemoveWorktreeOptions struct {
+	// Force removes the worktree even if it has local changes, untracked
+	// files, or if it's locked.
+	Force bool
+}
+
+// Validate validates the fields and sets the default values.
+func (o *RemoveWorktreeOptions) Validate() error { return nil }
+
+var (
+	ErrSparseCheckoutConePattern = errors.New("cone mode patterns must be directories")
+)
+
+// SparseCheckoutOptions describes how a sparse checkout should be
+// initialized.
+type SparseCheckoutOptions struct {
+	// NoCone reads the patterns as gitignore-like patterns instead of as a
+	// list of directories, as done in cone mode.
+	NoCone bool
+	// Patterns are the directories, or the patterns if NoCone is true, to be
+	// checked out. If empty the existing sparse-checkout file is kept or, if
+	// it doesn't exist, only the files at the root of the worktree are
+	// checked out.
+	Patterns []string
+}
+
+// Validate validates the fields and sets the default values.
+func (o *SparseCheckoutOptions) Validate() error {
+	if o.NoCone {
+		return nil
+	}
+
+	return validateConePatterns(o.Patterns)
+}
+
+func validateConePatterns(patterns []string) error {
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "!") || strings.ContainsAny(p, "*?[\\") {
+			return ErrSparseCheckoutConePattern
+		}
+	}
+
+	return nil
+}
+
+var (
+	ErrMissingRestorePaths = errors.New("at least one path is required")
+)
+
+// RestoreOptions describes how a restore operation should be performed.
+type RestoreOptions struct {
+	// Source is the tree-ish the paths are restored from. By default the
+	// worktree is restored from the index, and the index from HEAD.
+	Source plumbing.Revision
+	// Staged restores the paths of the index.
+	Staged bool
+	// Worktree restores the paths of the worktree. If neither Staged nor
+	// Worktree are set, only the worktree is restored.
+	Worktree bool
+	// Paths are the pathspecs of the paths to restore, each one being a
+	// path, a directory or a glob pattern. The paths matched by the
+	// pathspecs but missing in Source are removed.
+	Paths []string
+}
+
+// Validate validates the fields and sets the default values.
+func (o *RestoreOptions) Validate() error {
+	if len(o.Paths) == 0 {
+		return ErrMissingRestorePaths
+	}
+
+	if !o.Staged && !o.Worktree {
+		o.Worktree = true
+	}
+
+	return nil
+}
+
+// UntrackedFiles defines how the untracked files are reported by a status.
+type UntrackedFiles int8
+
+const (
+	// AllUntrackedFiles reports every untracked file, even the ones inside
+	// untracked directories. This is the default.
+	AllUntrackedFiles UntrackedFiles = iota
+	// NormalUntrackedFiles reports the untracked files, the directories
+	// without any tracked file are reported as a single entry ending with a
+	// slash.
+	NormalUntrackedFiles
+	// NoUntrackedFiles doesn't report the untracked files, the untracked
+	// directories of the worktree are not walked.
+	NoUntrackedFiles
+)
+
+// StatusOptions describes how a status should be computed.
+type StatusOptions struct {
+	// Untracked defines how the untracked files are reported, by default
+	// every untracked file is reported.
+	Untracked UntrackedFiles
+	// Ignored reports the ignored files with the Ignored status code. They
+	// are reported as the untracked files, so they are not reported if
+	// Untracked is NoUntrackedFiles.
+	Ignored bool
+	// Paths limits the status to the files matching the given pathspecs,
+	// each one being a path, a directory or a glob pattern. Only the
+	// directories that can contain matching files are walked.
+	Paths []string
+	// Renames detects the renames between HEAD and the index, reported with
+	// the Renamed status code, the key being the new name and Extra the
+	// previous one.
+	Renames bool
+}
+
+// DiffOptions describes how a diff of the worktree should be performed.
+type DiffOptions struct {
+	// Cached compares the index with Source instead of the worktree, as
+	// git diff --cached does. Source defaults to HEAD.
+	Cached bool
+	// Source is the tree-ish compared with the worktree or, if Cached is
+	// set, with the index. By default the worktree is compared with the
+	// index.
+	Source plumbing.Revision
+	// Paths limits the diff to the files matching the given pathspecs, each
+	// one being a path, a directory or a glob pattern.
+	Paths []string
+}
+
+const (
+	defaultDescribeCandidates = 10
+	maxDescribeCandidates     = 63
+	defaultDescribeAbbrev     = 7
+	defaultDirtyMark          = "-dirty"
+)
+
+// DescribeOptions describes how a describe operation should be performed.
+type DescribeOptions struct {
+	// Commit is the commit to describe, by default the commit of HEAD.
+	Commit plumbing.Hash
+	// Tags uses the lightweight tags too, not only the annotated ones. It is
+	// equivalent to running `git describe --tags`.
+	Tags bool
+	// Match only uses the tags matching any of the given glob patterns, the
+	// equivalent to `git describe --match`.
+	Match []string
+	// Exclude doesn't use the tags matching any of the given glob patterns,
+	// the equivalent to `git describe --exclude`.
+	Exclude []string
+	// Candidates is the number of the tags found walking the history from
+	// the commit which are considered to describe it, 10 by default and 63
+	// at most. It is equivalent to running `git describe --candidates`, a
+	// negative value being the equivalent to --candidates=0: no tag is
+	// considered and only a tagged commit is described, as with ExactMatch.
+	Candidates int
+	// ExactMatch only describes the commit if it is tagged, the equivalent
+	// to `git describe --exact-match`.
+	ExactMatch bool
+	// Long always uses the long format, even when the commit is tagged. It
+	// is equivalent to running `git describe --long`.
+	Long bool
+	// Abbrev is the length of the abbreviated hash of the commit, 7 by
+	// default.
+	Abbrev int
+	// Always describes the commit with its abbreviated hash when no tag can
+	// describe it, the equivalent to `git describe --always`.
+	Always bool
+	// Dirty appends DirtyMark to the description if the worktree has
+	// changes, as given by Worktree.Status. Only HEAD can be described with
+	// Dirty set. It is equivalent to running `git describe --dirty`.
+	Dirty bool
+	// DirtyMark is the suffix appended to the description when the worktree
+	// is dirty, "-dirty" by default.
+	DirtyMark string
+}
+
+// Validate validates the fields and sets the default values.
+func (o *DescribeOptions) Validate(r *Repository) error {
+	if o.Dirty && !o.Commit.IsZero() {
+		return fmt.Errorf("fields Dirty and Commit are mutual exclusive")
+	}
+
+	if o.Candidates == 0 {
+		o.Candidates = defaultDescribeCandidates
+	}
+
+	if o.Candidates > maxDescribeCandidates {
+		o.Candidates = maxDescribeCandidates
+	}
+
+	if o.Abbrev <= 0 {
+		o.Abbrev = defaultDescribeAbbrev
+	}
+
+	if o.DirtyMark == "" {
+		o.DirtyMark = defaultDirtyMark
+	}
+
+	return nil
+}
+
+// ArchiveOptions describes how an archive of a tree should be created.
+type ArchiveOptions struct {
+	// Format is the format of the archive, archive.Tar by default.
+	Format archive.Format
+	// Revision is the tree-ish archived, HEAD by default. When it is a
+	// commit, the modification time of the files is the committer time and
+	// the commit hash is recorded in the archive, otherwise the current
+	// time is used.
+	Revision plumbing.Revision
+	// Prefix is prepended to the paths of the files in the archive, such as
+	// "project/".
+	Prefix string
+	// Paths limits the archive to the files matching the given pathspecs,
+	// each one being a path, a directory or a glob pattern.
+	Paths []string
+}
+
+// Validate validates the fields and sets the default values.
+func (o *ArchiveOptions) Validate() error {
+	if o.Format == "" {
+		o.Format = archive.Tar
+	}
+
+	if o.Revision == "" {
+		o.Revision = plumbing.Revision(plumbing.HEAD)
+	}
+
+	return nil
+}
+
+var (
+	ErrMissingNoteObject = errors.New("note object field is required")
+)
+
+// AddNoteOptions describes how a note should be added to an object.
+type AddNoteOptions struct {
+	// Ref is the notes reference the note is added to, the one of the
+	// core.notesRef config or refs/notes/commits by default. Names not
+	// starting with refs/ are taken as relative to refs/notes/.
+	Ref plumbing.ReferenceName
+	// Object is the object annotated, the commit of HEAD by default.
+	Object plumbing.Hash
+	// Message is the message of the note. It is canonicalized during
+	// validation, as it is for tags.
+	Message string
+	// Force replaces the note of the object, if any, otherwise
+	// ErrNoteExists is returned.
+	Force bool
+	// Append appends the message to the note of the object, if any, as
+	// git notes append does.
+	Append bool
+	// Author and Committer are the signatures of the commit of the notes
+	// reference, read from the config by default, as they are for commits.
+	Author    *object.Signature
+	Committer *object.Signature
+}
+
+// Validate validates the fields and sets the default values.
+func (o *AddNoteOptions) Validate(r *Repository) error {
+	if o.Force && o.Append {
+		return fmt.Errorf("fields Force and Append are mutual exclusive")
+	}
+
+	if o.Message == "" {
+		return ErrMissingMessage
+	}
+
+	o.Message = strings.TrimSpace(o.Message) + "\n"
+	return validateNoteOptions(r, &o.Ref, &o.Object, &o.Author, &o.Committer)
+}
+
+// RemoveNoteOptions describes how a note should be removed from an object.
+type RemoveNoteOptions struct {
+	// Ref is the notes reference the note is removed from, see
+	// AddNoteOptions.Ref.
+	Ref plumbing.ReferenceName
+	// Object is the object whose note is removed, the commit of HEAD by
+	// default.
+	Object plumbing.Hash
+	// IgnoreMissing doesn't return ErrNoteNotFound if the object has no
+	// note.
+	IgnoreMissing bool
+	// Author and Committer are the signatures of the commit of the notes
+	// reference, see AddNoteOptions.
+	Author    *object.Signature
+	Committer *object.Signature
+}
+
+// Validate validates the fields and sets the default values.
+func (o *RemoveNoteOptions) Validate(r *Repository) error {
+	return validateNoteOptions(r, &o.Ref, &o.Object, &o.Author, &o.Committer)
+}
+
+// CopyNotesOptions describes how the note of an object should be copied to
+// another one.
+type CopyNotesOptions struct {
+	// Ref is the notes reference of the notes, see AddNoteOptions.Ref.
+	Ref plumbing.ReferenceName
+	// From is the object whose note is copied.
+	From plumbing.Hash
+	// To is the object the note is copied to, the commit of HEAD by
+	// default.
+	To plumbing.Hash
+	// Force replaces the note of To, if any, otherwise ErrNoteExists is
+	// returned.
+	Force bool
+	// Author and Committer are the signatures of the commit of the notes
+	// reference, see AddNoteOptions.
+	Author    *object.Signature
+	Committer *object.Signature
+}
+
+// Validate validates the fields and sets the default values.
+func (o *CopyNotesOptions) Validate(r *Repository) error {
+	if o.From.IsZero() {
+		return ErrMissingNoteObject
+	}
+
+	return validateNoteOptions(r, &o.Ref, &o.To, &o.Author, &o.Committer)
+}
+
+// validateNoteOptions sets the default notes reference, object and
+// signatures of the note operations.
+func validateNoteOptions(r *Repository, ref *plumbing.ReferenceName, obj *plumbing.Hash, author, committer **object.Signature) error {
+	name, err := r.notesReference(*ref)
+	if err != nil {
+		return err
+	}
+
+	*ref = name
+	if obj.IsZero() {
+		head, err := r.Head()
+		if err == plumbing.ErrReferenceNotFound {
+			return ErrMissingNoteObject
+		}
+
+		if err != nil {
+			return err
+		}
+
+		*obj = head.Hash()
+	}
+
+	co := &CommitOptions{Author: *author, Committer: *committer}
+	if co.Author == nil {
+		if err := co.loadConfigAuthorAndCommitter(r); err != nil {
+			return err
+		}
+	}
+
+	if co.Committer == nil {
+		co.Committer = co.Author
+	}
+
+	*author, *committer = co.Author, co.Committer
+	return nil
+}
@@ -0,0 +1,222 @@
+// Package archive implements the encoding of the trees of a repository as
+// tar and zip archives, the same way `git archive` does.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+)
+
+var (
+	// ErrUnknownFormat is returned creating an Encoder for an unsupported
+	// format.
+	ErrUnknownFormat = errors.New("unknown archive format")
+	// ErrUnsupportedMode is returned encoding a file with a mode which
+	// can't be archived.
+	ErrUnsupportedMode = errors.New("unsupported file mode")
+)
+
+// Format is the format of an archive.
+type Format string
+
+const (
+	// Tar is the tar format, with the pax extensions as needed.
+	Tar Format = "tar"
+	// TarGz is the tar format compressed with gzip.
+	TarGz Format = "tar.gz"
+	// Zip is the zip format.
+	Zip Format = "zip"
+)
+
+// The modes of the files of the archives, as git writes them with the
+// default tar.umask of 0002.
+const (
+	dirMode        = 0775
+	regularMode    = 0664
+	executableMode = 0775
+	symlinkMode    = 0777
+)
+
+// File is a file written to an archive.
+type File struct {
+	// Name is the path of the file in the archive, using slashes as
+	// separators, without a trailing slash for directories.
+	Name string
+	// Mode is the mode of the file. Directories and submodules are written
+	// as directories, while the content of symlinks is their target.
+	Mode filemode.FileMode
+	// ModTime is the modification time of the file.
+	ModTime time.Time
+	// Size is the size of the content of the file.
+	Size int64
+	// Content is the content of the file, nil for directories.
+	Content io.Reader
+}
+
+// Encoder writes the files of an archive.
+type Encoder struct {
+	gz  *gzip.Writer
+	tar *tar.Writer
+	zip *zip.Writer
+}
+
+// NewEncoder returns a new Encoder writing an archive in the given format
+// to w. The archive is completed when the Encoder is closed.
+func NewEncoder(w io.Writer, format Format) (*Encoder, error) {
+	e := &Encoder{}
+	switch format {
+	case Tar:
+		e.tar = tar.NewWriter(w)
+	case TarGz:
+		e.gz = gzip.NewWriter(w)
+		e.tar = tar.NewWriter(e.gz)
+	case Zip:
+		e.zip = zip.NewWriter(w)
+	default:
+		return nil, ErrUnknownFormat
+	}
+
+	return e, nil
+}
+
+// SetCommitID records the hash of the commit archived, as a comment in the
+// pax global header of tar archives or as the comment of zip archives. It
+// must be called before encoding any file.
+func (e *Encoder) SetCommitID(h plumbing.Hash) error {
+	if e.zip != nil {
+		return e.zip.SetComment(h.String())
+	}
+
+	return e.tar.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeXGlobalHeader,
+		Name:       "pax_global_header",
+		PAXRecords: map[string]string{"comment": h.String()},
+	})
+}
+
+// Encode writes the given file to the archive.
+func (e *Encoder) Encode(f *File) error {
+	mode, err := fileMode(f.Mode)
+	if err != nil {
+		return err
+	}
+
+	name := f.Name
+	if mode.IsDir() {
+		name += "/"
+	}
+
+	if e.zip != nil {
+		return e.encodeZip(f, name, mode)
+	}
+
+	return e.encodeTar(f, name, mode)
+}
+
+// fileMode returns the mode of the archived file with the given mode.
+func fileMode(m filemode.FileMode) (os.FileMode, error) {
+	switch m {
+	case filemode.Dir, filemode.Submodule:
+		return os.ModeDir | dirMode, nil
+	case filemode.Regular, filemode.Deprecated:
+		return regularMode, nil
+	case filemode.Executable:
+		return executableMode, nil
+	case filemode.Symlink:
+		return os.ModeSymlink | symlinkMode, nil
+	}
+
+	return 0, ErrUnsupportedMode
+}
+
+func (e *Encoder) encodeTar(f *File, name string, mode os.FileMode) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    int64(mode.Perm()),
+		ModTime: f.ModTime,
+		Uname:   "root",
+		Gname:   "root",
+	}
+
+	switch {
+	case mode.IsDir():
+		hdr.Typeflag = tar.TypeDir
+	case mode&os.ModeSymlink != 0:
+		target, err := readTarget(f)
+		if err != nil {
+			return err
+		}
+
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = target
+	default:
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = f.Size
+	}
+
+	if err := e.tar.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	if hdr.Typeflag != tar.TypeReg {
+		return nil
+	}
+
+	_, err := io.Copy(e.tar, f.Content)
+	return err
+}
+
+func (e *Encoder) encodeZip(f *File, name string, mode os.FileMode) error {
+	hdr := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: f.ModTime,
+	}
+
+	hdr.SetMode(mode)
+	if mode.IsDir() {
+		hdr.Method = zip.Store
+	}
+
+	w, err := e.zip.CreateHeader(hdr)
+	if err != nil || mode.IsDir() {
+		return err
+	}
+
+	_, err = io.Copy(w, f.Content)
+	return err
+}
+
+func readTarget(f *File) (string, error) {
+	target := make([]byte, f.Size)
+	if _, err := io.ReadFull(f.Content, target); err != nil {
+		return "", err
+	}
+
+	return string(target), nil
+}
+
+// Close completes the archive, without closing the underlying writer.
+func (e *Encoder) Close() error {
+	if e.zip != nil {
+		return e.zip.Close()
+	}
+
+	if err := e.tar.Close(); err != nil {
+		return err
+	}
+
+	if e.gz != nil {
+		return e.gz.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type EncoderSuite struct{}
+
+var _ = Suite(&EncoderSuite{})
+
+var (
+	commitID = plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	modTime  = time.Date(2017, 5, 4, 0, 3, 43, 0, time.UTC)
+)
+
+// encode encodes an archive of the given format with a file of each mode.
+func (s *EncoderSuite) encode(c *C, format Format) []byte {
+	var buf bytes.Buffer
+	e, err := NewEncoder(&buf, format)
+	c.Assert(err, IsNil)
+	c.Assert(e.SetCommitID(commitID), IsNil)
+
+	for _, f := range []struct {
+		name    string
+		mode    filemode.FileMode
+		content string
+	}{
+		{"dir", filemode.Dir, ""},
+		{"dir/foo", filemode.Regular, "foo"},
+		{"run", filemode.Executable, "#!/bin/sh"},
+		{"link", filemode.Symlink, "dir/foo"},
+		{"sub", filemode.Submodule, ""},
+	} {
+		err := e.Encode(&File{
+			Name:    f.name,
+			Mode:    f.mode,
+			ModTime: modTime,
+			Size:    int64(len(f.content)),
+			Content: strings.NewReader(f.content),
+		})
+		c.Assert(err, IsNil)
+	}
+
+	c.Assert(e.Close(), IsNil)
+	return buf.Bytes()
+}
+
+func (s *EncoderSuite) TestTar(c *C) {
+	s.testTar(c, bytes.NewReader(s.encode(c, Tar)))
+}
+
+func (s *EncoderSuite) TestTarGz(c *C) {
+	r, err := gzip.NewReader(bytes.NewReader(s.encode(c, TarGz)))
+	c.Assert(err, IsNil)
+	s.testTar(c, r)
+}
+
+func (s *EncoderSuite) testTar(c *C, r io.Reader) {
+	tr := tar.NewReader(r)
+
+	hdr, err := tr.Next()
+	c.Assert(err, IsNil)
+	c.Assert(hdr.Typeflag, Equals, byte(tar.TypeXGlobalHeader))
+	c.Assert(hdr.PAXRecords["comment"], Equals, commitID.String())
+
+	for _, expected := range []struct {
+		name     string
+		typeflag byte
+		mode     int64
+		content  string
+	}{
+		{"dir/", tar.TypeDir, 0775, ""},
+		{"dir/foo", tar.TypeReg, 0664, "foo"},
+		{"run", tar.TypeReg, 0775, "#!/bin/sh"},
+		{"link", tar.TypeSymlink, 0777, ""},
+		{"sub/", tar.TypeDir, 0775, ""},
+	} {
+		hdr, err := tr.Next()
+		c.Assert(err, IsNil)
+		c.Assert(hdr.Name, Equals, expected.name)
+		c.Assert(hdr.Typeflag, Equals, expected.typeflag)
+		c.Assert(hdr.Mode, Equals, expected.mode)
+		c.Assert(hdr.ModTime.Equal(modTime), Equals, true)
+
+		content, err := ioutil.ReadAll(tr)
+		c.Assert(err, IsNil)
+		c.Assert(string(content), Equals, expected.content)
+
+		if hdr.Typeflag == tar.TypeSymlink {
+			c.Assert(hdr.Linkname, Equals, "dir/foo")
+		}
+	}
+
+	_, err = tr.Next()
+	c.Assert(err, Equals, io.EOF)
+}
+
+func (s *EncoderSuite) TestZip(c *C) {
+	content := s.encode(c, Zip)
+	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	c.Assert(err, IsNil)
+	c.Assert(zr.Comment, Equals, commitID.String())
+	c.Assert(zr.File, HasLen, 5)
+
+	for i, expected := range []struct {
+		name    string
+		mode    os.FileMode
+		content string
+	}{
+		{"dir/", os.ModeDir | 0775, ""},
+		{"dir/foo", 0664, "foo"},
+		{"run", 0775, "#!/bin/sh"},
+		{"link", os.ModeSymlink | 0777, "dir/foo"},
+		{"sub/", os.ModeDir | 0775, ""},
+	} {
+		f := zr.File[i]
+		c.Assert(f.Name, Equals, expected.name)
+		c.Assert(f.Mode(), Equals, expected.mode)
+		c.Assert(f.Modified.Equal(modTime), Equals, true)
+
+		r, err := f.Open()
+		c.Assert(err, IsNil)
+		content, err := ioutil.ReadAll(r)
+		c.Assert(err, IsNil)
+		c.Assert(r.Close(), IsNil)
+		c.Assert(string(content), Equals, expected.content)
+	}
+}
+
+func (s *EncoderSuite) TestErrors(c *C) {
+	_, err := NewEncoder(ioutil.Discard, "rar")
+	c.Assert(err, Equals, ErrUnknownFormat)
+
+	e, err := NewEncoder(ioutil.Discard, Tar)
+	c.Assert(err, IsNil)
+	err = e.Encode(&File{Name: "foo", Mode: filemode.Empty})
+	c.Assert(err, Equals, ErrUnsupportedMode)
+}
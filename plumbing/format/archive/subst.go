@@ -0,0 +1,176 @@
+package archive
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const (
+	substPrefix = "$Format:"
+	substSuffix = "$"
+	abbrevLen   = 7
+
+	defaultDate = "Mon Jan 2 15:04:05 2006 -0700"
+	rfc2822Date = "Mon, 2 Jan 2006 15:04:05 -0700"
+	isoDate     = "2006-01-02 15:04:05 -0700"
+)
+
+// Substitute expands the $Format:<format>$ placeholders of the content of a
+// file with the export-subst gitattribute, <format> being a pretty format
+// of `git log` describing the given commit.
+//
+// The hashes (%H, %h, %T, %t, %P, %p), the authors and committers (%an,
+// %ae, %ad, %aD, %ai, %aI, %at and the same with c), the message (%s, %b,
+// %B), %n and %% are supported, the other placeholders are kept as they are.
+func Substitute(content []byte, c *object.Commit) []byte {
+	var buf bytes.Buffer
+	for {
+		start := bytes.Index(content, []byte(substPrefix))
+		if start == -1 {
+			break
+		}
+
+		end := bytes.Index(content[start+len(substPrefix):], []byte(substSuffix))
+		if end == -1 {
+			break
+		}
+
+		end += start + len(substPrefix)
+		buf.Write(content[:start])
+		buf.WriteString(format(string(content[start+len(substPrefix):end]), c))
+		content = content[end+len(substSuffix):]
+	}
+
+	buf.Write(content)
+	return buf.Bytes()
+}
+
+// format expands the placeholders of a pretty format describing the commit.
+func format(f string, c *object.Commit) string {
+	var buf strings.Builder
+	for len(f) != 0 {
+		i := strings.IndexByte(f, '%')
+		if i == -1 {
+			buf.WriteString(f)
+			break
+		}
+
+		buf.WriteString(f[:i])
+		f = f[i:]
+
+		n, value := placeholder(f, c)
+		if n == 0 {
+			buf.WriteByte('%')
+			f = f[1:]
+			continue
+		}
+
+		buf.WriteString(value)
+		f = f[n:]
+	}
+
+	return buf.String()
+}
+
+// placeholder expands the placeholder at the start of f, returning its
+// length, zero if it isn't supported.
+func placeholder(f string, c *object.Commit) (int, string) {
+	if len(f) < 2 {
+		return 0, ""
+	}
+
+	switch f[1] {
+	case '%':
+		return 2, "%"
+	case 'n':
+		return 2, "\n"
+	case 'H':
+		return 2, c.Hash.String()
+	case 'h':
+		return 2, abbrev(c.Hash)
+	case 'T':
+		return 2, c.TreeHash.String()
+	case 't':
+		return 2, abbrev(c.TreeHash)
+	case 'P', 'p':
+		parents := make([]string, len(c.ParentHashes))
+		for i, h := range c.ParentHashes {
+			parents[i] = h.String()
+			if f[1] == 'p' {
+				parents[i] = abbrev(h)
+			}
+		}
+
+		return 2, strings.Join(parents, " ")
+	case 's':
+		subject, _ := splitMessage(c.Message)
+		return 2, subject
+	case 'b':
+		_, body := splitMessage(c.Message)
+		return 2, body
+	case 'B':
+		return 2, c.Message
+	case 'a', 'c':
+		if len(f) < 3 {
+			return 0, ""
+		}
+
+		sig := c.Author
+		if f[1] == 'c' {
+			sig = c.Committer
+		}
+
+		if value, ok := signature(f[2], sig); ok {
+			return 3, value
+		}
+	}
+
+	return 0, ""
+}
+
+func signature(field byte, sig object.Signature) (string, bool) {
+	switch field {
+	case 'n':
+		return sig.Name, true
+	case 'e':
+		return sig.Email, true
+	case 'd':
+		return sig.When.Format(defaultDate), true
+	case 'D':
+		return sig.When.Format(rfc2822Date), true
+	case 'i':
+		return sig.When.Format(isoDate), true
+	case 'I':
+		return sig.When.Format(time.RFC3339), true
+	case 't':
+		return strconv.FormatInt(sig.When.Unix(), 10), true
+	}
+
+	return "", false
+}
+
+func abbrev(h plumbing.Hash) string {
+	return h.String()[:abbrevLen]
+}
+
+// splitMessage splits a commit message in its subject, the lines of the
+// first paragraph joined by spaces, and its body.
+func splitMessage(msg string) (subject, body string) {
+	paragraphs := strings.SplitN(strings.TrimLeft(msg, "\n"), "\n\n", 2)
+	lines := strings.Split(strings.TrimSpace(paragraphs[0]), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSpace(l)
+	}
+
+	subject = strings.Join(lines, " ")
+	if len(paragraphs) == 2 {
+		body = strings.TrimLeft(paragraphs[1], "\n")
+	}
+
+	return subject, body
+}
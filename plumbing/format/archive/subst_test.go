@@ -0,0 +1,43 @@
+package archive
+
+import (
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	. "gopkg.in/check.v1"
+)
+
+type SubstituteSuite struct{}
+
+var _ = Suite(&SubstituteSuite{})
+
+func (s *SubstituteSuite) TestSubstitute(c *C) {
+	when := time.Date(2017, 5, 4, 0, 3, 43, 0, time.FixedZone("", 2*60*60))
+	commit := &object.Commit{
+		Hash:         commitID,
+		TreeHash:     plumbing.NewHash("a8d315b2b1c615d43042c3a62402b8a54288cf5c"),
+		ParentHashes: []plumbing.Hash{plumbing.NewHash("35e85108805c84807bc66a02d91535e1e24b38b9")},
+		Author:       object.Signature{Name: "foo", Email: "foo@foo.foo", When: when},
+		Committer:    object.Signature{Name: "bar", Email: "bar@bar.bar", When: when},
+		Message:      "subject\nline\n\nbody\n",
+	}
+
+	for _, t := range []struct {
+		content  string
+		expected string
+	}{
+		{"no placeholders", "no placeholders"},
+		{"$Format:%H$", commitID.String()},
+		{"v $Format:%h$ ($Format:%t %p$)", "v 6ecf0ef (a8d315b 35e8510)"},
+		{"$Format:%an <%ae>%n%cn <%ce>$", "foo <foo@foo.foo>\nbar <bar@bar.bar>"},
+		{"$Format:%ad|%aD|%ai|%aI|%at$", "Thu May 4 00:03:43 2017 +0200|Thu, 4 May 2017 00:03:43 +0200|" +
+			"2017-05-04 00:03:43 +0200|2017-05-04T00:03:43+02:00|1493849023"},
+		{"$Format:%s%n%b$", "subject line\nbody\n"},
+		{"$Format:100%% %x %a$", "100% %x %a"},
+		{"$Format:%H", "$Format:%H"},
+	} {
+		c.Assert(string(Substitute([]byte(t.content), commit)), Equals, t.expected, Commentf("%q", t.content))
+	}
+}
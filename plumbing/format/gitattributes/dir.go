@@ -17,7 +17,7 @@ const (
 	systemFile        = "/etc/gitconfig"
 )
 
-func ReadAttributesFile(fs billy.Filesystem, path []string, attributesFile string, allowMacro bool) ([]MatchAttribute, error) {
+func ReadAttributesFile(fs billy.Filesystem, path []string, attributesFile string, allowMacro bool) (attributes []MatchAttribute, err error) {
 	f, err := fs.Open(fs.Join(append(path, attributesFile)...))
 	if os.IsNotExist(err) {
 		return nil, nil
@@ -25,6 +25,7 @@ func ReadAttributesFile(fs billy.Filesystem, path []string, attributesFile strin
 	if err != nil {
 		return nil, err
 	}
+	defer gioutil.CheckClose(f, &err)
 
 	return ReadAttributes(f, path, allowMacro)
 }
@@ -4,10 +4,12 @@ import (
 	"bufio"
 	"bytes"
 	"crypto"
+	encbin "encoding/binary"
 	"errors"
 	"io"
 	"io/ioutil"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/go-git/go-git/v5/plumbing"
@@ -25,8 +27,12 @@ var (
 	// ErrInvalidChecksum is returned by Decode if the SHA1 hash mismatch with
 	// the read content
 	ErrInvalidChecksum = errors.New("invalid checksum")
-
-	errUnknownExtension = errors.New("unknown extension")
+	// ErrMalformedExtension is returned by Decode when the content of an
+	// extension is malformed
+	ErrMalformedExtension = errors.New("malformed index extension")
+	// ErrUnsupportedExtension is returned by Decode when the index contains
+	// a mandatory extension not supported
+	ErrUnsupportedExtension = errors.New("unsupported index extension")
 )
 
 const (
@@ -36,6 +42,7 @@ const (
 	nameMask          = 0xfff
 	intentToAddMask   = 1 << 13
 	skipWorkTreeMask  = 1 << 14
+	hashLength        = 20
 )
 
 // A Decoder reads and decodes index files from an input stream.
@@ -51,7 +58,7 @@ type Decoder struct {
 func NewDecoder(r io.Reader) *Decoder {
 	h := hash.New(crypto.SHA1)
 	return &Decoder{
-		r:         io.TeeReader(r, h),
+		r:         r,
 		hash:      h,
 		extReader: bufio.NewReader(nil),
 	}
@@ -59,8 +66,23 @@ func NewDecoder(r io.Reader) *Decoder {
 
 // Decode reads the whole index object from its input and stores it in the
 // value pointed to by idx.
+//
+// When the index has the EndOfIndexEntry and the EntryOffsetTable
+// extensions, the blocks of entries are decoded in parallel.
 func (d *Decoder) Decode(idx *Index) error {
-	var err error
+	data, err := ioutil.ReadAll(d.r)
+	if err != nil {
+		return err
+	}
+
+	content, err := d.checksum(data)
+	if err != nil {
+		return err
+	}
+
+	r := bytes.NewReader(content)
+	d.r = r
+
 	idx.Version, err = validateHeader(d.r)
 	if err != nil {
 		return err
@@ -71,11 +93,57 @@ func (d *Decoder) Decode(idx *Index) error {
 		return err
 	}
 
-	if err := d.readEntries(idx, int(entryCount)); err != nil {
+	extensions := int64(-1)
+	if offset, ok := findEndOfIndexEntries(content); ok {
+		table, err := findEntryOffsetTable(content[offset:])
+		if err != nil {
+			return err
+		}
+
+		if table != nil {
+			if err := d.readEntryBlocks(idx, content, table, int(entryCount)); err != nil {
+				return err
+			}
+
+			extensions = int64(offset)
+		}
+	}
+
+	if extensions < 0 {
+		if err := d.readEntries(idx, int(entryCount)); err != nil {
+			return err
+		}
+
+		extensions = r.Size() - int64(r.Len())
+	}
+
+	if err := d.readExtensions(idx, content[extensions:]); err != nil {
 		return err
 	}
 
-	return d.readExtensions(idx)
+	return nil
+}
+
+// checksum verifies the trailing checksum of the given data, returning the
+// data it covers. A zero checksum is not verified, as it's written when
+// index.skipHash is enabled.
+func (d *Decoder) checksum(data []byte) ([]byte, error) {
+	if len(data) < hashLength {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	content, checksum := data[:len(data)-hashLength], data[len(data)-hashLength:]
+	if bytes.Equal(checksum, plumbing.ZeroHash[:]) {
+		return content, nil
+	}
+
+	d.hash.Reset()
+	d.hash.Write(content)
+	if !bytes.Equal(d.hash.Sum(nil), checksum) {
+		return nil, ErrInvalidChecksum
+	}
+
+	return content, nil
 }
 
 func (d *Decoder) readEntries(idx *Index, count int) error {
@@ -206,104 +274,198 @@ func (d *Decoder) padEntry(idx *Index, e *Entry, read int) error {
 	return err
 }
 
-func (d *Decoder) readExtensions(idx *Index) error {
-	// TODO: support 'Split index' and 'Untracked cache' extensions, take in
-	// count that they are not supported by jgit or libgit
-
-	var expected []byte
-	var err error
+// readEntryBlocks reads in parallel the blocks of entries of the given
+// EntryOffsetTable.
+func (d *Decoder) readEntryBlocks(idx *Index, content []byte, t *EntryOffsetTable, count int) error {
+	blocks := make([]*Index, len(t.Blocks))
+	errs := make([]error, len(t.Blocks))
 
-	var header [4]byte
-	for {
-		expected = d.hash.Sum(nil)
+	for _, b := range t.Blocks {
+		if int(b.Offset) >= len(content) {
+			return ErrMalformedExtension
+		}
+	}
 
-		var n int
-		if n, err = io.ReadFull(d.r, header[:]); err != nil {
-			if n == 0 {
-				err = io.EOF
-			}
+	var wg sync.WaitGroup
+	for i, b := range t.Blocks {
+		blocks[i] = &Index{Version: idx.Version}
+		wg.Add(1)
+		go func(i int, b EntryOffsetBlock) {
+			defer wg.Done()
 
-			break
-		}
+			bd := &Decoder{r: bytes.NewReader(content[b.Offset:])}
+			errs[i] = bd.readEntries(blocks[i], int(b.Count))
+		}(i, b)
+	}
 
-		err = d.readExtension(idx, header[:])
+	wg.Wait()
+	for _, err := range errs {
 		if err != nil {
-			break
+			return err
 		}
 	}
 
-	if err != errUnknownExtension {
-		return err
+	for _, b := range blocks {
+		idx.Entries = append(idx.Entries, b.Entries...)
+	}
+
+	if len(idx.Entries) != count {
+		return ErrMalformedExtension
 	}
 
-	return d.readChecksum(expected, header)
+	return nil
 }
 
-func (d *Decoder) readExtension(idx *Index, header []byte) error {
-	switch {
-	case bytes.Equal(header, treeExtSignature):
-		r, err := d.getExtensionReader()
+func (d *Decoder) readExtensions(idx *Index, data []byte) error {
+	for len(data) > 0 {
+		header, payload, rest, err := splitExtension(data)
 		if err != nil {
 			return err
 		}
 
+		d.extReader.Reset(bytes.NewReader(payload))
+		if err := d.readExtension(idx, header, d.extReader); err != nil {
+			return err
+		}
+
+		data = rest
+	}
+
+	return nil
+}
+
+// splitExtension splits the first extension of the given data in its
+// signature and content, returning the rest of the data.
+func splitExtension(data []byte) (header, payload, rest []byte, err error) {
+	if len(data) < 8 {
+		return nil, nil, nil, ErrMalformedExtension
+	}
+
+	size := uint64(encbin.BigEndian.Uint32(data[4:8]))
+	if uint64(len(data)-8) < size {
+		return nil, nil, nil, ErrMalformedExtension
+	}
+
+	return data[:4], data[8 : 8+size], data[8+size:], nil
+}
+
+func (d *Decoder) readExtension(idx *Index, header []byte, r *bufio.Reader) error {
+	switch {
+	case bytes.Equal(header, treeExtSignature):
 		idx.Cache = &Tree{}
 		d := &treeExtensionDecoder{r}
 		if err := d.Decode(idx.Cache); err != nil {
 			return err
 		}
 	case bytes.Equal(header, resolveUndoExtSignature):
-		r, err := d.getExtensionReader()
-		if err != nil {
-			return err
-		}
-
 		idx.ResolveUndo = &ResolveUndo{}
 		d := &resolveUndoDecoder{r}
 		if err := d.Decode(idx.ResolveUndo); err != nil {
 			return err
 		}
-	case bytes.Equal(header, endOfIndexEntryExtSignature):
-		r, err := d.getExtensionReader()
-		if err != nil {
+	case bytes.Equal(header, untrackedCacheExtSignature):
+		idx.UntrackedCache = &UntrackedCache{}
+		d := &untrackedCacheDecoder{r}
+		if err := d.Decode(idx.UntrackedCache); err != nil {
 			return err
 		}
+	case bytes.Equal(header, fsMonitorExtSignature):
+		// the bitmap of a split index refers to the entries merged with the
+		// shared index, so its entries are left to be checked
+		entries := idx.Entries
+		if idx.SplitIndex != nil {
+			entries = nil
+		}
 
+		idx.FSMonitor = &FSMonitor{}
+		d := &fsMonitorDecoder{r}
+		if err := d.Decode(idx.FSMonitor, entries); err != nil {
+			return err
+		}
+	case bytes.Equal(header, entryOffsetTableExtSignature):
+		idx.EntryOffsetTable = &EntryOffsetTable{}
+		d := &entryOffsetTableDecoder{r}
+		if err := d.Decode(idx.EntryOffsetTable); err != nil {
+			return err
+		}
+	case bytes.Equal(header, splitIndexExtSignature):
+		idx.SplitIndex = &SplitIndex{}
+		d := &splitIndexDecoder{r}
+		if err := d.Decode(idx.SplitIndex); err != nil {
+			return err
+		}
+	case bytes.Equal(header, sparseDirectoriesExtSignature):
+		idx.Sparse = true
+	case bytes.Equal(header, endOfIndexEntryExtSignature):
 		idx.EndOfIndexEntry = &EndOfIndexEntry{}
 		d := &endOfIndexEntryDecoder{r}
 		if err := d.Decode(idx.EndOfIndexEntry); err != nil {
 			return err
 		}
 	default:
-		return errUnknownExtension
+		// extensions starting with an uppercase letter are optional
+		if header[0] < 'A' || header[0] > 'Z' {
+			return ErrUnsupportedExtension
+		}
 	}
 
 	return nil
 }
 
-func (d *Decoder) getExtensionReader() (*bufio.Reader, error) {
-	len, err := binary.ReadUint32(d.r)
-	if err != nil {
-		return nil, err
+// findEndOfIndexEntries returns the offset of the extensions recorded by
+// the EndOfIndexEntry extension, if it's found at the end of the given
+// content and its hash matches the extensions.
+func findEndOfIndexEntries(content []byte) (uint32, bool) {
+	const size = 4 + 4 + 4 + hashLength
+	if len(content) < size {
+		return 0, false
 	}
 
-	d.extReader.Reset(&io.LimitedReader{R: d.r, N: int64(len)})
-	return d.extReader, nil
-}
+	eoie := content[len(content)-size:]
+	if !bytes.Equal(eoie[:4], endOfIndexEntryExtSignature) ||
+		encbin.BigEndian.Uint32(eoie[4:8]) != size-8 {
+		return 0, false
+	}
 
-func (d *Decoder) readChecksum(expected []byte, alreadyRead [4]byte) error {
-	var h plumbing.Hash
-	copy(h[:4], alreadyRead[:])
+	offset := encbin.BigEndian.Uint32(eoie[8:12])
+	if offset > uint32(len(content)-size) {
+		return 0, false
+	}
 
-	if _, err := io.ReadFull(d.r, h[4:]); err != nil {
-		return err
+	h := hash.New(crypto.SHA1)
+	data := content[offset : len(content)-size]
+	for len(data) > 0 {
+		_, _, rest, err := splitExtension(data)
+		if err != nil {
+			return 0, false
+		}
+
+		h.Write(data[:8])
+		data = rest
 	}
 
-	if !bytes.Equal(h[:], expected) {
-		return ErrInvalidChecksum
+	return offset, bytes.Equal(h.Sum(nil), eoie[12:])
+}
+
+// findEntryOffsetTable returns the EntryOffsetTable of the given extensions,
+// nil if not found.
+func findEntryOffsetTable(data []byte) (*EntryOffsetTable, error) {
+	for len(data) > 0 {
+		header, payload, rest, err := splitExtension(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if bytes.Equal(header, entryOffsetTableExtSignature) {
+			t := &EntryOffsetTable{}
+			d := &entryOffsetTableDecoder{bufio.NewReader(bytes.NewReader(payload))}
+			return t, d.Decode(t)
+		}
+
+		data = rest
 	}
 
-	return nil
+	return nil, nil
 }
 
 func validateHeader(r io.Reader) (version uint32, err error) {
@@ -477,3 +639,283 @@ func (d *endOfIndexEntryDecoder) Decode(e *EndOfIndexEntry) error {
 	_, err = io.ReadFull(d.r, e.Hash[:])
 	return err
 }
+
+type untrackedCacheDecoder struct {
+	r *bufio.Reader
+}
+
+func (d *untrackedCacheDecoder) Decode(uc *UntrackedCache) error {
+	if err := d.readEnvironments(uc); err != nil {
+		return err
+	}
+
+	if err := d.readStats(&uc.InfoExcludeStats); err != nil {
+		return err
+	}
+
+	if err := d.readStats(&uc.ExcludesFileStats); err != nil {
+		return err
+	}
+
+	var err error
+	if uc.Flags, err = binary.ReadUint32(d.r); err != nil {
+		return err
+	}
+
+	if err := binary.Read(d.r, &uc.InfoExcludeHash, &uc.ExcludesFileHash); err != nil {
+		return err
+	}
+
+	name, err := binary.ReadUntil(d.r, '\x00')
+	if err != nil {
+		return err
+	}
+
+	uc.ExcludePerDir = string(name)
+
+	count, err := binary.ReadVariableWidthInt(d.r)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		if err := d.readDirectories(uc, count); err != nil {
+			return err
+		}
+	}
+
+	// the rest of the extension is padding
+	_, err = io.Copy(ioutil.Discard, d.r)
+	return err
+}
+
+func (d *untrackedCacheDecoder) readEnvironments(uc *UntrackedCache) error {
+	l, err := binary.ReadVariableWidthInt(d.r)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, l)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		return err
+	}
+
+	for _, env := range bytes.Split(buf, []byte{'\x00'}) {
+		if len(env) != 0 {
+			uc.Environments = append(uc.Environments, string(env))
+		}
+	}
+
+	return nil
+}
+
+func (d *untrackedCacheDecoder) readStats(s *UntrackedCacheStats) error {
+	var sec, nsec, msec, mnsec uint32
+	flow := []interface{}{
+		&sec, &nsec,
+		&msec, &mnsec,
+		&s.Dev,
+		&s.Inode,
+		&s.UID,
+		&s.GID,
+		&s.Size,
+	}
+
+	if err := binary.Read(d.r, flow...); err != nil {
+		return err
+	}
+
+	if sec != 0 || nsec != 0 {
+		s.CreatedAt = time.Unix(int64(sec), int64(nsec))
+	}
+
+	if msec != 0 || mnsec != 0 {
+		s.ModifiedAt = time.Unix(int64(msec), int64(mnsec))
+	}
+
+	return nil
+}
+
+// readDirectories reads the given number of directories, stored in
+// depth-first order, followed by the bitmaps of the valid, check only and
+// exclude hash flags, and the stats and hashes they refer to.
+func (d *untrackedCacheDecoder) readDirectories(uc *UntrackedCache, count int64) error {
+	var dirs []*UntrackedCacheDirectory
+	root, err := d.readDirectory(&dirs)
+	if err != nil {
+		return err
+	}
+
+	if int64(len(dirs)) != count {
+		return ErrMalformedExtension
+	}
+
+	uc.Root = root
+
+	var flags [3][]bool
+	for i := range flags {
+		if flags[i], err = readEWAH(d.r); err != nil {
+			return err
+		}
+	}
+
+	valid, checkOnly, hashValid := flags[0], flags[1], flags[2]
+	for i, dir := range dirs {
+		dir.CheckOnly = i < len(checkOnly) && checkOnly[i]
+		if i < len(valid) && valid[i] {
+			dir.Valid = true
+			if err := d.readStats(&dir.Stats); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, dir := range dirs {
+		if i < len(hashValid) && hashValid[i] {
+			if _, err := io.ReadFull(d.r, dir.ExcludeHash[:]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (d *untrackedCacheDecoder) readDirectory(dirs *[]*UntrackedCacheDirectory) (*UntrackedCacheDirectory, error) {
+	dir := &UntrackedCacheDirectory{}
+	*dirs = append(*dirs, dir)
+
+	untracked, err := binary.ReadVariableWidthInt(d.r)
+	if err != nil {
+		return nil, err
+	}
+
+	subdirs, err := binary.ReadVariableWidthInt(d.r)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := binary.ReadUntil(d.r, '\x00')
+	if err != nil {
+		return nil, err
+	}
+
+	dir.Name = string(name)
+	for i := int64(0); i < untracked; i++ {
+		name, err := binary.ReadUntil(d.r, '\x00')
+		if err != nil {
+			return nil, err
+		}
+
+		dir.Untracked = append(dir.Untracked, string(name))
+	}
+
+	for i := int64(0); i < subdirs; i++ {
+		sub, err := d.readDirectory(dirs)
+		if err != nil {
+			return nil, err
+		}
+
+		dir.Directories = append(dir.Directories, sub)
+	}
+
+	return dir, nil
+}
+
+type fsMonitorDecoder struct {
+	r *bufio.Reader
+}
+
+func (d *fsMonitorDecoder) Decode(m *FSMonitor, entries []*Entry) error {
+	var err error
+	m.Version, err = binary.ReadUint32(d.r)
+	if err != nil {
+		return err
+	}
+
+	switch m.Version {
+	case 1:
+		ts, err := binary.ReadUint64(d.r)
+		if err != nil {
+			return err
+		}
+
+		m.Token = strconv.FormatUint(ts, 10)
+	case 2:
+		token, err := binary.ReadUntil(d.r, '\x00')
+		if err != nil {
+			return err
+		}
+
+		m.Token = string(token)
+	default:
+		return ErrUnsupportedVersion
+	}
+
+	// size of the bitmap, in bytes
+	if _, err := binary.ReadUint32(d.r); err != nil {
+		return err
+	}
+
+	dirty, err := readEWAH(d.r)
+	if err != nil {
+		return err
+	}
+
+	for i, e := range entries {
+		e.FSMonitorValid = i >= len(dirty) || !dirty[i]
+	}
+
+	return nil
+}
+
+type entryOffsetTableDecoder struct {
+	r *bufio.Reader
+}
+
+func (d *entryOffsetTableDecoder) Decode(t *EntryOffsetTable) error {
+	version, err := binary.ReadUint32(d.r)
+	if err != nil {
+		return err
+	}
+
+	if version != 1 {
+		return ErrUnsupportedVersion
+	}
+
+	for {
+		var b EntryOffsetBlock
+		if err := binary.Read(d.r, &b.Offset, &b.Count); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+
+		t.Blocks = append(t.Blocks, b)
+	}
+}
+
+type splitIndexDecoder struct {
+	r *bufio.Reader
+}
+
+func (d *splitIndexDecoder) Decode(s *SplitIndex) error {
+	if _, err := io.ReadFull(d.r, s.BaseHash[:]); err != nil {
+		return err
+	}
+
+	// the bitmaps are omitted if there are no changes
+	if _, err := d.r.Peek(1); err == io.EOF {
+		return nil
+	}
+
+	var err error
+	if s.Delete, err = readEWAH(d.r); err != nil {
+		return err
+	}
+
+	s.Replace, err = readEWAH(d.r)
+	return err
+}
@@ -1,10 +1,12 @@
 package index
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/utils/binary"
 
 	fixtures "github.com/go-git/go-git-fixtures/v4"
 	. "gopkg.in/check.v1"
@@ -218,3 +220,45 @@ func (s *IndexSuite) TestDecodeEndOfIndexEntry(c *C) {
 	c.Assert(idx.EndOfIndexEntry.Offset, Equals, uint32(716))
 	c.Assert(idx.EndOfIndexEntry.Hash.String(), Equals, "922e89d9ffd7cefce93a211615b2053c0f42bd78")
 }
+
+func (s *IndexSuite) TestReadEWAH(c *C) {
+	buf := bytes.NewBuffer(nil)
+	err := binary.Write(buf,
+		uint32(130), uint32(4),
+		// a run of one word of ones followed by a literal word
+		uint64(1|1<<1|1<<33), uint64(0x5),
+		// no run, followed by a literal word
+		uint64(1<<33), uint64(0x2),
+		uint32(2),
+	)
+	c.Assert(err, IsNil)
+
+	bits, err := readEWAH(buf)
+	c.Assert(err, IsNil)
+	c.Assert(bits, HasLen, 130)
+
+	for i, b := range bits {
+		expected := i < 65 || i == 66 || i == 129
+		c.Assert(b, Equals, expected, Commentf("bit %d", i))
+	}
+
+	buf.Reset()
+	err = writeEWAH(buf, bits)
+	c.Assert(err, IsNil)
+
+	written, err := readEWAH(buf)
+	c.Assert(err, IsNil)
+	c.Assert(written, DeepEquals, bits)
+}
+
+func (s *IndexSuite) TestDecodeEntryBlocksMalformedOffset(c *C) {
+	content := make([]byte, 64)
+	t := &EntryOffsetTable{Blocks: []EntryOffsetBlock{
+		{Offset: 12, Count: 1},
+		{Offset: 128, Count: 1},
+	}}
+
+	d := &Decoder{}
+	err := d.readEntryBlocks(&Index{Version: 2}, content, t, 2)
+	c.Assert(err, Equals, ErrMalformedExtension)
+}
@@ -5,7 +5,9 @@ import (
 	"crypto"
 	"errors"
 	"io"
+	"runtime"
 	"sort"
+	"strconv"
 	"time"
 
 	"github.com/go-git/go-git/v5/plumbing/hash"
@@ -14,75 +16,176 @@ import (
 
 var (
 	// EncodeVersionSupported is the range of supported index versions
-	EncodeVersionSupported uint32 = 3
+	EncodeVersionSupported uint32 = 4
 
 	// ErrInvalidTimestamp is returned by Encode if a Index with a Entry with
 	// negative timestamp values
 	ErrInvalidTimestamp = errors.New("negative timestamps are not allowed")
 )
 
+// entryBlockMinSize is the minimum number of entries of the blocks of a new
+// EntryOffsetTable, the same used by git.
+const entryBlockMinSize = 500
+
 // An Encoder writes an Index to an output stream.
 type Encoder struct {
-	w    io.Writer
-	hash hash.Hash
+	w      io.Writer
+	hash   hash.Hash
+	offset *offsetWriter
+
+	// lastName is the name of the last entry written, used by the path
+	// prefix compression of the version 4
+	lastName string
+	// headers is the hash of the signatures and sizes of the extensions
+	// written, recorded by the EndOfIndexEntry extension
+	headers hash.Hash
 }
 
 // NewEncoder returns a new encoder that writes to w.
 func NewEncoder(w io.Writer) *Encoder {
 	h := hash.New(crypto.SHA1)
-	mw := io.MultiWriter(w, h)
-	return &Encoder{mw, h}
+	o := &offsetWriter{}
+	mw := io.MultiWriter(w, h, o)
+	return &Encoder{w: mw, hash: h, offset: o}
 }
 
 // Encode writes the Index to the stream of the encoder.
+//
+// If the index has a SplitIndex with a Base, its entries are written as the
+// changes to the base. The EntryOffsetTable and EndOfIndexEntry extensions
+// are computed again for the written entries.
 func (e *Encoder) Encode(idx *Index) error {
-	// TODO: support v4
-	// TODO: support extensions
+	// TODO: support the rest of extensions
 	if idx.Version > EncodeVersionSupported {
 		return ErrUnsupportedVersion
 	}
 
-	if err := e.encodeHeader(idx); err != nil {
+	sort.Stable(byName(idx.Entries))
+	entries := splitEntries(idx)
+
+	if err := e.encodeHeader(idx, len(entries)); err != nil {
 		return err
 	}
 
-	if err := e.encodeEntries(idx); err != nil {
+	if err := e.encodeEntries(idx, entries); err != nil {
+		return err
+	}
+
+	if err := e.encodeExtensions(idx); err != nil {
 		return err
 	}
 
 	return e.encodeFooter()
 }
 
-func (e *Encoder) encodeHeader(idx *Index) error {
+func (e *Encoder) encodeHeader(idx *Index, count int) error {
 	return binary.Write(e.w,
 		indexSignature,
 		idx.Version,
-		uint32(len(idx.Entries)),
+		uint32(count),
 	)
 }
 
-func (e *Encoder) encodeEntries(idx *Index) error {
-	sort.Sort(byName(idx.Entries))
+// splitEntries returns the entries to write. If the index is split and has
+// a base, these are the entries replacing the ones of the base, with empty
+// names, followed by the entries added, and the bitmaps of the SplitIndex are
+// computed again.
+func splitEntries(idx *Index) []*Entry {
+	s := idx.SplitIndex
+	if s == nil || s.Base == nil {
+		return idx.Entries
+	}
 
+	current := make(map[entryKey]*Entry, len(idx.Entries))
 	for _, entry := range idx.Entries {
-		if err := e.encodeEntry(entry); err != nil {
-			return err
+		current[keyOf(entry)] = entry
+	}
+
+	s.Delete = make([]bool, len(s.Base.Entries))
+	s.Replace = make([]bool, len(s.Base.Entries))
+
+	var entries []*Entry
+	for pos, base := range s.Base.Entries {
+		entry, ok := current[keyOf(base)]
+		if !ok {
+			s.Delete[pos] = true
+			continue
+		}
+
+		delete(current, keyOf(base))
+		if !sameEntry(entry, base) {
+			s.Replace[pos] = true
+			replacement := *entry
+			replacement.Name = ""
+			entries = append(entries, &replacement)
+		}
+	}
+
+	for _, entry := range idx.Entries {
+		if _, ok := current[keyOf(entry)]; ok {
+			entries = append(entries, entry)
 		}
-		entryLength := entryHeaderLength
-		if entry.IntentToAdd || entry.SkipWorktree {
-			entryLength += 2
+	}
+
+	return entries
+}
+
+func (e *Encoder) encodeEntries(idx *Index, entries []*Entry) error {
+	size := entryBlockSize(idx, len(entries))
+
+	var blocks []EntryOffsetBlock
+	for i, entry := range entries {
+		// the blocks are decoded independently, so the name of their first
+		// entry is never compressed
+		first := size > 0 && i%size == 0
+		if first {
+			blocks = append(blocks, EntryOffsetBlock{Offset: uint32(e.offset.n)})
+		}
+
+		if size > 0 {
+			blocks[len(blocks)-1].Count++
 		}
 
-		wrote := entryLength + len(entry.Name)
-		if err := e.padEntry(wrote); err != nil {
+		if err := e.encodeEntry(idx, entry, i == 0 || first); err != nil {
 			return err
 		}
 	}
 
+	if idx.EntryOffsetTable != nil {
+		idx.EntryOffsetTable.Blocks = blocks
+	}
+
 	return nil
 }
 
-func (e *Encoder) encodeEntry(entry *Entry) error {
+// entryBlockSize returns the number of entries of the blocks of the
+// EntryOffsetTable, keeping its number of blocks, zero if the index has no
+// table.
+func entryBlockSize(idx *Index, count int) int {
+	if idx.EntryOffsetTable == nil || count == 0 {
+		return 0
+	}
+
+	blocks := len(idx.EntryOffsetTable.Blocks)
+	if blocks == 0 {
+		blocks = count / entryBlockMinSize
+		if blocks > runtime.NumCPU() {
+			blocks = runtime.NumCPU()
+		}
+	}
+
+	if blocks < 1 {
+		blocks = 1
+	}
+
+	if blocks > count {
+		blocks = count
+	}
+
+	return (count + blocks - 1) / blocks
+}
+
+func (e *Encoder) encodeEntry(idx *Index, entry *Entry, first bool) error {
 	sec, nsec, err := e.timeToUint32(&entry.CreatedAt)
 	if err != nil {
 		return err
@@ -113,6 +216,7 @@ func (e *Encoder) encodeEntry(entry *Entry) error {
 	}
 
 	flagsFlow := []interface{}{flags}
+	entryLength := entryHeaderLength
 
 	if entry.IntentToAdd || entry.SkipWorktree {
 		var extendedFlags uint16
@@ -125,6 +229,7 @@ func (e *Encoder) encodeEntry(entry *Entry) error {
 		}
 
 		flagsFlow = []interface{}{flags | entryExtended, extendedFlags}
+		entryLength += 2
 	}
 
 	flow = append(flow, flagsFlow...)
@@ -133,7 +238,35 @@ func (e *Encoder) encodeEntry(entry *Entry) error {
 		return err
 	}
 
-	return binary.Write(e.w, []byte(entry.Name))
+	if idx.Version == 4 {
+		return e.encodeEntryNameV4(entry, first)
+	}
+
+	if err := binary.Write(e.w, []byte(entry.Name)); err != nil {
+		return err
+	}
+
+	return e.padEntry(entryLength + len(entry.Name))
+}
+
+// encodeEntryNameV4 writes the name of the entry as the number of bytes to
+// remove from the end of the previous name followed by the suffix to append.
+// The first names are written whole, removing all the previous name.
+func (e *Encoder) encodeEntryNameV4(entry *Entry, first bool) error {
+	var common int
+	if !first {
+		for common < len(e.lastName) && common < len(entry.Name) &&
+			e.lastName[common] == entry.Name[common] {
+			common++
+		}
+	}
+
+	if err := binary.WriteVariableWidthInt(e.w, int64(len(e.lastName)-common)); err != nil {
+		return err
+	}
+
+	e.lastName = entry.Name
+	return binary.Write(e.w, []byte(entry.Name[common:]+"\x00"))
 }
 
 func (e *Encoder) timeToUint32(t *time.Time) (uint32, uint32, error) {
@@ -155,12 +288,302 @@ func (e *Encoder) padEntry(wrote int) error {
 	return err
 }
 
+// encodeExtensions writes the extensions of the index, ending with the
+// EndOfIndexEntry extension if the index has it or has an EntryOffsetTable.
+func (e *Encoder) encodeExtensions(idx *Index) error {
+	offset := uint32(e.offset.n)
+	e.headers = hash.New(crypto.SHA1)
+
+	if idx.EntryOffsetTable != nil {
+		buf := bytes.NewBuffer(nil)
+		if err := e.encodeEntryOffsetTable(buf, idx.EntryOffsetTable); err != nil {
+			return err
+		}
+
+		if err := e.encodeExtension(entryOffsetTableExtSignature, buf); err != nil {
+			return err
+		}
+	}
+
+	if idx.SplitIndex != nil {
+		buf := bytes.NewBuffer(nil)
+		if err := e.encodeSplitIndex(buf, idx.SplitIndex); err != nil {
+			return err
+		}
+
+		if err := e.encodeExtension(splitIndexExtSignature, buf); err != nil {
+			return err
+		}
+	}
+
+	if idx.UntrackedCache != nil {
+		buf := bytes.NewBuffer(nil)
+		if err := e.encodeUntrackedCache(buf, idx.UntrackedCache); err != nil {
+			return err
+		}
+
+		if err := e.encodeExtension(untrackedCacheExtSignature, buf); err != nil {
+			return err
+		}
+	}
+
+	if idx.FSMonitor != nil {
+		buf := bytes.NewBuffer(nil)
+		if err := e.encodeFSMonitor(buf, idx.FSMonitor, idx.Entries); err != nil {
+			return err
+		}
+
+		if err := e.encodeExtension(fsMonitorExtSignature, buf); err != nil {
+			return err
+		}
+	}
+
+	if idx.Sparse {
+		if err := e.encodeExtension(sparseDirectoriesExtSignature, bytes.NewBuffer(nil)); err != nil {
+			return err
+		}
+	}
+
+	if idx.EndOfIndexEntry != nil || idx.EntryOffsetTable != nil {
+		idx.EndOfIndexEntry = &EndOfIndexEntry{Offset: offset}
+		copy(idx.EndOfIndexEntry.Hash[:], e.headers.Sum(nil))
+
+		buf := bytes.NewBuffer(nil)
+		if err := binary.Write(buf, idx.EndOfIndexEntry.Offset, idx.EndOfIndexEntry.Hash[:]); err != nil {
+			return err
+		}
+
+		return e.encodeExtension(endOfIndexEntryExtSignature, buf)
+	}
+
+	return nil
+}
+
+func (e *Encoder) encodeExtension(signature []byte, data *bytes.Buffer) error {
+	header := bytes.NewBuffer(nil)
+	if err := binary.Write(header, signature, uint32(data.Len())); err != nil {
+		return err
+	}
+
+	e.headers.Write(header.Bytes())
+	return binary.Write(e.w, header.Bytes(), data.Bytes())
+}
+
+func (e *Encoder) encodeEntryOffsetTable(w *bytes.Buffer, t *EntryOffsetTable) error {
+	if err := binary.WriteUint32(w, 1); err != nil {
+		return err
+	}
+
+	for _, b := range t.Blocks {
+		if err := binary.Write(w, b.Offset, b.Count); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *Encoder) encodeSplitIndex(w *bytes.Buffer, s *SplitIndex) error {
+	w.Write(s.BaseHash[:])
+	if s.Delete == nil && s.Replace == nil {
+		return nil
+	}
+
+	if err := writeEWAH(w, s.Delete); err != nil {
+		return err
+	}
+
+	return writeEWAH(w, s.Replace)
+}
+
+func (e *Encoder) encodeUntrackedCache(w *bytes.Buffer, uc *UntrackedCache) error {
+	var envs []byte
+	for _, env := range uc.Environments {
+		envs = append(envs, env...)
+		envs = append(envs, '\x00')
+	}
+
+	if err := binary.WriteVariableWidthInt(w, int64(len(envs))); err != nil {
+		return err
+	}
+
+	w.Write(envs)
+	if err := e.encodeStats(w, &uc.InfoExcludeStats); err != nil {
+		return err
+	}
+
+	if err := e.encodeStats(w, &uc.ExcludesFileStats); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w,
+		uc.Flags,
+		uc.InfoExcludeHash[:],
+		uc.ExcludesFileHash[:],
+		[]byte(uc.ExcludePerDir+"\x00"),
+	); err != nil {
+		return err
+	}
+
+	var dirs []*UntrackedCacheDirectory
+	if uc.Root != nil {
+		dirs = flattenUntrackedCache(uc.Root, dirs)
+	}
+
+	if err := binary.WriteVariableWidthInt(w, int64(len(dirs))); err != nil {
+		return err
+	}
+
+	if len(dirs) != 0 {
+		if err := e.encodeDirectories(w, dirs); err != nil {
+			return err
+		}
+	}
+
+	return w.WriteByte('\x00')
+}
+
+// encodeDirectories writes the given directories, in depth-first order,
+// followed by the bitmaps of their flags and the stats and hashes they
+// refer to.
+func (e *Encoder) encodeDirectories(w *bytes.Buffer, dirs []*UntrackedCacheDirectory) error {
+	valid := make([]bool, len(dirs))
+	checkOnly := make([]bool, len(dirs))
+	hashValid := make([]bool, len(dirs))
+	for i, dir := range dirs {
+		valid[i] = dir.Valid
+		checkOnly[i] = dir.CheckOnly
+		hashValid[i] = !dir.ExcludeHash.IsZero()
+
+		if err := binary.WriteVariableWidthInt(w, int64(len(dir.Untracked))); err != nil {
+			return err
+		}
+
+		if err := binary.WriteVariableWidthInt(w, int64(len(dir.Directories))); err != nil {
+			return err
+		}
+
+		w.WriteString(dir.Name + "\x00")
+		for _, name := range dir.Untracked {
+			w.WriteString(name + "\x00")
+		}
+	}
+
+	for _, bits := range [][]bool{valid, checkOnly, hashValid} {
+		if err := writeEWAH(w, bits); err != nil {
+			return err
+		}
+	}
+
+	for _, dir := range dirs {
+		if !dir.Valid {
+			continue
+		}
+
+		if err := e.encodeStats(w, &dir.Stats); err != nil {
+			return err
+		}
+	}
+
+	for _, dir := range dirs {
+		if !dir.ExcludeHash.IsZero() {
+			w.Write(dir.ExcludeHash[:])
+		}
+	}
+
+	return nil
+}
+
+func flattenUntrackedCache(dir *UntrackedCacheDirectory, dirs []*UntrackedCacheDirectory) []*UntrackedCacheDirectory {
+	dirs = append(dirs, dir)
+	for _, sub := range dir.Directories {
+		dirs = flattenUntrackedCache(sub, dirs)
+	}
+
+	return dirs
+}
+
+func (e *Encoder) encodeStats(w io.Writer, s *UntrackedCacheStats) error {
+	sec, nsec, err := e.timeToUint32(&s.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	msec, mnsec, err := e.timeToUint32(&s.ModifiedAt)
+	if err != nil {
+		return err
+	}
+
+	return binary.Write(w,
+		sec, nsec,
+		msec, mnsec,
+		s.Dev,
+		s.Inode,
+		s.UID,
+		s.GID,
+		s.Size,
+	)
+}
+
+// encodeFSMonitor writes the token of the given FSMonitor and the bitmap of
+// the entries not flagged with FSMonitorValid, sorted as they are written.
+func (e *Encoder) encodeFSMonitor(w *bytes.Buffer, m *FSMonitor, entries []*Entry) error {
+	if err := binary.WriteUint32(w, m.Version); err != nil {
+		return err
+	}
+
+	switch m.Version {
+	case 1:
+		ts, err := strconv.ParseUint(m.Token, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		if err := binary.WriteUint64(w, ts); err != nil {
+			return err
+		}
+	case 2:
+		w.WriteString(m.Token + "\x00")
+	default:
+		return ErrUnsupportedVersion
+	}
+
+	dirty := make([]bool, len(entries))
+	for i, entry := range entries {
+		dirty[i] = !entry.FSMonitorValid
+	}
+
+	bitmap := bytes.NewBuffer(nil)
+	if err := writeEWAH(bitmap, dirty); err != nil {
+		return err
+	}
+
+	return binary.Write(w, uint32(bitmap.Len()), bitmap.Bytes())
+}
+
 func (e *Encoder) encodeFooter() error {
 	return binary.Write(e.w, e.hash.Sum(nil))
 }
 
+// offsetWriter counts the bytes written, to know the offsets of the entries
+// and the extensions.
+type offsetWriter struct {
+	n int
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return len(p), nil
+}
+
 type byName []*Entry
 
-func (l byName) Len() int           { return len(l) }
-func (l byName) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
-func (l byName) Less(i, j int) bool { return l[i].Name < l[j].Name }
+func (l byName) Len() int      { return len(l) }
+func (l byName) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l byName) Less(i, j int) bool {
+	if l[i].Name == l[j].Name {
+		return l[i].Stage < l[j].Stage
+	}
+
+	return l[i].Name < l[j].Name
+}
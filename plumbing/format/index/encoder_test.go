@@ -2,11 +2,14 @@ package index
 
 import (
 	"bytes"
+	"fmt"
 	"strings"
 	"time"
 
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
 
+	fixtures "github.com/go-git/go-git-fixtures/v4"
 	"github.com/google/go-cmp/cmp"
 	. "gopkg.in/check.v1"
 )
@@ -57,7 +60,7 @@ func (s *IndexSuite) TestEncode(c *C) {
 }
 
 func (s *IndexSuite) TestEncodeUnsupportedVersion(c *C) {
-	idx := &Index{Version: 4}
+	idx := &Index{Version: 5}
 
 	buf := bytes.NewBuffer(nil)
 	e := NewEncoder(buf)
@@ -104,3 +107,224 @@ func (s *IndexSuite) TestEncodeWithSkipWorktreeUnsupportedVersion(c *C) {
 	c.Assert(cmp.Equal(idx, output), Equals, true)
 	c.Assert(output.Entries[0].SkipWorktree, Equals, true)
 }
+
+func (s *IndexSuite) TestEncodeUntrackedCache(c *C) {
+	idx := &Index{
+		Version: 2,
+		Entries: []*Entry{{Name: "a/foo"}},
+		UntrackedCache: &UntrackedCache{
+			Environments:     []string{"Location /tmp/foo, system linux"},
+			InfoExcludeStats: UntrackedCacheStats{ModifiedAt: time.Unix(42, 24), Size: 42},
+			InfoExcludeHash:  plumbing.NewHash("e25b29c8946e0e192fae2edc1dabf7be71e8ecf3"),
+			Flags:            6,
+			ExcludePerDir:    ".gitignore",
+			Root: &UntrackedCacheDirectory{
+				Untracked: []string{"bar", "qux/"},
+				Valid:     true,
+				Stats:     UntrackedCacheStats{ModifiedAt: time.Unix(84, 48), Inode: 4242},
+				Directories: []*UntrackedCacheDirectory{{
+					Name:        "a",
+					CheckOnly:   true,
+					ExcludeHash: plumbing.NewHash("1dabf7be71e8ecf3e25b29c8946e0e192fae2edc"),
+				}, {
+					Name:      "b",
+					Untracked: []string{"baz"},
+					Valid:     true,
+					Stats:     UntrackedCacheStats{ModifiedAt: time.Unix(168, 96)},
+				}},
+			},
+		},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	e := NewEncoder(buf)
+	err := e.Encode(idx)
+	c.Assert(err, IsNil)
+
+	output := &Index{}
+	d := NewDecoder(buf)
+	err = d.Decode(output)
+	c.Assert(err, IsNil)
+
+	c.Assert(cmp.Equal(idx, output), Equals, true)
+}
+
+func (s *IndexSuite) TestEncodeFSMonitor(c *C) {
+	idx := &Index{
+		Version: 2,
+		Entries: []*Entry{
+			{Name: "foo", FSMonitorValid: true},
+			{Name: "bar"},
+			{Name: "qux", FSMonitorValid: true},
+		},
+		FSMonitor: &FSMonitor{Version: 2, Token: "builtin:42"},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	e := NewEncoder(buf)
+	err := e.Encode(idx)
+	c.Assert(err, IsNil)
+
+	output := &Index{}
+	d := NewDecoder(buf)
+	err = d.Decode(output)
+	c.Assert(err, IsNil)
+
+	c.Assert(cmp.Equal(idx, output), Equals, true)
+	c.Assert(output.Entries[0].Name, Equals, "bar")
+	c.Assert(output.Entries[0].FSMonitorValid, Equals, false)
+	c.Assert(output.Entries[1].FSMonitorValid, Equals, true)
+
+	idx.FSMonitor = &FSMonitor{Version: 1, Token: "1600000000000000000"}
+	buf.Reset()
+	err = NewEncoder(buf).Encode(idx)
+	c.Assert(err, IsNil)
+
+	output = &Index{}
+	err = NewDecoder(buf).Decode(output)
+	c.Assert(err, IsNil)
+	c.Assert(output.FSMonitor, DeepEquals, idx.FSMonitor)
+}
+
+func (s *IndexSuite) TestEncodeV4(c *C) {
+	idx := &Index{
+		Version: 4,
+		Entries: []*Entry{
+			{Name: "foo/bar/baz", Size: 1},
+			{Name: "foo/bar/qux", Size: 2},
+			{Name: "foo/quux", Size: 3},
+			{Name: "foo", Size: 4},
+			{Name: "bar", Size: 5},
+		},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err := NewEncoder(buf).Encode(idx)
+	c.Assert(err, IsNil)
+
+	output := &Index{}
+	err = NewDecoder(buf).Decode(output)
+	c.Assert(err, IsNil)
+
+	c.Assert(cmp.Equal(idx, output), Equals, true)
+	c.Assert(output.Entries[0].Name, Equals, "bar")
+	c.Assert(output.Entries[4].Name, Equals, "foo/quux")
+}
+
+func (s *IndexSuite) TestEncodeV4Fixture(c *C) {
+	f, err := fixtures.Basic().ByTag("index-v4").One().DotGit().Open("index")
+	c.Assert(err, IsNil)
+	defer func() { c.Assert(f.Close(), IsNil) }()
+
+	idx := &Index{}
+	err = NewDecoder(f).Decode(idx)
+	c.Assert(err, IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	err = NewEncoder(buf).Encode(idx)
+	c.Assert(err, IsNil)
+
+	output := &Index{}
+	err = NewDecoder(buf).Decode(output)
+	c.Assert(err, IsNil)
+
+	c.Assert(output.Version, Equals, uint32(4))
+	c.Assert(cmp.Equal(idx.Entries, output.Entries), Equals, true)
+}
+
+func (s *IndexSuite) TestEncodeEntryOffsetTable(c *C) {
+	idx := &Index{
+		Version:          4,
+		EntryOffsetTable: &EntryOffsetTable{Blocks: make([]EntryOffsetBlock, 3)},
+	}
+
+	for i := 0; i < 1000; i++ {
+		idx.Entries = append(idx.Entries, &Entry{
+			Name: fmt.Sprintf("dir%d/file%04d", i%7, i),
+			Size: uint32(i),
+		})
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err := NewEncoder(buf).Encode(idx)
+	c.Assert(err, IsNil)
+
+	c.Assert(idx.EndOfIndexEntry, NotNil)
+	c.Assert(idx.EntryOffsetTable.Blocks, HasLen, 3)
+	c.Assert(idx.EntryOffsetTable.Blocks[0].Offset, Equals, uint32(12))
+	c.Assert(idx.EntryOffsetTable.Blocks[0].Count, Equals, uint32(334))
+	c.Assert(idx.EntryOffsetTable.Blocks[2].Count, Equals, uint32(332))
+
+	output := &Index{}
+	err = NewDecoder(buf).Decode(output)
+	c.Assert(err, IsNil)
+
+	c.Assert(cmp.Equal(idx, output), Equals, true)
+}
+
+func (s *IndexSuite) TestEncodeSplitIndex(c *C) {
+	base := &Index{
+		Version: 2,
+		Entries: []*Entry{
+			{Name: "bar", Size: 1},
+			{Name: "baz", Size: 2},
+			{Name: "foo", Size: 3},
+		},
+	}
+
+	idx := &Index{
+		Version: 2,
+		Entries: []*Entry{
+			{Name: "bar", Size: 1},
+			{Name: "foo", Size: 42},
+			{Name: "qux", Size: 4},
+		},
+		SplitIndex: &SplitIndex{
+			BaseHash: plumbing.NewHash("e25b29c8946e0e192fae2edc1dabf7be71e8ecf3"),
+			Base:     base,
+		},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err := NewEncoder(buf).Encode(idx)
+	c.Assert(err, IsNil)
+
+	output := &Index{}
+	err = NewDecoder(buf).Decode(output)
+	c.Assert(err, IsNil)
+
+	c.Assert(output.Entries, HasLen, 2)
+	c.Assert(output.Entries[0].Name, Equals, "")
+	c.Assert(output.Entries[0].Size, Equals, uint32(42))
+	c.Assert(output.Entries[1].Name, Equals, "qux")
+	c.Assert(output.SplitIndex.BaseHash, Equals, idx.SplitIndex.BaseHash)
+	c.Assert(output.SplitIndex.Delete, DeepEquals, []bool{false, true, false})
+	c.Assert(output.SplitIndex.Replace, DeepEquals, []bool{false, false, true})
+
+	err = output.MergeSharedIndex(base)
+	c.Assert(err, IsNil)
+	c.Assert(cmp.Equal(idx, output), Equals, true)
+}
+
+func (s *IndexSuite) TestEncodeSparseDirectories(c *C) {
+	idx := &Index{
+		Version: 3,
+		Sparse:  true,
+		Entries: []*Entry{
+			{Name: "dir/", Mode: filemode.Dir, SkipWorktree: true},
+			{Name: "foo", Mode: filemode.Regular},
+		},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err := NewEncoder(buf).Encode(idx)
+	c.Assert(err, IsNil)
+
+	output := &Index{}
+	err = NewDecoder(buf).Decode(output)
+	c.Assert(err, IsNil)
+
+	c.Assert(cmp.Equal(idx, output), Equals, true)
+	c.Assert(output.Entries[0].IsSparseDir(), Equals, true)
+	c.Assert(output.Entries[1].IsSparseDir(), Equals, false)
+}
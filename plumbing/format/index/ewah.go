@@ -0,0 +1,108 @@
+package index
+
+import (
+	"io"
+
+	"github.com/go-git/go-git/v5/utils/binary"
+)
+
+const (
+	ewahWordBits       = 64
+	ewahRunningLenBits = 32
+	ewahMaxLiterals    = 1<<31 - 1
+)
+
+// readEWAH reads an EWAH compressed bitmap, as serialized by git: the number
+// of bits, the number of 64-bit words, the words and the position of the last
+// running length word.
+//
+// Each running length word is followed by literal words, in its lowest bit
+// it holds the value of the run, in the next 32 bits the number of words of
+// the run and in the upper 31 bits the number of literal words following it.
+func readEWAH(r io.Reader) ([]bool, error) {
+	size, err := binary.ReadUint32(r)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := binary.ReadUint32(r)
+	if err != nil {
+		return nil, err
+	}
+
+	bits := make([]bool, 0, size)
+	var literals uint64
+	for i := uint32(0); i < count; i++ {
+		w, err := binary.ReadUint64(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if literals > 0 {
+			literals--
+			for j := 0; j < ewahWordBits; j++ {
+				bits = append(bits, w&(1<<uint(j)) != 0)
+			}
+
+			continue
+		}
+
+		run := (w >> 1) & (1<<ewahRunningLenBits - 1)
+		if uint64(len(bits))+run*ewahWordBits > uint64(size)+ewahWordBits {
+			return nil, ErrMalformedExtension
+		}
+
+		for j := uint64(0); j < run*ewahWordBits; j++ {
+			bits = append(bits, w&1 != 0)
+		}
+
+		literals = w >> (ewahRunningLenBits + 1)
+	}
+
+	if literals > 0 || len(bits) < int(size) {
+		return nil, ErrMalformedExtension
+	}
+
+	// position of the last running length word, only needed to append bits
+	if _, err := binary.ReadUint32(r); err != nil {
+		return nil, err
+	}
+
+	return bits[:size], nil
+}
+
+// writeEWAH writes the given bitmap as an EWAH bitmap made of literal words.
+func writeEWAH(w io.Writer, bits []bool) error {
+	words := make([]uint64, (len(bits)+ewahWordBits-1)/ewahWordBits)
+	for i, b := range bits {
+		if b {
+			words[i/ewahWordBits] |= 1 << uint(i%ewahWordBits)
+		}
+	}
+
+	var rlws []uint64
+	var last uint32
+	for len(words) > 0 || rlws == nil {
+		n := len(words)
+		if n > ewahMaxLiterals {
+			n = ewahMaxLiterals
+		}
+
+		last = uint32(len(rlws))
+		rlws = append(rlws, uint64(n)<<(ewahRunningLenBits+1))
+		rlws = append(rlws, words[:n]...)
+		words = words[n:]
+	}
+
+	if err := binary.Write(w, uint32(len(bits)), uint32(len(rlws))); err != nil {
+		return err
+	}
+
+	for _, word := range rlws {
+		if err := binary.WriteUint64(w, word); err != nil {
+			return err
+		}
+	}
+
+	return binary.WriteUint32(w, last)
+}
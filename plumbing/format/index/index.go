@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -19,10 +20,15 @@ var (
 	// ErrEntryNotFound is returned by Index.Entry, if an entry is not found.
 	ErrEntryNotFound = errors.New("entry not found")
 
-	indexSignature              = []byte{'D', 'I', 'R', 'C'}
-	treeExtSignature            = []byte{'T', 'R', 'E', 'E'}
-	resolveUndoExtSignature     = []byte{'R', 'E', 'U', 'C'}
-	endOfIndexEntryExtSignature = []byte{'E', 'O', 'I', 'E'}
+	indexSignature                = []byte{'D', 'I', 'R', 'C'}
+	treeExtSignature              = []byte{'T', 'R', 'E', 'E'}
+	resolveUndoExtSignature       = []byte{'R', 'E', 'U', 'C'}
+	endOfIndexEntryExtSignature   = []byte{'E', 'O', 'I', 'E'}
+	untrackedCacheExtSignature    = []byte{'U', 'N', 'T', 'R'}
+	fsMonitorExtSignature         = []byte{'F', 'S', 'M', 'N'}
+	entryOffsetTableExtSignature  = []byte{'I', 'E', 'O', 'T'}
+	splitIndexExtSignature        = []byte{'l', 'i', 'n', 'k'}
+	sparseDirectoriesExtSignature = []byte{'s', 'd', 'i', 'r'}
 )
 
 // Stage during merge
@@ -30,7 +36,7 @@ type Stage int
 
 const (
 	// Merged is the default stage, fully merged
-	Merged Stage = 1
+	Merged Stage = 0
 	// AncestorMode is the base revision
 	AncestorMode Stage = 1
 	// OurMode is the first tree revision, ours
@@ -54,6 +60,17 @@ type Index struct {
 	ResolveUndo *ResolveUndo
 	// EndOfIndexEntry represents the 'End of Index Entry' extension
 	EndOfIndexEntry *EndOfIndexEntry
+	// UntrackedCache represents the 'Untracked cache' extension
+	UntrackedCache *UntrackedCache
+	// FSMonitor represents the 'File System Monitor cache' extension
+	FSMonitor *FSMonitor
+	// EntryOffsetTable represents the 'Index Entry Offset Table' extension
+	EntryOffsetTable *EntryOffsetTable
+	// SplitIndex represents the 'Split index' extension
+	SplitIndex *SplitIndex
+	// Sparse is true if the index contains sparse directory entries, as
+	// recorded by the 'Sparse directory entries' extension
+	Sparse bool
 }
 
 // Add creates a new Entry and returns it. The caller should first check that
@@ -149,6 +166,17 @@ type Entry struct {
 	// IntentToAdd record only the fact that the path will be added later
 	// https://git-scm.com/docs/git-add ("git add -N")
 	IntentToAdd bool
+	// FSMonitorValid reports that the path is known to be unchanged since the
+	// last query to the file system monitor, it's only meaningful along with
+	// the FSMonitor extension, where it's stored.
+	FSMonitorValid bool
+}
+
+// IsSparseDir returns true if the entry is a sparse directory entry, a
+// directory outside of the sparse checkout stored as a single entry with the
+// hash of its tree and a name ending with a slash.
+func (e *Entry) IsSparseDir() bool {
+	return e.Mode == filemode.Dir && strings.HasSuffix(e.Name, "/")
 }
 
 func (e Entry) String() string {
@@ -213,6 +241,101 @@ type EndOfIndexEntry struct {
 	Hash plumbing.Hash
 }
 
+// UntrackedCache caches the untracked files of the directories of the
+// worktree, so the directories unchanged since the cache was recorded don't
+// need to be read again.
+type UntrackedCache struct {
+	// Environments identifies the environments where the cache can be used,
+	// such as the location of the worktree.
+	Environments []string
+	// InfoExcludeStats and ExcludesFileStats are the stats of the
+	// $GIT_DIR/info/exclude file and of the core.excludesFile file.
+	InfoExcludeStats, ExcludesFileStats UntrackedCacheStats
+	// InfoExcludeHash and ExcludesFileHash are the hashes of the
+	// $GIT_DIR/info/exclude file and of the core.excludesFile file, zero if
+	// the file doesn't exist.
+	InfoExcludeHash, ExcludesFileHash plumbing.Hash
+	// Flags are the flags used to read the directories.
+	Flags uint32
+	// ExcludePerDir is the name of the per-directory exclude files, usually
+	// .gitignore.
+	ExcludePerDir string
+	// Root is the cache of the root directory of the worktree, nil if the
+	// cache is empty.
+	Root *UntrackedCacheDirectory
+}
+
+// UntrackedCacheDirectory is the cache of a directory of the worktree.
+type UntrackedCacheDirectory struct {
+	// Name of the directory, relative to its parent directory.
+	Name string
+	// Untracked are the untracked files of the directory, the names of the
+	// untracked directories end with a slash.
+	Untracked []string
+	// Directories are the cached subdirectories.
+	Directories []*UntrackedCacheDirectory
+	// Valid reports if Untracked is up to date with the directory described
+	// by Stats.
+	Valid bool
+	// CheckOnly reports if the directory was only checked to contain
+	// untracked files.
+	CheckOnly bool
+	// Stats of the directory when the cache was recorded, only if Valid.
+	Stats UntrackedCacheStats
+	// ExcludeHash is the hash of the per-directory exclude file, zero if it
+	// doesn't exist.
+	ExcludeHash plumbing.Hash
+}
+
+// UntrackedCacheStats are the stats of a file or a directory, as recorded by
+// the untracked cache.
+type UntrackedCacheStats struct {
+	CreatedAt, ModifiedAt      time.Time
+	Dev, Inode, UID, GID, Size uint32
+}
+
+// FSMonitor records the last query to the file system monitor, the entries
+// flagged with FSMonitorValid are known to be unchanged since then.
+type FSMonitor struct {
+	// Version of the extension, 1 if the token is a timestamp in nanoseconds
+	// or 2 if the token is an opaque string.
+	Version uint32
+	// Token identifying the last query to the file system monitor.
+	Token string
+}
+
+// EntryOffsetTable splits the entries of the index in blocks, so they can be
+// decoded in parallel. It can only be used along with the EndOfIndexEntry
+// extension, that locates it.
+type EntryOffsetTable struct {
+	Blocks []EntryOffsetBlock
+}
+
+// EntryOffsetBlock is a block of entries of an EntryOffsetTable.
+type EntryOffsetBlock struct {
+	// Offset of the first entry of the block, from the start of the file.
+	Offset uint32
+	// Count is the number of entries of the block.
+	Count uint32
+}
+
+// SplitIndex describes an index stored as the changes to a shared index,
+// stored at $GIT_DIR/sharedindex.<hash>. The entries of the split index are
+// the ones replacing or added to the entries of the shared index, the
+// replacing ones come first and have empty names.
+type SplitIndex struct {
+	// BaseHash is the hash of the shared index.
+	BaseHash plumbing.Hash
+	// Delete marks the entries of the shared index deleted.
+	Delete []bool
+	// Replace marks the entries of the shared index replaced, in order, by
+	// the first entries of the split index.
+	Replace []bool
+	// Base is the shared index. Once set, by MergeSharedIndex or by the
+	// caller, the encoder writes the entries as changes to it.
+	Base *Index
+}
+
 // SkipUnless applies patterns in the form of A, A/B, A/B/C
 // to the index to prevent the files from being checked out
 func (i *Index) SkipUnless(patterns []string) {
@@ -229,3 +352,75 @@ func (i *Index) SkipUnless(patterns []string) {
 		}
 	}
 }
+
+// MergeSharedIndex merges the entries of the given shared index with the
+// entries of this split index, as described by its SplitIndex. The shared
+// index is kept as the base of the split index, so it can be written again
+// as changes to it.
+func (i *Index) MergeSharedIndex(shared *Index) error {
+	s := i.SplitIndex
+	if s == nil {
+		return nil
+	}
+
+	changes := i.Entries
+	entries := make([]*Entry, 0, len(shared.Entries)+len(changes))
+	for pos, e := range shared.Entries {
+		merged := *e
+		if isSet(s.Replace, pos) {
+			if len(changes) == 0 || changes[0].Name != "" {
+				return ErrMalformedExtension
+			}
+
+			merged = *changes[0]
+			merged.Name = e.Name
+			changes = changes[1:]
+		}
+
+		if !isSet(s.Delete, pos) {
+			entries = append(entries, &merged)
+		}
+	}
+
+	positions := make(map[entryKey]int, len(entries))
+	for pos, e := range entries {
+		positions[keyOf(e)] = pos
+	}
+
+	for _, e := range changes {
+		if pos, ok := positions[keyOf(e)]; ok {
+			entries[pos] = e
+			continue
+		}
+
+		positions[keyOf(e)] = len(entries)
+		entries = append(entries, e)
+	}
+
+	sort.Stable(byName(entries))
+	i.Entries = entries
+	s.Base = shared
+	return nil
+}
+
+type entryKey struct {
+	name  string
+	stage Stage
+}
+
+func keyOf(e *Entry) entryKey {
+	return entryKey{e.Name, e.Stage}
+}
+
+func sameEntry(a, b *Entry) bool {
+	return a.Hash == b.Hash && a.Name == b.Name &&
+		a.CreatedAt.Equal(b.CreatedAt) && a.ModifiedAt.Equal(b.ModifiedAt) &&
+		a.Dev == b.Dev && a.Inode == b.Inode && a.Mode == b.Mode &&
+		a.UID == b.UID && a.GID == b.GID && a.Size == b.Size &&
+		a.Stage == b.Stage && a.SkipWorktree == b.SkipWorktree &&
+		a.IntentToAdd == b.IntentToAdd
+}
+
+func isSet(bits []bool, i int) bool {
+	return i < len(bits) && bits[i]
+}
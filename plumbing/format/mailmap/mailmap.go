@@ -0,0 +1,176 @@
+// Package mailmap implements the parsing of mailmap files, which map the
+// names and emails of authors and committers to their canonical ones.
+//
+// See https://git-scm.com/docs/gitmailmap for the format of the files.
+package mailmap
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const commentPrefix = "#"
+
+// Mailmap maps the names and emails of authors and committers to their
+// canonical ones. The zero value is an empty mailmap, mapping nothing.
+type Mailmap struct {
+	// entries are the mappings by the lowercase email they apply to
+	entries map[string]*entry
+}
+
+// identity is a canonical name and email, any of them empty if it isn't
+// replaced.
+type identity struct {
+	name  string
+	email string
+}
+
+type entry struct {
+	identity
+	// names are the mappings by the lowercase name they apply to, taking
+	// precedence over the identity of the entry
+	names map[string]*identity
+}
+
+// New returns an empty Mailmap.
+func New() *Mailmap {
+	return &Mailmap{}
+}
+
+// Parse parses a mailmap file, returning its mappings.
+func Parse(r io.Reader) (*Mailmap, error) {
+	m := New()
+	if err := m.Read(r); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Read reads the mappings of a mailmap file, overriding the ones already in
+// the mailmap for the same names and emails. The lines which can't be
+// parsed are ignored, as git does.
+func (m *Mailmap) Read(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		m.parseLine(s.Text())
+	}
+
+	return s.Err()
+}
+
+// parseLine parses a line in any of the forms:
+//
+//	Proper Name <commit@email>
+//	<proper@email> <commit@email>
+//	Proper Name <proper@email> <commit@email>
+//	Proper Name <proper@email> Commit Name <commit@email>
+func (m *Mailmap) parseLine(line string) {
+	if strings.HasPrefix(line, commentPrefix) {
+		return
+	}
+
+	name1, email1, rest, ok := parseNameAndEmail(line)
+	if !ok {
+		return
+	}
+
+	name2, email2, _, ok := parseNameAndEmail(rest)
+	if !ok {
+		m.add(name1, email1, "", email1)
+		return
+	}
+
+	m.add(name1, email1, name2, email2)
+}
+
+// parseNameAndEmail parses a name followed by an email between angle
+// brackets, returning the rest of the line.
+func parseNameAndEmail(s string) (name, email, rest string, ok bool) {
+	start := strings.IndexByte(s, '<')
+	if start == -1 {
+		return "", "", "", false
+	}
+
+	end := strings.IndexByte(s[start:], '>')
+	if end == -1 {
+		return "", "", "", false
+	}
+
+	end += start
+	return strings.TrimSpace(s[:start]), s[start+1 : end], s[end+1:], true
+}
+
+// add adds the mapping of the old name and email to the new ones. When
+// there is a single email in the line, the new email is the old one and
+// only the name is mapped.
+func (m *Mailmap) add(newName, newEmail, oldName, oldEmail string) {
+	if m.entries == nil {
+		m.entries = make(map[string]*entry)
+	}
+
+	if newEmail == oldEmail && oldName == "" {
+		newEmail = ""
+	}
+
+	key := strings.ToLower(oldEmail)
+	e, ok := m.entries[key]
+	if !ok {
+		e = &entry{}
+		m.entries[key] = e
+	}
+
+	if oldName == "" {
+		if newName != "" {
+			e.name = newName
+		}
+
+		if newEmail != "" {
+			e.email = newEmail
+		}
+
+		return
+	}
+
+	if e.names == nil {
+		e.names = make(map[string]*identity)
+	}
+
+	e.names[strings.ToLower(oldName)] = &identity{name: newName, email: newEmail}
+}
+
+// Resolve returns the canonical name and email of the given ones, which are
+// returned as they are if the mailmap doesn't map them. Names and emails
+// are matched case-insensitively.
+func (m *Mailmap) Resolve(name, email string) (string, string) {
+	e, ok := m.entries[strings.ToLower(email)]
+	if !ok {
+		return name, email
+	}
+
+	id := &e.identity
+	if named, ok := e.names[strings.ToLower(name)]; ok {
+		id = named
+	}
+
+	if id.name != "" {
+		name = id.name
+	}
+
+	if id.email != "" {
+		email = id.email
+	}
+
+	return name, email
+}
+
+// ResolveSignature returns a copy of the given signature with its
+// canonical name and email.
+func (m *Mailmap) ResolveSignature(s *object.Signature) *object.Signature {
+	resolved := *s
+	resolved.Name, resolved.Email = m.Resolve(s.Name, s.Email)
+	return &resolved
+}
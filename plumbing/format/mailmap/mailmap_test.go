@@ -0,0 +1,84 @@
+package mailmap
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type MailmapSuite struct{}
+
+var _ = Suite(&MailmapSuite{})
+
+const mailmapContent = `# comment
+Proper Name <commit@example.com>
+<proper@example.com> <Other@Example.com>
+Joe Developer <joe@example.com> <joe@laptop.local>
+Jane Doe <jane@example.com> jane <jane@desktop.local>
+Jane Doe <jane@example.com> Jane <bugs@company.xx> # comment
+Doe <doe@example.com> <bugs@company.xx>
+not a mapping
+`
+
+func (s *MailmapSuite) TestResolve(c *C) {
+	m, err := Parse(strings.NewReader(mailmapContent))
+	c.Assert(err, IsNil)
+
+	for _, t := range []struct {
+		name, email       string
+		expName, expEmail string
+	}{
+		{"foo", "commit@example.com", "Proper Name", "commit@example.com"},
+		{"foo", "other@example.com", "foo", "proper@example.com"},
+		{"joe", "joe@laptop.local", "Joe Developer", "joe@example.com"},
+		{"Jane", "Jane@Desktop.Local", "Jane Doe", "jane@example.com"},
+		{"other", "jane@desktop.local", "other", "jane@desktop.local"},
+		{"jane", "bugs@company.xx", "Jane Doe", "jane@example.com"},
+		{"other", "bugs@company.xx", "Doe", "doe@example.com"},
+		{"foo", "foo@example.com", "foo", "foo@example.com"},
+	} {
+		name, email := m.Resolve(t.name, t.email)
+		c.Assert(name, Equals, t.expName, Commentf("%s <%s>", t.name, t.email))
+		c.Assert(email, Equals, t.expEmail, Commentf("%s <%s>", t.name, t.email))
+	}
+}
+
+func (s *MailmapSuite) TestReadOverrides(c *C) {
+	m, err := Parse(strings.NewReader("Foo <foo@example.com>\n"))
+	c.Assert(err, IsNil)
+
+	err = m.Read(strings.NewReader("<bar@example.com> <foo@example.com>\n"))
+	c.Assert(err, IsNil)
+
+	name, email := m.Resolve("foo", "foo@example.com")
+	c.Assert(name, Equals, "Foo")
+	c.Assert(email, Equals, "bar@example.com")
+
+	err = m.Read(strings.NewReader("Bar <foo@example.com>\n"))
+	c.Assert(err, IsNil)
+
+	name, _ = m.Resolve("foo", "foo@example.com")
+	c.Assert(name, Equals, "Bar")
+}
+
+func (s *MailmapSuite) TestResolveSignature(c *C) {
+	m, err := Parse(strings.NewReader(mailmapContent))
+	c.Assert(err, IsNil)
+
+	when := time.Now()
+	sig := &object.Signature{Name: "joe", Email: "joe@laptop.local", When: when}
+	c.Assert(m.ResolveSignature(sig), DeepEquals, &object.Signature{
+		Name:  "Joe Developer",
+		Email: "joe@example.com",
+		When:  when,
+	})
+
+	c.Assert(sig.Name, Equals, "joe")
+	c.Assert(New().ResolveSignature(sig), DeepEquals, sig)
+}
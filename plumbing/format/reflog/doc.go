@@ -0,0 +1,11 @@
+// Package reflog implements encoding and decoding of reflog files.
+//
+// The reflog of a reference, stored in the `logs` directory of the git
+// directory, records the values taken by the reference over time. Each line
+// of the file is an entry:
+//
+//	<old hash> SP <new hash> SP <committer> SP <timestamp> SP <tz> TAB <message> LF
+//
+// The entries are written in chronological order, the most recent entry
+// being the last line of the file.
+package reflog
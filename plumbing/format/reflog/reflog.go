@@ -0,0 +1,157 @@
+package reflog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// ErrMalformedEntry is returned by the Decoder when a line of the reflog
+// isn't a valid entry.
+var ErrMalformedEntry = errors.New("malformed reflog entry")
+
+// Entry is an entry of a reflog, an update of a reference.
+type Entry struct {
+	// Old is the value of the reference before the update, the zero hash
+	// if the reference was created.
+	Old plumbing.Hash
+	// New is the value of the reference after the update.
+	New plumbing.Hash
+	// Committer is who made the update, and when.
+	Committer Signature
+	// Message describes the update.
+	Message string
+}
+
+// Signature identifies who made an update and when.
+type Signature struct {
+	// Name represents a person name. It is an arbitrary string.
+	Name string
+	// Email is an email, but it cannot be assumed to be well-formed.
+	Email string
+	// When is the timestamp of the update.
+	When time.Time
+}
+
+// A Decoder reads and decodes reflog entries from an input stream.
+type Decoder struct {
+	s *bufio.Scanner
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{s: bufio.NewScanner(r)}
+}
+
+// Decode reads the next entry from the stream and stores it in e, io.EOF is
+// returned when there are no more entries.
+func (d *Decoder) Decode(e *Entry) error {
+	for d.s.Scan() {
+		line := d.s.Text()
+		if line == "" {
+			continue
+		}
+
+		return decodeEntry(line, e)
+	}
+
+	if err := d.s.Err(); err != nil {
+		return err
+	}
+
+	return io.EOF
+}
+
+// DecodeAll reads all the entries from the stream, from the oldest one.
+func (d *Decoder) DecodeAll() ([]*Entry, error) {
+	var entries []*Entry
+	for {
+		e := &Entry{}
+		err := d.Decode(e)
+		if err == io.EOF {
+			return entries, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+}
+
+func decodeEntry(line string, e *Entry) error {
+	var header string
+	header, e.Message = line, ""
+	if tab := strings.IndexByte(line, '\t'); tab != -1 {
+		header, e.Message = line[:tab], line[tab+1:]
+	}
+
+	hashes := strings.SplitN(header, " ", 3)
+	if len(hashes) != 3 || !plumbing.IsHash(hashes[0]) || !plumbing.IsHash(hashes[1]) {
+		return ErrMalformedEntry
+	}
+
+	e.Old = plumbing.NewHash(hashes[0])
+	e.New = plumbing.NewHash(hashes[1])
+	return decodeSignature([]byte(hashes[2]), &e.Committer)
+}
+
+func decodeSignature(b []byte, s *Signature) error {
+	open := bytes.LastIndexByte(b, '<')
+	close := bytes.LastIndexByte(b, '>')
+	if open == -1 || close == -1 || close < open {
+		return ErrMalformedEntry
+	}
+
+	s.Name = string(bytes.TrimSpace(b[:open]))
+	s.Email = string(b[open+1 : close])
+
+	fields := strings.Fields(string(b[close+1:]))
+	if len(fields) != 2 {
+		return ErrMalformedEntry
+	}
+
+	ts, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return ErrMalformedEntry
+	}
+
+	tz, err := time.Parse("-0700", fields[1])
+	if err != nil {
+		return ErrMalformedEntry
+	}
+
+	s.When = time.Unix(ts, 0).In(tz.Location())
+	return nil
+}
+
+// An Encoder writes reflog entries to an output stream.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w}
+}
+
+// Encode writes the given entry, as a line, to the stream of the encoder.
+func (e *Encoder) Encode(entry *Entry) error {
+	msg := strings.Replace(entry.Message, "\n", " ", -1)
+	_, err := fmt.Fprintf(e.w, "%s %s %s <%s> %d %s\t%s\n",
+		entry.Old, entry.New,
+		entry.Committer.Name, entry.Committer.Email,
+		entry.Committer.When.Unix(), entry.Committer.When.Format("-0700"),
+		msg,
+	)
+
+	return err
+}
@@ -0,0 +1,79 @@
+package reflog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type ReflogSuite struct{}
+
+var _ = Suite(&ReflogSuite{})
+
+const fixture = "0000000000000000000000000000000000000000 6ecf0ef2c2dffb796033e5a02219af86ec6584e5 John Doe <john@doe.com> 1257894000 +0100\tclone: from https://github.com/git-fixtures/basic.git\n" +
+	"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 918c48b83bd081e863dbe1b80f8998f058cd8294 John Doe <john@doe.com> 1257897600 -0200\tcommit: foo\n"
+
+func (s *ReflogSuite) TestDecode(c *C) {
+	entries, err := NewDecoder(strings.NewReader(fixture)).DecodeAll()
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 2)
+
+	c.Assert(entries[0].Old, Equals, plumbing.ZeroHash)
+	c.Assert(entries[0].New, Equals, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(entries[0].Committer.Name, Equals, "John Doe")
+	c.Assert(entries[0].Committer.Email, Equals, "john@doe.com")
+	c.Assert(entries[0].Committer.When.Unix(), Equals, int64(1257894000))
+	c.Assert(entries[0].Committer.When.Format("-0700"), Equals, "+0100")
+	c.Assert(entries[0].Message, Equals, "clone: from https://github.com/git-fixtures/basic.git")
+
+	c.Assert(entries[1].Old, Equals, entries[0].New)
+	c.Assert(entries[1].Committer.When.Format("-0700"), Equals, "-0200")
+	c.Assert(entries[1].Message, Equals, "commit: foo")
+}
+
+func (s *ReflogSuite) TestDecodeMalformed(c *C) {
+	for _, line := range []string{
+		"foo",
+		"0000000000000000000000000000000000000000 foo John Doe <john@doe.com> 1257894000 +0100\tfoo",
+		"0000000000000000000000000000000000000000 6ecf0ef2c2dffb796033e5a02219af86ec6584e5 John Doe 1257894000 +0100\tfoo",
+		"0000000000000000000000000000000000000000 6ecf0ef2c2dffb796033e5a02219af86ec6584e5 John Doe <john@doe.com> foo +0100\tfoo",
+	} {
+		_, err := NewDecoder(strings.NewReader(line)).DecodeAll()
+		c.Assert(err, Equals, ErrMalformedEntry, Commentf("line: %s", line))
+	}
+}
+
+func (s *ReflogSuite) TestEncode(c *C) {
+	entries, err := NewDecoder(strings.NewReader(fixture)).DecodeAll()
+	c.Assert(err, IsNil)
+
+	buf := bytes.NewBuffer(nil)
+	e := NewEncoder(buf)
+	for _, entry := range entries {
+		c.Assert(e.Encode(entry), IsNil)
+	}
+
+	c.Assert(buf.String(), Equals, fixture)
+}
+
+func (s *ReflogSuite) TestEncodeMultilineMessage(c *C) {
+	buf := bytes.NewBuffer(nil)
+	err := NewEncoder(buf).Encode(&Entry{
+		New:       plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		Committer: Signature{Name: "foo", Email: "foo@foo.com", When: time.Unix(0, 0).UTC()},
+		Message:   "foo\nbar",
+	})
+	c.Assert(err, IsNil)
+
+	entries, err := NewDecoder(buf).DecodeAll()
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+	c.Assert(entries[0].Message, Equals, "foo bar")
+}
@@ -0,0 +1,124 @@
+package lfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+// ErrObjectNotFound is returned downloading a large file which doesn't exist.
+var ErrObjectNotFound = errors.New("lfs object not found")
+
+// TransferAdapter transfers the large files to and from where they are
+// stored.
+type TransferAdapter interface {
+	// Download returns the content of the large file of the given pointer,
+	// ErrObjectNotFound if it doesn't exist.
+	Download(p *Pointer) (io.ReadCloser, error)
+	// Upload stores the content of the large file of the given pointer.
+	Upload(p *Pointer, r io.Reader) error
+}
+
+// LocalAdapter is a TransferAdapter storing the large files in a directory,
+// as git-lfs does in .git/lfs/objects.
+type LocalAdapter struct {
+	fs billy.Filesystem
+}
+
+// NewLocalAdapter returns a LocalAdapter storing the large files in the
+// given filesystem.
+func NewLocalAdapter(fs billy.Filesystem) *LocalAdapter {
+	return &LocalAdapter{fs: fs}
+}
+
+// Download returns the content of the large file of the given pointer.
+func (a *LocalAdapter) Download(p *Pointer) (io.ReadCloser, error) {
+	f, err := a.fs.Open(a.path(p))
+	if os.IsNotExist(err) {
+		return nil, ErrObjectNotFound
+	}
+
+	return f, err
+}
+
+// Upload stores the content of the large file of the given pointer, unless
+// it already exists.
+func (a *LocalAdapter) Upload(p *Pointer, r io.Reader) (err error) {
+	name := a.path(p)
+	if _, err := a.fs.Stat(name); err == nil {
+		return nil
+	}
+
+	dir := path.Dir(name)
+	if err := a.fs.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := a.fs.TempFile(dir, "incoming-")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = a.fs.Remove(tmp.Name())
+		}
+	}()
+
+	_, err = io.Copy(tmp, p.Verify(r))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return a.fs.Rename(tmp.Name(), name)
+}
+
+// store stores the large file read from r, whose pointer is computed as it
+// is read, and returns its pointer.
+func (a *LocalAdapter) store(r io.Reader) (p *Pointer, err error) {
+	tmp, err := a.fs.TempFile("", "incoming-")
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = a.fs.Remove(tmp.Name())
+		}
+	}()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	p = &Pointer{Oid: hex.EncodeToString(h.Sum(nil)), Size: n}
+	name := a.path(p)
+	if _, err := a.fs.Stat(name); err == nil {
+		return p, a.fs.Remove(tmp.Name())
+	}
+
+	if err := a.fs.MkdirAll(path.Dir(name), 0755); err != nil {
+		return nil, err
+	}
+
+	return p, a.fs.Rename(tmp.Name(), name)
+}
+
+func (a *LocalAdapter) path(p *Pointer) string {
+	return path.Join(p.Oid[0:2], p.Oid[2:4], p.Oid)
+}
@@ -0,0 +1,120 @@
+package lfs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+type LocalAdapterSuite struct{}
+
+var _ = Suite(&LocalAdapterSuite{})
+
+func (s *LocalAdapterSuite) TestUploadDownload(c *C) {
+	fs := memfs.New()
+	a := NewLocalAdapter(fs)
+	p := &Pointer{Oid: fooOid, Size: 4}
+
+	_, err := a.Download(p)
+	c.Assert(err, Equals, ErrObjectNotFound)
+
+	c.Assert(a.Upload(p, strings.NewReader("foo\n")), IsNil)
+
+	content, err := util.ReadFile(fs, "b5/bb/"+fooOid)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "foo\n")
+
+	r, err := a.Download(p)
+	c.Assert(err, IsNil)
+	content, err = ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Assert(r.Close(), IsNil)
+	c.Assert(string(content), Equals, "foo\n")
+}
+
+func (s *LocalAdapterSuite) TestUploadMismatch(c *C) {
+	fs := memfs.New()
+	a := NewLocalAdapter(fs)
+	p := &Pointer{Oid: fooOid, Size: 4}
+
+	err := a.Upload(p, strings.NewReader("bar\n"))
+	c.Assert(err, Equals, ErrObjectMismatch)
+
+	files, err := fs.ReadDir("b5/bb")
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 0)
+}
+
+type FilterSuite struct{}
+
+var _ = Suite(&FilterSuite{})
+
+func (s *FilterSuite) TestCleanSmudge(c *C) {
+	fs := memfs.New()
+	f := NewFilter(NewLocalAdapter(fs), nil)
+
+	pointer, err := convert(f.Clean, "foo", "foo\n")
+	c.Assert(err, IsNil)
+	c.Assert(pointer, Equals, fooPointer)
+
+	// the large files are stored as they are cleaned
+	content, err := util.ReadFile(fs, "b5/bb/"+fooOid)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "foo\n")
+
+	files, err := fs.ReadDir("/")
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 1)
+
+	// the pointers are kept as they are
+	cleaned, err := convert(f.Clean, "foo", pointer)
+	c.Assert(err, IsNil)
+	c.Assert(cleaned, Equals, fooPointer)
+
+	smudged, err := convert(f.Smudge, "foo", pointer)
+	c.Assert(err, IsNil)
+	c.Assert(smudged, Equals, "foo\n")
+
+	smudged, err = convert(f.Smudge, "bar", "bar\n")
+	c.Assert(err, IsNil)
+	c.Assert(smudged, Equals, "bar\n")
+
+	c.Assert(util.WriteFile(fs, "b5/bb/"+fooOid, []byte("bar\n"), 0644), IsNil)
+	_, err = convert(f.Smudge, "foo", pointer)
+	c.Assert(err, Equals, ErrObjectMismatch)
+
+	c.Assert(fs.Remove("b5/bb/"+fooOid), IsNil)
+	_, err = convert(f.Smudge, "foo", pointer)
+	c.Assert(err, Equals, ErrObjectNotFound)
+
+	c.Assert(f.Upload(&Pointer{Oid: fooOid, Size: 4}), Equals, ErrNoRemoteAdapter)
+}
+
+func (s *FilterSuite) TestNormalize(c *C) {
+	fs := memfs.New()
+	f := NewFilter(NewLocalAdapter(fs), nil)
+
+	pointer, err := convert(f.Normalize, "foo", "foo\n")
+	c.Assert(err, IsNil)
+	c.Assert(pointer, Equals, fooPointer)
+
+	files, err := fs.ReadDir("/")
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 0)
+
+	normalized, err := convert(f.Normalize, "foo", pointer)
+	c.Assert(err, IsNil)
+	c.Assert(normalized, Equals, fooPointer)
+}
+
+// convert runs the given conversion of a filter on the given content.
+func convert(fn func(string, io.Writer, io.Reader) error, path, content string) (string, error) {
+	buf := bytes.NewBuffer(nil)
+	err := fn(path, buf, strings.NewReader(content))
+	return buf.String(), err
+}
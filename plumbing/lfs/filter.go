@@ -0,0 +1,203 @@
+package lfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// ErrNoRemoteAdapter is returned uploading the large files through a Filter
+// without a remote adapter.
+var ErrNoRemoteAdapter = errors.New("lfs remote adapter not configured")
+
+// Filter is the lfs filter driver, replacing the large files with their
+// pointers in the repository. It implements the git.NormalizeFilter
+// interface, and it is registered in a worktree with the name of the filter
+// gitattribute, lfs as set by git lfs track:
+//
+//	w.Filters = map[string]git.Filter{"lfs": lfs.NewFilter(local, remote)}
+//
+// The large files are only stored in the local adapter when the files are
+// cleaned, computing the status and the diff of a worktree only hashes them
+// and never transfers them. They are uploaded through the remote adapter by
+// Upload, before pushing the commits pointing to them.
+type Filter struct {
+	local  *LocalAdapter
+	remote TransferAdapter
+}
+
+// NewFilter returns a Filter storing the large files with the given local
+// adapter, usually in .git/lfs/objects. The large files missing there are
+// downloaded through the remote adapter, if it isn't nil.
+func NewFilter(local *LocalAdapter, remote TransferAdapter) *Filter {
+	return &Filter{local: local, remote: remote}
+}
+
+// Clean stores the large file read from src with the local adapter and
+// writes its pointer to dst. The pointers are kept as they are.
+func (f *Filter) Clean(path string, dst io.Writer, src io.Reader) error {
+	p, head, err := readPointer(src)
+	if err != nil {
+		return err
+	}
+
+	if p == nil {
+		p, err = f.local.store(io.MultiReader(bytes.NewReader(head), src))
+		if err != nil {
+			return err
+		}
+
+		head = p.Encode()
+	}
+
+	_, err = dst.Write(head)
+	return err
+}
+
+// Normalize writes to dst the pointer of the large file read from src, as
+// Clean does, without storing the large file. The pointers are kept as they
+// are.
+func (f *Filter) Normalize(path string, dst io.Writer, src io.Reader) error {
+	p, head, err := readPointer(src)
+	if err != nil {
+		return err
+	}
+
+	if p == nil {
+		p, err = NewPointer(io.MultiReader(bytes.NewReader(head), src))
+		if err != nil {
+			return err
+		}
+
+		head = p.Encode()
+	}
+
+	_, err = dst.Write(head)
+	return err
+}
+
+// Smudge writes to dst the large file of the pointer read from src, read
+// with the local adapter or else downloaded through the remote adapter. The
+// content which isn't a pointer is kept as it is.
+func (f *Filter) Smudge(path string, dst io.Writer, src io.Reader) error {
+	p, head, err := readPointer(src)
+	if err != nil {
+		return err
+	}
+
+	if p == nil {
+		_, err = io.Copy(dst, io.MultiReader(bytes.NewReader(head), src))
+		return err
+	}
+
+	r, err := f.local.Download(p)
+	if err == ErrObjectNotFound && f.remote != nil {
+		r, err = f.fetch(p)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+	_, err = io.Copy(dst, p.Verify(r))
+	return err
+}
+
+// fetch downloads the large file of the given pointer through the remote
+// adapter, storing it with the local one.
+func (f *Filter) fetch(p *Pointer) (io.ReadCloser, error) {
+	r, err := f.remote.Download(p)
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.local.Upload(p, r)
+	if closeErr := r.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return f.local.Download(p)
+}
+
+// Upload uploads the large files of the given pointers, stored with the local
+// adapter, through the remote adapter, as the git lfs pre-push hook does
+// before pushing the commits pointing to them.
+func (f *Filter) Upload(pointers ...*Pointer) error {
+	if f.remote == nil {
+		return ErrNoRemoteAdapter
+	}
+
+	for _, p := range pointers {
+		if err := f.upload(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *Filter) upload(p *Pointer) error {
+	r, err := f.local.Download(p)
+	if err != nil {
+		return err
+	}
+
+	err = f.remote.Upload(p, r)
+	if closeErr := r.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// TreePointers returns the pointers of the files of the given tree, to upload
+// the large files of a commit.
+func TreePointers(t *object.Tree) ([]*Pointer, error) {
+	var pointers []*Pointer
+	seen := make(map[string]bool)
+	err := t.Files().ForEach(func(f *object.File) error {
+		if f.Size > MaxPointerSize || !f.Mode.IsFile() {
+			return nil
+		}
+
+		content, err := f.Contents()
+		if err != nil {
+			return err
+		}
+
+		p, err := DecodePointer([]byte(content))
+		if err != nil || seen[p.Oid] {
+			return nil
+		}
+
+		seen[p.Oid] = true
+		pointers = append(pointers, p)
+		return nil
+	})
+
+	return pointers, err
+}
+
+// readPointer reads the beginning of the given content, returning its pointer
+// or nil if the content isn't a pointer file, and the content read.
+func readPointer(r io.Reader) (*Pointer, []byte, error) {
+	head, err := ioutil.ReadAll(io.LimitReader(r, MaxPointerSize+1))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p, err := DecodePointer(head)
+	if err != nil {
+		return nil, head, nil
+	}
+
+	return p, head, nil
+}
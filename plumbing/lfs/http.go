@@ -0,0 +1,248 @@
+package lfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/utils/ioutil"
+)
+
+const (
+	mediaType     = "application/vnd.git-lfs+json"
+	basicTransfer = "basic"
+)
+
+// HTTPAdapter is a TransferAdapter transferring the large files from and to
+// a Git LFS server, through its batch API and the basic transfer adapter.
+type HTTPAdapter struct {
+	endpoint string
+	auth     githttp.AuthMethod
+	client   *http.Client
+}
+
+// NewHTTPAdapter returns a HTTPAdapter using the LFS server at the given
+// endpoint, such as https://example.com/repo.git/info/lfs. The auth is used
+// for the requests to the batch API, and the default client is used if
+// client is nil.
+func NewHTTPAdapter(endpoint string, auth githttp.AuthMethod, client *http.Client) *HTTPAdapter {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &HTTPAdapter{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		auth:     auth,
+		client:   client,
+	}
+}
+
+// Endpoint returns the default LFS server endpoint of the repository with the
+// given HTTP URL.
+func Endpoint(url string) string {
+	url = strings.TrimSuffix(url, "/")
+	if !strings.HasSuffix(url, ".git") {
+		url += ".git"
+	}
+
+	return url + "/info/lfs"
+}
+
+type batchRequest struct {
+	Operation string         `json:"operation"`
+	Transfers []string       `json:"transfers"`
+	Objects   []batchPointer `json:"objects"`
+}
+
+type batchPointer struct {
+	Oid  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+type batchResponse struct {
+	Transfer string        `json:"transfer"`
+	Objects  []batchObject `json:"objects"`
+}
+
+type batchObject struct {
+	batchPointer
+	Actions map[string]*batchAction `json:"actions"`
+	Error   *batchError             `json:"error"`
+}
+
+type batchAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header"`
+}
+
+type batchError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Download returns the content of the large file of the given pointer.
+func (a *HTTPAdapter) Download(p *Pointer) (io.ReadCloser, error) {
+	obj, err := a.batch("download", p)
+	if err != nil {
+		return nil, err
+	}
+
+	action := obj.Actions["download"]
+	if action == nil {
+		return nil, fmt.Errorf("lfs server didn't return a download action for %s", p.Oid)
+	}
+
+	res, err := a.do(action, http.MethodGet, nil, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+// Upload stores the content of the large file of the given pointer, unless
+// the server already has it.
+func (a *HTTPAdapter) Upload(p *Pointer, r io.Reader) error {
+	obj, err := a.batch("upload", p)
+	if err != nil {
+		return err
+	}
+
+	action := obj.Actions["upload"]
+	if action == nil {
+		return nil
+	}
+
+	res, err := a.do(action, http.MethodPut, p.Verify(r), p.Size)
+	if err != nil {
+		return err
+	}
+
+	if err := res.Body.Close(); err != nil {
+		return err
+	}
+
+	verify := obj.Actions["verify"]
+	if verify == nil {
+		return nil
+	}
+
+	body, err := json.Marshal(batchPointer{Oid: p.Oid, Size: p.Size})
+	if err != nil {
+		return err
+	}
+
+	res, err = a.do(verify, http.MethodPost, bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
+
+// batch requests the given operation of the large file of the given pointer
+// to the batch API.
+func (a *HTTPAdapter) batch(operation string, p *Pointer) (obj *batchObject, err error) {
+	body, err := json.Marshal(&batchRequest{
+		Operation: operation,
+		Transfers: []string{basicTransfer},
+		Objects:   []batchPointer{{Oid: p.Oid, Size: p.Size}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, a.endpoint+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", mediaType)
+	req.Header.Set("Content-Type", mediaType)
+	if a.auth != nil {
+		a.auth.SetAuth(req)
+	}
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(res.Body, &err)
+
+	if err := githttp.NewErr(res); err != nil {
+		return nil, err
+	}
+
+	var batch batchResponse
+	if err := json.NewDecoder(res.Body).Decode(&batch); err != nil {
+		return nil, err
+	}
+
+	if batch.Transfer != "" && batch.Transfer != basicTransfer {
+		return nil, fmt.Errorf("unsupported lfs transfer adapter %q", batch.Transfer)
+	}
+
+	for i := range batch.Objects {
+		obj := &batch.Objects[i]
+		if obj.Oid != p.Oid {
+			continue
+		}
+
+		if obj.Error == nil {
+			return obj, nil
+		}
+
+		if obj.Error.Code == http.StatusNotFound {
+			return nil, ErrObjectNotFound
+		}
+
+		return nil, fmt.Errorf("lfs object %s: %s", p.Oid, obj.Error.Message)
+	}
+
+	return nil, fmt.Errorf("lfs server didn't return the object %s", p.Oid)
+}
+
+// do requests the given action, the response body is closed on failure.
+func (a *HTTPAdapter) do(action *batchAction, method string, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequest(method, action.Href, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if size >= 0 {
+		req.ContentLength = size
+	}
+
+	for k, v := range action.Header {
+		req.Header.Set(k, v)
+	}
+
+	if method == http.MethodPut {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	} else if method == http.MethodPost {
+		req.Header.Set("Accept", mediaType)
+		req.Header.Set("Content-Type", mediaType)
+	}
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotFound && method == http.MethodGet {
+		res.Body.Close()
+		return nil, ErrObjectNotFound
+	}
+
+	if err := githttp.NewErr(res); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,192 @@
+package lfs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+type HTTPAdapterSuite struct {
+	server  *httptest.Server
+	mu      sync.Mutex
+	objects map[string][]byte
+	verify  []string
+}
+
+var _ = Suite(&HTTPAdapterSuite{})
+
+func (s *HTTPAdapterSuite) SetUpTest(c *C) {
+	s.objects = make(map[string][]byte)
+	s.verify = nil
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repo.git/info/lfs/objects/batch", s.batch)
+	mux.HandleFunc("/objects/", s.object)
+	mux.HandleFunc("/verify", func(w http.ResponseWriter, r *http.Request) {
+		var p batchPointer
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		s.verify = append(s.verify, p.Oid)
+		s.mu.Unlock()
+	})
+
+	s.server = httptest.NewServer(mux)
+}
+
+func (s *HTTPAdapterSuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *HTTPAdapterSuite) batch(w http.ResponseWriter, r *http.Request) {
+	if user, pass, _ := r.BasicAuth(); user != "user" || pass != "pass" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var req batchRequest
+	if r.Header.Get("Content-Type") != mediaType {
+		http.Error(w, "invalid media type", http.StatusBadRequest)
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := batchResponse{Transfer: basicTransfer}
+	for _, p := range req.Objects {
+		obj := batchObject{batchPointer: p, Actions: make(map[string]*batchAction)}
+		action := &batchAction{
+			Href:   s.server.URL + "/objects/" + p.Oid,
+			Header: map[string]string{"Authorization": "RemoteAuth token"},
+		}
+
+		_, ok := s.objects[p.Oid]
+		switch {
+		case req.Operation == "download" && ok:
+			obj.Actions["download"] = action
+		case req.Operation == "download":
+			obj.Error = &batchError{Code: http.StatusNotFound, Message: "not found"}
+		case !ok:
+			obj.Actions["upload"] = action
+			obj.Actions["verify"] = &batchAction{Href: s.server.URL + "/verify"}
+		}
+
+		res.Objects = append(res.Objects, obj)
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	_ = json.NewEncoder(w).Encode(&res)
+}
+
+func (s *HTTPAdapterSuite) object(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "RemoteAuth token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	oid := strings.TrimPrefix(r.URL.Path, "/objects/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		content, ok := s.objects[oid]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = w.Write(content)
+	case http.MethodPut:
+		content, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.objects[oid] = content
+	}
+}
+
+func (s *HTTPAdapterSuite) adapter() *HTTPAdapter {
+	auth := &githttp.BasicAuth{Username: "user", Password: "pass"}
+	return NewHTTPAdapter(Endpoint(s.server.URL+"/repo"), auth, s.server.Client())
+}
+
+func (s *HTTPAdapterSuite) TestEndpoint(c *C) {
+	c.Assert(Endpoint("https://example.com/foo"), Equals, "https://example.com/foo.git/info/lfs")
+	c.Assert(Endpoint("https://example.com/foo.git/"), Equals, "https://example.com/foo.git/info/lfs")
+}
+
+func (s *HTTPAdapterSuite) TestUploadDownload(c *C) {
+	a := s.adapter()
+	p := &Pointer{Oid: fooOid, Size: 4}
+
+	_, err := a.Download(p)
+	c.Assert(err, Equals, ErrObjectNotFound)
+
+	c.Assert(a.Upload(p, strings.NewReader("foo\n")), IsNil)
+	c.Assert(string(s.objects[fooOid]), Equals, "foo\n")
+	c.Assert(s.verify, DeepEquals, []string{fooOid})
+
+	// the objects stored aren't uploaded again
+	c.Assert(a.Upload(p, strings.NewReader("foo\n")), IsNil)
+	c.Assert(s.verify, HasLen, 1)
+
+	r, err := a.Download(p)
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Assert(r.Close(), IsNil)
+	c.Assert(string(content), Equals, "foo\n")
+}
+
+func (s *HTTPAdapterSuite) TestFilter(c *C) {
+	f := NewFilter(NewLocalAdapter(memfs.New()), s.adapter())
+
+	pointer, err := convert(f.Clean, "foo", "foo\n")
+	c.Assert(err, IsNil)
+	c.Assert(pointer, Equals, fooPointer)
+
+	// the large files are only uploaded explicitly
+	c.Assert(s.objects, HasLen, 0)
+	c.Assert(f.Upload(&Pointer{Oid: fooOid, Size: 4}), IsNil)
+	c.Assert(string(s.objects[fooOid]), Equals, "foo\n")
+
+	// the large files missing locally are downloaded and stored
+	local := memfs.New()
+	f = NewFilter(NewLocalAdapter(local), s.adapter())
+	content, err := convert(f.Smudge, "foo", pointer)
+	c.Assert(err, IsNil)
+	c.Assert(content, Equals, "foo\n")
+
+	stored, err := util.ReadFile(local, "b5/bb/"+fooOid)
+	c.Assert(err, IsNil)
+	c.Assert(string(stored), Equals, "foo\n")
+}
+
+func (s *HTTPAdapterSuite) TestAuthenticationRequired(c *C) {
+	a := NewHTTPAdapter(Endpoint(s.server.URL+"/repo"), nil, nil)
+	_, err := a.Download(&Pointer{Oid: fooOid, Size: 4})
+	c.Assert(err, Equals, transport.ErrAuthenticationRequired)
+}
@@ -0,0 +1,130 @@
+// Package lfs implements the Git LFS pointer files and the transfer of the
+// large files they point to, and a filter driver replacing the files with
+// their pointers in the repository.
+//
+// See https://github.com/git-lfs/git-lfs/blob/main/docs/spec.md
+package lfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidPointer is returned decoding content which isn't a valid
+	// pointer file.
+	ErrInvalidPointer = errors.New("invalid lfs pointer")
+	// ErrObjectMismatch is returned reading a large file whose content
+	// doesn't match its pointer.
+	ErrObjectMismatch = errors.New("lfs object doesn't match its pointer")
+)
+
+const (
+	// Version is the version of the pointer files, the URL of their
+	// specification.
+	Version = "https://git-lfs.github.com/spec/v1"
+	// MaxPointerSize is the maximum size of a pointer file.
+	MaxPointerSize = 1024
+
+	oidPrefix = "sha256:"
+)
+
+// Pointer is a Git LFS pointer file, the content stored in the repository in
+// place of a large file.
+type Pointer struct {
+	// Oid is the hex encoded SHA-256 hash of the large file.
+	Oid string
+	// Size is the size of the large file in bytes.
+	Size int64
+}
+
+// NewPointer returns the pointer of the large file with the given content.
+func NewPointer(r io.Reader) (*Pointer, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pointer{Oid: hex.EncodeToString(h.Sum(nil)), Size: n}, nil
+}
+
+// DecodePointer decodes the given pointer file content.
+func DecodePointer(content []byte) (*Pointer, error) {
+	if len(content) > MaxPointerSize || !bytes.HasPrefix(content, []byte("version ")) {
+		return nil, ErrInvalidPointer
+	}
+
+	values := make(map[string]string)
+	for i, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+		kv := strings.SplitN(line, " ", 2)
+		if len(kv) != 2 || (i == 0) != (kv[0] == "version") {
+			return nil, ErrInvalidPointer
+		}
+
+		values[kv[0]] = kv[1]
+	}
+
+	if values["version"] != Version || !strings.HasPrefix(values["oid"], oidPrefix) {
+		return nil, ErrInvalidPointer
+	}
+
+	p := &Pointer{Oid: strings.TrimPrefix(values["oid"], oidPrefix)}
+	if len(p.Oid) != sha256.Size*2 {
+		return nil, ErrInvalidPointer
+	}
+
+	if _, err := hex.DecodeString(p.Oid); err != nil {
+		return nil, ErrInvalidPointer
+	}
+
+	size, err := strconv.ParseInt(values["size"], 10, 64)
+	if err != nil || size < 0 {
+		return nil, ErrInvalidPointer
+	}
+
+	p.Size = size
+	return p, nil
+}
+
+// Encode returns the content of the pointer file.
+func (p *Pointer) Encode() []byte {
+	return []byte(p.String())
+}
+
+func (p *Pointer) String() string {
+	return fmt.Sprintf("version %s\noid %s%s\nsize %d\n", Version, oidPrefix, p.Oid, p.Size)
+}
+
+// Verify returns a reader reading the given content of the large file, which
+// fails with ErrObjectMismatch at the end of the content if it doesn't match
+// the pointer.
+func (p *Pointer) Verify(r io.Reader) io.Reader {
+	return &verifier{r: r, p: p, h: sha256.New()}
+}
+
+type verifier struct {
+	r io.Reader
+	p *Pointer
+	h hash.Hash
+	n int64
+}
+
+func (v *verifier) Read(b []byte) (int, error) {
+	n, err := v.r.Read(b)
+	v.h.Write(b[:n])
+	v.n += int64(n)
+
+	if err == io.EOF && (v.n != v.p.Size || hex.EncodeToString(v.h.Sum(nil)) != v.p.Oid) {
+		return n, ErrObjectMismatch
+	}
+
+	return n, err
+}
@@ -0,0 +1,71 @@
+package lfs
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type PointerSuite struct{}
+
+var _ = Suite(&PointerSuite{})
+
+const (
+	fooOid     = "b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c"
+	fooPointer = "version https://git-lfs.github.com/spec/v1\n" +
+		"oid sha256:" + fooOid + "\n" +
+		"size 4\n"
+)
+
+func (s *PointerSuite) TestNewPointer(c *C) {
+	p, err := NewPointer(strings.NewReader("foo\n"))
+	c.Assert(err, IsNil)
+	c.Assert(p, DeepEquals, &Pointer{Oid: fooOid, Size: 4})
+	c.Assert(string(p.Encode()), Equals, fooPointer)
+}
+
+func (s *PointerSuite) TestDecodePointer(c *C) {
+	p, err := DecodePointer([]byte(fooPointer))
+	c.Assert(err, IsNil)
+	c.Assert(p, DeepEquals, &Pointer{Oid: fooOid, Size: 4})
+
+	// the unknown keys are ignored
+	p, err = DecodePointer([]byte(fooPointer + "x-foo bar\n"))
+	c.Assert(err, IsNil)
+	c.Assert(p.Size, Equals, int64(4))
+}
+
+func (s *PointerSuite) TestDecodePointerInvalid(c *C) {
+	for _, content := range []string{
+		"",
+		"foo\n",
+		"oid sha256:" + fooOid + "\nversion https://git-lfs.github.com/spec/v1\nsize 4\n",
+		"version https://git-lfs.github.com/spec/v2\noid sha256:" + fooOid + "\nsize 4\n",
+		"version https://git-lfs.github.com/spec/v1\noid sha256:foo\nsize 4\n",
+		"version https://git-lfs.github.com/spec/v1\noid md5:" + fooOid + "\nsize 4\n",
+		"version https://git-lfs.github.com/spec/v1\noid sha256:" + fooOid + "\n",
+		"version https://git-lfs.github.com/spec/v1\noid sha256:" + fooOid + "\nsize -1\n",
+		fooPointer + strings.Repeat("x", MaxPointerSize),
+	} {
+		_, err := DecodePointer([]byte(content))
+		c.Assert(err, Equals, ErrInvalidPointer, Commentf("%q", content))
+	}
+}
+
+func (s *PointerSuite) TestVerify(c *C) {
+	p := &Pointer{Oid: fooOid, Size: 4}
+
+	content, err := ioutil.ReadAll(p.Verify(strings.NewReader("foo\n")))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "foo\n")
+
+	_, err = ioutil.ReadAll(p.Verify(strings.NewReader("bar\n")))
+	c.Assert(err, Equals, ErrObjectMismatch)
+
+	_, err = ioutil.ReadAll(p.Verify(strings.NewReader("foo")))
+	c.Assert(err, Equals, ErrObjectMismatch)
+}
@@ -126,6 +126,18 @@ func (r ReferenceName) Short() string {
 const (
 	HEAD   ReferenceName = "HEAD"
 	Master ReferenceName = "refs/heads/master"
+	// OrigHead records the position of HEAD before a drastic operation, such
+	// as a merge or a reset, so it can be easily restored.
+	OrigHead ReferenceName = "ORIG_HEAD"
+	// MergeHead records the commit being merged into HEAD, while a merge is
+	// in progress.
+	MergeHead ReferenceName = "MERGE_HEAD"
+	// CherryPickHead records the commit being cherry-picked, while a
+	// cherry-pick is stopped because of conflicts.
+	CherryPickHead ReferenceName = "CHERRY_PICK_HEAD"
+	// RevertHead records the commit being reverted, while a revert is
+	// stopped because of conflicts.
+	RevertHead ReferenceName = "REVERT_HEAD"
 )
 
 // Reference is a representation of git reference
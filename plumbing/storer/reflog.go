@@ -0,0 +1,22 @@
+package storer
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
+)
+
+// ReflogStorer is a storage of reflogs, the logs of the updates made to the
+// references. Storers implementing it, in addition to ReferenceStorer, get
+// the updates made to HEAD and to the branches logged.
+type ReflogStorer interface {
+	// Reflog returns the entries of the reflog of the given reference, from
+	// the oldest one. No entries are returned if the reference doesn't
+	// have a reflog.
+	Reflog(plumbing.ReferenceName) ([]*reflog.Entry, error)
+	// AppendReflog adds an entry to the reflog of the given reference.
+	AppendReflog(plumbing.ReferenceName, *reflog.Entry) error
+	// SetReflog replaces the entries of the reflog of the given reference.
+	SetReflog(plumbing.ReferenceName, []*reflog.Entry) error
+	// RemoveReflog removes the reflog of the given reference.
+	RemoveReflog(plumbing.ReferenceName) error
+}
@@ -0,0 +1,304 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/internal/revision"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// isReflogged returns true if the updates of the given reference are logged,
+// following core.logAllRefUpdates: by default, as git does, HEAD, the
+// branches, the remote-tracking branches and the notes of non-bare
+// repositories. The updates of references already having a reflog are
+// always logged. The reflog of the stash is kept by Worktree.Stash.
+func isReflogged(s storer.ReferenceStorer, rs storer.ReflogStorer, n plumbing.ReferenceName) (bool, error) {
+	mode := "true"
+	if cs, ok := s.(config.ConfigStorer); ok {
+		cfg, err := cs.Config()
+		if err != nil {
+			return false, err
+		}
+
+		mode = strings.ToLower(cfg.Core.LogAllRefUpdates)
+		if mode == "" && cfg.Core.IsBare {
+			mode = "false"
+		}
+	}
+
+	switch mode {
+	case "always":
+		if n == plumbing.HEAD || strings.HasPrefix(n.String(), "refs/") {
+			return true, nil
+		}
+	case "false":
+	default:
+		if n == plumbing.HEAD || n.IsBranch() || n.IsRemote() || n.IsNote() {
+			return true, nil
+		}
+	}
+
+	entries, err := rs.Reflog(n)
+	return len(entries) > 0, err
+}
+
+// updateReference sets ref in s, if old is not nil it first checks the
+// stored value matches old, see storer.ReferenceStorer.CheckAndSetReference.
+//
+// The update is logged, with the given message and committer, in the reflog
+// of the reference and in the one of HEAD when HEAD points to it. Updates not
+// changing the reference are not logged, neither are the ones of storers
+// not implementing storer.ReflogStorer.
+func updateReference(s storer.ReferenceStorer, ref, old *plumbing.Reference, msg string, committer *object.Signature) error {
+	current, err := s.Reference(ref.Name())
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		return err
+	}
+
+	from, err := resolvedHash(s, ref.Name())
+	if err != nil {
+		return err
+	}
+
+	if err := s.CheckAndSetReference(ref, old); err != nil {
+		return err
+	}
+
+	if current != nil && current.String() == ref.String() {
+		return nil
+	}
+
+	to, err := resolvedHash(s, ref.Name())
+	if err != nil || to.IsZero() {
+		return err
+	}
+
+	return logReferenceUpdate(s, ref.Name(), from, to, msg, committer)
+}
+
+// resolvedHash returns the hash the given reference resolves to, the zero
+// hash if it doesn't exist.
+func resolvedHash(s storer.ReferenceStorer, n plumbing.ReferenceName) (plumbing.Hash, error) {
+	ref, err := storer.ResolveReference(s, n)
+	if err == plumbing.ErrReferenceNotFound {
+		return plumbing.ZeroHash, nil
+	}
+
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return ref.Hash(), nil
+}
+
+func logReferenceUpdate(s storer.ReferenceStorer, n plumbing.ReferenceName, from, to plumbing.Hash, msg string, committer *object.Signature) error {
+	rs, ok := s.(storer.ReflogStorer)
+	if !ok {
+		return nil
+	}
+
+	names := []plumbing.ReferenceName{n}
+	if n != plumbing.HEAD {
+		head, err := s.Reference(plumbing.HEAD)
+		if err != nil && err != plumbing.ErrReferenceNotFound {
+			return err
+		}
+
+		if head != nil && head.Type() == plumbing.SymbolicReference && head.Target() == n {
+			names = append(names, plumbing.HEAD)
+		}
+	}
+
+	e := &reflog.Entry{
+		Old: from,
+		New: to,
+		Committer: reflog.Signature{
+			Name:  committer.Name,
+			Email: committer.Email,
+			When:  committer.When,
+		},
+		Message: msg,
+	}
+
+	for _, name := range names {
+		ok, err := isReflogged(s, rs, name)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			continue
+		}
+
+		if err := rs.AppendReflog(name, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reflogCommitter returns the signature of the reflog entries of an
+// operation: its committer, or if nil the identity read from the config of s
+// and from the global config. It is resolved once per operation, and not for
+// each of the references the operation updates.
+func reflogCommitter(s storer.ReferenceStorer, committer *object.Signature) *object.Signature {
+	if committer != nil {
+		return committer
+	}
+
+	sig := &object.Signature{When: time.Now()}
+
+	var configs []*config.Config
+	if cs, ok := s.(config.ConfigStorer); ok {
+		if cfg, err := cs.Config(); err == nil {
+			configs = append(configs, cfg)
+		}
+	}
+
+	if cfg, err := config.LoadConfig(config.GlobalScope); err == nil {
+		configs = append(configs, cfg)
+	}
+
+	for _, cfg := range configs {
+		for _, user := range []struct{ Name, Email string }{
+			{cfg.Committer.Name, cfg.Committer.Email},
+			{cfg.User.Name, cfg.User.Email},
+		} {
+			if user.Name != "" && user.Email != "" {
+				sig.Name, sig.Email = user.Name, user.Email
+				return sig
+			}
+		}
+	}
+
+	return sig
+}
+
+// setReference sets ref, logging the update with the given message and
+// committer, see updateReference.
+func (r *Repository) setReference(ref *plumbing.Reference, msg string, committer *object.Signature) error {
+	return updateReference(r.Storer, ref, nil, msg, committer)
+}
+
+// reflogStorer returns the storage of the reflogs. Storers not implementing
+// storer.ReflogStorer get one in memory, bound to the Repository.
+func (r *Repository) reflogStorer() storer.ReflogStorer {
+	if rs, ok := r.Storer.(storer.ReflogStorer); ok {
+		return rs
+	}
+
+	if r.reflogs == nil {
+		r.reflogs = make(memory.ReflogStorage)
+	}
+
+	return r.reflogs
+}
+
+// resolveReflogRevision resolves the @{<n>} and @{<date>} statements from the
+// reflog of the given reference, or from the one of the current branch if
+// ref is empty.
+func (r *Repository) resolveReflogRevision(ref revision.Ref, item revision.Revisioner) (plumbing.Hash, error) {
+	name, err := r.reflogReferenceName(ref)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	log, err := r.reflogStorer().Reflog(name)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	switch item := item.(type) {
+	case revision.AtReflog:
+		if item.Depth >= len(log) {
+			return plumbing.ZeroHash, fmt.Errorf("log for %s only has %d entries", name.Short(), len(log))
+		}
+
+		return log[len(log)-1-item.Depth].New, nil
+	case revision.AtDate:
+		if len(log) == 0 {
+			return plumbing.ZeroHash, fmt.Errorf("log for %s is empty", name.Short())
+		}
+
+		for i := len(log) - 1; i >= 0; i-- {
+			if !log[i].Committer.When.After(item.Date) {
+				return log[i].New, nil
+			}
+		}
+
+		// the date is older than the log, the oldest known value is used
+		if !log[0].Old.IsZero() {
+			return log[0].Old, nil
+		}
+
+		return log[0].New, nil
+	}
+
+	return plumbing.ZeroHash, fmt.Errorf("unsupported reflog statement %T", item)
+}
+
+// reflogReferenceName returns the name of the reference the given revision
+// reference refers to, being the current branch if ref is empty.
+func (r *Repository) reflogReferenceName(ref revision.Ref) (plumbing.ReferenceName, error) {
+	if ref == "" {
+		head, err := r.Storer.Reference(plumbing.HEAD)
+		if err != nil {
+			return "", err
+		}
+
+		if head.Type() == plumbing.SymbolicReference {
+			return head.Target(), nil
+		}
+
+		return plumbing.HEAD, nil
+	}
+
+	for _, rule := range append([]string{"%s"}, plumbing.RefRevParseRules...) {
+		name := plumbing.ReferenceName(fmt.Sprintf(rule, ref))
+		if _, err := r.Storer.Reference(name); err == nil {
+			return name, nil
+		}
+	}
+
+	return "", plumbing.ErrReferenceNotFound
+}
+
+const checkoutReflogPrefix = "checkout: moving from "
+
+// previousCheckout returns the branch, or commit, checked out before the
+// n-th last checkout, as found in the reflog of HEAD.
+func (r *Repository) previousCheckout(n int) (string, error) {
+	log, err := r.reflogStorer().Reflog(plumbing.HEAD)
+	if err != nil {
+		return "", err
+	}
+
+	found := 0
+	for i := len(log) - 1; i >= 0; i-- {
+		if !strings.HasPrefix(log[i].Message, checkoutReflogPrefix) {
+			continue
+		}
+
+		found++
+		if found < n {
+			continue
+		}
+
+		from := strings.TrimPrefix(log[i].Message, checkoutReflogPrefix)
+		if to := strings.LastIndex(from, " to "); to != -1 {
+			from = from[:to]
+		}
+
+		return from, nil
+	}
+
+	return "", fmt.Errorf("only %d checkouts found in the reflog of HEAD", found)
+}
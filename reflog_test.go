@@ -0,0 +1,243 @@
+package git
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/memory"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+type ReflogSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&ReflogSuite{})
+
+func reflogMessages(c *C, r *Repository, name plumbing.ReferenceName) []string {
+	log, err := r.reflogStorer().Reflog(name)
+	c.Assert(err, IsNil)
+
+	var msgs []string
+	for _, e := range log {
+		msgs = append(msgs, e.Message)
+	}
+
+	return msgs
+}
+
+func prepareReflog(c *C) (*Repository, *Worktree, []plumbing.Hash) {
+	r, w := newMemoryWorktree(c)
+
+	first := commitFiles(c, w, "first", map[string]string{"foo": "foo\n"})
+	second := commitFiles(c, w, "second", map[string]string{"foo": "bar\n"})
+
+	err := w.Checkout(&CheckoutOptions{Branch: "refs/heads/feature", Create: true})
+	c.Assert(err, IsNil)
+
+	third := commitFiles(c, w, "third", map[string]string{"foo": "baz\n"})
+
+	err = w.Reset(&ResetOptions{Commit: second, Mode: HardReset})
+	c.Assert(err, IsNil)
+
+	return r, w, []plumbing.Hash{first, second, third}
+}
+
+func (s *ReflogSuite) TestReflog(c *C) {
+	r, _, hashes := prepareReflog(c)
+
+	c.Assert(reflogMessages(c, r, plumbing.HEAD), DeepEquals, []string{
+		"commit (initial): first",
+		"commit: second",
+		"checkout: moving from master to feature",
+		"commit: third",
+		"reset: moving to " + hashes[1].String(),
+	})
+
+	c.Assert(reflogMessages(c, r, plumbing.Master), DeepEquals, []string{
+		"commit (initial): first",
+		"commit: second",
+	})
+
+	c.Assert(reflogMessages(c, r, "refs/heads/feature"), DeepEquals, []string{
+		"branch: Created from HEAD",
+		"commit: third",
+		"reset: moving to " + hashes[1].String(),
+	})
+
+	log, err := r.reflogStorer().Reflog(plumbing.HEAD)
+	c.Assert(err, IsNil)
+	c.Assert(log[0].Old, Equals, plumbing.ZeroHash)
+	c.Assert(log[0].New, Equals, hashes[0])
+	c.Assert(log[4].Old, Equals, hashes[2])
+	c.Assert(log[4].New, Equals, hashes[1])
+
+	err = r.Storer.RemoveReference("refs/heads/feature")
+	c.Assert(err, IsNil)
+	c.Assert(reflogMessages(c, r, "refs/heads/feature"), HasLen, 0)
+}
+
+func (s *ReflogSuite) TestReflogCommitter(c *C) {
+	r, w, _ := prepareReflog(c)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.User.Name = "bar"
+	cfg.User.Email = "bar@bar.bar"
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	err = w.Checkout(&CheckoutOptions{Branch: plumbing.Master})
+	c.Assert(err, IsNil)
+
+	log, err := r.reflogStorer().Reflog(plumbing.HEAD)
+	c.Assert(err, IsNil)
+	c.Assert(log, HasLen, 6)
+
+	sig := defaultSignature()
+	c.Assert(log[1].Committer.Name, Equals, sig.Name)
+	c.Assert(log[1].Committer.Email, Equals, sig.Email)
+	c.Assert(log[1].Committer.When.Equal(sig.When), Equals, true)
+
+	c.Assert(log[5].Committer.Name, Equals, "bar")
+	c.Assert(log[5].Committer.Email, Equals, "bar@bar.bar")
+}
+
+func (s *ReflogSuite) TestResolveRevision(c *C) {
+	r, _, hashes := prepareReflog(c)
+
+	datas := map[string]plumbing.Hash{
+		"HEAD@{0}":    hashes[1],
+		"HEAD@{1}":    hashes[2],
+		"HEAD@{4}":    hashes[0],
+		"@{1}":        hashes[2],
+		"feature@{1}": hashes[2],
+		"master@{1}":  hashes[0],
+		"@{-1}":       hashes[1],
+	}
+
+	for rev, expected := range datas {
+		h, err := r.ResolveRevision(plumbing.Revision(rev))
+		c.Assert(err, IsNil, Commentf("revision: %s", rev))
+		c.Assert(*h, Equals, expected, Commentf("revision: %s", rev))
+	}
+
+	_, err := r.ResolveRevision("HEAD@{5}")
+	c.Assert(err, ErrorMatches, "log for HEAD only has 5 entries")
+}
+
+func (s *ReflogSuite) TestResolveRevisionDate(c *C) {
+	r, _, hashes := prepareReflog(c)
+
+	log, err := r.reflogStorer().Reflog(plumbing.Master)
+	c.Assert(err, IsNil)
+	c.Assert(log, HasLen, 2)
+
+	log[0].Committer.When = time.Now().AddDate(0, 0, -3)
+	log[1].Committer.When = time.Now().Add(-time.Hour)
+	err = r.reflogStorer().SetReflog(plumbing.Master, log)
+	c.Assert(err, IsNil)
+
+	datas := map[string]plumbing.Hash{
+		"master@{yesterday}":  hashes[0],
+		"master@{now}":        hashes[1],
+		"master@{2.days.ago}": hashes[0],
+		"master@{1.week.ago}": hashes[0],
+	}
+
+	for rev, expected := range datas {
+		h, err := r.ResolveRevision(plumbing.Revision(rev))
+		c.Assert(err, IsNil, Commentf("revision: %s", rev))
+		c.Assert(*h, Equals, expected, Commentf("revision: %s", rev))
+	}
+}
+
+func (s *ReflogSuite) TestReflogFilesystem(c *C) {
+	dir, clean := s.TemporalDir()
+	defer clean()
+
+	r, err := PlainInit(dir, false)
+	c.Assert(err, IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	h := commitFiles(c, w, "first", map[string]string{"foo": "foo\n"})
+
+	fs := osfs.New(dir)
+	content, err := util.ReadFile(fs, ".git/logs/refs/heads/master")
+	c.Assert(err, IsNil)
+
+	d := reflog.NewDecoder(bytes.NewReader(content))
+	e := &reflog.Entry{}
+	c.Assert(d.Decode(e), IsNil)
+	c.Assert(e.New, Equals, h)
+	c.Assert(e.Message, Equals, "commit (initial): first")
+
+	sto := filesystem.NewStorage(osfs.New(dir+"/.git"), cache.NewObjectLRUDefault())
+	log, err := sto.Reflog(plumbing.HEAD)
+	c.Assert(err, IsNil)
+	c.Assert(log, HasLen, 1)
+	c.Assert(log[0].New, Equals, h)
+}
+
+func (s *ReflogSuite) TestReflogClone(c *C) {
+	url := s.GetBasicLocalRepositoryURL()
+	r, err := Clone(memory.NewStorage(), memfs.New(), &CloneOptions{URL: url})
+	c.Assert(err, IsNil)
+
+	c.Assert(reflogMessages(c, r, plumbing.HEAD), DeepEquals, []string{"clone: from " + url})
+	c.Assert(reflogMessages(c, r, "refs/remotes/origin/master"), DeepEquals, []string{"fetch: storing head"})
+}
+
+func (s *ReflogSuite) TestReflogBare(c *C) {
+	r, _, hashes := prepareReflog(c)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Core.IsBare = true
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	ref := plumbing.NewHashReference("refs/heads/foo", hashes[0])
+	c.Assert(r.setReference(ref, "foo", defaultSignature()), IsNil)
+	c.Assert(reflogMessages(c, r, "refs/heads/foo"), HasLen, 0)
+
+	ref = plumbing.NewHashReference(plumbing.Master, hashes[0])
+	c.Assert(r.setReference(ref, "foo", defaultSignature()), IsNil)
+	c.Assert(reflogMessages(c, r, plumbing.Master), HasLen, 3)
+}
+
+func (s *ReflogSuite) TestReflogLogAllRefUpdates(c *C) {
+	r, _, hashes := prepareReflog(c)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Core.LogAllRefUpdates = "false"
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	ref := plumbing.NewHashReference("refs/heads/foo", hashes[0])
+	c.Assert(r.setReference(ref, "foo", defaultSignature()), IsNil)
+	c.Assert(reflogMessages(c, r, "refs/heads/foo"), HasLen, 0)
+
+	ref = plumbing.NewHashReference(plumbing.Master, hashes[0])
+	c.Assert(r.setReference(ref, "foo", defaultSignature()), IsNil)
+	c.Assert(reflogMessages(c, r, plumbing.Master), HasLen, 3)
+
+	ref = plumbing.NewHashReference("refs/tags/foo", hashes[0])
+	c.Assert(r.setReference(ref, "foo", defaultSignature()), IsNil)
+	c.Assert(reflogMessages(c, r, "refs/tags/foo"), HasLen, 0)
+
+	cfg.Core.LogAllRefUpdates = "always"
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	ref = plumbing.NewHashReference("refs/tags/bar", hashes[0])
+	c.Assert(r.setReference(ref, "bar", defaultSignature()), IsNil)
+	c.Assert(reflogMessages(c, r, "refs/tags/bar"), DeepEquals, []string{"bar"})
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-billy/v5/osfs"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/internal/url"
@@ -60,6 +61,9 @@ const (
 type Remote struct {
 	c *config.RemoteConfig
 	s storage.Storer
+	// wt is the worktree of the repository of the remote, where the hooks
+	// are run, nil if unknown.
+	wt billy.Filesystem
 }
 
 // NewRemote creates a new Remote.
@@ -170,6 +174,12 @@ func (r *Remote) PushContext(ctx context.Context, o *PushOptions) (err error) {
 		return NoErrAlreadyUpToDate
 	}
 
+	if !o.NoVerify {
+		if err := r.prePush(o, req); err != nil {
+			return err
+		}
+	}
+
 	objects := objectsToPush(req.Commands)
 
 	haves, err := referencesToHashes(remoteRefs)
@@ -227,6 +237,47 @@ func (r *Remote) PushContext(ctx context.Context, o *PushOptions) (err error) {
 	return r.updateRemoteReferenceStorage(req, rs)
 }
 
+// prePush runs the pre-push hook, given the remote and the references to be
+// updated.
+func (r *Remote) prePush(o *PushOptions, req *packp.ReferenceUpdateRequest) error {
+	hooks, err := newHookRunner(r.s, r.wt, o.Hooks)
+	if err != nil {
+		return err
+	}
+
+	var input strings.Builder
+	for _, cmd := range req.Commands {
+		local := "(delete)"
+		if cmd.Action() != packp.Delete {
+			local = pushLocalReference(o.RefSpecs, cmd.Name)
+		}
+
+		fmt.Fprintf(&input, "%s %s %s %s\n", local, cmd.New, cmd.Name, cmd.Old)
+	}
+
+	return hooks.run(PrePushHook, strings.NewReader(input.String()), r.c.Name, o.RemoteURL)
+}
+
+// pushLocalReference returns the local reference pushed to the given remote
+// reference, as written by the refspecs.
+func pushLocalReference(specs []config.RefSpec, remote plumbing.ReferenceName) string {
+	for _, rs := range specs {
+		if rs.IsDelete() {
+			continue
+		}
+
+		if !rs.IsWildcard() && rs.Dst("") == remote {
+			return rs.Src()
+		}
+
+		if rs.IsWildcard() && rs.Reverse().Match(remote) {
+			return rs.Reverse().Dst(remote).String()
+		}
+	}
+
+	return remote.String()
+}
+
 func (r *Remote) useRefDeltas(ar *packp.AdvRefs) bool {
 	return !ar.Capabilities.Supports(capability.OFSDelta)
 }
@@ -346,6 +397,7 @@ func (r *Remote) updateRemoteReferenceStorage(
 	result *packp.ReportStatus,
 ) error {
 
+	committer := reflogCommitter(r.s, nil)
 	for _, spec := range r.c.Fetch {
 		for _, c := range req.Commands {
 			if !spec.Match(c.Name) {
@@ -356,7 +408,7 @@ func (r *Remote) updateRemoteReferenceStorage(
 			ref := plumbing.NewHashReference(local, c.New)
 			switch c.Action() {
 			case packp.Create, packp.Update:
-				if err := r.s.SetReference(ref); err != nil {
+				if err := updateReference(r.s, ref, nil, "update by push", committer); err != nil {
 					return err
 				}
 			case packp.Delete:
@@ -465,7 +517,8 @@ func (r *Remote) fetch(ctx context.Context, o *FetchOptions) (sto storer.Referen
 		}
 	}
 
-	updated, err := r.updateLocalReferenceStorage(o.RefSpecs, refs, remoteRefs, o.Tags, o.Force)
+	committer := reflogCommitter(r.s, nil)
+	updated, err := r.updateLocalReferenceStorage(o.RefSpecs, refs, remoteRefs, o.Tags, o.Force, committer)
 	if err != nil {
 		return nil, err
 	}
@@ -1141,6 +1194,7 @@ func (r *Remote) updateLocalReferenceStorage(
 	fetchedRefs, remoteRefs memory.ReferenceStorage,
 	tagMode TagMode,
 	force bool,
+	committer *object.Signature,
 ) (updated bool, err error) {
 	isWildcard := true
 	forceNeeded := false
@@ -1177,7 +1231,14 @@ func (r *Remote) updateLocalReferenceStorage(
 				}
 			}
 
-			refUpdated, err := checkAndUpdateReferenceStorerIfNeeded(r.s, new, old)
+			msg := "fetch: fast-forward"
+			if old == nil {
+				msg = "fetch: storing head"
+			} else if force || spec.IsForceUpdate() {
+				msg = "fetch: forced-update"
+			}
+
+			refUpdated, err := checkAndUpdateReferenceStorerIfNeeded(r.s, new, old, msg, committer)
 			if err != nil {
 				return updated, err
 			}
@@ -1196,7 +1257,7 @@ func (r *Remote) updateLocalReferenceStorage(
 	if isWildcard {
 		tags = remoteRefs
 	}
-	tagUpdated, err := r.buildFetchedTags(tags)
+	tagUpdated, err := r.buildFetchedTags(tags, committer)
 	if err != nil {
 		return updated, err
 	}
@@ -1212,7 +1273,7 @@ func (r *Remote) updateLocalReferenceStorage(
 	return
 }
 
-func (r *Remote) buildFetchedTags(refs memory.ReferenceStorage) (updated bool, err error) {
+func (r *Remote) buildFetchedTags(refs memory.ReferenceStorage, committer *object.Signature) (updated bool, err error) {
 	for _, ref := range refs {
 		if !ref.Name().IsTag() {
 			continue
@@ -1227,7 +1288,7 @@ func (r *Remote) buildFetchedTags(refs memory.ReferenceStorage) (updated bool, e
 			return false, err
 		}
 
-		refUpdated, err := updateReferenceStorerIfNeeded(r.s, ref)
+		refUpdated, err := updateReferenceStorerIfNeeded(r.s, ref, "fetch: storing head", committer)
 		if err != nil {
 			return updated, err
 		}
@@ -21,12 +21,14 @@ import (
 	"github.com/go-git/go-git/v5/internal/revision"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
 	"github.com/go-git/go-git/v5/plumbing/format/packfile"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/go-git/go-git/v5/storage"
 	"github.com/go-git/go-git/v5/storage/filesystem"
 	"github.com/go-git/go-git/v5/storage/filesystem/dotgit"
+	"github.com/go-git/go-git/v5/storage/memory"
 	"github.com/go-git/go-git/v5/utils/ioutil"
 	"github.com/imdario/mergo"
 )
@@ -57,6 +59,7 @@ var (
 	ErrIsBareRepository          = errors.New("worktree not available in a bare repository")
 	ErrUnableToResolveCommit     = errors.New("unable to resolve commit")
 	ErrPackedObjectsNotSupported = errors.New("packed objects not supported")
+	ErrNoUpstream                = errors.New("no upstream configured for branch")
 )
 
 // Repository represents a git repository
@@ -65,6 +68,12 @@ type Repository struct {
 
 	r  map[string]*Remote
 	wt billy.Filesystem
+	// dotgit holds the state files of the operations in progress, when the
+	// storer isn't based on a filesystem.
+	dotgit billy.Filesystem
+	// reflogs holds the reflogs, such as the one of the stash, when the
+	// storer doesn't implement storer.ReflogStorer.
+	reflogs memory.ReflogStorage
 }
 
 // Init creates an empty git repository, based on the given Storer and worktree.
@@ -534,7 +543,7 @@ func (r *Repository) Remote(name string) (*Remote, error) {
 		return nil, ErrRemoteNotFound
 	}
 
-	return NewRemote(r.Storer, c), nil
+	return r.newRemote(c), nil
 }
 
 // Remotes returns a list with all the remotes
@@ -548,20 +557,28 @@ func (r *Repository) Remotes() ([]*Remote, error) {
 
 	var i int
 	for _, c := range cfg.Remotes {
-		remotes[i] = NewRemote(r.Storer, c)
+		remotes[i] = r.newRemote(c)
 		i++
 	}
 
 	return remotes, nil
 }
 
+// newRemote returns the remote with the given config, which runs the hooks
+// in the worktree of the repository.
+func (r *Repository) newRemote(c *config.RemoteConfig) *Remote {
+	remote := NewRemote(r.Storer, c)
+	remote.wt = r.wt
+	return remote
+}
+
 // CreateRemote creates a new remote
 func (r *Repository) CreateRemote(c *config.RemoteConfig) (*Remote, error) {
 	if err := c.Validate(); err != nil {
 		return nil, err
 	}
 
-	remote := NewRemote(r.Storer, c)
+	remote := r.newRemote(c)
 
 	cfg, err := r.Config()
 	if err != nil {
@@ -587,7 +604,7 @@ func (r *Repository) CreateRemoteAnonymous(c *config.RemoteConfig) (*Remote, err
 		return nil, ErrAnonymousRemoteName
 	}
 
-	remote := NewRemote(r.Storer, c)
+	remote := r.newRemote(c)
 
 	return remote, nil
 }
@@ -975,7 +992,7 @@ func (r *Repository) fetchAndUpdateReferences(
 		return nil, err
 	}
 
-	refsUpdated, err := r.updateReferences(remote.c.Fetch, resolvedRef)
+	refsUpdated, err := r.updateReferences(remote.c.Fetch, resolvedRef, "clone: from "+remote.c.URLs[0])
 	if err != nil {
 		return nil, err
 	}
@@ -988,8 +1005,9 @@ func (r *Repository) fetchAndUpdateReferences(
 }
 
 func (r *Repository) updateReferences(spec []config.RefSpec,
-	resolvedRef *plumbing.Reference) (updated bool, err error) {
+	resolvedRef *plumbing.Reference, msg string) (updated bool, err error) {
 
+	committer := reflogCommitter(r.Storer, nil)
 	if !resolvedRef.Name().IsBranch() {
 		// Detached HEAD mode
 		h, err := r.resolveToCommitHash(resolvedRef.Hash())
@@ -997,7 +1015,7 @@ func (r *Repository) updateReferences(spec []config.RefSpec,
 			return false, err
 		}
 		head := plumbing.NewHashReference(plumbing.HEAD, h)
-		return updateReferenceStorerIfNeeded(r.Storer, head)
+		return updateReferenceStorerIfNeeded(r.Storer, head, msg, committer)
 	}
 
 	refs := []*plumbing.Reference{
@@ -1010,7 +1028,7 @@ func (r *Repository) updateReferences(spec []config.RefSpec,
 	refs = append(refs, r.calculateRemoteHeadReference(spec, resolvedRef)...)
 
 	for _, ref := range refs {
-		u, err := updateReferenceStorerIfNeeded(r.Storer, ref)
+		u, err := updateReferenceStorerIfNeeded(r.Storer, ref, msg, committer)
 		if err != nil {
 			return updated, err
 		}
@@ -1047,7 +1065,7 @@ func (r *Repository) calculateRemoteHeadReference(spec []config.RefSpec,
 }
 
 func checkAndUpdateReferenceStorerIfNeeded(
-	s storer.ReferenceStorer, r, old *plumbing.Reference) (
+	s storer.ReferenceStorer, r, old *plumbing.Reference, msg string, committer *object.Signature) (
 	updated bool, err error) {
 	p, err := s.Reference(r.Name())
 	if err != nil && err != plumbing.ErrReferenceNotFound {
@@ -1056,7 +1074,7 @@ func checkAndUpdateReferenceStorerIfNeeded(
 
 	// we use the string method to compare references, is the easiest way
 	if err == plumbing.ErrReferenceNotFound || r.String() != p.String() {
-		if err := s.CheckAndSetReference(r, old); err != nil {
+		if err := updateReference(s, r, old, msg, committer); err != nil {
 			return false, err
 		}
 
@@ -1067,8 +1085,8 @@ func checkAndUpdateReferenceStorerIfNeeded(
 }
 
 func updateReferenceStorerIfNeeded(
-	s storer.ReferenceStorer, r *plumbing.Reference) (updated bool, err error) {
-	return checkAndUpdateReferenceStorerIfNeeded(s, r, nil)
+	s storer.ReferenceStorer, r *plumbing.Reference, msg string, committer *object.Signature) (updated bool, err error) {
+	return checkAndUpdateReferenceStorerIfNeeded(s, r, nil, msg, committer)
 }
 
 // Fetch fetches references along with the objects necessary to complete
@@ -1140,9 +1158,12 @@ func (r *Repository) Log(o *LogOptions) (object.CommitIter, error) {
 		it  object.CommitIter
 		err error
 	)
-	if o.All {
+	switch {
+	case o.Range != nil:
+		it, err = r.logRange(o.Range, o.Order)
+	case o.All:
 		it, err = r.logAll(fn)
-	} else {
+	default:
 		it, err = r.log(o.From, fn)
 	}
 
@@ -1150,12 +1171,14 @@ func (r *Repository) Log(o *LogOptions) (object.CommitIter, error) {
 		return nil, err
 	}
 
+	// for `git log --all` and ranges also check parent (if the next commit
+	// comes from the real parent)
+	checkParent := o.All || o.Range != nil
 	if o.FileName != nil {
-		// for `git log --all` also check parent (if the next commit comes from the real parent)
-		it = r.logWithFile(*o.FileName, it, o.All)
+		it = r.logWithFile(*o.FileName, it, checkParent)
 	}
 	if o.PathFilter != nil {
-		it = r.logWithPathFilter(o.PathFilter, it, o.All)
+		it = r.logWithPathFilter(o.PathFilter, it, checkParent)
 	}
 
 	if o.Since != nil || o.Until != nil {
@@ -1163,6 +1186,26 @@ func (r *Repository) Log(o *LogOptions) (object.CommitIter, error) {
 		it = r.logWithLimit(it, limitOptions)
 	}
 
+	if o.UseMailmap {
+		m, err := r.Mailmap()
+		if err != nil {
+			it.Close()
+			return nil, err
+		}
+
+		it = newMailmapCommitIter(m, it)
+	}
+
+	if o.NotesFunc != nil {
+		notes, err := r.newNotesCommitIter(o.Notes, o.NotesFunc, it)
+		if err != nil {
+			it.Close()
+			return nil, err
+		}
+
+		it = notes
+	}
+
 	return it, nil
 }
 
@@ -1211,26 +1254,44 @@ func (*Repository) logWithLimit(commitIter object.CommitIter, limitOptions objec
 }
 
 func commitIterFunc(order LogOrder) func(c *object.Commit) object.CommitIter {
+	fn := seenCommitIterFunc(order)
+	if fn == nil {
+		return nil
+	}
+
+	return func(c *object.Commit) object.CommitIter {
+		return fn(c, nil)
+	}
+}
+
+// seenCommitIterFunc is like commitIterFunc, but the returned iterators
+// don't walk the given seen commits.
+func seenCommitIterFunc(order LogOrder) func(c *object.Commit, seen map[plumbing.Hash]bool) object.CommitIter {
 	switch order {
 	case LogOrderDefault:
-		return func(c *object.Commit) object.CommitIter {
-			return object.NewCommitPreorderIter(c, nil, nil)
+		return func(c *object.Commit, seen map[plumbing.Hash]bool) object.CommitIter {
+			return object.NewCommitPreorderIter(c, seen, nil)
 		}
 	case LogOrderDFS:
-		return func(c *object.Commit) object.CommitIter {
-			return object.NewCommitPreorderIter(c, nil, nil)
+		return func(c *object.Commit, seen map[plumbing.Hash]bool) object.CommitIter {
+			return object.NewCommitPreorderIter(c, seen, nil)
 		}
 	case LogOrderDFSPost:
-		return func(c *object.Commit) object.CommitIter {
-			return object.NewCommitPostorderIter(c, nil)
+		return func(c *object.Commit, seen map[plumbing.Hash]bool) object.CommitIter {
+			var ignore []plumbing.Hash
+			for h := range seen {
+				ignore = append(ignore, h)
+			}
+
+			return object.NewCommitPostorderIter(c, ignore)
 		}
 	case LogOrderBSF:
-		return func(c *object.Commit) object.CommitIter {
-			return object.NewCommitIterBSF(c, nil, nil)
+		return func(c *object.Commit, seen map[plumbing.Hash]bool) object.CommitIter {
+			return object.NewCommitIterBSF(c, seen, nil)
 		}
 	case LogOrderCommitterTime:
-		return func(c *object.Commit) object.CommitIter {
-			return object.NewCommitIterCTime(c, nil, nil)
+		return func(c *object.Commit, seen map[plumbing.Hash]bool) object.CommitIter {
+			return object.NewCommitIterCTime(c, seen, nil)
 		}
 	}
 	return nil
@@ -1419,11 +1480,14 @@ func (r *Repository) Worktree() (*Worktree, error) {
 	return &Worktree{r: r, Filesystem: r.wt}, nil
 }
 
-// ResolveRevision resolves revision to corresponding hash. It will always
-// resolve to a commit hash, not a tree or annotated tag.
+// ResolveRevision resolves revision to corresponding hash. Commits, trees,
+// blobs and annotated tags can be resolved, a revision made only of a
+// reference resolves to a commit, peeling the annotated tags.
 //
 // Implemented resolvers : HEAD, branch, tag, heads/branch, refs/heads/branch,
-// refs/tags/tag, refs/remotes/origin/branch, refs/remotes/origin/HEAD, tilde and caret (HEAD~1, master~^, tag~2, ref/heads/master~1, ...), selection by text (HEAD^{/fix nasty bug}), hash (prefix and full)
+// refs/tags/tag, refs/remotes/origin/branch, refs/remotes/origin/HEAD, tilde and caret (HEAD~1, master~^, tag~2, ref/heads/master~1, ...), selection by text (HEAD^{/fix nasty bug}, :/fix nasty bug), hash (prefix and full),
+// reflog (HEAD@{1}, master@{yesterday}, @{-1}), upstream and push branches (@{upstream}, master@{u}, @{push}),
+// peeling (v1.0.0^{}, v1.0.0^{tag}, HEAD^{tree}, ...), and paths in trees and in the index (HEAD:README, :README, :2:README)
 func (r *Repository) ResolveRevision(rev plumbing.Revision) (*plumbing.Hash, error) {
 	p := revision.NewParserFromString(string(rev))
 
@@ -1433,63 +1497,28 @@ func (r *Repository) ResolveRevision(rev plumbing.Revision) (*plumbing.Hash, err
 		return nil, err
 	}
 
-	var commit *object.Commit
+	var obj object.Object
+	var ref revision.Ref
 
 	for _, item := range items {
 		switch item := item.(type) {
 		case revision.Ref:
-			revisionRef := item
-
-			var tryHashes []plumbing.Hash
-
-			tryHashes = append(tryHashes, r.resolveHashPrefix(string(revisionRef))...)
+			ref = item
 
-			for _, rule := range append([]string{"%s"}, plumbing.RefRevParseRules...) {
-				ref, err := storer.ResolveReference(r.Storer, plumbing.ReferenceName(fmt.Sprintf(rule, revisionRef)))
-
-				if err == nil {
-					tryHashes = append(tryHashes, ref.Hash())
-					break
-				}
-			}
-
-			// in ambiguous cases, `git rev-parse` will emit a warning, but
-			// will always return the oid in preference to a ref; we don't have
-			// the ability to emit a warning here, so (for speed purposes)
-			// don't bother to detect the ambiguity either, just return in the
-			// priority that git would.
-			gotOne := false
-			for _, hash := range tryHashes {
-				commitObj, err := r.CommitObject(hash)
-				if err == nil {
-					commit = commitObj
-					gotOne = true
-					break
-				}
-
-				tagObj, err := r.TagObject(hash)
-				if err == nil {
-					// If the tag target lookup fails here, this most likely
-					// represents some sort of repo corruption, so let the
-					// error bubble up.
-					tagCommit, err := tagObj.Commit()
-					if err != nil {
-						return &plumbing.ZeroHash, err
-					}
-					commit = tagCommit
-					gotOne = true
-					break
-				}
+			obj, err = r.resolveRevisionRef(item)
+			if err != nil {
+				return &plumbing.ZeroHash, err
 			}
-
-			if !gotOne {
-				return &plumbing.ZeroHash, plumbing.ErrReferenceNotFound
+		case revision.CaretPath:
+			commit, err := peelToCommit(obj)
+			if err != nil {
+				return &plumbing.ZeroHash, err
 			}
 
-		case revision.CaretPath:
 			depth := item.Depth
 
 			if depth == 0 {
+				obj = commit
 				break
 			}
 
@@ -1502,7 +1531,7 @@ func (r *Repository) ResolveRevision(rev plumbing.Revision) (*plumbing.Hash, err
 			}
 
 			if depth == 1 {
-				commit = c
+				obj = c
 
 				break
 			}
@@ -1513,8 +1542,13 @@ func (r *Repository) ResolveRevision(rev plumbing.Revision) (*plumbing.Hash, err
 				return &plumbing.ZeroHash, err
 			}
 
-			commit = c
+			obj = c
 		case revision.TildePath:
+			commit, err := peelToCommit(obj)
+			if err != nil {
+				return &plumbing.ZeroHash, err
+			}
+
 			for i := 0; i < item.Depth; i++ {
 				c, err := commit.Parents().Next()
 
@@ -1524,40 +1558,148 @@ func (r *Repository) ResolveRevision(rev plumbing.Revision) (*plumbing.Hash, err
 
 				commit = c
 			}
+
+			obj = commit
 		case revision.CaretReg:
+			commit, err := peelToCommit(obj)
+			if err != nil {
+				return &plumbing.ZeroHash, err
+			}
+
 			history := object.NewCommitPreorderIter(commit, nil, nil)
 
-			re := item.Regexp
-			negate := item.Negate
+			c, err := findCommitMessage(history, item.Regexp, item.Negate)
+			if err != nil {
+				return &plumbing.ZeroHash, err
+			}
+
+			obj = c
+		case revision.CaretType:
+			obj, err = peelRevisionObject(obj, item.ObjectType)
+			if err != nil {
+				return &plumbing.ZeroHash, err
+			}
+		case revision.ColonReg:
+			iter, err := object.NewCommitAllIter(r.Storer, func(c *object.Commit) object.CommitIter {
+				return object.NewCommitIterCTime(c, nil, nil)
+			})
+			if err != nil {
+				return &plumbing.ZeroHash, err
+			}
+
+			obj, err = findCommitMessage(iter, item.Regexp, item.Negate)
+			if err != nil {
+				return &plumbing.ZeroHash, err
+			}
+		case revision.ColonPath:
+			obj, err = r.resolveRevisionPath(obj, item.Path)
+			if err != nil {
+				return &plumbing.ZeroHash, err
+			}
+		case revision.ColonStagePath:
+			obj, err = r.resolveRevisionIndexPath(item.Path, index.Stage(item.Stage))
+			if err != nil {
+				return &plumbing.ZeroHash, err
+			}
+		case revision.AtReflog, revision.AtDate:
+			h, err := r.resolveReflogRevision(ref, item)
+			if err != nil {
+				return &plumbing.ZeroHash, err
+			}
 
-			var c *object.Commit
+			obj, err = r.CommitObject(h)
+			if err != nil {
+				return &plumbing.ZeroHash, err
+			}
+		case revision.AtCheckout:
+			name, err := r.previousCheckout(item.Depth)
+			if err != nil {
+				return &plumbing.ZeroHash, err
+			}
 
-			err := history.ForEach(func(hc *object.Commit) error {
-				if !negate && re.MatchString(hc.Message) {
-					c = hc
-					return storer.ErrStop
-				}
+			h, err := r.ResolveRevision(plumbing.Revision(name))
+			if err != nil {
+				return &plumbing.ZeroHash, err
+			}
 
-				if negate && !re.MatchString(hc.Message) {
-					c = hc
-					return storer.ErrStop
-				}
+			obj, err = r.CommitObject(*h)
+			if err != nil {
+				return &plumbing.ZeroHash, err
+			}
+		case revision.AtUpstream, revision.AtPush:
+			name, err := r.resolveTrackingBranch(ref, item)
+			if err != nil {
+				return &plumbing.ZeroHash, err
+			}
 
-				return nil
-			})
+			obj, err = r.resolveRevisionRef(revision.Ref(name))
 			if err != nil {
 				return &plumbing.ZeroHash, err
 			}
+		}
+	}
 
-			if c == nil {
-				return &plumbing.ZeroHash, fmt.Errorf("no commit message match regexp: %q", re.String())
+	if _, ok := items[len(items)-1].(revision.Ref); ok {
+		if tag, ok := obj.(*object.Tag); ok {
+			// If the tag target lookup fails here, this most likely
+			// represents some sort of repo corruption, so let the
+			// error bubble up.
+			commit, err := tag.Commit()
+			if err != nil {
+				return &plumbing.ZeroHash, err
 			}
 
-			commit = c
+			obj = commit
+		}
+	}
+
+	h := obj.ID()
+	return &h, nil
+}
+
+// resolveRevisionRef resolves a reference name or a hash to an object.
+func (r *Repository) resolveRevisionRef(revisionRef revision.Ref) (object.Object, error) {
+	var tryHashes []plumbing.Hash
+
+	tryHashes = append(tryHashes, r.resolveHashPrefix(string(revisionRef))...)
+
+	for _, rule := range append([]string{"%s"}, plumbing.RefRevParseRules...) {
+		ref, err := storer.ResolveReference(r.Storer, plumbing.ReferenceName(fmt.Sprintf(rule, revisionRef)))
+
+		if err == nil {
+			tryHashes = append(tryHashes, ref.Hash())
+			break
 		}
 	}
 
-	return &commit.Hash, nil
+	// in ambiguous cases, `git rev-parse` will emit a warning, but
+	// will always return the oid in preference to a ref; we don't have
+	// the ability to emit a warning here, so (for speed purposes)
+	// don't bother to detect the ambiguity either, just return in the
+	// priority that git would. Commits and tags are preferred to trees
+	// and blobs.
+	var other object.Object
+	for _, hash := range tryHashes {
+		obj, err := r.Object(plumbing.AnyObject, hash)
+		if err != nil {
+			continue
+		}
+
+		switch obj.(type) {
+		case *object.Commit, *object.Tag:
+			return obj, nil
+		}
+
+		if other == nil {
+			other = obj
+		}
+	}
+
+	if other == nil {
+		return nil, plumbing.ErrReferenceNotFound
+	}
+
+	return other, nil
 }
 
 // resolveHashPrefix returns a list of potential hashes that the given string
@@ -0,0 +1,84 @@
+package git
+
+import (
+	"os"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+const (
+	mergeMsgFile  = "MERGE_MSG"
+	mergeModeFile = "MERGE_MODE"
+	squashMsgFile = "SQUASH_MSG"
+
+	rebaseMergeDir = "rebase-merge"
+	sequencerDir   = "sequencer"
+)
+
+// dotGitFilesystem returns the filesystem of the git directory, where the
+// state of the operations in progress (e.g. MERGE_MSG) is stored. Storers
+// not based on a filesystem get an in-memory one, bound to the Repository.
+func (r *Repository) dotGitFilesystem() billy.Filesystem {
+	type fsBased interface {
+		Filesystem() billy.Filesystem
+	}
+
+	if fs, ok := r.Storer.(fsBased); ok {
+		return fs.Filesystem()
+	}
+
+	if r.dotgit == nil {
+		r.dotgit = memfs.New()
+	}
+
+	return r.dotgit
+}
+
+// readStateFile returns the content of the given file of the git directory,
+// an empty string is returned if the file doesn't exist.
+func (r *Repository) readStateFile(name string) (string, error) {
+	content, err := util.ReadFile(r.dotGitFilesystem(), name)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+
+	return string(content), err
+}
+
+// writeStateFile writes the given file of the git directory, ensuring the
+// content ends with a new line.
+func (r *Repository) writeStateFile(name, content string) error {
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+
+	return util.WriteFile(r.dotGitFilesystem(), name, []byte(content), 0644)
+}
+
+// removeStateFile removes the given files of the git directory, if they
+// exist.
+func (r *Repository) removeStateFile(names ...string) error {
+	fs := r.dotGitFilesystem()
+	for _, name := range names {
+		if err := util.RemoveAll(fs, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasReference returns true if the given reference, such as MERGE_HEAD,
+// exists.
+func (r *Repository) hasReference(name plumbing.ReferenceName) (bool, error) {
+	_, err := r.Storer.Reference(name)
+	if err == plumbing.ErrReferenceNotFound {
+		return false, nil
+	}
+
+	return err == nil, err
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/go-git/go-git/v5/plumbing/transport"
@@ -2798,6 +2799,191 @@ func (s *RepositorySuite) TestResolveRevisionWithErrors(c *C) {
 	}
 }
 
+func (s *RepositorySuite) TestResolveRevisionObjects(c *C) {
+	f := fixtures.ByURL("https://github.com/git-fixtures/basic.git").One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+	r, err := Open(sto, f.DotGit())
+	c.Assert(err, IsNil)
+
+	head, err := r.CommitObject(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	c.Assert(err, IsNil)
+	tree, err := head.Tree()
+	c.Assert(err, IsNil)
+	changelog, err := tree.FindEntry("CHANGELOG")
+	c.Assert(err, IsNil)
+	goDir, err := tree.FindEntry("go")
+	c.Assert(err, IsNil)
+	example, err := tree.FindEntry("go/example.go")
+	c.Assert(err, IsNil)
+
+	datas := map[string]plumbing.Hash{
+		"HEAD^{commit}":          head.Hash,
+		"HEAD^{object}":          head.Hash,
+		"HEAD^{}":                head.Hash,
+		"HEAD^{tree}":            head.TreeHash,
+		"HEAD:":                  head.TreeHash,
+		"HEAD:CHANGELOG":         changelog.Hash,
+		"master:./CHANGELOG":     changelog.Hash,
+		"HEAD:go":                goDir.Hash,
+		"HEAD:go/example.go":     example.Hash,
+		"v1.0.0^{tree}":          head.TreeHash,
+		":/vendor stuff":         plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		"HEAD~1^{}:CHANGELOG":    changelog.Hash,
+		"refs/heads/master^{}~1": plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"),
+	}
+
+	for rev, hash := range datas {
+		h, err := r.ResolveRevision(plumbing.Revision(rev))
+
+		c.Assert(err, IsNil, Commentf("while checking %s", rev))
+		c.Check(*h, Equals, hash, Commentf("while checking %s", rev))
+	}
+
+	for _, rev := range []string{"HEAD:foo", "HEAD^{blob}", "HEAD:CHANGELOG^{tree}", "HEAD:../CHANGELOG", ":/nothing matches this"} {
+		_, err := r.ResolveRevision(plumbing.Revision(rev))
+		c.Assert(err, NotNil, Commentf("while checking %s", rev))
+	}
+}
+
+func (s *RepositorySuite) TestResolveRevisionPeelTags(c *C) {
+	f := fixtures.ByURL("https://github.com/git-fixtures/tags.git").One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+	r, err := Open(sto, f.DotGit())
+	c.Assert(err, IsNil)
+
+	datas := map[string]string{
+		"annotated-tag^{tag}":    "b742a2a9fa0afcfa9a6fad080980fbc26b007c69",
+		"annotated-tag^{object}": "b742a2a9fa0afcfa9a6fad080980fbc26b007c69",
+		"annotated-tag^{}":       "f7b877701fbf855b44c0a9e86f3fdce2c298b07f",
+		"annotated-tag^{commit}": "f7b877701fbf855b44c0a9e86f3fdce2c298b07f",
+		"commit-tag^{}":          "f7b877701fbf855b44c0a9e86f3fdce2c298b07f",
+		"tree-tag^{}":            "70846e9a10ef7b41064b40f07713d5b8b9a8fc73",
+		"tree-tag^{tree}":        "70846e9a10ef7b41064b40f07713d5b8b9a8fc73",
+		"blob-tag^{}":            "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391",
+		"blob-tag^{blob}":        "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391",
+	}
+
+	for rev, hash := range datas {
+		h, err := r.ResolveRevision(plumbing.Revision(rev))
+
+		c.Assert(err, IsNil, Commentf("while checking %s", rev))
+		c.Check(h.String(), Equals, hash, Commentf("while checking %s", rev))
+	}
+
+	_, err = r.ResolveRevision("tree-tag^{commit}")
+	c.Assert(err, NotNil)
+}
+
+func (s *RepositorySuite) TestResolveRevisionIndex(c *C) {
+	r, w := newMemoryWorktree(c)
+
+	commitFiles(c, w, "init", map[string]string{"foo": "foo\n"})
+
+	err := util.WriteFile(w.Filesystem, "foo", []byte("staged\n"), 0644)
+	c.Assert(err, IsNil)
+	staged, err := w.Add("foo")
+	c.Assert(err, IsNil)
+
+	for _, rev := range []string{":foo", ":0:foo", ":./foo"} {
+		h, err := r.ResolveRevision(plumbing.Revision(rev))
+		c.Assert(err, IsNil, Commentf("while checking %s", rev))
+		c.Assert(*h, Equals, staged, Commentf("while checking %s", rev))
+	}
+
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+	e := *idx.Entries[0]
+	e.Stage = index.TheirMode
+	idx.Entries = append(idx.Entries, &e)
+	err = r.Storer.SetIndex(idx)
+	c.Assert(err, IsNil)
+
+	h, err := r.ResolveRevision(":3:foo")
+	c.Assert(err, IsNil)
+	c.Assert(*h, Equals, staged)
+
+	_, err = r.ResolveRevision(":2:foo")
+	c.Assert(err, NotNil)
+	_, err = r.ResolveRevision(":bar")
+	c.Assert(err, NotNil)
+}
+
+func (s *RepositorySuite) TestResolveRevisionUpstream(c *C) {
+	r, err := Clone(memory.NewStorage(), nil, &CloneOptions{URL: s.GetBasicLocalRepositoryURL()})
+	c.Assert(err, IsNil)
+
+	remote, err := r.Reference("refs/remotes/origin/master", false)
+	c.Assert(err, IsNil)
+
+	for _, rev := range []string{"@{upstream}", "@{u}", "master@{u}", "HEAD@{u}", "@{push}", "master@{push}"} {
+		h, err := r.ResolveRevision(plumbing.Revision(rev))
+		c.Assert(err, IsNil, Commentf("while checking %s", rev))
+		c.Assert(*h, Equals, remote.Hash(), Commentf("while checking %s", rev))
+	}
+
+	err = r.Storer.SetReference(plumbing.NewHashReference("refs/heads/foo", remote.Hash()))
+	c.Assert(err, IsNil)
+
+	_, err = r.ResolveRevision("foo@{upstream}")
+	c.Assert(err, Equals, ErrNoUpstream)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Raw.Section("push").SetOption("default", "upstream")
+	err = r.Storer.SetConfig(cfg)
+	c.Assert(err, IsNil)
+
+	_, err = r.ResolveRevision("foo@{push}")
+	c.Assert(err, Equals, ErrNoUpstream)
+}
+
+func (s *RepositorySuite) TestResolveRange(c *C) {
+	f := fixtures.ByURL("https://github.com/git-fixtures/basic.git").One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+	r, err := Open(sto, f.DotGit())
+	c.Assert(err, IsNil)
+
+	master := "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"
+	branch := "e8d3ffab552895c19b9fcf7aa264d277cde33881"
+	base := "918c48b83bd081e863dbe1b80f8998f058cd8294"
+
+	datas := []struct {
+		revs     []plumbing.Revision
+		expected []string
+	}{
+		{[]plumbing.Revision{"master..branch"}, []string{branch}},
+		{[]plumbing.Revision{"^master", "branch"}, []string{branch}},
+		{[]plumbing.Revision{"branch.."}, []string{master}},
+		{[]plumbing.Revision{"master...branch"}, []string{master, branch}},
+		{[]plumbing.Revision{"HEAD^!"}, []string{master}},
+		{[]plumbing.Revision{"master^@", "^HEAD~2"}, []string{base}},
+		{[]plumbing.Revision{"HEAD~3^@", "^HEAD~3^"}, []string{"a5b8b09e2f8fcb0bb99d3ccb0958157b40890d69", "b8e471f58bcbca63b07bda20e428190409c2db47"}},
+	}
+
+	for _, d := range datas {
+		rng, err := r.ResolveRange(d.revs...)
+		c.Assert(err, IsNil, Commentf("while checking %v", d.revs))
+
+		iter, err := r.Log(&LogOptions{Range: rng})
+		c.Assert(err, IsNil)
+
+		var hashes []string
+		err = iter.ForEach(func(commit *object.Commit) error {
+			hashes = append(hashes, commit.Hash.String())
+			return nil
+		})
+		c.Assert(err, IsNil)
+		c.Assert(hashes, DeepEquals, d.expected, Commentf("while checking %v", d.revs))
+	}
+
+	rng, err := r.ResolveRange("master...branch")
+	c.Assert(err, IsNil)
+	c.Assert(rng.Exclude, DeepEquals, []plumbing.Hash{plumbing.NewHash(base)})
+
+	_, err = r.ResolveRange("HEAD^{tree}..master")
+	c.Assert(err, NotNil)
+}
+
 func (s *RepositorySuite) testRepackObjects(
 	c *C, deleteTime time.Time, expectedPacks int) {
 	srcFs := fixtures.ByTag("unpacked").One().DotGit()
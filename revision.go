@@ -0,0 +1,510 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/internal/revision"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// RevisionRange is a set of commits, the ones reachable from any of the
+// Include commits but not from any of the Exclude commits, as given to
+// `git log` or `git rev-list`. It can be given to Repository.Log using
+// LogOptions.Range.
+type RevisionRange struct {
+	// Include are the commits the range starts from.
+	Include []plumbing.Hash
+	// Exclude are the commits whose history is not part of the range.
+	Exclude []plumbing.Hash
+}
+
+// ResolveRange resolves the given revisions into a RevisionRange. Each
+// revision is resolved using ResolveRevision and can be:
+//
+//   - <rev>, to include the commits reachable from rev.
+//   - ^<rev>, to exclude the commits reachable from rev.
+//   - <rev1>..<rev2>, equivalent to ^<rev1> <rev2>.
+//   - <rev1>...<rev2>, the commits reachable from either rev1 or rev2 but
+//     not from both.
+//   - <rev>^@, all the parents of rev, excluding rev itself.
+//   - <rev>^!, rev excluding all of its parents.
+//
+// An omitted side of a .. or ... range defaults to HEAD.
+func (r *Repository) ResolveRange(revs ...plumbing.Revision) (*RevisionRange, error) {
+	rng := &RevisionRange{}
+	for _, rev := range revs {
+		if err := r.resolveRangeRevision(rng, string(rev)); err != nil {
+			return nil, err
+		}
+	}
+
+	return rng, nil
+}
+
+func (r *Repository) resolveRangeRevision(rng *RevisionRange, rev string) error {
+	if i := strings.Index(rev, "..."); i != -1 {
+		left, err := r.resolveRangeCommit(rev[:i])
+		if err != nil {
+			return err
+		}
+
+		right, err := r.resolveRangeCommit(rev[i+3:])
+		if err != nil {
+			return err
+		}
+
+		bases, err := left.MergeBase(right)
+		if err != nil {
+			return err
+		}
+
+		rng.Include = append(rng.Include, left.Hash, right.Hash)
+		for _, base := range bases {
+			rng.Exclude = append(rng.Exclude, base.Hash)
+		}
+
+		return nil
+	}
+
+	if i := strings.Index(rev, ".."); i != -1 {
+		from, err := r.resolveRangeCommit(rev[:i])
+		if err != nil {
+			return err
+		}
+
+		to, err := r.resolveRangeCommit(rev[i+2:])
+		if err != nil {
+			return err
+		}
+
+		rng.Exclude = append(rng.Exclude, from.Hash)
+		rng.Include = append(rng.Include, to.Hash)
+		return nil
+	}
+
+	switch {
+	case strings.HasPrefix(rev, "^"):
+		c, err := r.resolveRangeCommit(rev[1:])
+		if err != nil {
+			return err
+		}
+
+		rng.Exclude = append(rng.Exclude, c.Hash)
+	case strings.HasSuffix(rev, "^@"):
+		c, err := r.resolveRangeCommit(strings.TrimSuffix(rev, "^@"))
+		if err != nil {
+			return err
+		}
+
+		rng.Include = append(rng.Include, c.ParentHashes...)
+	case strings.HasSuffix(rev, "^!"):
+		c, err := r.resolveRangeCommit(strings.TrimSuffix(rev, "^!"))
+		if err != nil {
+			return err
+		}
+
+		rng.Include = append(rng.Include, c.Hash)
+		rng.Exclude = append(rng.Exclude, c.ParentHashes...)
+	default:
+		c, err := r.resolveRangeCommit(rev)
+		if err != nil {
+			return err
+		}
+
+		rng.Include = append(rng.Include, c.Hash)
+	}
+
+	return nil
+}
+
+// resolveRangeCommit resolves the given side of a range to a commit, HEAD
+// being used if empty.
+func (r *Repository) resolveRangeCommit(rev string) (*object.Commit, error) {
+	if rev == "" {
+		rev = string(plumbing.HEAD)
+	}
+
+	h, err := r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := r.Object(plumbing.AnyObject, *h)
+	if err != nil {
+		return nil, err
+	}
+
+	return peelToCommit(obj)
+}
+
+// peelToCommit returns the commit the given object is, or the one an
+// annotated tag points to.
+func peelToCommit(obj object.Object) (*object.Commit, error) {
+	obj, err := peelRevisionObject(obj, plumbing.CommitObject.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return obj.(*object.Commit), nil
+}
+
+// peelRevisionObject peels the given object until an object of the given
+// type is found, following the annotated tags and going from the commits to
+// their trees, as the ^{<type>} statement does. An empty type peels the
+// annotated tags until an object of another type is found, "object" leaves
+// the object as is.
+func peelRevisionObject(obj object.Object, typ string) (object.Object, error) {
+	if typ == "object" {
+		return obj, nil
+	}
+
+	for {
+		_, isTag := obj.(*object.Tag)
+		if typ == "" && !isTag || obj.Type().String() == typ {
+			return obj, nil
+		}
+
+		var err error
+		switch o := obj.(type) {
+		case *object.Tag:
+			obj, err = o.Object()
+		case *object.Commit:
+			if typ != plumbing.TreeObject.String() {
+				return nil, fmt.Errorf("object %s is a commit, not a %s", o.Hash, typ)
+			}
+
+			obj, err = o.Tree()
+		default:
+			return nil, fmt.Errorf("object %s is a %s, not a %s", obj.ID(), obj.Type(), typ)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// findCommitMessage returns the first commit of the iterator whose message
+// matches re, or doesn't match it if negate is true.
+func findCommitMessage(iter object.CommitIter, re *regexp.Regexp, negate bool) (*object.Commit, error) {
+	var c *object.Commit
+
+	err := iter.ForEach(func(hc *object.Commit) error {
+		if re.MatchString(hc.Message) != negate {
+			c = hc
+			return storer.ErrStop
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if c == nil {
+		return nil, fmt.Errorf("no commit message match regexp: %q", re.String())
+	}
+
+	return c, nil
+}
+
+// resolveRevisionPath returns the object at the given path of the tree of
+// obj, or of the index stage 0 when obj is nil, as <rev>:<path> and
+// :<path> do.
+func (r *Repository) resolveRevisionPath(obj object.Object, p string) (object.Object, error) {
+	if obj == nil {
+		return r.resolveRevisionIndexPath(p, index.Merged)
+	}
+
+	obj, err := peelRevisionObject(obj, plumbing.TreeObject.String())
+	if err != nil {
+		return nil, err
+	}
+
+	p, err = revisionPath(p)
+	if err != nil || p == "" {
+		return obj, err
+	}
+
+	e, err := obj.(*object.Tree).FindEntry(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Object(plumbing.AnyObject, e.Hash)
+}
+
+// resolveRevisionIndexPath returns the blob of the index entry at the given
+// path and stage, as :<n>:<path> does.
+func (r *Repository) resolveRevisionIndexPath(p string, stage index.Stage) (object.Object, error) {
+	p, err := revisionPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range idx.Entries {
+		if e.Name == p && e.Stage == stage {
+			return r.BlobObject(e.Hash)
+		}
+	}
+
+	return nil, fmt.Errorf("path %q is not in the index at stage %d", p, stage)
+}
+
+// revisionPath returns the path of a revision relative to the root of the
+// worktree. Paths starting with ./ are relative to the current directory,
+// being the root since the Repository has no notion of it.
+func revisionPath(p string) (string, error) {
+	if p == "." || p == "./" {
+		return "", nil
+	}
+
+	if strings.HasPrefix(p, "./") || strings.HasPrefix(p, "../") {
+		p = path.Clean(p)
+	}
+
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", fmt.Errorf("path %q is outside of the repository", p)
+	}
+
+	return strings.TrimSuffix(p, "/"), nil
+}
+
+// resolveTrackingBranch returns the remote-tracking branch, or the local
+// branch, @{upstream} or @{push} refers to for the given branch, being the
+// current one when ref is empty or HEAD.
+func (r *Repository) resolveTrackingBranch(ref revision.Ref, item revision.Revisioner) (plumbing.ReferenceName, error) {
+	branch, err := r.revisionBranch(ref)
+	if err != nil {
+		return "", err
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return "", err
+	}
+
+	b := cfg.Branches[branch.Short()]
+	if _, ok := item.(revision.AtPush); ok {
+		return pushBranch(cfg, branch, b)
+	}
+
+	if b == nil || b.Remote == "" || b.Merge == "" {
+		return "", ErrNoUpstream
+	}
+
+	return remoteTrackingBranch(cfg, b.Remote, b.Merge)
+}
+
+// revisionBranch returns the branch a @{upstream} or @{push} statement
+// applies to.
+func (r *Repository) revisionBranch(ref revision.Ref) (plumbing.ReferenceName, error) {
+	if ref != "" && ref != revision.Ref(plumbing.HEAD) {
+		name := plumbing.NewBranchReferenceName(string(ref))
+		if strings.HasPrefix(string(ref), "refs/heads/") {
+			name = plumbing.ReferenceName(ref)
+		}
+
+		if _, err := r.Storer.Reference(name); err != nil {
+			return "", err
+		}
+
+		return name, nil
+	}
+
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return "", err
+	}
+
+	if head.Type() != plumbing.SymbolicReference {
+		return "", ErrBranchNotFound
+	}
+
+	return head.Target(), nil
+}
+
+// pushBranch returns the remote-tracking branch of the branch the given one
+// is pushed to, following branch.<name>.pushRemote, remote.pushDefault and
+// push.default.
+func pushBranch(cfg *config.Config, branch plumbing.ReferenceName, b *config.Branch) (plumbing.ReferenceName, error) {
+	var remote, mode string
+	if b != nil {
+		remote = b.Remote
+	}
+
+	raw := cfg.Raw
+	if raw.HasSection("branch") && raw.Section("branch").HasSubsection(branch.Short()) {
+		if r := raw.Section("branch").Subsection(branch.Short()).Option("pushRemote"); r != "" {
+			remote = r
+		}
+	}
+
+	if raw.HasSection("remote") {
+		if r := raw.Section("remote").Option("pushDefault"); r != "" && (b == nil || remote == b.Remote) {
+			remote = r
+		}
+	}
+
+	if raw.HasSection("push") {
+		mode = raw.Section("push").Option("default")
+	}
+
+	if remote == "" {
+		remote = DefaultRemoteName
+	}
+
+	switch mode {
+	case "nothing":
+		return "", ErrNoUpstream
+	case "upstream", "tracking":
+		if b == nil || b.Merge == "" || b.Remote != remote {
+			return "", ErrNoUpstream
+		}
+
+		return remoteTrackingBranch(cfg, remote, b.Merge)
+	}
+
+	return remoteTrackingBranch(cfg, remote, branch)
+}
+
+// remoteTrackingBranch returns the local reference storing the given branch
+// of the given remote, following its fetch refspecs.
+func remoteTrackingBranch(cfg *config.Config, remote string, branch plumbing.ReferenceName) (plumbing.ReferenceName, error) {
+	if remote == "." {
+		return branch, nil
+	}
+
+	rc, ok := cfg.Remotes[remote]
+	if !ok {
+		return "", ErrRemoteNotFound
+	}
+
+	for _, spec := range rc.Fetch {
+		if spec.Match(branch) {
+			return spec.Dst(branch), nil
+		}
+	}
+
+	return "", fmt.Errorf("%s of %s is not stored as a remote-tracking branch", branch.Short(), remote)
+}
+
+// logRange returns an iterator over the commits of the given range, in the
+// given order for the commits reachable from each of the included ones.
+func (r *Repository) logRange(rng *RevisionRange, order LogOrder) (object.CommitIter, error) {
+	hidden := make(map[plumbing.Hash]bool)
+	for _, h := range rng.Exclude {
+		c, err := r.CommitObject(h)
+		if err != nil {
+			return nil, err
+		}
+
+		err = object.NewCommitPreorderIter(c, hidden, nil).ForEach(func(c *object.Commit) error {
+			hidden[c.Hash] = true
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var include []*object.Commit
+	for _, h := range rng.Include {
+		c, err := r.CommitObject(h)
+		if err != nil {
+			return nil, err
+		}
+
+		include = append(include, c)
+	}
+
+	return &commitRangeIter{
+		iterFunc: seenCommitIterFunc(order),
+		include:  include,
+		seen:     hidden,
+	}, nil
+}
+
+// commitRangeIter walks the commits reachable from each of the included
+// commits in turn, skipping the commits already seen.
+type commitRangeIter struct {
+	iterFunc func(*object.Commit, map[plumbing.Hash]bool) object.CommitIter
+	include  []*object.Commit
+	seen     map[plumbing.Hash]bool
+	current  object.CommitIter
+}
+
+func (it *commitRangeIter) Next() (*object.Commit, error) {
+	for {
+		if it.current == nil {
+			if len(it.include) == 0 {
+				return nil, io.EOF
+			}
+
+			it.current = it.iterFunc(it.include[0], it.seen)
+			it.include = it.include[1:]
+		}
+
+		c, err := it.current.Next()
+		if err == io.EOF {
+			it.current.Close()
+			it.current = nil
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if it.seen[c.Hash] {
+			continue
+		}
+
+		it.seen[c.Hash] = true
+		return c, nil
+	}
+}
+
+func (it *commitRangeIter) ForEach(cb func(*object.Commit) error) error {
+	defer it.Close()
+	for {
+		c, err := it.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := cb(c); err != nil {
+			if err == storer.ErrStop {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
+func (it *commitRangeIter) Close() {
+	if it.current != nil {
+		it.current.Close()
+		it.current = nil
+	}
+
+	it.include = nil
+}
@@ -45,7 +45,7 @@ func (s Status) String() string {
 		}
 
 		if status.Staging == Renamed {
-			path = fmt.Sprintf("%s -> %s", path, status.Extra)
+			path = fmt.Sprintf("%s -> %s", status.Extra, path)
 		}
 
 		fmt.Fprintf(buf, "%c%c %s\n", status.Staging, status.Worktree, path)
@@ -76,4 +76,5 @@ const (
 	Renamed            StatusCode = 'R'
 	Copied             StatusCode = 'C'
 	UpdatedButUnmerged StatusCode = 'U'
+	Ignored            StatusCode = '!'
 )
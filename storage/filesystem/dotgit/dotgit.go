@@ -27,6 +27,7 @@ const (
 	packedRefsPath = "packed-refs"
 	configPath     = "config"
 	indexPath      = "index"
+	sharedIdxPath  = "sharedindex."
 	shallowPath    = "shallow"
 	modulePath     = "modules"
 	objectsPath    = "objects"
@@ -183,6 +184,18 @@ func (d *DotGit) Index() (billy.File, error) {
 	return d.fs.Open(indexPath)
 }
 
+// SharedIndexWriter returns a file pointer for write to the shared index with
+// the given hash, used by a split index
+func (d *DotGit) SharedIndexWriter(h plumbing.Hash) (billy.File, error) {
+	return d.fs.Create(sharedIdxPath + h.String())
+}
+
+// SharedIndex returns a file pointer for read to the shared index with the
+// given hash, used by a split index
+func (d *DotGit) SharedIndex(h plumbing.Hash) (billy.File, error) {
+	return d.fs.Open(sharedIdxPath + h.String())
+}
+
 // ShallowWriter returns a file pointer for write to the shallow file
 func (d *DotGit) ShallowWriter() (billy.File, error) {
 	return d.fs.Create(shallowPath)
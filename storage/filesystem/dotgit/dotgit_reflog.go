@@ -0,0 +1,49 @@
+package dotgit
+
+import (
+	"os"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Reflog returns a file pointer for read to the reflog of the given
+// reference, nil is returned if the reference doesn't have a reflog.
+func (d *DotGit) Reflog(name plumbing.ReferenceName) (billy.File, error) {
+	f, err := d.fs.Open(d.reflogPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// ReflogWriter returns a file pointer for write to the reflog of the given
+// reference. The content written is appended to the existing entries,
+// unless truncate is true.
+func (d *DotGit) ReflogWriter(name plumbing.ReferenceName, truncate bool) (billy.File, error) {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if truncate {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+
+	return d.fs.OpenFile(d.reflogPath(name), flag, 0666)
+}
+
+// RemoveReflog removes the reflog of the given reference, if it exists.
+func (d *DotGit) RemoveReflog(name plumbing.ReferenceName) error {
+	err := d.fs.Remove(d.reflogPath(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (d *DotGit) reflogPath(name plumbing.ReferenceName) string {
+	return d.fs.Join(logsPath, name.String())
+}
@@ -2,8 +2,10 @@ package filesystem
 
 import (
 	"bufio"
+	"bytes"
 	"os"
 
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/format/index"
 	"github.com/go-git/go-git/v5/storage/filesystem/dotgit"
 	"github.com/go-git/go-git/v5/utils/ioutil"
@@ -13,7 +15,15 @@ type IndexStorage struct {
 	dir *dotgit.DotGit
 }
 
+// SetIndex writes the index. If it is a split index without a shared index
+// yet, its entries are written to a new shared index.
 func (s *IndexStorage) SetIndex(idx *index.Index) (err error) {
+	if idx.SplitIndex != nil && idx.SplitIndex.Base == nil {
+		if err := s.setSharedIndex(idx); err != nil {
+			return err
+		}
+	}
+
 	f, err := s.dir.IndexWriter()
 	if err != nil {
 		return err
@@ -32,6 +42,38 @@ func (s *IndexStorage) SetIndex(idx *index.Index) (err error) {
 	return err
 }
 
+func (s *IndexStorage) setSharedIndex(idx *index.Index) (err error) {
+	shared := &index.Index{Version: idx.Version}
+	for _, e := range idx.Entries {
+		entry := *e
+		shared.Entries = append(shared.Entries, &entry)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := index.NewEncoder(buf).Encode(shared); err != nil {
+		return err
+	}
+
+	var h plumbing.Hash
+	copy(h[:], buf.Bytes()[buf.Len()-len(h):])
+
+	f, err := s.dir.SharedIndexWriter(h)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	if _, err = f.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	idx.SplitIndex.BaseHash = h
+	idx.SplitIndex.Base = shared
+	return nil
+}
+
+// Index reads the index. If it is a split index, its entries are merged with
+// the ones of its shared index.
 func (s *IndexStorage) Index() (i *index.Index, err error) {
 	idx := &index.Index{
 		Version: 2,
@@ -49,6 +91,30 @@ func (s *IndexStorage) Index() (i *index.Index, err error) {
 	defer ioutil.CheckClose(f, &err)
 
 	d := index.NewDecoder(bufio.NewReader(f))
-	err = d.Decode(idx)
+	if err = d.Decode(idx); err != nil {
+		return idx, err
+	}
+
+	if idx.SplitIndex != nil && !idx.SplitIndex.BaseHash.IsZero() {
+		err = s.mergeSharedIndex(idx)
+	}
+
 	return idx, err
 }
+
+func (s *IndexStorage) mergeSharedIndex(idx *index.Index) (err error) {
+	f, err := s.dir.SharedIndex(idx.SplitIndex.BaseHash)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+
+	shared := &index.Index{}
+	d := index.NewDecoder(bufio.NewReader(f))
+	if err = d.Decode(shared); err != nil {
+		return err
+	}
+
+	return idx.MergeSharedIndex(shared)
+}
@@ -0,0 +1,52 @@
+package filesystem
+
+import (
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	. "gopkg.in/check.v1"
+)
+
+type IndexSuite struct{}
+
+var _ = Suite(&IndexSuite{})
+
+func (s *IndexSuite) TestSplitIndex(c *C) {
+	fs := memfs.New()
+	storage := NewStorage(fs, cache.NewObjectLRUDefault())
+
+	idx := &index.Index{
+		Version: 2,
+		Entries: []*index.Entry{
+			{Name: "foo", Size: 1},
+			{Name: "bar", Size: 2},
+		},
+		SplitIndex: &index.SplitIndex{},
+	}
+
+	err := storage.SetIndex(idx)
+	c.Assert(err, IsNil)
+	c.Assert(idx.SplitIndex.BaseHash.IsZero(), Equals, false)
+
+	_, err = fs.Stat("sharedindex." + idx.SplitIndex.BaseHash.String())
+	c.Assert(err, IsNil)
+
+	idx, err = storage.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.Entries, HasLen, 2)
+	c.Assert(idx.SplitIndex.Base, NotNil)
+
+	idx.Entries[0].Size = 42
+	idx.Entries = append(idx.Entries, &index.Entry{Name: "qux", Size: 3})
+	err = storage.SetIndex(idx)
+	c.Assert(err, IsNil)
+	c.Assert(idx.SplitIndex.Replace, DeepEquals, []bool{true, false})
+
+	idx, err = storage.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.Entries, HasLen, 3)
+	c.Assert(idx.Entries[0].Name, Equals, "bar")
+	c.Assert(idx.Entries[0].Size, Equals, uint32(42))
+	c.Assert(idx.Entries[2].Name, Equals, "qux")
+}
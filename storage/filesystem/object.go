@@ -543,6 +543,15 @@ func (s *ObjectStorage) HashesWithPrefix(prefix []byte) ([]plumbing.Hash, error)
 		return nil, err
 	}
 
+	if err := s.requireIndex(); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[plumbing.Hash]bool, len(hashes))
+	for _, h := range hashes {
+		seen[h] = true
+	}
+
 	// TODO: This could be faster with some idxfile changes,
 	// or diving into the packfile.
 	for _, index := range s.index {
@@ -557,7 +566,8 @@ func (s *ObjectStorage) HashesWithPrefix(prefix []byte) ([]plumbing.Hash, error)
 			} else if err != nil {
 				return nil, err
 			}
-			if bytes.HasPrefix(e.Hash[:], prefix) {
+			if bytes.HasPrefix(e.Hash[:], prefix) && !seen[e.Hash] {
+				seen[e.Hash] = true
 				hashes = append(hashes, e.Hash)
 			}
 		}
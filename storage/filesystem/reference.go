@@ -31,8 +31,13 @@ func (r *ReferenceStorage) IterReferences() (storer.ReferenceIter, error) {
 	return storer.NewReferenceSliceIter(refs), nil
 }
 
+// RemoveReference removes the given reference along with its reflog.
 func (r *ReferenceStorage) RemoveReference(n plumbing.ReferenceName) error {
-	return r.dir.RemoveRef(n)
+	if err := r.dir.RemoveRef(n); err != nil {
+		return err
+	}
+
+	return r.dir.RemoveReflog(n)
 }
 
 func (r *ReferenceStorage) CountLooseRefs() (int, error) {
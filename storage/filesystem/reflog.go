@@ -0,0 +1,58 @@
+package filesystem
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
+	"github.com/go-git/go-git/v5/storage/filesystem/dotgit"
+	"github.com/go-git/go-git/v5/utils/ioutil"
+)
+
+// ReflogStorage stores the reflogs in the logs directory of the git
+// directory, in the format used by git.
+type ReflogStorage struct {
+	dir *dotgit.DotGit
+}
+
+// Reflog returns the entries of the reflog of the given reference, from the
+// oldest one.
+func (s *ReflogStorage) Reflog(name plumbing.ReferenceName) (entries []*reflog.Entry, err error) {
+	f, err := s.dir.Reflog(name)
+	if err != nil || f == nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	return reflog.NewDecoder(f).DecodeAll()
+}
+
+// AppendReflog adds an entry to the reflog of the given reference.
+func (s *ReflogStorage) AppendReflog(name plumbing.ReferenceName, e *reflog.Entry) error {
+	return s.writeReflog(name, false, e)
+}
+
+// SetReflog replaces the entries of the reflog of the given reference.
+func (s *ReflogStorage) SetReflog(name plumbing.ReferenceName, entries []*reflog.Entry) error {
+	return s.writeReflog(name, true, entries...)
+}
+
+// RemoveReflog removes the reflog of the given reference.
+func (s *ReflogStorage) RemoveReflog(name plumbing.ReferenceName) error {
+	return s.dir.RemoveReflog(name)
+}
+
+func (s *ReflogStorage) writeReflog(name plumbing.ReferenceName, truncate bool, entries ...*reflog.Entry) (err error) {
+	f, err := s.dir.ReflogWriter(name, truncate)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	e := reflog.NewEncoder(f)
+	for _, entry := range entries {
+		if err := e.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
 	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/go-git/go-git/v5/storage"
 )
@@ -24,6 +25,7 @@ type Storage struct {
 	ShallowStorage
 	IndexStorage
 	ReferenceStorage
+	ReflogStorage
 	ModuleStorage
 }
 
@@ -31,6 +33,7 @@ type Storage struct {
 func NewStorage() *Storage {
 	return &Storage{
 		ReferenceStorage: make(ReferenceStorage),
+		ReflogStorage:    make(ReflogStorage),
 		ConfigStorage:    ConfigStorage{},
 		ShallowStorage:   ShallowStorage{},
 		ObjectStorage: ObjectStorage{
@@ -295,6 +298,44 @@ func (r ReferenceStorage) RemoveReference(n plumbing.ReferenceName) error {
 	return nil
 }
 
+// RemoveReference removes the given reference along with its reflog.
+func (s *Storage) RemoveReference(n plumbing.ReferenceName) error {
+	if err := s.ReferenceStorage.RemoveReference(n); err != nil {
+		return err
+	}
+
+	return s.ReflogStorage.RemoveReflog(n)
+}
+
+// ReflogStorage stores the reflogs in memory, indexed by reference name.
+type ReflogStorage map[plumbing.ReferenceName][]*reflog.Entry
+
+// Reflog returns the entries of the reflog of the given reference, from the
+// oldest one.
+func (s ReflogStorage) Reflog(n plumbing.ReferenceName) ([]*reflog.Entry, error) {
+	entries := make([]*reflog.Entry, len(s[n]))
+	copy(entries, s[n])
+	return entries, nil
+}
+
+// AppendReflog adds an entry to the reflog of the given reference.
+func (s ReflogStorage) AppendReflog(n plumbing.ReferenceName, e *reflog.Entry) error {
+	s[n] = append(s[n], e)
+	return nil
+}
+
+// SetReflog replaces the entries of the reflog of the given reference.
+func (s ReflogStorage) SetReflog(n plumbing.ReferenceName, entries []*reflog.Entry) error {
+	s[n] = append([]*reflog.Entry(nil), entries...)
+	return nil
+}
+
+// RemoveReflog removes the reflog of the given reference.
+func (s ReflogStorage) RemoveReflog(n plumbing.ReferenceName) error {
+	delete(s, n)
+	return nil
+}
+
 type ShallowStorage []plumbing.Hash
 
 func (s *ShallowStorage) SetShallow(commits []plumbing.Hash) error {
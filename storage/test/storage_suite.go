@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"time"
 
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
 	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/go-git/go-git/v5/storage"
 
@@ -484,6 +486,53 @@ func (s *BaseStorageSuite) TestDeltaObjectStorer(c *C) {
 	c.Assert(ok, Equals, true)
 }
 
+func (s *BaseStorageSuite) TestReflogStorer(c *C) {
+	rs, ok := s.Storer.(storer.ReflogStorer)
+	if !ok {
+		c.Skip("not a ReflogStorer")
+	}
+
+	name := plumbing.ReferenceName("refs/heads/foo")
+	entries, err := rs.Reflog(name)
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 0)
+
+	first := &reflog.Entry{
+		New:       plumbing.NewHash("bc9968d75e48de59f0870ffb71f5e160bbbdcf52"),
+		Committer: reflog.Signature{Name: "foo", Email: "foo@foo.com", When: time.Unix(1257894000, 0)},
+		Message:   "commit (initial): foo",
+	}
+
+	second := &reflog.Entry{
+		Old:       first.New,
+		New:       plumbing.NewHash("c3f4688a08fd86f1bf8e055724c84b7a40a09733"),
+		Committer: first.Committer,
+		Message:   "commit: bar",
+	}
+
+	c.Assert(rs.AppendReflog(name, first), IsNil)
+	c.Assert(rs.AppendReflog(name, second), IsNil)
+
+	entries, err = rs.Reflog(name)
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 2)
+	c.Assert(entries[0].New, Equals, first.New)
+	c.Assert(entries[1].Old, Equals, first.New)
+	c.Assert(entries[1].Message, Equals, "commit: bar")
+	c.Assert(entries[1].Committer.When.Unix(), Equals, int64(1257894000))
+
+	c.Assert(rs.SetReflog(name, entries[1:]), IsNil)
+	entries, err = rs.Reflog(name)
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+	c.Assert(entries[0].New, Equals, second.New)
+
+	c.Assert(rs.RemoveReflog(name), IsNil)
+	entries, err = rs.Reflog(name)
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 0)
+}
+
 func objectEquals(a plumbing.EncodedObject, b plumbing.EncodedObject) error {
 	ha := a.Hash()
 	hb := b.Hash()
@@ -0,0 +1,342 @@
+// Package merge implements a line oriented three-way merge, similar to the
+// one performed by the Unix diff3 and git merge-file commands.
+//
+// The changes made on each side are computed as line oriented diffs against
+// the common ancestor using the utils/diff package. Non-overlapping changes
+// are applied together, while changes that overlap (or touch) in the ancestor
+// are reported as conflicts, unless they are identical or a Favor is given.
+package merge
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/utils/diff"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+const (
+	// MarkerSize is the length of the conflict markers.
+	MarkerSize = 7
+
+	// DefaultOursLabel is the label used after the conflict start marker when
+	// Options.OursLabel is empty.
+	DefaultOursLabel = "ours"
+	// DefaultTheirsLabel is the label used after the conflict end marker when
+	// Options.TheirsLabel is empty.
+	DefaultTheirsLabel = "theirs"
+	// DefaultBaseLabel is the label used after the ancestor marker when
+	// Options.BaseLabel is empty and Options.Style is Diff3Style.
+	DefaultBaseLabel = "base"
+)
+
+// Favor defines how overlapping changes are resolved.
+type Favor int8
+
+const (
+	// FavorNone reports overlapping changes as conflicts.
+	FavorNone Favor = iota
+	// FavorOurs resolves overlapping changes using our side, it is the
+	// equivalent to `git merge-file --ours`.
+	FavorOurs
+	// FavorTheirs resolves overlapping changes using their side, it is the
+	// equivalent to `git merge-file --theirs`.
+	FavorTheirs
+	// FavorUnion resolves overlapping changes using the lines of both sides,
+	// it is the equivalent to `git merge-file --union`.
+	FavorUnion
+)
+
+// ConflictStyle defines how a conflict is written in the merged content.
+type ConflictStyle int8
+
+const (
+	// MergeStyle writes only our and their side of a conflict.
+	MergeStyle ConflictStyle = iota
+	// Diff3Style writes also the ancestor lines of a conflict, between the
+	// `|||||||` and `=======` markers.
+	Diff3Style
+)
+
+// Options describes how a merge should be performed.
+type Options struct {
+	// OursLabel is written after the conflict start marker.
+	OursLabel string
+	// TheirsLabel is written after the conflict end marker.
+	TheirsLabel string
+	// BaseLabel is written after the ancestor marker, only used with
+	// Diff3Style.
+	BaseLabel string
+	// Favor defines how overlapping changes are resolved, by default they are
+	// reported as conflicts.
+	Favor Favor
+	// Style defines how conflicts are written.
+	Style ConflictStyle
+}
+
+// Result is the outcome of a three-way merge.
+type Result struct {
+	// Content is the merged content, containing conflict markers for every
+	// unresolved conflict.
+	Content []byte
+	// Conflicts is the number of conflicting hunks found.
+	Conflicts int
+}
+
+// HasConflicts returns true if any of the hunks of the merge conflicted.
+func (r *Result) HasConflicts() bool {
+	return r.Conflicts > 0
+}
+
+// Merge performs a three-way merge of ours and theirs using base as their
+// common ancestor. If opts is nil the default options are used.
+func Merge(base, ours, theirs []byte, opts *Options) *Result {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	m := &merger{opts: opts, base: splitLines(string(base))}
+	return m.merge(string(ours), string(theirs))
+}
+
+// hunk represents the replacement of the lines [start, end) of the ancestor
+// with the given lines, made by one of the sides.
+type hunk struct {
+	side       int
+	start, end int
+	lines      []string
+}
+
+const (
+	oursSide = iota
+	theirsSide
+)
+
+type merger struct {
+	opts *Options
+	base []string
+	buf  bytes.Buffer
+
+	conflicts int
+}
+
+func (m *merger) merge(ours, theirs string) *Result {
+	base := strings.Join(m.base, "")
+	hunks := append(
+		hunks(oursSide, diff.Do(base, ours)),
+		hunks(theirsSide, diff.Do(base, theirs))...,
+	)
+
+	sort.SliceStable(hunks, func(i, j int) bool {
+		if hunks[i].start != hunks[j].start {
+			return hunks[i].start < hunks[j].start
+		}
+
+		return hunks[i].end < hunks[j].end
+	})
+
+	pos := 0
+	for i := 0; i < len(hunks); {
+		start, end := hunks[i].start, hunks[i].end
+		j := i + 1
+		for ; j < len(hunks) && hunks[j].start <= end; j++ {
+			if hunks[j].end > end {
+				end = hunks[j].end
+			}
+		}
+
+		m.writeLines(m.base[pos:start])
+		m.resolve(hunks[i:j], start, end)
+		pos = end
+		i = j
+	}
+
+	m.writeLines(m.base[pos:])
+
+	return &Result{Content: m.buf.Bytes(), Conflicts: m.conflicts}
+}
+
+// resolve writes the result of a region of the ancestor, modified by the
+// given hunks.
+func (m *merger) resolve(hs []*hunk, start, end int) {
+	var sides [2][]*hunk
+	for _, h := range hs {
+		sides[h.side] = append(sides[h.side], h)
+	}
+
+	ours := m.apply(sides[oursSide], start, end)
+	theirs := m.apply(sides[theirsSide], start, end)
+
+	switch {
+	case len(sides[theirsSide]) == 0:
+		m.writeLines(ours)
+	case len(sides[oursSide]) == 0:
+		m.writeLines(theirs)
+	case equalLines(ours, theirs):
+		m.writeLines(ours)
+	case m.opts.Favor == FavorOurs:
+		m.writeLines(ours)
+	case m.opts.Favor == FavorTheirs:
+		m.writeLines(theirs)
+	case m.opts.Favor == FavorUnion:
+		m.writeLines(ours)
+		m.writeLines(theirs)
+	default:
+		m.writeConflict(ours, m.base[start:end], theirs)
+	}
+}
+
+// apply returns the lines [start, end) of the ancestor with the given hunks
+// applied.
+func (m *merger) apply(hs []*hunk, start, end int) []string {
+	var lines []string
+	pos := start
+	for _, h := range hs {
+		lines = append(lines, m.base[pos:h.start]...)
+		lines = append(lines, h.lines...)
+		pos = h.end
+	}
+
+	return append(lines, m.base[pos:end]...)
+}
+
+func (m *merger) writeConflict(ours, base, theirs []string) {
+	m.conflicts++
+
+	// like git, the lines shared by both sides at the beginning and the end
+	// of the conflict are moved out of it, unless the ancestor is displayed.
+	var suffix []string
+	if m.opts.Style != Diff3Style {
+		var prefix []string
+		prefix, ours, theirs = commonPrefix(ours, theirs)
+		suffix, ours, theirs = commonSuffix(ours, theirs)
+		m.writeLines(prefix)
+	}
+
+	m.writeMarker('<', label(m.opts.OursLabel, DefaultOursLabel))
+	m.writeLines(ours)
+	if m.opts.Style == Diff3Style {
+		m.writeMarker('|', label(m.opts.BaseLabel, DefaultBaseLabel))
+		m.writeLines(base)
+	}
+
+	m.writeMarker('=', "")
+	m.writeLines(theirs)
+	m.writeMarker('>', label(m.opts.TheirsLabel, DefaultTheirsLabel))
+	m.writeLines(suffix)
+}
+
+func commonPrefix(a, b []string) (prefix, restA, restB []string) {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+
+	return a[:i], a[i:], b[i:]
+}
+
+func commonSuffix(a, b []string) (suffix, restA, restB []string) {
+	i := 0
+	for i < len(a) && i < len(b) && a[len(a)-1-i] == b[len(b)-1-i] {
+		i++
+	}
+
+	return a[len(a)-i:], a[:len(a)-i], b[:len(b)-i]
+}
+
+func (m *merger) writeMarker(c byte, label string) {
+	m.terminateLine()
+	m.buf.Write(bytes.Repeat([]byte{c}, MarkerSize))
+	if label != "" {
+		m.buf.WriteByte(' ')
+		m.buf.WriteString(label)
+	}
+
+	m.buf.WriteByte('\n')
+}
+
+func (m *merger) writeLines(lines []string) {
+	for _, l := range lines {
+		m.buf.WriteString(l)
+	}
+}
+
+// terminateLine adds a line feed if the content written so far doesn't end
+// with one, so a marker always starts at the beginning of a line.
+func (m *merger) terminateLine() {
+	if m.buf.Len() > 0 && m.buf.Bytes()[m.buf.Len()-1] != '\n' {
+		m.buf.WriteByte('\n')
+	}
+}
+
+// hunks converts a line oriented diff into the list of hunks made by a side.
+func hunks(side int, diffs []diffmatchpatch.Diff) []*hunk {
+	var result []*hunk
+	var current *hunk
+
+	pos := 0
+	for _, d := range diffs {
+		lines := splitLines(d.Text)
+		if d.Type == diffmatchpatch.DiffEqual {
+			current = nil
+			pos += len(lines)
+			continue
+		}
+
+		if current == nil {
+			current = &hunk{side: side, start: pos, end: pos}
+			result = append(result, current)
+		}
+
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			pos += len(lines)
+			current.end = pos
+		case diffmatchpatch.DiffInsert:
+			current.lines = append(current.lines, lines...)
+		}
+	}
+
+	return result
+}
+
+// splitLines splits s in lines, keeping the line terminators.
+func splitLines(s string) []string {
+	var lines []string
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			lines = append(lines, s)
+			break
+		}
+
+		lines = append(lines, s[:i+1])
+		s = s[i+1:]
+	}
+
+	return lines
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func label(l, def string) string {
+	if l == "" {
+		return def
+	}
+
+	return l
+}
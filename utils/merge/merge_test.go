@@ -0,0 +1,97 @@
+package merge_test
+
+import (
+	"testing"
+
+	"github.com/go-git/go-git/v5/utils/merge"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type MergeSuite struct{}
+
+var _ = Suite(&MergeSuite{})
+
+func (s *MergeSuite) TestClean(c *C) {
+	for i, t := range []struct {
+		base, ours, theirs, expected string
+	}{
+		{"", "", "", ""},
+		{"a\nb\nc\n", "a\nb\nc\n", "a\nb\nc\n", "a\nb\nc\n"},
+		{"a\nb\nc\n", "A\nb\nc\n", "a\nb\nc\n", "A\nb\nc\n"},
+		{"a\nb\nc\n", "a\nb\nc\n", "a\nb\nC\n", "a\nb\nC\n"},
+		{"a\nb\nc\n", "A\nb\nc\n", "a\nb\nC\n", "A\nb\nC\n"},
+		{"a\nb\nc\n", "A\nb\nc\n", "A\nb\nc\n", "A\nb\nc\n"},
+		{"a\nb\nc\nd\n", "b\nc\nd\n", "a\nb\nc\n", "b\nc\n"},
+		{"a\nb\nc\n", "x\na\nb\nc\n", "a\nb\nc\ny\n", "x\na\nb\nc\ny\n"},
+		{"a\nb\nc", "A\nb\nc", "a\nb\nc\n", "A\nb\nc\n"},
+	} {
+		r := merge.Merge([]byte(t.base), []byte(t.ours), []byte(t.theirs), nil)
+		c.Assert(r.HasConflicts(), Equals, false, Commentf("subtest %d", i))
+		c.Assert(string(r.Content), Equals, t.expected, Commentf("subtest %d", i))
+	}
+}
+
+func (s *MergeSuite) TestConflict(c *C) {
+	r := merge.Merge(
+		[]byte("a\nb\nc\n"),
+		[]byte("a\nB\nc\n"),
+		[]byte("a\nX\nc\n"),
+		&merge.Options{OursLabel: "HEAD", TheirsLabel: "feature"},
+	)
+
+	c.Assert(r.Conflicts, Equals, 1)
+	c.Assert(string(r.Content), Equals, "a\n"+
+		"<<<<<<< HEAD\nB\n=======\nX\n>>>>>>> feature\n"+
+		"c\n",
+	)
+}
+
+func (s *MergeSuite) TestConflictDiff3Style(c *C) {
+	r := merge.Merge(
+		[]byte("a\nb\nc\n"),
+		[]byte("a\nB\nc\n"),
+		[]byte("a\nX\nc\n"),
+		&merge.Options{Style: merge.Diff3Style},
+	)
+
+	c.Assert(r.Conflicts, Equals, 1)
+	c.Assert(string(r.Content), Equals, "a\n"+
+		"<<<<<<< ours\nB\n||||||| base\nb\n=======\nX\n>>>>>>> theirs\n"+
+		"c\n",
+	)
+}
+
+func (s *MergeSuite) TestConflictMissingNewline(c *C) {
+	r := merge.Merge([]byte("a"), []byte("b"), []byte("c"), nil)
+
+	c.Assert(r.Conflicts, Equals, 1)
+	c.Assert(string(r.Content), Equals,
+		"<<<<<<< ours\nb\n=======\nc\n>>>>>>> theirs\n",
+	)
+}
+
+func (s *MergeSuite) TestAddAdd(c *C) {
+	r := merge.Merge(nil, []byte("a\nb\n"), []byte("a\nc\n"), nil)
+
+	c.Assert(r.Conflicts, Equals, 1)
+	c.Assert(string(r.Content), Equals,
+		"a\n<<<<<<< ours\nb\n=======\nc\n>>>>>>> theirs\n",
+	)
+}
+
+func (s *MergeSuite) TestFavor(c *C) {
+	base, ours, theirs := []byte("a\nb\nc\n"), []byte("a\nB\nc\n"), []byte("a\nX\nc\n")
+
+	for favor, expected := range map[merge.Favor]string{
+		merge.FavorOurs:   "a\nB\nc\n",
+		merge.FavorTheirs: "a\nX\nc\n",
+		merge.FavorUnion:  "a\nB\nX\nc\n",
+	} {
+		r := merge.Merge(base, ours, theirs, &merge.Options{Favor: favor})
+		c.Assert(r.HasConflicts(), Equals, false)
+		c.Assert(string(r.Content), Equals, expected)
+	}
+}
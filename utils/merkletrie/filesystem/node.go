@@ -1,9 +1,11 @@
 package filesystem
 
 import (
+	"bytes"
 	"io"
 	"os"
 	"path"
+	"strings"
 
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/filemode"
@@ -24,6 +26,9 @@ var ignore = map[string]bool{
 type node struct {
 	fs         billy.Filesystem
 	submodules map[string]plumbing.Hash
+	cache      Cache
+	convert    ConvertFunc
+	converts   ConvertsFunc
 
 	path     string
 	hash     []byte
@@ -43,6 +48,57 @@ func NewRootNode(
 	return &node{fs: fs, submodules: submodules, isDir: true}
 }
 
+// Options are the options of the nodes of a billy.Filesystem.
+type Options struct {
+	// Cache, if set, is used to skip reading the files and directories known
+	// to be unchanged.
+	Cache Cache
+	// Convert, if set, converts the content of the regular files before
+	// computing their hashes.
+	Convert ConvertFunc
+	// Converts, if set, tells the files converted by Convert, the other ones
+	// are hashed without reading their whole content in memory.
+	Converts ConvertsFunc
+}
+
+// ConvertFunc writes to w the content of the file at the given path read
+// from r, converted as it is when the file is added to the index.
+type ConvertFunc func(path string, w io.Writer, r io.Reader) error
+
+// ConvertsFunc returns true if the content of the file at the given path may
+// be changed by a ConvertFunc.
+type ConvertsFunc func(path string) (bool, error)
+
+// Cache provides the contents of the files and directories of a filesystem
+// known to be unchanged, such as the ones recorded in the index along with a
+// file system monitor.
+type Cache interface {
+	// FileHash returns the hash of the file at the given path, as returned
+	// by Node.Hash, if the file is known to be unchanged.
+	FileHash(path string) ([]byte, bool)
+	// DirNames returns the names of the children of the directory at the
+	// given path, if the directory is known to be unchanged. The names of
+	// the directories end with a slash.
+	DirNames(path string) ([]string, bool)
+}
+
+// NewRootNodeWithOptions returns the root node based on a given
+// billy.Filesystem, as NewRootNode does, using the given options.
+func NewRootNodeWithOptions(
+	fs billy.Filesystem,
+	submodules map[string]plumbing.Hash,
+	opts Options,
+) noder.Noder {
+	return &node{
+		fs:         fs,
+		submodules: submodules,
+		cache:      opts.Cache,
+		convert:    opts.Convert,
+		converts:   opts.Converts,
+		isDir:      true,
+	}
+}
+
 // Hash the hash of a filesystem is the result of concatenating the computed
 // plumbing.Hash of the file as a Blob and its plumbing.FileMode; that way the
 // difftree algorithm will detect changes in the contents of files and also in
@@ -90,6 +146,12 @@ func (n *node) calculateChildren() error {
 		return nil
 	}
 
+	if n.cache != nil {
+		if names, ok := n.cache.DirNames(n.path); ok {
+			return n.calculateCachedChildren(names)
+		}
+	}
+
 	files, err := n.fs.ReadDir(n.path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -114,23 +176,75 @@ func (n *node) calculateChildren() error {
 	return nil
 }
 
-func (n *node) newChildNode(file os.FileInfo) (*node, error) {
-	path := path.Join(n.path, file.Name())
+// calculateCachedChildren creates the children from the names provided by
+// the cache, the files are only read if their hashes aren't cached.
+func (n *node) calculateCachedChildren(names []string) error {
+	for _, name := range names {
+		if _, ok := ignore[strings.TrimSuffix(name, "/")]; ok {
+			continue
+		}
+
+		c, err := n.newCachedChildNode(name)
+		if err != nil {
+			return err
+		}
+
+		if c != nil {
+			n.children = append(n.children, c)
+		}
+	}
+
+	return nil
+}
+
+func (n *node) newCachedChildNode(name string) (*node, error) {
+	path := path.Join(n.path, name)
+	if _, isSubmodule := n.submodules[path]; !isSubmodule {
+		if strings.HasSuffix(name, "/") {
+			return n.newNode(strings.TrimSuffix(path, "/"), make([]byte, 24), true), nil
+		}
+
+		if hash, ok := n.cache.FileHash(path); ok {
+			return n.newNode(path, hash, false), nil
+		}
+	}
+
+	file, err := n.fs.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
 
-	hash, err := n.calculateHash(path, file)
 	if err != nil {
 		return nil, err
 	}
 
-	node := &node{
+	return n.newChildNode(file)
+}
+
+func (n *node) newNode(path string, hash []byte, isDir bool) *node {
+	return &node{
 		fs:         n.fs,
 		submodules: n.submodules,
+		cache:      n.cache,
+		convert:    n.convert,
+		converts:   n.converts,
 
 		path:  path,
 		hash:  hash,
-		isDir: file.IsDir(),
+		isDir: isDir,
+	}
+}
+
+func (n *node) newChildNode(file os.FileInfo) (*node, error) {
+	path := path.Join(n.path, file.Name())
+
+	hash, err := n.calculateHash(path, file)
+	if err != nil {
+		return nil, err
 	}
 
+	node := n.newNode(path, hash, file.IsDir())
+
 	if hash, isSubmodule := n.submodules[path]; isSubmodule {
 		node.hash = append(hash[:], filemode.Submodule.Bytes()...)
 		node.isDir = false
@@ -144,6 +258,12 @@ func (n *node) calculateHash(path string, file os.FileInfo) ([]byte, error) {
 		return make([]byte, 24), nil
 	}
 
+	if n.cache != nil {
+		if hash, ok := n.cache.FileHash(path); ok {
+			return hash, nil
+		}
+	}
+
 	var hash plumbing.Hash
 	var err error
 	if file.Mode()&os.ModeSymlink != 0 {
@@ -172,6 +292,18 @@ func (n *node) doCalculateHashForRegular(path string, file os.FileInfo) (plumbin
 
 	defer f.Close()
 
+	convert := n.convert != nil
+	if convert && n.converts != nil {
+		convert, err = n.converts(path)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	if convert {
+		return n.doCalculateHashForConverted(path, f)
+	}
+
 	h := plumbing.NewHasher(plumbing.BlobObject, file.Size())
 	if _, err := io.Copy(h, f); err != nil {
 		return plumbing.ZeroHash, err
@@ -180,6 +312,16 @@ func (n *node) doCalculateHashForRegular(path string, file os.FileInfo) (plumbin
 	return h.Sum(), nil
 }
 
+func (n *node) doCalculateHashForConverted(path string, f io.Reader) (plumbing.Hash, error) {
+	// the size of the converted content is needed before hashing it
+	buf := bytes.NewBuffer(nil)
+	if err := n.convert(path, buf, f); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return plumbing.ComputeHash(plumbing.BlobObject, buf.Bytes()), nil
+}
+
 func (n *node) doCalculateHashForSymlink(path string, file os.FileInfo) (plumbing.Hash, error) {
 	target, err := n.fs.Readlink(path)
 	if err != nil {
@@ -3,6 +3,7 @@ package filesystem
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"testing"
@@ -196,6 +197,104 @@ func (s *NoderSuite) TestDiffDirectory(c *C) {
 	c.Assert(a, Equals, merkletrie.Modify)
 }
 
+type testCache struct {
+	hashes map[string][]byte
+	dirs   map[string][]string
+}
+
+func (c *testCache) FileHash(path string) ([]byte, bool) {
+	h, ok := c.hashes[path]
+	return h, ok
+}
+
+func (c *testCache) DirNames(path string) ([]string, bool) {
+	names, ok := c.dirs[path]
+	return names, ok
+}
+
+func (s *NoderSuite) TestDiffCache(c *C) {
+	fsA := memfs.New()
+	WriteFile(fsA, "foo", []byte("foo"), 0644)
+	WriteFile(fsA, "qux/bar", []byte("foo"), 0644)
+	WriteFile(fsA, "qux/qux", []byte("foo"), 0644)
+
+	fsB := memfs.New()
+	WriteFile(fsB, "foo", []byte("bar"), 0644)
+	WriteFile(fsB, "qux/bar", []byte("foo"), 0644)
+	WriteFile(fsB, "qux/qux", []byte("foo"), 0644)
+	WriteFile(fsB, "qux/baz", []byte("foo"), 0644)
+
+	a := NewRootNode(fsA, nil)
+	children, err := a.Children()
+	c.Assert(err, IsNil)
+
+	// the content of foo and the new qux/baz are hidden by the cache
+	cache := &testCache{
+		hashes: map[string][]byte{"foo": children[0].Hash()},
+		dirs: map[string][]string{
+			"":    {"foo", "qux/", "missing"},
+			"qux": {"bar", "qux"},
+		},
+	}
+
+	ch, err := merkletrie.DiffTree(
+		NewRootNode(fsA, nil),
+		NewRootNodeWithOptions(fsB, nil, Options{Cache: cache}),
+		IsEquals,
+	)
+
+	c.Assert(err, IsNil)
+	c.Assert(ch, HasLen, 0)
+
+	delete(cache.dirs, "qux")
+	ch, err = merkletrie.DiffTree(
+		NewRootNode(fsA, nil),
+		NewRootNodeWithOptions(fsB, nil, Options{Cache: cache}),
+		IsEquals,
+	)
+
+	c.Assert(err, IsNil)
+	c.Assert(ch, HasLen, 1)
+	c.Assert(ch[0].To.String(), Equals, "qux/baz")
+}
+
+func (s *NoderSuite) TestDiffConvert(c *C) {
+	fsA := memfs.New()
+	WriteFile(fsA, "foo", []byte("foo\n"), 0644)
+	WriteFile(fsA, "bar", []byte("bar\r\n"), 0644)
+
+	fsB := memfs.New()
+	WriteFile(fsB, "foo", []byte("foo\r\n"), 0644)
+	WriteFile(fsB, "bar", []byte("bar\r\n"), 0644)
+
+	var converted []string
+	opts := Options{
+		Convert: func(path string, w io.Writer, r io.Reader) error {
+			converted = append(converted, path)
+			content, err := ioutil.ReadAll(r)
+			if err != nil {
+				return err
+			}
+
+			_, err = w.Write(bytes.Replace(content, []byte("\r\n"), []byte("\n"), -1))
+			return err
+		},
+		Converts: func(path string) (bool, error) {
+			return path == "foo", nil
+		},
+	}
+
+	ch, err := merkletrie.DiffTree(
+		NewRootNode(fsA, nil),
+		NewRootNodeWithOptions(fsB, nil, opts),
+		IsEquals,
+	)
+
+	c.Assert(err, IsNil)
+	c.Assert(ch, HasLen, 0)
+	c.Assert(converted, DeepEquals, []string{"foo"})
+}
+
 func WriteFile(fs billy.Filesystem, filename string, data []byte, perm os.FileMode) error {
 	f, err := fs.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
 	if err != nil {
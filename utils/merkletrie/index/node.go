@@ -23,12 +23,17 @@ type node struct {
 }
 
 // NewRootNode returns the root node of a computed tree from a index.Index,
+// the unmerged entries (higher stage entries of a conflict) are ignored.
 func NewRootNode(idx *index.Index) noder.Noder {
 	const rootNode = ""
 
 	m := map[string]*node{rootNode: {isDir: true}}
 
 	for _, e := range idx.Entries {
+		if e.Stage != index.Merged {
+			continue
+		}
+
 		parts := strings.Split(e.Name, string("/"))
 
 		var fullpath string
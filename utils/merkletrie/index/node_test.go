@@ -105,6 +105,26 @@ func (s *NoderSuite) TestDiffSameRoot(c *C) {
 
 var empty = make([]byte, 24)
 
+func (s *NoderSuite) TestDiffUnmerged(c *C) {
+	indexA := &index.Index{
+		Entries: []*index.Entry{
+			{Name: "foo", Hash: plumbing.NewHash("8ab686eafeb1f44702738c8b0f24f2567c36da6d")},
+		},
+	}
+
+	indexB := &index.Index{
+		Entries: []*index.Entry{
+			{Name: "foo", Hash: plumbing.NewHash("8ab686eafeb1f44702738c8b0f24f2567c36da6d")},
+			{Name: "bar", Stage: index.AncestorMode, Hash: plumbing.NewHash("dead12345eb1f44702738c8b0f24f2567c36da6d")},
+			{Name: "bar", Stage: index.OurMode, Hash: plumbing.NewHash("8ab686eafeb1f44702738c8b0f24f2567c36da6d")},
+		},
+	}
+
+	ch, err := merkletrie.DiffTree(NewRootNode(indexA), NewRootNode(indexB), isEquals)
+	c.Assert(err, IsNil)
+	c.Assert(ch, HasLen, 0)
+}
+
 func isEquals(a, b noder.Hasher) bool {
 	if bytes.Equal(a.Hash(), empty) || bytes.Equal(b.Hash(), empty) {
 		return false
@@ -38,6 +38,12 @@ type Worktree struct {
 	Filesystem billy.Filesystem
 	// External excludes not found in the repository .gitignore
 	Excludes []gitignore.Pattern
+	// FileSystemMonitor, if set, is used by Status instead of the hook of
+	// core.fsmonitor to skip the files known to be unchanged.
+	FileSystemMonitor FileSystemMonitor
+	// Filters are the filter drivers of the filter gitattribute by name,
+	// used instead of the commands of the filter.<name> configuration.
+	Filters map[string]Filter
 
 	r *Repository
 }
@@ -46,7 +52,8 @@ type Worktree struct {
 // Returns nil if the operation is successful, NoErrAlreadyUpToDate if there are
 // no changes to be fetched, or an error.
 //
-// Pull only supports merges where the can be resolved as a fast-forward.
+// When the current branch and the fetched one diverged, they are merged or
+// the local commits rebased according to PullOptions.Mode.
 func (w *Worktree) Pull(o *PullOptions) error {
 	return w.PullContext(context.Background(), o)
 }
@@ -55,7 +62,10 @@ func (w *Worktree) Pull(o *PullOptions) error {
 // branch. Returns nil if the operation is successful, NoErrAlreadyUpToDate if
 // there are no changes to be fetched, or an error.
 //
-// Pull only supports merges where the can be resolved as a fast-forward.
+// When the current branch and the fetched one diverged, they are merged or
+// the local commits rebased according to PullOptions.Mode. If they stop
+// because of conflicts ErrMergeConflict or ErrRebaseConflict is returned, see
+// Worktree.Merge and Worktree.Rebase.
 //
 // The provided Context must be non-nil. If the context expires before the
 // operation is complete, an error is returned. The context only affects the
@@ -109,16 +119,33 @@ func (w *Worktree) PullContext(ctx context.Context, o *PullOptions) error {
 			return err
 		}
 
-		if !ff {
+		mode, noFastForward, err := w.pullMode(o)
+		if err != nil {
+			return err
+		}
+
+		if !ff && mode == FastForwardOnlyPull {
 			return ErrNonFastForwardUpdate
 		}
+
+		if headAheadOfRef {
+			return NoErrAlreadyUpToDate
+		}
+
+		if !ff || noFastForward {
+			if err := w.pullDiverged(o, mode, noFastForward, remote, ref); err != nil {
+				return err
+			}
+
+			return w.pullSubmodules(o)
+		}
 	}
 
 	if err != nil && err != plumbing.ErrReferenceNotFound {
 		return err
 	}
 
-	if err := w.updateHEAD(ref.Hash()); err != nil {
+	if err := w.updateHEAD(ref.Hash(), "pull: Fast-forward", reflogCommitter(w.r.Storer, o.Committer)); err != nil {
 		return err
 	}
 
@@ -129,6 +156,10 @@ func (w *Worktree) PullContext(ctx context.Context, o *PullOptions) error {
 		return err
 	}
 
+	return w.pullSubmodules(o)
+}
+
+func (w *Worktree) pullSubmodules(o *PullOptions) error {
 	if o.RecurseSubmodules != NoRecurseSubmodules {
 		return w.updateSubmodules(&SubmoduleUpdateOptions{
 			RecurseSubmodules: o.RecurseSubmodules,
@@ -139,6 +170,76 @@ func (w *Worktree) PullContext(ctx context.Context, o *PullOptions) error {
 	return nil
 }
 
+// pullMode returns the mode to be used by Pull, reading it from the config
+// if not given, and if a merge commit should be always created.
+func (w *Worktree) pullMode(o *PullOptions) (mode PullMode, noFastForward bool, err error) {
+	cfg, err := w.r.ConfigScoped(config.SystemScope)
+	if err != nil {
+		return mode, false, err
+	}
+
+	noFastForward = cfg.Pull.FastForward == "false"
+	if o.Mode != DefaultPull {
+		return o.Mode, noFastForward && o.Mode == MergePull, nil
+	}
+
+	rebase := cfg.Pull.Rebase
+	head, err := w.r.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return mode, false, err
+	}
+
+	if b, ok := cfg.Branches[head.Target().Short()]; ok && head.Target().IsBranch() && b.Rebase != "" {
+		rebase = b.Rebase
+	}
+
+	switch {
+	case rebase == "true" || rebase == "merges" || rebase == "interactive":
+		return RebasePull, false, nil
+	case cfg.Pull.FastForward == "only":
+		return FastForwardOnlyPull, false, nil
+	case rebase == "false" || cfg.Pull.FastForward != "":
+		return MergePull, noFastForward, nil
+	}
+
+	return FastForwardOnlyPull, false, nil
+}
+
+// pullDiverged incorporates ref into the current branch when it can't be, or
+// shouldn't be, fast-forwarded.
+func (w *Worktree) pullDiverged(o *PullOptions, mode PullMode, noFastForward bool, remote *Remote, ref *plumbing.Reference) error {
+	if mode == MergePull {
+		url := o.RemoteURL
+		if url == "" {
+			url = remote.c.URLs[0]
+		}
+
+		_, err := w.Merge(&MergeOptions{
+			Commit:         ref.Hash(),
+			Message:        fmt.Sprintf("Merge branch '%s' of %s", ref.Name().Short(), url),
+			NoFastForward:  noFastForward,
+			StrategyOption: o.StrategyOption,
+			Author:         o.Author,
+			Committer:      o.Committer,
+		})
+
+		return err
+	}
+
+	committer := o.Committer
+	if committer == nil {
+		committer = o.Author
+	}
+
+	_, err := w.Rebase(&RebaseOptions{
+		Upstream:       ref.Hash(),
+		StrategyOption: o.StrategyOption,
+		Committer:      committer,
+	})
+
+	return err
+}
+
 func (w *Worktree) updateSubmodules(o *SubmoduleUpdateOptions) error {
 	s, err := w.Submodules()
 	if err != nil {
@@ -154,8 +255,28 @@ func (w *Worktree) Checkout(opts *CheckoutOptions) error {
 		return err
 	}
 
+	msg, err := w.checkoutReflogMessage(opts)
+	if err != nil {
+		return err
+	}
+
+	committer := reflogCommitter(w.r.Storer, nil)
+
+	hooks, err := w.r.hooks(opts.Hooks)
+	if err != nil {
+		return err
+	}
+
+	var prev plumbing.Hash
+	head, err := w.r.Head()
+	if err == nil {
+		prev = head.Hash()
+	} else if err != plumbing.ErrReferenceNotFound {
+		return err
+	}
+
 	if opts.Create {
-		if err := w.createBranch(opts); err != nil {
+		if err := w.createBranch(opts, committer); err != nil {
 			return err
 		}
 	}
@@ -173,22 +294,47 @@ func (w *Worktree) Checkout(opts *CheckoutOptions) error {
 	}
 
 	if !opts.Hash.IsZero() && !opts.Create {
-		err = w.setHEADToCommit(opts.Hash)
+		err = w.setHEADToCommit(opts.Hash, msg, committer)
 	} else {
-		err = w.setHEADToBranch(opts.Branch, c)
+		err = w.setHEADToBranch(opts.Branch, c, msg, committer)
 	}
 
 	if err != nil {
 		return err
 	}
 
-	if len(opts.SparseCheckoutDirectories) > 0 {
-		return w.ResetSparsely(ro, opts.SparseCheckoutDirectories)
+	if err := w.resetSparsely(ro, opts.SparseCheckoutDirectories, committer); err != nil {
+		return err
 	}
 
-	return w.Reset(ro)
+	return hooks.run(PostCheckoutHook, nil, prev.String(), c.String(), "1")
 }
-func (w *Worktree) createBranch(opts *CheckoutOptions) error {
+
+// checkoutReflogMessage returns the message logging the move of HEAD made by
+// the given checkout.
+func (w *Worktree) checkoutReflogMessage(opts *CheckoutOptions) (string, error) {
+	head, err := w.r.Storer.Reference(plumbing.HEAD)
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		return "", err
+	}
+
+	var from string
+	if head != nil {
+		from = head.Hash().String()
+		if head.Type() == plumbing.SymbolicReference {
+			from = head.Target().Short()
+		}
+	}
+
+	to := opts.Branch.Short()
+	if !opts.Hash.IsZero() && !opts.Create {
+		to = opts.Hash.String()
+	}
+
+	return checkoutReflogPrefix + from + " to " + to, nil
+}
+
+func (w *Worktree) createBranch(opts *CheckoutOptions, committer *object.Signature) error {
 	_, err := w.r.Storer.Reference(opts.Branch)
 	if err == nil {
 		return fmt.Errorf("a branch named %q already exists", opts.Branch)
@@ -198,17 +344,20 @@ func (w *Worktree) createBranch(opts *CheckoutOptions) error {
 		return err
 	}
 
+	from := opts.Hash.String()
 	if opts.Hash.IsZero() {
 		ref, err := w.r.Head()
 		if err != nil {
 			return err
 		}
 
-		opts.Hash = ref.Hash()
+		opts.Hash, from = ref.Hash(), string(plumbing.HEAD)
 	}
 
-	return w.r.Storer.SetReference(
+	return w.r.setReference(
 		plumbing.NewHashReference(opts.Branch, opts.Hash),
+		"branch: Created from "+from,
+		committer,
 	)
 }
 
@@ -245,12 +394,12 @@ func (w *Worktree) getCommitFromCheckoutOptions(opts *CheckoutOptions) (plumbing
 	return plumbing.ZeroHash, fmt.Errorf("unsupported tag target %q", o.Type())
 }
 
-func (w *Worktree) setHEADToCommit(commit plumbing.Hash) error {
+func (w *Worktree) setHEADToCommit(commit plumbing.Hash, msg string, committer *object.Signature) error {
 	head := plumbing.NewHashReference(plumbing.HEAD, commit)
-	return w.r.Storer.SetReference(head)
+	return w.r.setReference(head, msg, committer)
 }
 
-func (w *Worktree) setHEADToBranch(branch plumbing.ReferenceName, commit plumbing.Hash) error {
+func (w *Worktree) setHEADToBranch(branch plumbing.ReferenceName, commit plumbing.Hash, msg string, committer *object.Signature) error {
 	target, err := w.r.Storer.Reference(branch)
 	if err != nil {
 		return err
@@ -263,10 +412,16 @@ func (w *Worktree) setHEADToBranch(branch plumbing.ReferenceName, commit plumbin
 		head = plumbing.NewHashReference(plumbing.HEAD, commit)
 	}
 
-	return w.r.Storer.SetReference(head)
+	return w.r.setReference(head, msg, committer)
 }
 
 func (w *Worktree) ResetSparsely(opts *ResetOptions, dirs []string) error {
+	return w.resetSparsely(opts, dirs, reflogCommitter(w.r.Storer, nil))
+}
+
+// resetSparsely is ResetSparsely, logging the update of HEAD with the
+// committer of the operation performing the reset.
+func (w *Worktree) resetSparsely(opts *ResetOptions, dirs []string, committer *object.Signature) error {
 	if err := opts.Validate(w.r); err != nil {
 		return err
 	}
@@ -282,7 +437,7 @@ func (w *Worktree) ResetSparsely(opts *ResetOptions, dirs []string) error {
 		}
 	}
 
-	if err := w.setHEADCommit(opts.Commit); err != nil {
+	if err := w.setHEADCommit(opts.Commit, "reset: moving to "+opts.Commit.String(), committer); err != nil {
 		return err
 	}
 
@@ -317,15 +472,19 @@ func (w *Worktree) Reset(opts *ResetOptions) error {
 
 func (w *Worktree) resetIndex(t *object.Tree, dirs []string) error {
 	idx, err := w.r.Storer.Index()
-	if len(dirs) > 0 {
-		idx.SkipUnless(dirs)
-	}
-
 	if err != nil {
 		return err
 	}
+
 	b := newIndexBuilder(idx)
 
+	// the unmerged entries are discarded, the paths are restored from t
+	for _, e := range idx.Entries {
+		if e.Stage != index.Merged {
+			b.Remove(e.Name)
+		}
+	}
+
 	changes, err := w.diffTreeWithStaging(t, true)
 	if err != nil {
 		return err
@@ -351,25 +510,43 @@ func (w *Worktree) resetIndex(t *object.Tree, dirs []string) error {
 			name = ch.From.String()
 		}
 
+		// the skip-worktree bit of a replaced entry is kept
+		var skip bool
+		if old, ok := b.entries[name]; ok {
+			skip = old.SkipWorktree
+		}
+
 		b.Remove(name)
 		if e == nil {
 			continue
 		}
 
 		b.Add(&index.Entry{
-			Name: name,
-			Hash: e.Hash,
-			Mode: e.Mode,
+			Name:         name,
+			Hash:         e.Hash,
+			Mode:         e.Mode,
+			SkipWorktree: skip,
 		})
 
 	}
 
 	b.Write(idx)
+	if err := w.applySparseCheckoutDirectories(idx, dirs); err != nil {
+		return err
+	}
+
 	return w.r.Storer.SetIndex(idx)
 }
 
-func (w *Worktree) resetWorktree(t *object.Tree) error {
-	changes, err := w.diffStagingWithWorktree(true)
+func (w *Worktree) resetWorktree(t *object.Tree) (err error) {
+	filters, err := w.newContentFilters()
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(filters, &err)
+
+	changes, err := w.diffStagingWithWorktree(true, filters)
 	if err != nil {
 		return err
 	}
@@ -381,16 +558,20 @@ func (w *Worktree) resetWorktree(t *object.Tree) error {
 	b := newIndexBuilder(idx)
 
 	for _, ch := range changes {
-		if err := w.checkoutChange(ch, t, b); err != nil {
+		if err := w.checkoutChange(ch, t, b, filters); err != nil {
 			return err
 		}
 	}
 
+	if err := w.removeSkippedFiles(idx); err != nil {
+		return err
+	}
+
 	b.Write(idx)
 	return w.r.Storer.SetIndex(idx)
 }
 
-func (w *Worktree) checkoutChange(ch merkletrie.Change, t *object.Tree, idx *indexBuilder) error {
+func (w *Worktree) checkoutChange(ch merkletrie.Change, t *object.Tree, idx *indexBuilder, filters *contentFilters) error {
 	a, err := ch.Action()
 	if err != nil {
 		return err
@@ -417,11 +598,18 @@ func (w *Worktree) checkoutChange(ch merkletrie.Change, t *object.Tree, idx *ind
 		return w.checkoutChangeSubmodule(name, a, e, idx)
 	}
 
-	return w.checkoutChangeRegularFile(name, a, t, e, idx)
+	return w.checkoutChangeRegularFile(name, a, t, e, idx, filters)
 }
 
-func (w *Worktree) containsUnstagedChanges() (bool, error) {
-	ch, err := w.diffStagingWithWorktree(false)
+func (w *Worktree) containsUnstagedChanges() (unstaged bool, err error) {
+	filters, err := w.newContentFilters()
+	if err != nil {
+		return false, err
+	}
+
+	defer ioutil.CheckClose(filters, &err)
+
+	ch, err := w.diffStagingWithWorktree(false, filters)
 	if err != nil {
 		return false, err
 	}
@@ -442,7 +630,9 @@ func (w *Worktree) containsUnstagedChanges() (bool, error) {
 	return false, nil
 }
 
-func (w *Worktree) setHEADCommit(commit plumbing.Hash) error {
+// setHEADCommit points HEAD, or the branch it points to, to the given commit,
+// logging the update with the given message and committer.
+func (w *Worktree) setHEADCommit(commit plumbing.Hash, msg string, committer *object.Signature) error {
 	head, err := w.r.Reference(plumbing.HEAD, false)
 	if err != nil {
 		return err
@@ -450,7 +640,7 @@ func (w *Worktree) setHEADCommit(commit plumbing.Hash) error {
 
 	if head.Type() == plumbing.HashReference {
 		head = plumbing.NewHashReference(plumbing.HEAD, commit)
-		return w.r.Storer.SetReference(head)
+		return w.r.setReference(head, msg, committer)
 	}
 
 	branch, err := w.r.Reference(head.Target(), false)
@@ -463,7 +653,7 @@ func (w *Worktree) setHEADCommit(commit plumbing.Hash) error {
 	}
 
 	branch = plumbing.NewHashReference(branch.Name(), commit)
-	return w.r.Storer.SetReference(branch)
+	return w.r.setReference(branch, msg, committer)
 }
 
 func (w *Worktree) checkoutChangeSubmodule(name string,
@@ -504,6 +694,7 @@ func (w *Worktree) checkoutChangeRegularFile(name string,
 	t *object.Tree,
 	e *object.TreeEntry,
 	idx *indexBuilder,
+	filters *contentFilters,
 ) error {
 	switch a {
 	case merkletrie.Modify:
@@ -522,7 +713,7 @@ func (w *Worktree) checkoutChangeRegularFile(name string,
 			return err
 		}
 
-		if err := w.checkoutFile(f); err != nil {
+		if err := w.checkoutFile(f, filters); err != nil {
 			return err
 		}
 
@@ -532,7 +723,9 @@ func (w *Worktree) checkoutChangeRegularFile(name string,
 	return nil
 }
 
-func (w *Worktree) checkoutFile(f *object.File) (err error) {
+// checkoutFile writes the given file to the worktree, converted with the
+// given filters.
+func (w *Worktree) checkoutFile(f *object.File, filters *contentFilters) (err error) {
 	mode, err := f.Mode.ToOSFileMode()
 	if err != nil {
 		return
@@ -542,6 +735,11 @@ func (w *Worktree) checkoutFile(f *object.File) (err error) {
 		return w.checkoutFileSymlink(f)
 	}
 
+	converts, err := filters.converts(f.Name)
+	if err != nil {
+		return
+	}
+
 	from, err := f.Reader()
 	if err != nil {
 		return
@@ -555,6 +753,10 @@ func (w *Worktree) checkoutFile(f *object.File) (err error) {
 	}
 
 	defer ioutil.CheckClose(to, &err)
+	if converts {
+		return filters.toWorktree(f.Name, to, from)
+	}
+
 	buf := sync.GetByteSlice()
 	_, err = io.CopyBuffer(to, from, *buf)
 	sync.PutByteSlice(buf)
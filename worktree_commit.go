@@ -3,15 +3,18 @@ package git
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"path"
 	"sort"
 	"strings"
+	"unicode"
 
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/format/index"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/storage"
+	"github.com/go-git/go-git/v5/utils/ioutil"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/go-git/go-billy/v5"
@@ -21,10 +24,32 @@ var (
 	// ErrEmptyCommit occurs when a commit is attempted using a clean
 	// working tree, with no changes to be committed.
 	ErrEmptyCommit = errors.New("cannot create empty commit: clean working tree")
+	// ErrUnmergedPaths occurs when a commit is attempted while the index
+	// contains conflicts not resolved yet.
+	ErrUnmergedPaths = errors.New("cannot commit: index contains unmerged paths")
+	// ErrNothingToAmend occurs when amending a commit in a repository
+	// without commits.
+	ErrNothingToAmend = errors.New("cannot amend: nothing to amend")
+	// ErrAmendMerging occurs when amending a commit while a merge is in
+	// progress.
+	ErrAmendMerging = errors.New("cannot amend: a merge is in progress")
 )
 
+// scissorsLine is the line, after the comment character, from which the
+// message is truncated by CleanupScissors.
+const scissorsLine = " ------------------------ >8 ------------------------"
+
 // Commit stores the current contents of the index in a new commit along with
 // a log message from the user describing the changes.
+//
+// If a merge is in progress the commit concludes it, being MERGE_HEAD its
+// second parent, the same way it concludes a cherry-pick or a revert stopped
+// because of conflicts. When msg is empty, the message prepared by the
+// operation (the MERGE_MSG or SQUASH_MSG files) is used.
+//
+// With CommitOptions.Amend the commit replaces the one of HEAD, while with
+// CommitOptions.Fixup or CommitOptions.Squash the message refers to the
+// commit to fix up on an autosquash rebase.
 func (w *Worktree) Commit(msg string, opts *CommitOptions) (plumbing.Hash, error) {
 	if err := opts.Validate(w.r); err != nil {
 		return plumbing.ZeroHash, err
@@ -36,11 +61,62 @@ func (w *Worktree) Commit(msg string, opts *CommitOptions) (plumbing.Hash, error
 		}
 	}
 
+	hooks, err := w.r.hooks(opts.Hooks)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if !opts.NoVerify {
+		if err := hooks.run(PreCommitHook, nil); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	// the index is read after the pre-commit hook, which may change it
 	idx, err := w.r.Storer.Index()
 	if err != nil {
 		return plumbing.ZeroHash, err
 	}
 
+	if err := checkNoUnmergedEntries(idx); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	merging, err := w.isMerging()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if opts.Amend && merging {
+		return plumbing.ZeroHash, ErrAmendMerging
+	}
+
+	source := "message"
+	switch {
+	case !opts.Fixup.IsZero():
+		msg, err = w.fixupMessage("fixup! ", opts.Fixup, msg)
+	case !opts.Squash.IsZero():
+		msg, err = w.fixupMessage("squash! ", opts.Squash, msg)
+	case opts.Amend && msg == "":
+		msg, err = w.headMessage()
+		source = "commit"
+	case msg == "":
+		msg, source, err = w.preparedMessage()
+	}
+
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	msg, err = hooks.commitMessageHooks(msg, source, opts.NoVerify)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if msg, err = w.cleanupMessage(msg, opts.Cleanup); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
 	h := &buildTreeHelper{
 		fs: w.Filesystem,
 		s:  w.r.Storer,
@@ -56,11 +132,184 @@ func (w *Worktree) Commit(msg string, opts *CommitOptions) (plumbing.Hash, error
 		return plumbing.ZeroHash, err
 	}
 
-	return commit, w.updateHEAD(commit)
+	action := "commit"
+	switch {
+	case opts.Amend:
+		action = "commit (amend)"
+	case merging:
+		action = "commit (merge)"
+	case len(opts.Parents) == 0:
+		action = "commit (initial)"
+	}
+
+	if err := w.updateHEAD(commit, fmt.Sprintf("%s: %s", action, commitSubject(msg)), opts.Committer); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if merging {
+		if err := w.removeMergeState(); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	if err := w.removePickState(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if err := w.r.removeStateFile(squashMsgFile); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	// the post-commit hook can't affect the outcome of the commit
+	_ = hooks.run(PostCommitHook, nil)
+	return commit, nil
+}
+
+// checkNoUnmergedEntries returns ErrUnmergedPaths if any of the entries of
+// the index is a conflict stage.
+func checkNoUnmergedEntries(idx *index.Index) error {
+	for _, e := range idx.Entries {
+		if e.Stage != index.Merged {
+			return ErrUnmergedPaths
+		}
+	}
+
+	return nil
+}
+
+func (w *Worktree) isMerging() (bool, error) {
+	return w.r.hasReference(plumbing.MergeHead)
+}
+
+// preparedMessage returns the message prepared by a merge, without the
+// comment lines, and its source as given to the prepare-commit-msg hook.
+func (w *Worktree) preparedMessage() (msg, source string, err error) {
+	for _, f := range []struct{ name, source string }{
+		{mergeMsgFile, "merge"},
+		{squashMsgFile, "squash"},
+	} {
+		content, err := w.r.readStateFile(f.name)
+		if err != nil {
+			return "", "", err
+		}
+
+		if content == "" {
+			continue
+		}
+
+		var lines []string
+		for _, l := range strings.Split(content, "\n") {
+			if !strings.HasPrefix(l, "#") {
+				lines = append(lines, l)
+			}
+		}
+
+		return strings.TrimSpace(strings.Join(lines, "\n")), f.source, nil
+	}
+
+	return "", "", nil
+}
+
+// headMessage returns the message of the commit of HEAD, reused when
+// amending it.
+func (w *Worktree) headMessage() (string, error) {
+	head, err := w.r.Head()
+	if err != nil {
+		return "", err
+	}
+
+	commit, err := w.r.CommitObject(head.Hash())
+	if err != nil {
+		return "", err
+	}
+
+	return commit.Message, nil
+}
+
+// fixupMessage returns the message of a commit fixing up the given one, the
+// prefix followed by the subject of the commit and msg, if any, after a
+// blank line.
+func (w *Worktree) fixupMessage(prefix string, h plumbing.Hash, msg string) (string, error) {
+	commit, err := w.r.CommitObject(h)
+	if err != nil {
+		return "", err
+	}
+
+	subject := prefix + commitSubject(commit.Message)
+	if msg == "" {
+		return subject, nil
+	}
+
+	return subject + "\n\n" + msg, nil
+}
+
+// cleanupMessage cleans up the message the same way `git commit --cleanup`
+// does for the given mode.
+func (w *Worktree) cleanupMessage(msg string, mode CleanupMode) (string, error) {
+	if mode == CleanupVerbatim {
+		return msg, nil
+	}
+
+	commentChar := "#"
+	if mode == CleanupStrip || mode == CleanupScissors {
+		cfg, err := w.r.Config()
+		if err != nil {
+			return "", err
+		}
+
+		if cfg.Core.CommentChar != "" {
+			commentChar = cfg.Core.CommentChar
+		}
+	}
+
+	var lines []string
+	for _, l := range strings.Split(msg, "\n") {
+		if mode == CleanupScissors && l == commentChar+scissorsLine {
+			break
+		}
+
+		if mode == CleanupStrip && strings.HasPrefix(l, commentChar) {
+			continue
+		}
+
+		lines = append(lines, strings.TrimRightFunc(l, unicode.IsSpace))
+	}
+
+	return stripSpace(lines), nil
 }
 
-func (w *Worktree) autoAddModifiedAndDeleted() error {
-	s, err := w.Status()
+// stripSpace joins the given lines without the leading and trailing empty
+// lines, collapsing the consecutive empty ones, ending in a newline.
+func stripSpace(lines []string) string {
+	var buf strings.Builder
+	empty := false
+	for _, l := range lines {
+		if l == "" {
+			empty = buf.Len() != 0
+			continue
+		}
+
+		if empty {
+			buf.WriteString("\n")
+			empty = false
+		}
+
+		buf.WriteString(l)
+		buf.WriteString("\n")
+	}
+
+	return buf.String()
+}
+
+func (w *Worktree) autoAddModifiedAndDeleted() (err error) {
+	filters, err := w.newContentFilters()
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(filters, &err)
+
+	s, err := w.statusWithFilters(&StatusOptions{}, filters)
 	if err != nil {
 		return err
 	}
@@ -75,7 +324,7 @@ func (w *Worktree) autoAddModifiedAndDeleted() error {
 			continue
 		}
 
-		if _, _, err := w.doAddFile(idx, s, path, nil); err != nil {
+		if _, _, err := w.doAddFile(idx, s, path, nil, filters); err != nil {
 			return err
 		}
 
@@ -84,7 +333,9 @@ func (w *Worktree) autoAddModifiedAndDeleted() error {
 	return w.r.Storer.SetIndex(idx)
 }
 
-func (w *Worktree) updateHEAD(commit plumbing.Hash) error {
+// updateHEAD points HEAD, or the branch it points to, to the given commit,
+// logging the update with the given message and committer.
+func (w *Worktree) updateHEAD(commit plumbing.Hash, msg string, committer *object.Signature) error {
 	head, err := w.r.Storer.Reference(plumbing.HEAD)
 	if err != nil {
 		return err
@@ -96,7 +347,7 @@ func (w *Worktree) updateHEAD(commit plumbing.Hash) error {
 	}
 
 	ref := plumbing.NewHashReference(name, commit)
-	return w.r.Storer.SetReference(ref)
+	return w.r.setReference(ref, msg, committer)
 }
 
 func (w *Worktree) buildCommitObject(msg string, opts *CommitOptions, tree plumbing.Hash) (plumbing.Hash, error) {
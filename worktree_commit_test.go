@@ -338,6 +338,131 @@ func (s *WorktreeSuite) TestJustStoreObjectsNotAlreadyStored(c *C) {
 	c.Assert(infoLicenseSecond.ModTime(), Equals, infoLicense.ModTime()) // object of LICENSE should have the same timestamp because no additional write operation was performed
 }
 
+func (s *WorktreeSuite) TestCommitAmend(c *C) {
+	r, err := Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.User.Name = "bar"
+	cfg.User.Email = "bar@bar.bar"
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	first := commitFiles(c, w, "first", map[string]string{"foo": "foo"})
+	second := commitFiles(c, w, "second", map[string]string{"bar": "bar"})
+
+	err = util.WriteFile(w.Filesystem, "qux", []byte("qux"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("qux")
+	c.Assert(err, IsNil)
+
+	hash, err := w.Commit("", &CommitOptions{Amend: true})
+	c.Assert(err, IsNil)
+	c.Assert(hash, Not(Equals), second)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash(), Equals, hash)
+
+	commit, err := r.CommitObject(hash)
+	c.Assert(err, IsNil)
+	c.Assert(commit.Message, Equals, "second")
+	c.Assert(commit.ParentHashes, DeepEquals, []plumbing.Hash{first})
+	c.Assert(commit.Author.Name, Equals, defaultSignature().Name)
+	c.Assert(commit.Committer.Name, Equals, "bar")
+
+	_, err = commit.File("qux")
+	c.Assert(err, IsNil)
+
+	// the root commit is amended without parents
+	c.Assert(w.Reset(&ResetOptions{Commit: first, Mode: HardReset}), IsNil)
+	hash, err = w.Commit("root", &CommitOptions{Amend: true, Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	commit, err = r.CommitObject(hash)
+	c.Assert(err, IsNil)
+	c.Assert(commit.Message, Equals, "root")
+	c.Assert(commit.ParentHashes, HasLen, 0)
+}
+
+func (s *WorktreeSuite) TestCommitAmendNothing(c *C) {
+	_, w := newMemoryWorktree(c)
+
+	_, err := w.Commit("foo", &CommitOptions{Author: defaultSignature(), Amend: true})
+	c.Assert(err, Equals, ErrNothingToAmend)
+}
+
+func (s *WorktreeSuite) TestCommitFixupSquash(c *C) {
+	r, w := newMemoryWorktree(c)
+
+	target := commitFiles(c, w, "foo\n\nbody", map[string]string{"foo": "foo"})
+
+	opts := &CommitOptions{Author: defaultSignature(), AllowEmptyCommits: true, Fixup: target}
+	hash, err := w.Commit("", opts)
+	c.Assert(err, IsNil)
+	commit, err := r.CommitObject(hash)
+	c.Assert(err, IsNil)
+	c.Assert(commit.Message, Equals, "fixup! foo")
+
+	opts = &CommitOptions{Author: defaultSignature(), AllowEmptyCommits: true, Squash: target}
+	hash, err = w.Commit("bar", opts)
+	c.Assert(err, IsNil)
+	commit, err = r.CommitObject(hash)
+	c.Assert(err, IsNil)
+	c.Assert(commit.Message, Equals, "squash! foo\n\nbar")
+
+	opts = &CommitOptions{Author: defaultSignature(), Fixup: target, Squash: target}
+	_, err = w.Commit("", opts)
+	c.Assert(err, ErrorMatches, "fields Amend, Fixup and Squash are mutual exclusive")
+}
+
+func (s *WorktreeSuite) TestCommitCleanup(c *C) {
+	r, w := newMemoryWorktree(c)
+
+	msg := "\n\nfoo  \n\n\n# comment\nbar\t\n" +
+		"# ------------------------ >8 ------------------------\nqux\n\n"
+
+	for _, t := range []struct {
+		mode     CleanupMode
+		expected string
+	}{
+		{CleanupVerbatim, msg},
+		{CleanupWhitespace, "foo\n\n# comment\nbar\n# ------------------------ >8 ------------------------\nqux\n"},
+		{CleanupStrip, "foo\n\nbar\nqux\n"},
+		{CleanupScissors, "foo\n\n# comment\nbar\n"},
+	} {
+		hash, err := w.Commit(msg, &CommitOptions{
+			Author:            defaultSignature(),
+			AllowEmptyCommits: true,
+			Cleanup:           t.mode,
+		})
+		c.Assert(err, IsNil)
+
+		commit, err := r.CommitObject(hash)
+		c.Assert(err, IsNil)
+		c.Assert(commit.Message, Equals, t.expected, Commentf("mode %d", t.mode))
+	}
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Core.CommentChar = ";"
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	hash, err := w.Commit("foo\n; comment\n# bar", &CommitOptions{
+		Author:            defaultSignature(),
+		AllowEmptyCommits: true,
+		Cleanup:           CleanupStrip,
+	})
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(hash)
+	c.Assert(err, IsNil)
+	c.Assert(commit.Message, Equals, "foo\n# bar\n")
+}
+
 func assertStorageStatus(
 	c *C, r *Repository,
 	treesCount, blobCount, commitCount int, head plumbing.Hash,
@@ -0,0 +1,308 @@
+package git
+
+import (
+	"bytes"
+	encbin "encoding/binary"
+	"io"
+	stdioutil "io/ioutil"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/binary"
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/go-git/go-git/v5/utils/ioutil"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+	"github.com/go-git/go-git/v5/utils/merkletrie/filesystem"
+	mindex "github.com/go-git/go-git/v5/utils/merkletrie/index"
+	"github.com/go-git/go-git/v5/utils/merkletrie/noder"
+
+	dmp "github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Diff returns the patch of the changes of the worktree, as git diff does. By
+// default it contains the changes of the worktree not staged in the index,
+// with Cached the changes staged in the index since HEAD, and with a Source
+// the changes of the worktree, or the index, since the given tree-ish. The
+// untracked files are never included.
+//
+// The patch can be written with a diff.UnifiedEncoder.
+func (w *Worktree) Diff(o DiffOptions) (p fdiff.Patch, err error) {
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	filters, err := w.newContentFilters()
+	if err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(filters, &err)
+
+	changes, err := w.diffChanges(&o, idx, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	// the files of the index are compared as they are in the repository
+	worktreeFilters := filters
+	if o.Cached {
+		worktreeFilters = nil
+	}
+
+	patch := &worktreePatch{}
+	for _, ch := range changes {
+		name := ch.To.String()
+		if name == "" {
+			name = ch.From.String()
+		}
+
+		if !matchPathspec(o.Paths, name) {
+			continue
+		}
+
+		fp, err := w.diffFilePatch(ch, worktreeFilters)
+		if err != nil {
+			return nil, err
+		}
+
+		patch.filePatches = append(patch.filePatches, fp)
+	}
+
+	return patch, nil
+}
+
+// diffChanges returns the changes from the index or the source tree to the
+// worktree or the index, without the untracked and skip-worktree files.
+func (w *Worktree) diffChanges(o *DiffOptions, idx *index.Index, filters *contentFilters) (merkletrie.Changes, error) {
+	var from noder.Noder
+	if o.Cached || o.Source != "" {
+		t, err := w.revisionTree(o.Source)
+		if err != nil {
+			return nil, err
+		}
+
+		if t != nil {
+			from = object.NewTreeRootNode(t)
+		}
+	} else {
+		from = mindex.NewRootNode(withoutSkipWorktree(idx))
+	}
+
+	if o.Cached {
+		to := mindex.NewRootNode(withoutSkipWorktree(idx))
+		return merkletrie.DiffTree(from, to, diffTreeIsEquals)
+	}
+
+	submodules, err := w.getSubmodulesStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := filesystem.Options{Convert: filters.normalize, Converts: filters.converts}
+	to := filesystem.NewRootNodeWithOptions(w.Filesystem, submodules, opts)
+	changes, err := merkletrie.DiffTree(from, to, diffTreeIsEquals)
+	if err != nil {
+		return nil, err
+	}
+
+	tracked := make(map[string]bool, len(idx.Entries))
+	for _, e := range idx.Entries {
+		tracked[e.Name] = true
+	}
+
+	var res merkletrie.Changes
+	for _, ch := range excludeSkippedChanges(changes, idx) {
+		if len(ch.From) == 0 && !tracked[ch.To.String()] {
+			continue
+		}
+
+		res = append(res, ch)
+	}
+
+	return res, nil
+}
+
+// diffFilePatch returns the patch of the given change, the files of its
+// destination are read from the worktree, and converted with filters, if
+// filters is not nil.
+func (w *Worktree) diffFilePatch(ch merkletrie.Change, filters *contentFilters) (fdiff.FilePatch, error) {
+	from, fromContent, fromBinary, err := w.diffFile(ch.From, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	to, toContent, toBinary, err := w.diffFile(ch.To, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	fp := &worktreeFilePatch{from: from, to: to}
+	if fromBinary || toBinary {
+		fp.binary = true
+		return fp, nil
+	}
+
+	for _, d := range diff.Do(fromContent, toContent) {
+		var op fdiff.Operation
+		switch d.Type {
+		case dmp.DiffEqual:
+			op = fdiff.Equal
+		case dmp.DiffDelete:
+			op = fdiff.Delete
+		case dmp.DiffInsert:
+			op = fdiff.Add
+		}
+
+		fp.chunks = append(fp.chunks, &worktreeChunk{d.Text, op})
+	}
+
+	return fp, nil
+}
+
+// diffFile returns the file at the given path of a change and its content,
+// read from the worktree if filters is not nil or else from the object
+// storage.
+// The file is nil if the path is empty.
+func (w *Worktree) diffFile(p noder.Path, filters *contentFilters) (f *worktreeFile, content string, isBinary bool, err error) {
+	if len(p) == 0 {
+		return nil, "", false, nil
+	}
+
+	h := p.Hash()
+	f = &worktreeFile{path: p.String()}
+	copy(f.hash[:], h)
+	if len(h) > len(f.hash) {
+		f.mode = filemode.FileMode(encbin.LittleEndian.Uint32(h[len(f.hash):]))
+	}
+
+	if f.mode == filemode.Submodule {
+		return f, "Subproject commit " + f.hash.String() + "\n", false, nil
+	}
+
+	r, err := w.diffFileReader(f, filters != nil)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	defer r.Close()
+
+	data, err := stdioutil.ReadAll(r)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	if filters != nil && f.mode != filemode.Symlink {
+		buf := bytes.NewBuffer(nil)
+		if err := filters.normalize(f.path, buf, bytes.NewReader(data)); err != nil {
+			return nil, "", false, err
+		}
+
+		data = buf.Bytes()
+	}
+
+	isBinary, err = binary.IsBinary(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	return f, string(data), isBinary, nil
+}
+
+func (w *Worktree) diffFileReader(f *worktreeFile, worktree bool) (io.ReadCloser, error) {
+	if !worktree {
+		blob, err := object.GetBlob(w.r.Storer, f.hash)
+		if err != nil {
+			return nil, err
+		}
+
+		return blob.Reader()
+	}
+
+	if f.mode == filemode.Symlink {
+		target, err := w.Filesystem.Readlink(f.path)
+		if err != nil {
+			return nil, err
+		}
+
+		return stdioutil.NopCloser(strings.NewReader(target)), nil
+	}
+
+	return w.Filesystem.Open(f.path)
+}
+
+// worktreePatch is an implementation of fdiff.Patch for the changes of the
+// worktree or the index.
+type worktreePatch struct {
+	filePatches []fdiff.FilePatch
+}
+
+func (p *worktreePatch) FilePatches() []fdiff.FilePatch {
+	return p.filePatches
+}
+
+func (p *worktreePatch) Message() string {
+	return ""
+}
+
+type worktreeFilePatch struct {
+	from, to *worktreeFile
+	chunks   []fdiff.Chunk
+	binary   bool
+}
+
+func (fp *worktreeFilePatch) IsBinary() bool {
+	return fp.binary
+}
+
+func (fp *worktreeFilePatch) Files() (from, to fdiff.File) {
+	// the nil files have to be returned as nil interfaces
+	if fp.from != nil {
+		from = fp.from
+	}
+
+	if fp.to != nil {
+		to = fp.to
+	}
+
+	return
+}
+
+func (fp *worktreeFilePatch) Chunks() []fdiff.Chunk {
+	return fp.chunks
+}
+
+type worktreeFile struct {
+	hash plumbing.Hash
+	mode filemode.FileMode
+	path string
+}
+
+func (f *worktreeFile) Hash() plumbing.Hash {
+	return f.hash
+}
+
+func (f *worktreeFile) Mode() filemode.FileMode {
+	return f.mode
+}
+
+func (f *worktreeFile) Path() string {
+	return f.path
+}
+
+type worktreeChunk struct {
+	content string
+	op      fdiff.Operation
+}
+
+func (c *worktreeChunk) Content() string {
+	return c.content
+}
+
+func (c *worktreeChunk) Type() fdiff.Operation {
+	return c.op
+}
@@ -0,0 +1,145 @@
+package git
+
+import (
+	"bytes"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+type DiffSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&DiffSuite{})
+
+func prepareDiff(c *C) (*Worktree, plumbing.Hash) {
+	_, w := newMemoryWorktree(c)
+
+	h := commitFiles(c, w, "init", map[string]string{
+		"foo":   "foo\nbar\n",
+		"a/bar": "bar\n",
+		"a/qux": "qux\n",
+	})
+
+	return w, h
+}
+
+func encodePatch(c *C, p fdiff.Patch) string {
+	buf := bytes.NewBuffer(nil)
+	err := fdiff.NewUnifiedEncoder(buf, fdiff.DefaultContextLines).Encode(p)
+	c.Assert(err, IsNil)
+	return buf.String()
+}
+
+func (s *DiffSuite) TestDiffWorktree(c *C) {
+	w, _ := prepareDiff(c)
+
+	err := util.WriteFile(w.Filesystem, "foo", []byte("foo\nbaz\n"), 0644)
+	c.Assert(err, IsNil)
+	err = w.Filesystem.Remove("a/bar")
+	c.Assert(err, IsNil)
+	err = util.WriteFile(w.Filesystem, "untracked", []byte("untracked\n"), 0644)
+	c.Assert(err, IsNil)
+
+	p, err := w.Diff(DiffOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(p.FilePatches(), HasLen, 2)
+
+	c.Assert(encodePatch(c, p), Equals, ""+
+		"diff --git a/a/bar b/a/bar\n"+
+		"deleted file mode 100644\n"+
+		"index 5716ca5987cbf97d6bb54920bea6adde242d87e6..0000000000000000000000000000000000000000\n"+
+		"--- a/a/bar\n"+
+		"+++ /dev/null\n"+
+		"@@ -1 +0,0 @@\n"+
+		"-bar\n"+
+		"diff --git a/foo b/foo\n"+
+		"index 3bd1f0e29744a1f32b08d5650e62e2e62afb177c..0c071e1d07528f124e31f1b6c71348ec13f21a7a 100644\n"+
+		"--- a/foo\n"+
+		"+++ b/foo\n"+
+		"@@ -1,2 +1,2 @@\n"+
+		" foo\n"+
+		"-bar\n"+
+		"+baz\n",
+	)
+
+	p, err = w.Diff(DiffOptions{Paths: []string{"a"}})
+	c.Assert(err, IsNil)
+	c.Assert(p.FilePatches(), HasLen, 1)
+
+	from, to := p.FilePatches()[0].Files()
+	c.Assert(from.Path(), Equals, "a/bar")
+	c.Assert(to, IsNil)
+}
+
+func (s *DiffSuite) TestDiffCached(c *C) {
+	w, _ := prepareDiff(c)
+
+	err := util.WriteFile(w.Filesystem, "foo", []byte("foo\nbaz\n"), 0644)
+	c.Assert(err, IsNil)
+	err = util.WriteFile(w.Filesystem, "new", []byte("new\n"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("new")
+	c.Assert(err, IsNil)
+
+	p, err := w.Diff(DiffOptions{Cached: true})
+	c.Assert(err, IsNil)
+	c.Assert(p.FilePatches(), HasLen, 1)
+
+	from, to := p.FilePatches()[0].Files()
+	c.Assert(from, IsNil)
+	c.Assert(to.Path(), Equals, "new")
+
+	chunks := p.FilePatches()[0].Chunks()
+	c.Assert(chunks, HasLen, 1)
+	c.Assert(chunks[0].Type(), Equals, fdiff.Add)
+	c.Assert(chunks[0].Content(), Equals, "new\n")
+
+	p, err = w.Diff(DiffOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(p.FilePatches(), HasLen, 1)
+
+	from, _ = p.FilePatches()[0].Files()
+	c.Assert(from.Path(), Equals, "foo")
+}
+
+func (s *DiffSuite) TestDiffSource(c *C) {
+	w, h := prepareDiff(c)
+
+	commitFiles(c, w, "second", map[string]string{"a/qux": "quux\n"})
+	err := util.WriteFile(w.Filesystem, "foo", []byte("foo\n"), 0644)
+	c.Assert(err, IsNil)
+
+	p, err := w.Diff(DiffOptions{Source: plumbing.Revision(h.String())})
+	c.Assert(err, IsNil)
+	c.Assert(p.FilePatches(), HasLen, 2)
+
+	from, to := p.FilePatches()[0].Files()
+	c.Assert(from.Path(), Equals, "a/qux")
+	c.Assert(to.Path(), Equals, "a/qux")
+
+	p, err = w.Diff(DiffOptions{Source: plumbing.Revision(h.String()), Cached: true})
+	c.Assert(err, IsNil)
+	c.Assert(p.FilePatches(), HasLen, 1)
+
+	p, err = w.Diff(DiffOptions{Cached: true})
+	c.Assert(err, IsNil)
+	c.Assert(p.FilePatches(), HasLen, 0)
+}
+
+func (s *DiffSuite) TestDiffBinary(c *C) {
+	w, _ := prepareDiff(c)
+
+	err := util.WriteFile(w.Filesystem, "foo", []byte("foo\x00bar"), 0644)
+	c.Assert(err, IsNil)
+
+	p, err := w.Diff(DiffOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(p.FilePatches(), HasLen, 1)
+	c.Assert(p.FilePatches()[0].IsBinary(), Equals, true)
+	c.Assert(p.FilePatches()[0].Chunks(), HasLen, 0)
+}
@@ -0,0 +1,257 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+)
+
+var (
+	// ErrUnsafeCRLF is returned adding a file whose line endings would not
+	// be restored by a checkout, if core.safecrlf is "true".
+	ErrUnsafeCRLF = errors.New("irreversible line endings conversion")
+)
+
+const gitattributesFile = ".gitattributes"
+
+// binaryMacro is the builtin binary macro of the gitattributes.
+var binaryMacro, _ = gitattributes.ParseAttributesLine("[attr]binary -diff -merge -text", nil, true)
+
+// eolConverter converts the line endings of the text files between the
+// worktree and the repository, as described by the text and eol
+// gitattributes and the core.autocrlf, core.eol and core.safecrlf options.
+type eolConverter struct {
+	fs       billy.Filesystem
+	autoCRLF string
+	eol      string
+	safeCRLF string
+
+	// dirs caches the gitattributes read from each directory
+	dirs map[string][]gitattributes.MatchAttribute
+}
+
+// eolConversion describes how the line endings of a file are converted.
+type eolConversion struct {
+	// text is set if the line endings are converted to LF in the repository
+	text bool
+	// auto is set if only the files detected as text are converted
+	auto bool
+	// crlf is set if the line endings are converted to CRLF in the worktree
+	crlf bool
+}
+
+func newEOLConverter(fs billy.Filesystem, cfg *config.Config) *eolConverter {
+	return &eolConverter{
+		fs:       fs,
+		autoCRLF: strings.ToLower(cfg.Core.AutoCRLF),
+		eol:      strings.ToLower(cfg.Core.EOL),
+		safeCRLF: strings.ToLower(cfg.Core.SafeCRLF),
+		dirs:     make(map[string][]gitattributes.MatchAttribute),
+	}
+}
+
+// attributes returns the gitattributes of the given path, read from the
+// .gitattributes files of the worktree directories containing it.
+func (c *eolConverter) attributes(name string) (map[string]gitattributes.Attribute, error) {
+	path := strings.Split(name, "/")
+	stack := []gitattributes.MatchAttribute{binaryMacro}
+	for i := range path {
+		dir := strings.Join(path[:i], "/")
+		attrs, ok := c.dirs[dir]
+		if !ok {
+			// the capacity is limited, as the path is appended to
+			var err error
+			attrs, err = gitattributes.ReadAttributesFile(c.fs, path[:i:i], gitattributesFile, i == 0)
+			if err != nil {
+				return nil, err
+			}
+
+			c.dirs[dir] = attrs
+		}
+
+		stack = append(stack, attrs...)
+	}
+
+	results, _ := gitattributes.NewMatcher(stack).Match(path, nil)
+	return results, nil
+}
+
+// conversion returns how the line endings of the file at the given path are
+// converted.
+func (c *eolConverter) conversion(name string) (eolConversion, error) {
+	var conv eolConversion
+	attrs, err := c.attributes(name)
+	if err != nil {
+		return conv, err
+	}
+
+	text, eol := attrs["text"], attrs["eol"]
+	hasEOL := eol != nil && eol.IsValueSet()
+	switch {
+	case text != nil && text.IsUnset():
+		return conv, nil
+	case text != nil && text.IsValueSet() && text.Value() == "auto":
+		conv.text, conv.auto = true, true
+	case text != nil && text.IsSet(), hasEOL:
+		conv.text = true
+	case c.autoCRLF == "true" || c.autoCRLF == "input":
+		conv.text, conv.auto = true, true
+	default:
+		return conv, nil
+	}
+
+	switch {
+	case hasEOL:
+		conv.crlf = eol.Value() == "crlf"
+	case c.autoCRLF == "true":
+		conv.crlf = true
+	case c.autoCRLF == "input":
+		conv.crlf = false
+	default:
+		conv.crlf = c.eol == "crlf" || (c.eol == "native" && runtime.GOOS == "windows")
+	}
+
+	return conv, nil
+}
+
+// toObject converts the line endings of the content of the file at the given
+// path, read from the worktree, to the ones stored in the repository.
+func (c *eolConverter) toObject(name string, content []byte) ([]byte, error) {
+	return c.convertToObject(name, content, c.safeCRLF == "true")
+}
+
+// normalize converts the line endings as toObject does, but it never fails
+// on irreversible conversions, to compare the files of the worktree with the
+// ones of the repository.
+func (c *eolConverter) normalize(name string, content []byte) ([]byte, error) {
+	return c.convertToObject(name, content, false)
+}
+
+func (c *eolConverter) convertToObject(name string, content []byte, safe bool) ([]byte, error) {
+	conv, err := c.conversion(name)
+	if err != nil || !conv.text {
+		return content, err
+	}
+
+	stats := newEOLStats(content)
+	if conv.auto && stats.isBinary() {
+		return content, nil
+	}
+
+	if safe && !stats.isReversible(conv) {
+		return nil, ErrUnsafeCRLF
+	}
+
+	if stats.crlf == 0 {
+		return content, nil
+	}
+
+	return bytes.Replace(content, []byte("\r\n"), []byte("\n"), -1), nil
+}
+
+// toWorktree converts the line endings of the content of the file at the
+// given path, read from the repository, to the ones of the worktree.
+func (c *eolConverter) toWorktree(name string, content []byte) ([]byte, error) {
+	conv, err := c.conversion(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !newEOLStats(content).convertsToCRLF(conv) {
+		return content, nil
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(content)+len(content)/16))
+	for i, b := range content {
+		if b == '\n' && (i == 0 || content[i-1] != '\r') {
+			buf.WriteByte('\r')
+		}
+
+		buf.WriteByte(b)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// eolStats counts the line endings and the characters of a file, to detect
+// if it's binary as git does.
+type eolStats struct {
+	nul, loneCR, loneLF, crlf int
+	printable, nonPrintable   int
+}
+
+func newEOLStats(content []byte) eolStats {
+	var s eolStats
+	for i, b := range content {
+		switch {
+		case b == '\r':
+			if i+1 < len(content) && content[i+1] == '\n' {
+				s.crlf++
+			} else {
+				s.loneCR++
+			}
+		case b == '\n':
+			if i == 0 || content[i-1] != '\r' {
+				s.loneLF++
+			}
+		case b == 127:
+			s.nonPrintable++
+		case b < 32:
+			switch b {
+			case '\b', '\t', '\033', '\014':
+				s.printable++
+			case 0:
+				s.nul++
+				s.nonPrintable++
+			default:
+				// a trailing EOF character is ignored
+				if b != '\032' || i+1 != len(content) {
+					s.nonPrintable++
+				}
+			}
+		default:
+			s.printable++
+		}
+	}
+
+	return s
+}
+
+func (s eolStats) isBinary() bool {
+	return s.loneCR > 0 || s.nul > 0 || (s.printable>>7) < s.nonPrintable
+}
+
+// convertsToCRLF returns true if the lone LF are converted to CRLF checking
+// out the file.
+func (s eolStats) convertsToCRLF(conv eolConversion) bool {
+	if !conv.text || !conv.crlf || s.loneLF == 0 {
+		return false
+	}
+
+	if conv.auto && (s.loneCR > 0 || s.crlf > 0 || s.isBinary()) {
+		return false
+	}
+
+	return true
+}
+
+// isReversible returns true if checking out the file after adding it
+// restores its line endings.
+func (s eolStats) isReversible(conv eolConversion) bool {
+	converted := s
+	converted.loneLF += converted.crlf
+	converted.crlf = 0
+
+	if converted.convertsToCRLF(conv) {
+		converted.crlf += converted.loneLF
+		converted.loneLF = 0
+	}
+
+	return (s.crlf == 0 || converted.crlf > 0) &&
+		(s.loneLF == 0 || converted.loneLF > 0)
+}
@@ -0,0 +1,203 @@
+package git
+
+import (
+	"io/ioutil"
+	"path"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+type EOLSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&EOLSuite{})
+
+func prepareEOL(c *C, autoCRLF string, files map[string]string) (*Repository, *Worktree) {
+	r, err := Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+
+	// the attributes apply to the files added after them
+	for name, content := range files {
+		if path.Base(name) == ".gitattributes" {
+			err := util.WriteFile(r.wt, name, []byte(content), 0644)
+			c.Assert(err, IsNil)
+		}
+	}
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Core.AutoCRLF = autoCRLF
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	commitFiles(c, w, "init", files)
+	return r, w
+}
+
+// assertBlob checks the content of the file at the given path in HEAD.
+func assertBlob(c *C, r *Repository, name, content string) {
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(head.Hash())
+	c.Assert(err, IsNil)
+
+	f, err := commit.File(name)
+	c.Assert(err, IsNil)
+
+	found, err := f.Contents()
+	c.Assert(err, IsNil)
+	c.Assert(found, Equals, content)
+}
+
+func resetHard(c *C, r *Repository, w *Worktree) {
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+
+	err = w.Reset(&ResetOptions{Commit: head.Hash(), Mode: HardReset})
+	c.Assert(err, IsNil)
+}
+
+func (s *EOLSuite) TestAutoCRLF(c *C) {
+	r, w := prepareEOL(c, "true", map[string]string{
+		"foo":    "foo\r\nbar\r\n",
+		"binary": "foo\r\n\x00",
+	})
+
+	assertBlob(c, r, "foo", "foo\nbar\n")
+	assertBlob(c, r, "binary", "foo\r\n\x00")
+	assertClean(c, w)
+
+	c.Assert(w.Filesystem.Remove("foo"), IsNil)
+	c.Assert(w.Filesystem.Remove("binary"), IsNil)
+	resetHard(c, r, w)
+
+	assertWorktreeFiles(c, w, map[string]string{
+		"foo":    "foo\r\nbar\r\n",
+		"binary": "foo\r\n\x00",
+	})
+	assertClean(c, w)
+
+	err := util.WriteFile(w.Filesystem, "foo", []byte("foo\r\nqux\r\n"), 0644)
+	c.Assert(err, IsNil)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo").Worktree, Equals, Modified)
+
+	p, err := w.Diff(DiffOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(encodePatch(c, p), Matches, "(?s).*-bar\n\\+qux\n")
+}
+
+func (s *EOLSuite) TestAutoCRLFInput(c *C) {
+	r, w := prepareEOL(c, "input", map[string]string{"foo": "foo\r\nbar\r\n"})
+	assertBlob(c, r, "foo", "foo\nbar\n")
+
+	c.Assert(w.Filesystem.Remove("foo"), IsNil)
+	resetHard(c, r, w)
+
+	assertWorktreeFiles(c, w, map[string]string{"foo": "foo\nbar\n"})
+	assertClean(c, w)
+}
+
+func (s *EOLSuite) TestGitattributes(c *C) {
+	r, w := prepareEOL(c, "", map[string]string{
+		".gitattributes":   "*.txt text eol=crlf\n*.sh text eol=lf\n*.bin binary\n",
+		"a/.gitattributes": "*.dat text\n",
+		"foo.txt":          "foo\nbar\r\n",
+		"foo.sh":           "foo\r\n",
+		"foo.bin":          "foo\r\n",
+		"a/foo.dat":        "foo\r\n",
+		"foo.dat":          "foo\r\n",
+	})
+
+	assertBlob(c, r, "foo.txt", "foo\nbar\n")
+	assertBlob(c, r, "foo.sh", "foo\n")
+	assertBlob(c, r, "foo.bin", "foo\r\n")
+	assertBlob(c, r, "a/foo.dat", "foo\n")
+	assertBlob(c, r, "foo.dat", "foo\r\n")
+
+	for _, name := range []string{"foo.txt", "foo.sh", "foo.bin", "a/foo.dat", "foo.dat"} {
+		c.Assert(w.Filesystem.Remove(name), IsNil)
+	}
+
+	resetHard(c, r, w)
+
+	assertWorktreeFiles(c, w, map[string]string{
+		"foo.txt":   "foo\r\nbar\r\n",
+		"foo.sh":    "foo\n",
+		"foo.bin":   "foo\r\n",
+		"a/foo.dat": "foo\n",
+		"foo.dat":   "foo\r\n",
+	})
+	assertClean(c, w)
+}
+
+func (s *EOLSuite) TestGitattributesOverrideAutoCRLF(c *C) {
+	r, w := prepareEOL(c, "true", map[string]string{
+		".gitattributes": "*.txt -text\n",
+		"foo.txt":        "foo\r\n",
+		"foo":            "foo\r\n",
+	})
+
+	assertBlob(c, r, "foo.txt", "foo\r\n")
+	assertBlob(c, r, "foo", "foo\n")
+	assertClean(c, w)
+}
+
+func (s *EOLSuite) TestSafeCRLF(c *C) {
+	r, w := prepareEOL(c, "", map[string]string{".gitattributes": "*.txt text eol=lf\n"})
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Core.SafeCRLF = "true"
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	err = util.WriteFile(w.Filesystem, "foo.txt", []byte("foo\r\n"), 0644)
+	c.Assert(err, IsNil)
+
+	_, err = w.Add("foo.txt")
+	c.Assert(err, Equals, ErrUnsafeCRLF)
+
+	err = util.WriteFile(w.Filesystem, "foo.txt", []byte("foo\n"), 0644)
+	c.Assert(err, IsNil)
+
+	h, err := w.Add("foo.txt")
+	c.Assert(err, IsNil)
+
+	blob, err := r.BlobObject(h)
+	c.Assert(err, IsNil)
+	rd, err := blob.Reader()
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadAll(rd)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "foo\n")
+	c.Assert(h, Equals, plumbing.ComputeHash(plumbing.BlobObject, content))
+}
+
+func (s *EOLSuite) TestEOLStats(c *C) {
+	conv := eolConversion{text: true, auto: true, crlf: true}
+
+	c.Assert(newEOLStats([]byte("foo\nbar\n")).convertsToCRLF(conv), Equals, true)
+	c.Assert(newEOLStats([]byte("foo\r\nbar\n")).convertsToCRLF(conv), Equals, false)
+	c.Assert(newEOLStats([]byte("foo\rbar\n")).convertsToCRLF(conv), Equals, false)
+	c.Assert(newEOLStats([]byte("foo\x00\n")).convertsToCRLF(conv), Equals, false)
+
+	conv.auto = false
+	c.Assert(newEOLStats([]byte("foo\r\nbar\n")).convertsToCRLF(conv), Equals, true)
+	c.Assert(newEOLStats([]byte("foo\r\nbar\r\n")).isReversible(conv), Equals, true)
+	c.Assert(newEOLStats([]byte("foo\nbar\n")).isReversible(conv), Equals, false)
+
+	conv.crlf = false
+	c.Assert(newEOLStats([]byte("foo\r\n")).isReversible(conv), Equals, false)
+	c.Assert(newEOLStats([]byte("foo\n")).isReversible(conv), Equals, true)
+}
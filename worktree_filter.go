@@ -0,0 +1,541 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+)
+
+var (
+	// ErrFilterProcess is returned when a filter process doesn't follow the
+	// long running filter process protocol.
+	ErrFilterProcess = errors.New("filter process protocol error")
+	// ErrMissingFilter is returned converting a file whose filter driver is
+	// required but not configured.
+	ErrMissingFilter = errors.New("required filter is not configured")
+)
+
+const filterSection = "filter"
+
+// Filter is a filter driver, converting the content of the files with the
+// gitattribute filter=<name> between the worktree and the repository.
+type Filter interface {
+	// Clean writes to dst the content of the file at the given path, read
+	// from the worktree in src, converted to the content stored in the
+	// repository.
+	Clean(path string, dst io.Writer, src io.Reader) error
+	// Smudge writes to dst the content of the file at the given path, read
+	// from the repository in src, converted to the content written to the
+	// worktree.
+	Smudge(path string, dst io.Writer, src io.Reader) error
+}
+
+// NormalizeFilter is a Filter able to compute the content Clean writes
+// without its side effects, such as storing the large files of the lfs
+// filter. It is used instead of Clean to compare the files of the worktree
+// with the ones of the repository, computing the status and the diff.
+type NormalizeFilter interface {
+	Filter
+	// Normalize writes to dst the content Clean would write.
+	Normalize(path string, dst io.Writer, src io.Reader) error
+}
+
+// contentFilters converts the content of the files between the worktree and
+// the repository, applying the filter driver of their filter gitattribute
+// and converting their line endings.
+type contentFilters struct {
+	eol     *eolConverter
+	filters map[string]Filter
+	cfg     *config.Config
+	dir     string
+
+	// drivers caches the filter drivers resolved by name
+	drivers map[string]*filterDriver
+}
+
+type filterDriver struct {
+	filter   Filter
+	required bool
+}
+
+// newContentFilters returns the filters converting the files of an operation,
+// they must be closed to stop the filter processes they start.
+func (w *Worktree) newContentFilters() (*contentFilters, error) {
+	cfg, err := w.r.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	return &contentFilters{
+		eol:     newEOLConverter(w.Filesystem, cfg),
+		filters: w.Filters,
+		cfg:     cfg,
+		dir:     w.Filesystem.Root(),
+		drivers: make(map[string]*filterDriver),
+	}, nil
+}
+
+// driver returns the filter driver of the file at the given path, nil if it
+// has none.
+func (f *contentFilters) driver(name string) (*filterDriver, error) {
+	attrs, err := f.eol.attributes(name)
+	if err != nil {
+		return nil, err
+	}
+
+	attr := attrs["filter"]
+	if attr == nil || !attr.IsValueSet() {
+		return nil, nil
+	}
+
+	driver, ok := f.drivers[attr.Value()]
+	if !ok {
+		driver = f.newDriver(attr.Value())
+		f.drivers[attr.Value()] = driver
+	}
+
+	if driver.filter == nil {
+		if driver.required {
+			return nil, ErrMissingFilter
+		}
+
+		return nil, nil
+	}
+
+	return driver, nil
+}
+
+// newDriver returns the filter driver with the given name, the filters of
+// the worktree or else the commands of the configuration.
+func (f *contentFilters) newDriver(name string) *filterDriver {
+	if filter, ok := f.filters[name]; ok {
+		return &filterDriver{filter: filter, required: true}
+	}
+
+	opts := f.cfg.Raw.Section(filterSection).Subsection(name).Options
+	driver := &filterDriver{required: opts.Get("required") == "true"}
+	if process := opts.Get("process"); process != "" {
+		driver.filter = &processFilter{command: process, dir: f.dir}
+	} else if opts.Has("clean") || opts.Has("smudge") {
+		driver.filter = &commandFilter{
+			clean:  opts.Get("clean"),
+			smudge: opts.Get("smudge"),
+			dir:    f.dir,
+		}
+	}
+
+	return driver
+}
+
+// converts returns true if the content of the file at the given path may be
+// changed converting it.
+func (f *contentFilters) converts(name string) (bool, error) {
+	driver, err := f.driver(name)
+	if err != nil || driver != nil {
+		return driver != nil, err
+	}
+
+	conv, err := f.eol.conversion(name)
+	return conv.text, err
+}
+
+// toObject writes to w the content of the file at the given path read from
+// r, converted from the worktree to the content stored in the repository.
+func (f *contentFilters) toObject(name string, w io.Writer, r io.Reader) error {
+	return f.convertToObject(name, w, r, false, f.eol.toObject)
+}
+
+// normalize converts the content as toObject does, to compare the files of
+// the worktree with the ones of the repository. The filter drivers
+// implementing NormalizeFilter are used without side effects.
+func (f *contentFilters) normalize(name string, w io.Writer, r io.Reader) error {
+	return f.convertToObject(name, w, r, true, f.eol.normalize)
+}
+
+// convertToObject cleans the content with the filter driver, and converts its
+// line endings with the given function. Only the files whose line endings
+// are converted are read in memory.
+func (f *contentFilters) convertToObject(name string, w io.Writer, r io.Reader, normalize bool,
+	convertEOL func(string, []byte) ([]byte, error),
+) error {
+	conv, err := f.eol.conversion(name)
+	if err != nil {
+		return err
+	}
+
+	if !conv.text {
+		return f.clean(name, w, r, normalize)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := f.clean(name, buf, r, normalize); err != nil {
+		return err
+	}
+
+	content, err := convertEOL(name, buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(content)
+	return err
+}
+
+// toWorktree writes to w the content of the file at the given path read from
+// r, converted from the repository to the content written to the worktree.
+func (f *contentFilters) toWorktree(name string, w io.Writer, r io.Reader) error {
+	conv, err := f.eol.conversion(name)
+	if err != nil {
+		return err
+	}
+
+	if conv.text {
+		content, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		content, err = f.eol.toWorktree(name, content)
+		if err != nil {
+			return err
+		}
+
+		r = bytes.NewReader(content)
+	}
+
+	driver, err := f.driver(name)
+	if err != nil {
+		return err
+	}
+
+	if driver == nil {
+		_, err = io.Copy(w, r)
+		return err
+	}
+
+	return driver.apply(driver.filter.Smudge, name, w, r)
+}
+
+func (f *contentFilters) clean(name string, w io.Writer, r io.Reader, normalize bool) error {
+	driver, err := f.driver(name)
+	if err != nil {
+		return err
+	}
+
+	if driver == nil {
+		_, err = io.Copy(w, r)
+		return err
+	}
+
+	if n, ok := driver.filter.(NormalizeFilter); ok && normalize {
+		return driver.apply(n.Normalize, name, w, r)
+	}
+
+	return driver.apply(driver.filter.Clean, name, w, r)
+}
+
+// apply runs the given conversion of the filter. The content is kept as it is
+// if the filter fails and it isn't required, so only the content of the
+// required filters is streamed, the other ones are read in memory.
+func (d *filterDriver) apply(convert func(string, io.Writer, io.Reader) error, name string, w io.Writer, r io.Reader) error {
+	if d.required {
+		return convert(name, w, r)
+	}
+
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	out := bytes.NewBuffer(nil)
+	if err := convert(name, out, bytes.NewReader(content)); err != nil {
+		out = bytes.NewBuffer(content)
+	}
+
+	_, err = out.WriteTo(w)
+	return err
+}
+
+// Close stops the filter processes started.
+func (f *contentFilters) Close() error {
+	var err error
+	for _, driver := range f.drivers {
+		if p, ok := driver.filter.(*processFilter); ok {
+			if e := p.Close(); err == nil {
+				err = e
+			}
+		}
+	}
+
+	return err
+}
+
+// commandFilter is a filter driver running the filter.<name>.clean and
+// filter.<name>.smudge commands for each file.
+type commandFilter struct {
+	clean, smudge string
+	dir           string
+}
+
+func (f *commandFilter) Clean(path string, dst io.Writer, src io.Reader) error {
+	return f.run(f.clean, path, dst, src)
+}
+
+func (f *commandFilter) Smudge(path string, dst io.Writer, src io.Reader) error {
+	return f.run(f.smudge, path, dst, src)
+}
+
+func (f *commandFilter) run(command, path string, dst io.Writer, src io.Reader) error {
+	if command == "" {
+		_, err := io.Copy(dst, src)
+		return err
+	}
+
+	command = strings.Replace(command, "%f", shellQuote(path), -1)
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = f.dir
+	cmd.Stdin = src
+	cmd.Stdout = dst
+
+	stderr := bytes.NewBuffer(nil)
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("filter %q failed: %s: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// processFilter is a filter driver running the filter.<name>.process
+// command, a single process converting all the files through the long
+// running filter process protocol.
+type processFilter struct {
+	command string
+	dir     string
+
+	cmd          *exec.Cmd
+	stdin        io.WriteCloser
+	encoder      *pktline.Encoder
+	scanner      *pktline.Scanner
+	capabilities map[string]bool
+	err          error
+}
+
+func (f *processFilter) Clean(path string, dst io.Writer, src io.Reader) error {
+	return f.run("clean", path, dst, src)
+}
+
+func (f *processFilter) Smudge(path string, dst io.Writer, src io.Reader) error {
+	return f.run("smudge", path, dst, src)
+}
+
+// start starts the process and negotiates the version and the capabilities.
+func (f *processFilter) start() error {
+	f.cmd = exec.Command("sh", "-c", f.command)
+	f.cmd.Dir = f.dir
+
+	var err error
+	f.stdin, err = f.cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	stdout, err := f.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := f.cmd.Start(); err != nil {
+		return err
+	}
+
+	f.encoder = pktline.NewEncoder(f.stdin)
+	f.scanner = pktline.NewScanner(stdout)
+
+	if err := f.send([]string{"git-filter-client", "version=2"}); err != nil {
+		return err
+	}
+
+	welcome, err := f.readList()
+	if err != nil {
+		return err
+	}
+
+	if len(welcome) != 2 || welcome[0] != "git-filter-server" || welcome[1] != "version=2" {
+		return ErrFilterProcess
+	}
+
+	if err := f.send([]string{"capability=clean", "capability=smudge"}); err != nil {
+		return err
+	}
+
+	capabilities, err := f.readList()
+	if err != nil {
+		return err
+	}
+
+	f.capabilities = make(map[string]bool)
+	for _, c := range capabilities {
+		f.capabilities[strings.TrimPrefix(c, "capability=")] = true
+	}
+
+	return nil
+}
+
+// run converts a file with the given command, "clean" or "smudge".
+func (f *processFilter) run(command, path string, dst io.Writer, src io.Reader) error {
+	if f.cmd == nil {
+		f.err = f.start()
+	}
+
+	if f.err != nil {
+		return f.err
+	}
+
+	if !f.capabilities[command] {
+		_, err := io.Copy(dst, src)
+		return err
+	}
+
+	if err := f.send([]string{"command=" + command, "pathname=" + path}); err != nil {
+		return err
+	}
+
+	// the process can't be used anymore if the content isn't fully sent
+	if err := f.sendContent(src); err != nil {
+		f.err = err
+		return err
+	}
+
+	if err := f.readStatus(command); err != nil {
+		return err
+	}
+
+	// the content is read until its end even if it can't be written, to
+	// keep using the process
+	var werr error
+	for {
+		if !f.scanner.Scan() {
+			return f.scanError()
+		}
+
+		if len(f.scanner.Bytes()) == 0 {
+			break
+		}
+
+		if werr == nil {
+			_, werr = dst.Write(f.scanner.Bytes())
+		}
+	}
+
+	// the status may be updated after the content
+	if err := f.readStatus(command); err != nil {
+		return err
+	}
+
+	return werr
+}
+
+// readStatus reads the status of a command, an empty list keeps the status.
+func (f *processFilter) readStatus(command string) error {
+	list, err := f.readList()
+	if err != nil {
+		return err
+	}
+
+	for _, l := range list {
+		switch l {
+		case "status=success":
+		case "status=abort":
+			delete(f.capabilities, command)
+			return fmt.Errorf("filter process %q aborted %s", f.command, command)
+		default:
+			return fmt.Errorf("filter process %q failed: %s", f.command, l)
+		}
+	}
+
+	return nil
+}
+
+// send writes the given text lines followed by a flush packet.
+func (f *processFilter) send(lines []string) error {
+	for _, l := range lines {
+		if err := f.encoder.EncodeString(l + "\n"); err != nil {
+			return err
+		}
+	}
+
+	return f.encoder.Flush()
+}
+
+// sendContent writes the content read from r in packets followed by a flush
+// packet.
+func (f *processFilter) sendContent(r io.Reader) error {
+	buf := make([]byte, pktline.MaxPayloadSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if err := f.encoder.Encode(buf[:n]); err != nil {
+				return err
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return f.encoder.Flush()
+}
+
+// readList reads text lines until a flush packet.
+func (f *processFilter) readList() ([]string, error) {
+	var list []string
+	for f.scanner.Scan() {
+		l := f.scanner.Bytes()
+		if len(l) == 0 {
+			return list, nil
+		}
+
+		list = append(list, strings.TrimSuffix(string(l), "\n"))
+	}
+
+	return nil, f.scanError()
+}
+
+func (f *processFilter) scanError() error {
+	if err := f.scanner.Err(); err != nil {
+		return err
+	}
+
+	return ErrFilterProcess
+}
+
+// Close stops the process, closing its input.
+func (f *processFilter) Close() error {
+	if f.cmd == nil || f.cmd.Process == nil {
+		return nil
+	}
+
+	if err := f.stdin.Close(); err != nil {
+		return err
+	}
+
+	return f.cmd.Wait()
+}
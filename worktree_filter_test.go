@@ -0,0 +1,432 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/lfs"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+type FilterSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&FilterSuite{})
+
+type upperFilter struct {
+	paths []string
+}
+
+func (f *upperFilter) Clean(path string, dst io.Writer, src io.Reader) error {
+	f.paths = append(f.paths, path)
+	return f.convert(dst, src, bytes.ToUpper)
+}
+
+func (f *upperFilter) Smudge(path string, dst io.Writer, src io.Reader) error {
+	return f.convert(dst, src, bytes.ToLower)
+}
+
+func (f *upperFilter) convert(dst io.Writer, src io.Reader, convert func([]byte) []byte) error {
+	content, err := ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+
+	_, err = dst.Write(convert(content))
+	return err
+}
+
+type failingFilter struct{}
+
+func (failingFilter) Clean(path string, dst io.Writer, src io.Reader) error {
+	return fmt.Errorf("clean failed")
+}
+
+func (failingFilter) Smudge(path string, dst io.Writer, src io.Reader) error {
+	return fmt.Errorf("smudge failed")
+}
+
+// prepareFilter commits the given files to a repository on disk, with the
+// given filter options in the configuration.
+func (s *FilterSuite) prepareFilter(c *C, options map[string]string, filters map[string]Filter, files map[string]string) (*Repository, *Worktree, func()) {
+	dir, clean := s.TemporalDir()
+
+	r, err := PlainInit(dir, false)
+	c.Assert(err, IsNil)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	for key, value := range options {
+		cfg.Raw.Section(filterSection).Subsection("test").SetOption(key, value)
+	}
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	attributes := "*.txt filter=test\n"
+	err = util.WriteFile(r.wt, ".gitattributes", []byte(attributes), 0644)
+	c.Assert(err, IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+	w.Filters = filters
+
+	committed := map[string]string{".gitattributes": attributes}
+	for name, content := range files {
+		committed[name] = content
+	}
+
+	commitFiles(c, w, "init", committed)
+	return r, w, clean
+}
+
+func (s *FilterSuite) TestFilter(c *C) {
+	f := &upperFilter{}
+	r, w, clean := s.prepareFilter(c, nil, map[string]Filter{"test": f}, map[string]string{
+		"foo.txt": "foo\n",
+		"bar":     "bar\n",
+	})
+	defer clean()
+
+	assertBlob(c, r, "foo.txt", "FOO\n")
+	assertBlob(c, r, "bar", "bar\n")
+	for _, path := range f.paths {
+		c.Assert(path, Equals, "foo.txt")
+	}
+
+	assertClean(c, w)
+
+	c.Assert(w.Filesystem.Remove("foo.txt"), IsNil)
+	resetHard(c, r, w)
+
+	content, err := util.ReadFile(w.Filesystem, "foo.txt")
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "foo\n")
+
+	err = util.WriteFile(w.Filesystem, "foo.txt", []byte("Foo\n"), 0644)
+	c.Assert(err, IsNil)
+	assertClean(c, w)
+
+	err = util.WriteFile(w.Filesystem, "foo.txt", []byte("qux\n"), 0644)
+	c.Assert(err, IsNil)
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo.txt").Worktree, Equals, Modified)
+}
+
+func (s *FilterSuite) TestFilterLFS(c *C) {
+	objects := memfs.New()
+	f := lfs.NewFilter(lfs.NewLocalAdapter(objects), nil)
+	r, w, clean := s.prepareFilter(c, nil, map[string]Filter{"test": f}, map[string]string{
+		"foo.txt": "foo\n",
+	})
+	defer clean()
+
+	p, err := lfs.NewPointer(strings.NewReader("foo\n"))
+	c.Assert(err, IsNil)
+	assertBlob(c, r, "foo.txt", p.String())
+	assertClean(c, w)
+
+	c.Assert(w.Filesystem.Remove("foo.txt"), IsNil)
+	resetHard(c, r, w)
+
+	content, err := util.ReadFile(w.Filesystem, "foo.txt")
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "foo\n")
+
+	// the status and the diff don't store the large files
+	c.Assert(util.WriteFile(w.Filesystem, "foo.txt", []byte("bar\n"), 0644), IsNil)
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo.txt").Worktree, Equals, Modified)
+	_, err = w.Diff(DiffOptions{})
+	c.Assert(err, IsNil)
+
+	p, err = lfs.NewPointer(strings.NewReader("bar\n"))
+	c.Assert(err, IsNil)
+	_, err = objects.Stat(path.Join(p.Oid[0:2], p.Oid[2:4], p.Oid))
+	c.Assert(os.IsNotExist(err), Equals, true)
+	resetHard(c, r, w)
+
+	// the large files are required to check out their pointers
+	c.Assert(util.RemoveAll(objects, "/"), IsNil)
+	c.Assert(w.Filesystem.Remove("foo.txt"), IsNil)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	err = w.Reset(&ResetOptions{Commit: head.Hash(), Mode: HardReset})
+	c.Assert(err, Equals, lfs.ErrObjectNotFound)
+}
+
+func (s *FilterSuite) TestFilterLFSStatusNoRequests(c *C) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	remote := lfs.NewHTTPAdapter(lfs.Endpoint(server.URL+"/repo"), nil, server.Client())
+	f := lfs.NewFilter(lfs.NewLocalAdapter(memfs.New()), remote)
+	r, w, clean := s.prepareFilter(c, nil, map[string]Filter{"test": f}, map[string]string{
+		"foo.txt": "foo\n",
+	})
+	defer clean()
+
+	err := util.WriteFile(w.Filesystem, "foo.txt", []byte("bar\n"), 0644)
+	c.Assert(err, IsNil)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo.txt").Worktree, Equals, Modified)
+
+	_, err = w.Diff(DiffOptions{})
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo.txt")
+	c.Assert(err, IsNil)
+	c.Assert(atomic.LoadInt32(&requests), Equals, int32(0))
+
+	// the large files are uploaded explicitly
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	commit, err := r.CommitObject(head.Hash())
+	c.Assert(err, IsNil)
+	tree, err := commit.Tree()
+	c.Assert(err, IsNil)
+
+	pointers, err := lfs.TreePointers(tree)
+	c.Assert(err, IsNil)
+	c.Assert(pointers, HasLen, 1)
+	c.Assert(f.Upload(pointers...), NotNil)
+	c.Assert(atomic.LoadInt32(&requests), Equals, int32(1))
+}
+
+func (s *FilterSuite) TestFilterRequired(c *C) {
+	_, w, clean := s.prepareFilter(c, map[string]string{"required": "true"}, nil, nil)
+	defer clean()
+
+	err := util.WriteFile(w.Filesystem, "foo.txt", []byte("foo\n"), 0644)
+	c.Assert(err, IsNil)
+
+	_, err = w.Add("foo.txt")
+	c.Assert(err, ErrorMatches, ".*"+ErrMissingFilter.Error())
+
+	w.Filters = map[string]Filter{"test": failingFilter{}}
+	_, err = w.Add("foo.txt")
+	c.Assert(err, ErrorMatches, ".*clean failed")
+}
+
+func (s *FilterSuite) TestFilterCommand(c *C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("shell filters are not supported on windows")
+	}
+
+	r, w, clean := s.prepareFilter(c, map[string]string{
+		"clean":  "tr a-z A-Z",
+		"smudge": "tr A-Z a-z",
+	}, nil, map[string]string{"foo.txt": "foo\n"})
+	defer clean()
+
+	assertBlob(c, r, "foo.txt", "FOO\n")
+	assertClean(c, w)
+
+	c.Assert(w.Filesystem.Remove("foo.txt"), IsNil)
+	resetHard(c, r, w)
+
+	content, err := util.ReadFile(w.Filesystem, "foo.txt")
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "foo\n")
+}
+
+func (s *FilterSuite) TestFilterCommandFailed(c *C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("shell filters are not supported on windows")
+	}
+
+	// the content is kept if the filter isn't required
+	r, w, clean := s.prepareFilter(c, map[string]string{
+		"clean": "exit 1",
+	}, nil, map[string]string{"foo.txt": "foo\n"})
+	defer clean()
+
+	assertBlob(c, r, "foo.txt", "foo\n")
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Raw.Section(filterSection).Subsection("test").SetOption("required", "true")
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	err = util.WriteFile(w.Filesystem, "foo.txt", []byte("bar\n"), 0644)
+	c.Assert(err, IsNil)
+
+	_, err = w.Add("foo.txt")
+	c.Assert(err, ErrorMatches, `.*filter "exit 1" failed: exit status 1: `)
+}
+
+func (s *FilterSuite) TestFilterProcess(c *C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("shell filters are not supported on windows")
+	}
+
+	process := fmt.Sprintf("GO_GIT_TEST_FILTER_PROCESS=1 %s -test.run=TestFilterProcessHelper", shellQuote(os.Args[0]))
+	r, w, clean := s.prepareFilter(c, map[string]string{
+		"process": process,
+	}, nil, map[string]string{
+		"foo.txt": "foo\n",
+		"bar.txt": strings.Repeat("bar\n", pktline.MaxPayloadSize/2),
+	})
+	defer clean()
+
+	assertBlob(c, r, "foo.txt", "FOO\n")
+	assertBlob(c, r, "bar.txt", strings.Repeat("BAR\n", pktline.MaxPayloadSize/2))
+	assertClean(c, w)
+
+	c.Assert(w.Filesystem.Remove("foo.txt"), IsNil)
+	c.Assert(w.Filesystem.Remove("bar.txt"), IsNil)
+	resetHard(c, r, w)
+
+	content, err := util.ReadFile(w.Filesystem, "foo.txt")
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "foo\n")
+
+	content, err = util.ReadFile(w.Filesystem, "bar.txt")
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, strings.Repeat("bar\n", pktline.MaxPayloadSize/2))
+}
+
+func (s *FilterSuite) TestFilterProcessConcurrentStatus(c *C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("shell filters are not supported on windows")
+	}
+
+	process := fmt.Sprintf("GO_GIT_TEST_FILTER_PROCESS=1 %s -test.run=TestFilterProcessHelper", shellQuote(os.Args[0]))
+	_, w, clean := s.prepareFilter(c, map[string]string{
+		"process": process,
+	}, nil, map[string]string{"foo.txt": "foo\n"})
+	defer clean()
+
+	// each operation runs its own filter process
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			status, err := w.Status()
+			if err == nil && !status.IsClean() {
+				err = fmt.Errorf("unexpected status: %s", status)
+			}
+
+			errs <- err
+		}()
+	}
+
+	for i := 0; i < cap(errs); i++ {
+		c.Assert(<-errs, IsNil)
+	}
+}
+
+// TestFilterProcessHelper isn't a real test, it's the filter process run by
+// TestFilterProcess, converting the content to uppercase on clean and to
+// lowercase on smudge.
+func TestFilterProcessHelper(t *testing.T) {
+	if os.Getenv("GO_GIT_TEST_FILTER_PROCESS") != "1" {
+		return
+	}
+
+	if err := runFilterProcess(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+func runFilterProcess() error {
+	scanner := pktline.NewScanner(os.Stdin)
+	encoder := pktline.NewEncoder(os.Stdout)
+
+	readList := func() []string {
+		var list []string
+		for scanner.Scan() && len(scanner.Bytes()) != 0 {
+			list = append(list, strings.TrimSuffix(string(scanner.Bytes()), "\n"))
+		}
+
+		return list
+	}
+
+	readList()
+	if err := encoder.EncodeString("git-filter-server\n", "version=2\n"); err != nil {
+		return err
+	}
+
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+
+	readList()
+	if err := encoder.EncodeString("capability=clean\n", "capability=smudge\n"); err != nil {
+		return err
+	}
+
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+
+	for {
+		command := readList()
+		if len(command) == 0 {
+			return scanner.Err()
+		}
+
+		var content []byte
+		for scanner.Scan() && len(scanner.Bytes()) != 0 {
+			content = append(content, scanner.Bytes()...)
+		}
+
+		if command[0] == "command=clean" {
+			content = bytes.ToUpper(content)
+		} else {
+			content = bytes.ToLower(content)
+		}
+
+		if err := encoder.EncodeString("status=success\n"); err != nil {
+			return err
+		}
+
+		if err := encoder.Flush(); err != nil {
+			return err
+		}
+
+		for len(content) > 0 {
+			n := len(content)
+			if n > pktline.MaxPayloadSize {
+				n = pktline.MaxPayloadSize
+			}
+
+			if err := encoder.Encode(content[:n]); err != nil {
+				return err
+			}
+
+			content = content[n:]
+		}
+
+		if err := encoder.Flush(); err != nil {
+			return err
+		}
+
+		if err := encoder.Flush(); err != nil {
+			return err
+		}
+	}
+}
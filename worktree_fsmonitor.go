@@ -0,0 +1,542 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+)
+
+var (
+	// ErrFSMonitorResponse is returned by the core.fsmonitor hook monitor
+	// when the output of the hook is not a valid response.
+	ErrFSMonitorResponse = errors.New("invalid fsmonitor hook response")
+)
+
+// FileSystemMonitor reports the paths of the worktree changed since a point
+// in time, allowing Status to skip the files and directories known to be
+// unchanged. The hook of core.fsmonitor is used when no other is given.
+type FileSystemMonitor interface {
+	// Changes returns the paths changed since the query identified by the
+	// given token, and the token identifying this query. The token is empty
+	// in the first query, when every path is considered as changed. The
+	// paths of directories end with a slash, changing all their content,
+	// and "/" invalidates the whole worktree.
+	Changes(token string) (changes []string, next string, err error)
+}
+
+// hookFileSystemMonitor runs a core.fsmonitor hook, using the version 2 of
+// its protocol: the hook is called with the version and the last token as
+// arguments and prints the new token followed by the changed paths, all of
+// them terminated by NUL characters.
+type hookFileSystemMonitor struct {
+	hook string
+	dir  string
+}
+
+func (m *hookFileSystemMonitor) Changes(token string) ([]string, string, error) {
+	cmd := exec.Command(m.hook, "2", token)
+	cmd.Dir = m.dir
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, "", err
+	}
+
+	fields := strings.Split(string(out), "\x00")
+	if fields[0] == "" {
+		return nil, "", ErrFSMonitorResponse
+	}
+
+	var changes []string
+	for _, f := range fields[1:] {
+		if f != "" {
+			changes = append(changes, f)
+		}
+	}
+
+	return changes, fields[0], nil
+}
+
+// fileSystemMonitor returns the monitor of the worktree, the configured
+// core.fsmonitor hook by default. The boolean values of core.fsmonitor, used
+// by git for its builtin daemon, are not supported.
+func (w *Worktree) fileSystemMonitor(cfg *config.Config) FileSystemMonitor {
+	if w.FileSystemMonitor != nil {
+		return w.FileSystemMonitor
+	}
+
+	hook := cfg.Core.FSMonitor
+	switch strings.ToLower(hook) {
+	case "", "false", "true":
+		return nil
+	}
+
+	root := w.Filesystem.Root()
+	if !filepath.IsAbs(hook) && strings.ContainsAny(hook, `/\`) {
+		hook = filepath.Join(root, hook)
+	}
+
+	return &hookFileSystemMonitor{hook: hook, dir: root}
+}
+
+// statusCache is the cache of the worktree used by the status, made of the
+// index entries that the file system monitor reports as unchanged and of the
+// untracked files of the directories recorded in the untracked cache.
+type statusCache struct {
+	monitor FileSystemMonitor
+	// token is the token of the last query to the monitor, empty if the
+	// query failed
+	token string
+	// monitored is true if the changes reported by the monitor are
+	// complete, false if everything must be considered as changed
+	monitored bool
+	changes   map[string]bool
+	// changedDirs are the directories with changed children
+	changedDirs map[string]bool
+	// changedTrees are the directories reported as changed, with all their
+	// content
+	changedTrees []string
+
+	hashes  map[string][]byte
+	tracked map[string][]string
+
+	untracked   bool
+	environment string
+	dirs        map[string]*index.UntrackedCacheDirectory
+	stats       map[string]index.UntrackedCacheStats
+}
+
+// unameSysname returns the name of the operating system as reported by uname,
+// which git records in the environment of the untracked cache.
+func unameSysname() string {
+	switch runtime.GOOS {
+	case "linux", "android":
+		return "Linux"
+	case "darwin", "ios":
+		return "Darwin"
+	case "freebsd":
+		return "FreeBSD"
+	case "netbsd":
+		return "NetBSD"
+	case "openbsd":
+		return "OpenBSD"
+	case "dragonfly":
+		return "DragonFly"
+	case "solaris", "illumos":
+		return "SunOS"
+	case "aix":
+		return "AIX"
+	case "windows":
+		return "Windows"
+	}
+
+	return runtime.GOOS
+}
+
+// newStatusCache returns the cache used to walk the worktree, nil if neither
+// a file system monitor nor the untracked cache, core.untrackedCache, are
+// enabled.
+func (w *Worktree) newStatusCache(idx *index.Index) (*statusCache, error) {
+	cfg, err := w.r.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &statusCache{
+		monitor:   w.fileSystemMonitor(cfg),
+		untracked: cfg.Core.UntrackedCache,
+		environment: fmt.Sprintf("Location %s, system %s",
+			w.Filesystem.Root(), unameSysname(),
+		),
+	}
+
+	if c.monitor == nil && !c.untracked {
+		return nil, nil
+	}
+
+	if c.monitor != nil {
+		c.queryMonitor(idx)
+	}
+
+	c.hashes = make(map[string][]byte)
+	tracked := make(map[string]map[string]bool)
+	for _, e := range idx.Entries {
+		if e.SkipWorktree {
+			continue
+		}
+
+		if c.isValid(idx, e) {
+			c.hashes[e.Name] = append(e.Hash[:], e.Mode.Bytes()...)
+		}
+
+		name := e.Name
+		for name != "" {
+			dir, base := path.Split(name)
+			dir = strings.TrimSuffix(dir, "/")
+			if name != e.Name {
+				base += "/"
+			}
+
+			if tracked[dir] == nil {
+				tracked[dir] = make(map[string]bool)
+			}
+
+			tracked[dir][base] = true
+			name = dir
+		}
+	}
+
+	c.tracked = make(map[string][]string, len(tracked))
+	for dir, names := range tracked {
+		c.tracked[dir] = sortedNames(names)
+	}
+
+	if c.untracked {
+		c.loadUntrackedCache(w, idx)
+	}
+
+	return c, nil
+}
+
+// queryMonitor asks the monitor for the changes since the token of the
+// index, a failing monitor is ignored and everything is walked.
+func (c *statusCache) queryMonitor(idx *index.Index) {
+	var token string
+	if idx.FSMonitor != nil {
+		token = idx.FSMonitor.Token
+	}
+
+	changes, next, err := c.monitor.Changes(token)
+	if err != nil {
+		return
+	}
+
+	c.token = next
+	c.monitored = token != ""
+	c.changes = make(map[string]bool, len(changes))
+	c.changedDirs = make(map[string]bool)
+	for _, ch := range changes {
+		if ch == "/" {
+			c.monitored = false
+			return
+		}
+
+		name := strings.TrimSuffix(ch, "/")
+		if name != ch {
+			c.changedTrees = append(c.changedTrees, ch)
+			c.changedDirs[name] = true
+		}
+
+		c.changes[name] = true
+		c.changedDirs[parentDir(name)] = true
+	}
+}
+
+func (c *statusCache) isValid(idx *index.Index, e *index.Entry) bool {
+	return c.monitored && idx.FSMonitor != nil && e.FSMonitorValid &&
+		e.Stage == index.Merged && e.Mode != filemode.Submodule &&
+		!c.isChanged(e.Name)
+}
+
+// isChanged returns true if the monitor reported a change of the given path.
+func (c *statusCache) isChanged(name string) bool {
+	if !c.monitored || c.changes[name] {
+		return true
+	}
+
+	for _, prefix := range c.changedTrees {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadUntrackedCache loads the untracked cache of the index, if recorded in
+// this environment, and the stats of the directories before they are walked.
+func (c *statusCache) loadUntrackedCache(w *Worktree, idx *index.Index) {
+	c.dirs = make(map[string]*index.UntrackedCacheDirectory)
+	if uc := idx.UntrackedCache; uc != nil && uc.Root != nil &&
+		len(uc.Environments) == 1 && uc.Environments[0] == c.environment {
+		c.loadUntrackedDirectory("", uc.Root)
+	}
+
+	c.stats = make(map[string]index.UntrackedCacheStats)
+	c.statDirectory(w, "")
+	for dir := range c.tracked {
+		c.statDirectory(w, dir)
+	}
+
+	for dir := range c.dirs {
+		c.statDirectory(w, dir)
+	}
+}
+
+func (c *statusCache) loadUntrackedDirectory(name string, dir *index.UntrackedCacheDirectory) {
+	c.dirs[name] = dir
+	for _, sub := range dir.Directories {
+		c.loadUntrackedDirectory(path.Join(name, sub.Name), sub)
+	}
+}
+
+func (c *statusCache) statDirectory(w *Worktree, dir string) {
+	if _, ok := c.stats[dir]; ok {
+		return
+	}
+
+	fi, err := w.Filesystem.Lstat(dir)
+	if err != nil || !fi.IsDir() {
+		return
+	}
+
+	e := &index.Entry{}
+	if fillSystemInfo != nil {
+		fillSystemInfo(e, fi.Sys())
+	}
+
+	c.stats[dir] = index.UntrackedCacheStats{
+		CreatedAt:  e.CreatedAt,
+		ModifiedAt: fi.ModTime(),
+		Dev:        e.Dev,
+		Inode:      e.Inode,
+		UID:        e.UID,
+		GID:        e.GID,
+		Size:       uint32(fi.Size()),
+	}
+}
+
+// FileHash returns the hash of the index entry of the given path, if the
+// monitor reports the file as unchanged.
+func (c *statusCache) FileHash(path string) ([]byte, bool) {
+	h, ok := c.hashes[path]
+	return h, ok
+}
+
+// DirNames returns the tracked and the cached untracked files of the given
+// directory, if the monitor reports the directory as unchanged or if its
+// stats didn't change since the untracked cache was recorded.
+func (c *statusCache) DirNames(dir string) ([]string, bool) {
+	cached, ok := c.dirs[dir]
+	if !ok || !cached.Valid {
+		return nil, false
+	}
+
+	unchanged := c.monitored && !c.changedDirs[dir] && !c.isChanged(dir+"/")
+	if !unchanged {
+		stats, ok := c.stats[dir]
+		unchanged = ok && sameStats(stats, cached.Stats)
+	}
+
+	if !unchanged {
+		return nil, false
+	}
+
+	names := make(map[string]bool)
+	for _, name := range c.tracked[dir] {
+		names[name] = true
+	}
+
+	for _, name := range cached.Untracked {
+		names[name] = true
+	}
+
+	return sortedNames(names), true
+}
+
+// update records in the index the token of the monitor, the entries found
+// unchanged and, if the whole worktree was walked, the untracked files. It
+// returns true if any of them changed, so the index needs to be written.
+func (c *statusCache) update(idx *index.Index, right merkletrie.Changes, o *StatusOptions) bool {
+	var changed bool
+	if c.monitor != nil {
+		changed = c.updateFSMonitor(idx, right, o)
+	}
+
+	if c.untracked && len(o.Paths) == 0 && o.Untracked != NoUntrackedFiles {
+		old := idx.UntrackedCache
+		c.updateUntrackedCache(idx, right)
+		changed = changed || !sameUntrackedCache(old, idx.UntrackedCache)
+	}
+
+	return changed
+}
+
+func (c *statusCache) updateFSMonitor(idx *index.Index, right merkletrie.Changes, o *StatusOptions) bool {
+	if c.token == "" {
+		changed := idx.FSMonitor != nil
+		idx.FSMonitor = nil
+		return changed
+	}
+
+	dirty := make(map[string]bool, len(right))
+	for _, ch := range right {
+		dirty[nameFromAction(&ch)] = true
+	}
+
+	changed := idx.FSMonitor == nil || idx.FSMonitor.Token != c.token
+	for _, e := range idx.Entries {
+		valid := !e.SkipWorktree && !dirty[e.Name]
+		if !matchPathspec(o.Paths, e.Name) {
+			_, valid = c.hashes[e.Name]
+		}
+
+		changed = changed || e.FSMonitorValid != valid
+		e.FSMonitorValid = valid
+	}
+
+	idx.FSMonitor = &index.FSMonitor{Version: 2, Token: c.token}
+	return changed
+}
+
+// updateUntrackedCache replaces the untracked cache of the index by the
+// untracked files found, the directories stated before the walk are valid.
+func (c *statusCache) updateUntrackedCache(idx *index.Index, right merkletrie.Changes) {
+	dirs := make(map[string]*index.UntrackedCacheDirectory)
+	var get func(name string) *index.UntrackedCacheDirectory
+	get = func(name string) *index.UntrackedCacheDirectory {
+		if dir, ok := dirs[name]; ok {
+			return dir
+		}
+
+		dir := &index.UntrackedCacheDirectory{Name: path.Base(name)}
+		if name == "" {
+			dir.Name = ""
+		}
+
+		if stats, ok := c.stats[name]; ok {
+			dir.Valid = true
+			dir.Stats = stats
+		}
+
+		dirs[name] = dir
+		if name != "" {
+			parent := get(parentDir(name))
+			parent.Directories = append(parent.Directories, dir)
+		}
+
+		return dir
+	}
+
+	for name := range c.stats {
+		get(name)
+	}
+
+	for _, ch := range right {
+		a, err := ch.Action()
+		if err != nil || a != merkletrie.Insert {
+			continue
+		}
+
+		name := ch.To.String()
+		for name != "" {
+			parent := parentDir(name)
+			base := path.Base(name)
+			if name != ch.To.String() {
+				base += "/"
+			}
+
+			dir := get(parent)
+			dir.Untracked = append(dir.Untracked, base)
+			if _, tracked := c.tracked[parent]; tracked || parent == "" {
+				break
+			}
+
+			if len(dir.Untracked) > 1 {
+				break
+			}
+
+			name = parent
+		}
+	}
+
+	for _, dir := range dirs {
+		sort.Strings(dir.Untracked)
+		sort.Slice(dir.Directories, func(i, j int) bool {
+			return dir.Directories[i].Name < dir.Directories[j].Name
+		})
+	}
+
+	idx.UntrackedCache = &index.UntrackedCache{
+		Environments:  []string{c.environment},
+		ExcludePerDir: ".gitignore",
+		Root:          get(""),
+	}
+}
+
+// sameUntrackedCache returns true if both caches record the same untracked
+// files, for the same directories and environments.
+func sameUntrackedCache(a, b *index.UntrackedCache) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	if a.ExcludePerDir != b.ExcludePerDir || !sameStrings(a.Environments, b.Environments) {
+		return false
+	}
+
+	return sameUntrackedDirectory(a.Root, b.Root)
+}
+
+func sameUntrackedDirectory(a, b *index.UntrackedCacheDirectory) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	if a.Name != b.Name || a.Valid != b.Valid || a.CheckOnly != b.CheckOnly ||
+		a.ExcludeHash != b.ExcludeHash || !sameStrings(a.Untracked, b.Untracked) ||
+		len(a.Directories) != len(b.Directories) {
+		return false
+	}
+
+	if a.Valid && !sameStats(a.Stats, b.Stats) {
+		return false
+	}
+
+	for i := range a.Directories {
+		if !sameUntrackedDirectory(a.Directories[i], b.Directories[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sameStats(a, b index.UntrackedCacheStats) bool {
+	return a.ModifiedAt.Equal(b.ModifiedAt) && a.CreatedAt.Equal(b.CreatedAt) &&
+		a.Dev == b.Dev && a.Inode == b.Inode && a.Size == b.Size
+}
+
+func sortedNames(names map[string]bool) []string {
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+
+	sort.Strings(sorted)
+	return sorted
+}
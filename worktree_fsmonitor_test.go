@@ -0,0 +1,236 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+type FileSystemMonitorSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&FileSystemMonitorSuite{})
+
+type testMonitor struct {
+	tokens  []string
+	changes []string
+}
+
+func (m *testMonitor) Changes(token string) ([]string, string, error) {
+	m.tokens = append(m.tokens, token)
+	changes := m.changes
+	m.changes = nil
+	return changes, string(rune('a' + len(m.tokens) - 1)), nil
+}
+
+func (s *FileSystemMonitorSuite) prepareRepository(c *C) (*Repository, *Worktree, func()) {
+	dir, clean := s.TemporalDir()
+
+	r, err := PlainInit(dir, false)
+	c.Assert(err, IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	commitFiles(c, w, "init", map[string]string{"foo": "foo\n", "a/bar": "bar\n"})
+	return r, w, clean
+}
+
+func (s *FileSystemMonitorSuite) TestStatusFileSystemMonitor(c *C) {
+	r, w, clean := s.prepareRepository(c)
+	defer clean()
+
+	m := &testMonitor{}
+	w.FileSystemMonitor = m
+	assertClean(c, w)
+
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.FSMonitor, NotNil)
+	c.Assert(idx.FSMonitor.Token, Equals, "a")
+	for _, e := range idx.Entries {
+		c.Assert(e.FSMonitorValid, Equals, true)
+	}
+
+	// the unreported changes are not seen
+	err = util.WriteFile(w.Filesystem, "foo", []byte("modified\n"), 0644)
+	c.Assert(err, IsNil)
+	err = util.WriteFile(w.Filesystem, "a/bar", []byte("modified\n"), 0644)
+	c.Assert(err, IsNil)
+	assertClean(c, w)
+
+	m.changes = []string{"foo"}
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 1)
+	c.Assert(status.File("foo").Worktree, Equals, Modified)
+
+	// the entries found modified are checked until they are clean again
+	status, err = w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo").Worktree, Equals, Modified)
+
+	m.changes = []string{"a/"}
+	status, err = w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("a/bar").Worktree, Equals, Modified)
+
+	c.Assert(m.tokens, DeepEquals, []string{"", "a", "b", "c", "d"})
+}
+
+func (s *FileSystemMonitorSuite) TestStatusFileSystemMonitorInvalidate(c *C) {
+	_, w, clean := s.prepareRepository(c)
+	defer clean()
+
+	m := &testMonitor{}
+	w.FileSystemMonitor = m
+	assertClean(c, w)
+
+	err := util.WriteFile(w.Filesystem, "foo", []byte("modified\n"), 0644)
+	c.Assert(err, IsNil)
+
+	m.changes = []string{"/"}
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo").Worktree, Equals, Modified)
+}
+
+func (s *FileSystemMonitorSuite) TestStatusUntrackedCache(c *C) {
+	r, w, clean := s.prepareRepository(c)
+	defer clean()
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Core.UntrackedCache = true
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	for _, name := range []string{"qux", "u/x", "a/baz"} {
+		err := util.WriteFile(w.Filesystem, name, []byte(name), 0644)
+		c.Assert(err, IsNil)
+	}
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 3)
+
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.UntrackedCache, NotNil)
+
+	root := idx.UntrackedCache.Root
+	c.Assert(root.Valid, Equals, true)
+	c.Assert(root.Untracked, DeepEquals, []string{"qux", "u/"})
+	c.Assert(root.Directories, HasLen, 2)
+	c.Assert(root.Directories[0].Name, Equals, "a")
+	c.Assert(root.Directories[0].Untracked, DeepEquals, []string{"baz"})
+	c.Assert(root.Directories[1].Name, Equals, "u")
+	c.Assert(root.Directories[1].Valid, Equals, false)
+
+	// the cached untracked files are trusted while the directory is unchanged
+	root.Untracked = []string{"u/"}
+	c.Assert(r.Storer.SetIndex(idx), IsNil)
+
+	status, err = w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 2)
+	c.Assert(status.File("u/x").Worktree, Equals, Untracked)
+
+	err = util.WriteFile(w.Filesystem, "new", []byte("new"), 0644)
+	c.Assert(err, IsNil)
+
+	status, err = w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 4)
+	c.Assert(status.File("qux").Worktree, Equals, Untracked)
+	c.Assert(status.File("new").Worktree, Equals, Untracked)
+}
+
+func (s *FileSystemMonitorSuite) TestStatusUntrackedCacheUnchanged(c *C) {
+	r, w, clean := s.prepareRepository(c)
+	defer clean()
+
+	err := util.WriteFile(w.Filesystem, "qux", []byte("qux"), 0644)
+	c.Assert(err, IsNil)
+
+	file := filepath.Join(w.Filesystem.Root(), GitDirName, "index")
+	assertIndexNotWritten := func() {
+		past := time.Now().Add(-time.Hour).Truncate(time.Second)
+		c.Assert(os.Chtimes(file, past, past), IsNil)
+
+		_, err := w.Status()
+		c.Assert(err, IsNil)
+
+		fi, err := os.Stat(file)
+		c.Assert(err, IsNil)
+		c.Assert(fi.ModTime().Equal(past), Equals, true)
+	}
+
+	// the cache is disabled, the index is left as it is
+	assertIndexNotWritten()
+
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.UntrackedCache, IsNil)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Core.UntrackedCache = true
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	_, err = w.Status()
+	c.Assert(err, IsNil)
+
+	idx, err = r.Storer.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.UntrackedCache.Environments, DeepEquals, []string{
+		"Location " + w.Filesystem.Root() + ", system " + unameSysname(),
+	})
+
+	// the cache is up to date, the index is not written again
+	assertIndexNotWritten()
+}
+
+func (s *FileSystemMonitorSuite) TestHookFileSystemMonitor(c *C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("shell hooks are not supported on windows")
+	}
+
+	r, w, clean := s.prepareRepository(c)
+	defer clean()
+
+	hook := filepath.Join(w.Filesystem.Root(), ".git", "hooks", "fsmonitor")
+	c.Assert(os.MkdirAll(filepath.Dir(hook), 0755), IsNil)
+	err := ioutil.WriteFile(hook, []byte("#!/bin/sh\n"+
+		"echo \"$@\" > .git/fsmonitor-args\n"+
+		"printf 'next\\0foo\\0a/\\0'\n",
+	), 0755)
+	c.Assert(err, IsNil)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Core.FSMonitor = ".git/hooks/fsmonitor"
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	m := w.fileSystemMonitor(cfg)
+	c.Assert(m, NotNil)
+
+	changes, next, err := m.Changes("token")
+	c.Assert(err, IsNil)
+	c.Assert(next, Equals, "next")
+	c.Assert(changes, DeepEquals, []string{"foo", "a/"})
+
+	args, err := util.ReadFile(w.Filesystem, ".git/fsmonitor-args")
+	c.Assert(err, IsNil)
+	c.Assert(string(args), Equals, "2 token\n")
+
+	assertClean(c, w)
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.FSMonitor.Token, Equals, "next")
+}
@@ -0,0 +1,502 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/ioutil"
+)
+
+var (
+	// ErrMergeInProgress is returned when a merge is attempted while another
+	// one, stopped because of conflicts, hasn't been concluded or aborted.
+	ErrMergeInProgress = errors.New("a merge is already in progress")
+	// ErrNoMergeInProgress is returned when aborting a merge that doesn't
+	// exist.
+	ErrNoMergeInProgress = errors.New("there is no merge in progress")
+	// ErrMergeConflict is returned when the merge stopped because of
+	// conflicts, they should be resolved and committed with Worktree.Commit.
+	ErrMergeConflict = errors.New("automatic merge failed, fix conflicts and then commit the result")
+	// ErrUnrelatedHistories is returned when merging commits without a common
+	// ancestor, unless MergeOptions.AllowUnrelatedHistories is used.
+	ErrUnrelatedHistories = errors.New("refusing to merge unrelated histories")
+)
+
+// MergeResult is the outcome of a Worktree.Merge.
+type MergeResult struct {
+	// Commit is the commit HEAD points to after the merge, the merge commit
+	// or the merged commit on a fast-forward. It is zero if the merge stopped
+	// because of conflicts or if Squash was used.
+	Commit plumbing.Hash
+	// FastForward is true if the merge was resolved as a fast-forward.
+	FastForward bool
+	// Conflicts found during the merge, sorted by path.
+	Conflicts []*MergeConflict
+}
+
+// Merge incorporates the changes of the given commit into the current branch.
+// When the current branch can be fast-forwarded the branch is just updated,
+// otherwise a three-way merge is performed and, if clean, a merge commit is
+// created.
+//
+// If the merge has conflicts, the index contains the stages of every
+// conflicting path, the worktree files contain the conflict markers and
+// ErrMergeConflict is returned along with the conflicts. Once the conflicts
+// are resolved and added, Worktree.Commit concludes the merge; it can also
+// be aborted using MergeOptions.Abort.
+//
+// NoErrAlreadyUpToDate is returned if the commit is already reachable from
+// HEAD.
+func (w *Worktree) Merge(opts *MergeOptions) (*MergeResult, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	if opts.Abort {
+		return nil, w.abortMerge()
+	}
+
+	if err := w.checkNoOperationInProgress(); err != nil {
+		return nil, err
+	}
+
+	hooks, err := w.r.hooks(opts.Hooks)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := w.r.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	ours, err := w.r.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	theirs, label, err := w.mergeSource(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	upToDate, err := theirs.IsAncestor(ours)
+	if err != nil {
+		return nil, err
+	}
+
+	if theirs.Hash == ours.Hash || upToDate {
+		return &MergeResult{Commit: ours.Hash}, NoErrAlreadyUpToDate
+	}
+
+	ff, err := ours.IsAncestor(theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	if ff && !opts.NoFastForward && !opts.Squash {
+		result, err := w.fastForwardMerge(ours, theirs, label, reflogCommitter(w.r.Storer, opts.Committer))
+		if err != nil {
+			return nil, err
+		}
+
+		// the post-merge hook can't affect the outcome of the merge
+		_ = hooks.run(PostMergeHook, nil, "0")
+		return result, nil
+	}
+
+	if !ff && opts.FastForwardOnly {
+		return nil, ErrNonFastForwardUpdate
+	}
+
+	if err := w.checkCleanForMerge(); err != nil {
+		return nil, err
+	}
+
+	bases, err := ours.MergeBase(theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bases) == 0 && !opts.AllowUnrelatedHistories {
+		return nil, ErrUnrelatedHistories
+	}
+
+	res, err := w.r.mergeCommits(bases, ours, theirs, &MergeTreesOptions{
+		OursLabel:      string(plumbing.HEAD),
+		TheirsLabel:    label,
+		StrategyOption: opts.StrategyOption,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.r.Storer.SetReference(plumbing.NewHashReference(plumbing.OrigHead, ours.Hash)); err != nil {
+		return nil, err
+	}
+
+	if err := w.checkoutMergeResult(res); err != nil {
+		return nil, err
+	}
+
+	result := &MergeResult{Conflicts: res.Conflicts}
+	msg := opts.Message
+	if msg == "" {
+		msg, err = w.mergeMessage(opts, label)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Squash {
+		if err := w.writeSquashState(bases, theirs, res); err != nil {
+			return result, err
+		}
+
+		_ = hooks.run(PostMergeHook, nil, "1")
+		return result, nil
+	}
+
+	if !res.IsClean() {
+		return result, w.writeMergeState(theirs, msg, opts, res)
+	}
+
+	result.Commit, err = w.commitMerge(hooks, msg, label, opts, res.Tree, ours, theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = hooks.run(PostMergeHook, nil, "0")
+	return result, nil
+}
+
+// mergeSource returns the commit to be merged and the label used in the
+// conflict markers.
+func (w *Worktree) mergeSource(opts *MergeOptions) (*object.Commit, string, error) {
+	h, label := opts.Commit, opts.Commit.String()
+	if opts.Reference != "" {
+		ref, err := w.r.Reference(opts.Reference, true)
+		if err != nil {
+			return nil, "", err
+		}
+
+		h, label = ref.Hash(), opts.Reference.Short()
+	}
+
+	h, err := w.r.resolveToCommitHash(h)
+	if err != nil {
+		return nil, "", err
+	}
+
+	c, err := w.r.CommitObject(h)
+	return c, label, err
+}
+
+func (w *Worktree) fastForwardMerge(ours, theirs *object.Commit, label string, committer *object.Signature) (*MergeResult, error) {
+	if err := w.r.Storer.SetReference(plumbing.NewHashReference(plumbing.OrigHead, ours.Hash)); err != nil {
+		return nil, err
+	}
+
+	if err := w.checkoutCommit(theirs.Hash, fmt.Sprintf("merge %s: Fast-forward", label), committer); err != nil {
+		return nil, err
+	}
+
+	return &MergeResult{Commit: theirs.Hash, FastForward: true}, nil
+}
+
+// checkCleanForMerge returns ErrWorktreeNotClean if the index or the tracked
+// files of the worktree contain changes, untracked files are ignored.
+func (w *Worktree) checkCleanForMerge() error {
+	s, err := w.Status()
+	if err != nil {
+		return err
+	}
+
+	for _, fs := range s {
+		if fs.Staging == Untracked && fs.Worktree == Untracked {
+			continue
+		}
+
+		if fs.Staging != Unmodified || fs.Worktree != Unmodified {
+			return ErrWorktreeNotClean
+		}
+	}
+
+	return nil
+}
+
+// checkoutMergeResult updates the index and the worktree to the result of the
+// merge, replacing the conflicting paths of the index with their stages.
+func (w *Worktree) checkoutMergeResult(res *MergeTreesResult) error {
+	t, err := w.r.TreeObject(res.Tree)
+	if err != nil {
+		return err
+	}
+
+	if err := w.checkoutTree(t); err != nil {
+		return err
+	}
+
+	if res.IsClean() {
+		return nil
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	var entries []*index.Entry
+	for _, c := range res.Conflicts {
+		entries = append(entries, conflictIndexEntries(c)...)
+	}
+
+	for _, e := range entries {
+		removeIndexEntries(idx, e.Name)
+	}
+
+	idx.Entries = append(idx.Entries, entries...)
+	return w.r.Storer.SetIndex(idx)
+}
+
+// checkoutTree updates the index and the worktree to the given tree. Only the
+// paths that differ between the index and the tree are written, so unlike a
+// hard reset the untracked files are kept.
+func (w *Worktree) checkoutTree(t *object.Tree) (err error) {
+	filters, err := w.newContentFilters()
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(filters, &err)
+
+	changes, err := w.diffTreeWithStaging(t, true)
+	if err != nil {
+		return err
+	}
+
+	if err := w.resetIndex(t, nil); err != nil {
+		return err
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	b := newIndexBuilder(idx)
+	for _, ch := range excludeSkippedChanges(changes, idx) {
+		if err := w.checkoutChange(ch, t, b, filters); err != nil {
+			return err
+		}
+	}
+
+	if err := w.removeSkippedFiles(idx); err != nil {
+		return err
+	}
+
+	b.Write(idx)
+	return w.r.Storer.SetIndex(idx)
+}
+
+// checkoutCommit moves HEAD, or the branch it points to, to the given commit
+// and checks out its tree, keeping the untracked files. The update is logged
+// with the given message and committer.
+func (w *Worktree) checkoutCommit(h plumbing.Hash, msg string, committer *object.Signature) error {
+	if err := w.setHEADCommit(h, msg, committer); err != nil {
+		return err
+	}
+
+	t, err := w.getTreeFromCommitHash(h)
+	if err != nil {
+		return err
+	}
+
+	return w.checkoutTree(t)
+}
+
+// conflictIndexEntries returns the higher stage index entries representing
+// the given conflict.
+func conflictIndexEntries(c *MergeConflict) []*index.Entry {
+	var entries []*index.Entry
+	for _, s := range []struct {
+		stage index.Stage
+		entry *MergeEntry
+	}{
+		{index.AncestorMode, c.Ancestor},
+		{index.OurMode, c.Ours},
+		{index.TheirMode, c.Theirs},
+	} {
+		if s.entry == nil {
+			continue
+		}
+
+		name := s.entry.Path
+		if c.Type == FileDirectoryConflict {
+			if s.stage == index.AncestorMode {
+				continue
+			}
+
+			name = c.Path
+		}
+
+		entries = append(entries, &index.Entry{
+			Name:  name,
+			Hash:  s.entry.Hash,
+			Mode:  s.entry.Mode,
+			Stage: s.stage,
+		})
+	}
+
+	return entries
+}
+
+// removeIndexEntries removes all the entries of the given path, including
+// the higher stage ones.
+func removeIndexEntries(idx *index.Index, path string) {
+	for {
+		if _, err := idx.Remove(path); err != nil {
+			return
+		}
+	}
+}
+
+func (w *Worktree) mergeMessage(opts *MergeOptions, label string) (string, error) {
+	var msg string
+	switch {
+	case opts.Reference.IsBranch():
+		msg = fmt.Sprintf("Merge branch '%s'", label)
+	case opts.Reference.IsRemote():
+		msg = fmt.Sprintf("Merge remote-tracking branch '%s'", label)
+	case opts.Reference.IsTag():
+		msg = fmt.Sprintf("Merge tag '%s'", label)
+	default:
+		msg = fmt.Sprintf("Merge commit '%s'", label)
+	}
+
+	head, err := w.r.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return "", err
+	}
+
+	if head.Type() == plumbing.SymbolicReference && head.Target() != plumbing.Master {
+		msg += " into " + head.Target().Short()
+	}
+
+	return msg, nil
+}
+
+func (w *Worktree) writeMergeState(theirs *object.Commit, msg string, opts *MergeOptions, res *MergeTreesResult) error {
+	if err := w.r.Storer.SetReference(plumbing.NewHashReference(plumbing.MergeHead, theirs.Hash)); err != nil {
+		return err
+	}
+
+	msg = strings.TrimRight(msg, "\n") + "\n\n# Conflicts:\n"
+	for _, c := range res.Conflicts {
+		msg += "#\t" + c.Path + "\n"
+	}
+
+	if err := w.r.writeStateFile(mergeMsgFile, msg); err != nil {
+		return err
+	}
+
+	var mode string
+	if opts.NoFastForward {
+		mode = "no-ff"
+	}
+
+	if err := w.r.writeStateFile(mergeModeFile, mode); err != nil {
+		return err
+	}
+
+	return ErrMergeConflict
+}
+
+func (w *Worktree) writeSquashState(bases []*object.Commit, theirs *object.Commit, res *MergeTreesResult) error {
+	var ignore []plumbing.Hash
+	for _, b := range bases {
+		ignore = append(ignore, b.Hash)
+	}
+
+	msg := "Squashed commit of the following:\n"
+	iter := object.NewCommitPreorderIter(theirs, nil, ignore)
+	err := iter.ForEach(func(c *object.Commit) error {
+		msg += "\n" + c.String()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := w.r.writeStateFile(squashMsgFile, msg); err != nil {
+		return err
+	}
+
+	if !res.IsClean() {
+		return ErrMergeConflict
+	}
+
+	return nil
+}
+
+func (w *Worktree) commitMerge(hooks *hookRunner, msg, label string, opts *MergeOptions, tree plumbing.Hash, ours, theirs *object.Commit) (plumbing.Hash, error) {
+	if !opts.NoVerify {
+		if err := hooks.run(PreMergeCommitHook, nil); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	msg, err := hooks.commitMessageHooks(msg, "merge", opts.NoVerify)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	co := &CommitOptions{
+		Author:    opts.Author,
+		Committer: opts.Committer,
+		Parents:   []plumbing.Hash{ours.Hash, theirs.Hash},
+	}
+
+	if err := co.Validate(w.r); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	commit, err := w.buildCommitObject(msg, co, tree)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return commit, w.updateHEAD(commit, fmt.Sprintf("merge %s: Merge made by the 'recursive' strategy.", label), co.Committer)
+}
+
+// abortMerge restores the index and the worktree to HEAD, removing the state
+// of the merge in progress.
+func (w *Worktree) abortMerge() error {
+	if _, err := w.r.Storer.Reference(plumbing.MergeHead); err != nil {
+		if err == plumbing.ErrReferenceNotFound {
+			return ErrNoMergeInProgress
+		}
+
+		return err
+	}
+
+	if err := w.Reset(&ResetOptions{Mode: HardReset}); err != nil {
+		return err
+	}
+
+	return w.removeMergeState()
+}
+
+// removeMergeState removes MERGE_HEAD and the files describing the merge in
+// progress.
+func (w *Worktree) removeMergeState() error {
+	if err := w.r.Storer.RemoveReference(plumbing.MergeHead); err != nil {
+		return err
+	}
+
+	return w.r.removeStateFile(mergeMsgFile, mergeModeFile)
+}
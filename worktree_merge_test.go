@@ -0,0 +1,262 @@
+package git
+
+import (
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MergeSuite) TestWorktreeMergeFastForward(c *C) {
+	r, _, theirs := s.prepareMerge(c,
+		map[string]string{"foo": "foo\n"},
+		mergeSide{},
+		mergeSide{files: map[string]string{"bar": "bar\n"}},
+	)
+
+	// drop the empty commit of ours, so theirs is a descendant of master
+	base := theirs.ParentHashes[0]
+	err := r.Storer.SetReference(plumbing.NewHashReference(plumbing.Master, base))
+	c.Assert(err, IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+	c.Assert(w.Reset(&ResetOptions{Mode: HardReset}), IsNil)
+
+	res, err := w.Merge(&MergeOptions{Reference: "refs/heads/theirs"})
+	c.Assert(err, IsNil)
+	c.Assert(res.FastForward, Equals, true)
+	c.Assert(res.Commit, Equals, theirs.Hash)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash(), Equals, theirs.Hash)
+
+	orig, err := r.Reference(plumbing.OrigHead, false)
+	c.Assert(err, IsNil)
+	c.Assert(orig.Hash(), Equals, base)
+
+	content, err := util.ReadFile(w.Filesystem, "bar")
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "bar\n")
+
+	_, err = w.Merge(&MergeOptions{Reference: "refs/heads/theirs"})
+	c.Assert(err, Equals, NoErrAlreadyUpToDate)
+}
+
+func (s *MergeSuite) TestWorktreeMergeCommit(c *C) {
+	r, ours, theirs := s.prepareMerge(c,
+		map[string]string{"foo": "foo\n"},
+		mergeSide{files: map[string]string{"qux": "qux\n"}},
+		mergeSide{files: map[string]string{"bar": "bar\n"}},
+	)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	_, err = w.Merge(&MergeOptions{Reference: "refs/heads/theirs", FastForwardOnly: true})
+	c.Assert(err, Equals, ErrNonFastForwardUpdate)
+
+	res, err := w.Merge(&MergeOptions{
+		Reference: "refs/heads/theirs",
+		Author:    defaultSignature(),
+	})
+	c.Assert(err, IsNil)
+	c.Assert(res.FastForward, Equals, false)
+	c.Assert(res.Conflicts, HasLen, 0)
+
+	commit, err := r.CommitObject(res.Commit)
+	c.Assert(err, IsNil)
+	c.Assert(commit.ParentHashes, DeepEquals, []plumbing.Hash{ours.Hash, theirs.Hash})
+	c.Assert(commit.Message, Equals, "Merge branch 'theirs'")
+	assertTreeFiles(c, r, commit.TreeHash, map[string]string{
+		"foo": "foo\n", "bar": "bar\n", "qux": "qux\n",
+	})
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+}
+
+func (s *MergeSuite) TestWorktreeMergeConflict(c *C) {
+	r, ours, theirs := s.prepareMerge(c,
+		map[string]string{"foo": "a\nb\nc\n"},
+		mergeSide{files: map[string]string{"foo": "a\nours\nc\n"}},
+		mergeSide{files: map[string]string{"foo": "a\ntheirs\nc\n"}},
+	)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	res, err := w.Merge(&MergeOptions{Reference: "refs/heads/theirs"})
+	c.Assert(err, Equals, ErrMergeConflict)
+	c.Assert(res.Conflicts, HasLen, 1)
+	c.Assert(res.Commit, Equals, plumbing.ZeroHash)
+
+	content, err := util.ReadFile(w.Filesystem, "foo")
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals,
+		"a\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> theirs\nc\n")
+
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.Entries, HasLen, 3)
+	for i, stage := range []index.Stage{index.AncestorMode, index.OurMode, index.TheirMode} {
+		c.Assert(idx.Entries[i].Name, Equals, "foo")
+		c.Assert(idx.Entries[i].Stage, Equals, stage)
+	}
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo").Staging, Equals, UpdatedButUnmerged)
+
+	mergeHead, err := r.Reference(plumbing.MergeHead, false)
+	c.Assert(err, IsNil)
+	c.Assert(mergeHead.Hash(), Equals, theirs.Hash)
+
+	_, err = w.Merge(&MergeOptions{Reference: "refs/heads/theirs"})
+	c.Assert(err, Equals, ErrMergeInProgress)
+
+	_, err = w.Commit("", &CommitOptions{Author: defaultSignature()})
+	c.Assert(err, Equals, ErrUnmergedPaths)
+
+	err = util.WriteFile(w.Filesystem, "foo", []byte("a\nresolved\nc\n"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo")
+	c.Assert(err, IsNil)
+
+	h, err := w.Commit("", &CommitOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	c.Assert(commit.ParentHashes, DeepEquals, []plumbing.Hash{ours.Hash, theirs.Hash})
+	c.Assert(commit.Message, Equals, "Merge branch 'theirs'")
+	c.Assert(strings.Contains(commit.Message, "Conflicts"), Equals, false)
+	assertTreeFiles(c, r, commit.TreeHash, map[string]string{"foo": "a\nresolved\nc\n"})
+
+	_, err = r.Reference(plumbing.MergeHead, false)
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+}
+
+func (s *MergeSuite) TestWorktreeMergeAbort(c *C) {
+	r, ours, _ := s.prepareMerge(c,
+		map[string]string{"foo": "a\nb\nc\n"},
+		mergeSide{files: map[string]string{"foo": "a\nours\nc\n"}},
+		mergeSide{files: map[string]string{"foo": "a\ntheirs\nc\n"}},
+	)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	_, err = w.Merge(&MergeOptions{Abort: true})
+	c.Assert(err, Equals, ErrNoMergeInProgress)
+
+	_, err = w.Merge(&MergeOptions{Reference: "refs/heads/theirs"})
+	c.Assert(err, Equals, ErrMergeConflict)
+
+	_, err = w.Merge(&MergeOptions{Abort: true})
+	c.Assert(err, IsNil)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash(), Equals, ours.Hash)
+
+	content, err := util.ReadFile(w.Filesystem, "foo")
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "a\nours\nc\n")
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+
+	_, err = r.Reference(plumbing.MergeHead, false)
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+}
+
+func (s *MergeSuite) TestWorktreeMergeStrategyOption(c *C) {
+	r, _, _ := s.prepareMerge(c,
+		map[string]string{"foo": "a\nb\nc\n"},
+		mergeSide{files: map[string]string{"foo": "a\nours\nc\n"}},
+		mergeSide{files: map[string]string{"foo": "a\ntheirs\nc\n"}},
+	)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	res, err := w.Merge(&MergeOptions{
+		Reference:      "refs/heads/theirs",
+		StrategyOption: TheirsStrategyOption,
+		Author:         defaultSignature(),
+	})
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(res.Commit)
+	c.Assert(err, IsNil)
+	assertTreeFiles(c, r, commit.TreeHash, map[string]string{"foo": "a\ntheirs\nc\n"})
+}
+
+func (s *MergeSuite) TestWorktreeMergeSquash(c *C) {
+	r, ours, _ := s.prepareMerge(c,
+		map[string]string{"foo": "foo\n"},
+		mergeSide{files: map[string]string{"qux": "qux\n"}},
+		mergeSide{files: map[string]string{"bar": "bar\n"}},
+	)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	res, err := w.Merge(&MergeOptions{Reference: "refs/heads/theirs", Squash: true})
+	c.Assert(err, IsNil)
+	c.Assert(res.Commit, Equals, plumbing.ZeroHash)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash(), Equals, ours.Hash)
+
+	h, err := w.Commit("", &CommitOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	c.Assert(commit.ParentHashes, DeepEquals, []plumbing.Hash{ours.Hash})
+	c.Assert(strings.HasPrefix(commit.Message, "Squashed commit of the following:"), Equals, true)
+	assertTreeFiles(c, r, commit.TreeHash, map[string]string{
+		"foo": "foo\n", "bar": "bar\n", "qux": "qux\n",
+	})
+}
+
+func (s *MergeSuite) TestWorktreeMergeNotClean(c *C) {
+	r, _, _ := s.prepareMerge(c,
+		map[string]string{"foo": "foo\n"},
+		mergeSide{files: map[string]string{"qux": "qux\n"}},
+		mergeSide{files: map[string]string{"foo": "bar\n"}},
+	)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	err = util.WriteFile(w.Filesystem, "foo", []byte("dirty\n"), 0644)
+	c.Assert(err, IsNil)
+
+	_, err = w.Merge(&MergeOptions{Reference: "refs/heads/theirs"})
+	c.Assert(err, Equals, ErrWorktreeNotClean)
+}
+
+func (s *MergeSuite) TestMergeOptionsValidate(c *C) {
+	c.Assert((&MergeOptions{}).Validate(), Equals, ErrMissingMergeSource)
+	c.Assert((&MergeOptions{
+		Reference:       "refs/heads/foo",
+		NoFastForward:   true,
+		FastForwardOnly: true,
+	}).Validate(), Equals, ErrFastForwardExclusive)
+	c.Assert((&MergeOptions{
+		Reference:     "refs/heads/foo",
+		Squash:        true,
+		NoFastForward: true,
+	}).Validate(), Equals, ErrSquashNoFastForward)
+	c.Assert((&MergeOptions{Abort: true}).Validate(), IsNil)
+}
@@ -0,0 +1,855 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var (
+	// ErrRebaseConflict is returned when the rebase stopped because a commit
+	// can't be applied cleanly. Once the conflicts are resolved and added to
+	// the index, the rebase can be resumed with RebaseOptions.Continue.
+	ErrRebaseConflict = errors.New("could not apply commit, resolve the conflicts and continue the rebase")
+	// ErrRebaseInProgress is returned when a rebase, or a merge, is attempted
+	// while another rebase hasn't been concluded or aborted.
+	ErrRebaseInProgress = errors.New("a rebase is already in progress")
+	// ErrNoRebaseInProgress is returned when continuing, skipping or aborting
+	// a rebase that doesn't exist.
+	ErrNoRebaseInProgress = errors.New("there is no rebase in progress")
+	// ErrMissingRebaseExec is returned by ExecRebaseAction entries when
+	// RebaseOptions.Exec is nil.
+	ErrMissingRebaseExec = errors.New("exec entry found but RebaseOptions.Exec is nil")
+	// ErrAmbiguousRebaseCommit is returned when the abbreviated commit of an
+	// entry of the todo list matches several commits.
+	ErrAmbiguousRebaseCommit = errors.New("abbreviated commit of the rebase todo is ambiguous")
+)
+
+const (
+	rebaseHeadNameFile = rebaseMergeDir + "/head-name"
+	rebaseOntoFile     = rebaseMergeDir + "/onto"
+	rebaseOrigHeadFile = rebaseMergeDir + "/orig-head"
+	rebaseTodoFile     = rebaseMergeDir + "/git-rebase-todo"
+	rebaseDoneFile     = rebaseMergeDir + "/done"
+	rebaseStoppedFile  = rebaseMergeDir + "/stopped-sha"
+	rebaseMessageFile  = rebaseMergeDir + "/message"
+	rebaseAmendFile    = rebaseMergeDir + "/amend"
+	rebaseMessagesDir  = rebaseMergeDir + "/messages"
+	rebaseDetachedHEAD = "detached HEAD"
+
+	fixupPrefix  = "fixup! "
+	squashPrefix = "squash! "
+)
+
+// RebaseResult is the outcome of a Worktree.Rebase.
+type RebaseResult struct {
+	// Head is the commit HEAD points to after the rebase, or at the point
+	// the rebase stopped.
+	Head plumbing.Hash
+	// Stopped is the commit that couldn't be applied, if the rebase stopped
+	// because of conflicts.
+	Stopped plumbing.Hash
+	// Conflicts found applying Stopped, sorted by path.
+	Conflicts []*MergeConflict
+}
+
+// Rebase replays the commits reachable from HEAD but not from
+// RebaseOptions.Upstream on top of RebaseOptions.Onto, following the todo
+// list, and updates the current branch to the result.
+//
+// During the rebase HEAD is detached and the state is kept in the
+// rebase-merge directory of the git directory. If a commit can't be applied
+// cleanly the rebase stops, the index contains the stages of the conflicting
+// paths and ErrRebaseConflict is returned along with the conflicts; it can
+// then be resumed with RebaseOptions.Continue or RebaseOptions.Skip, or
+// aborted with RebaseOptions.Abort.
+func (w *Worktree) Rebase(opts *RebaseOptions) (*RebaseResult, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case opts.Abort:
+		return nil, w.abortRebase()
+	case opts.Continue:
+		return w.continueRebase(opts)
+	case opts.Skip:
+		return w.skipRebase(opts)
+	}
+
+	if err := w.checkNoOperationInProgress(); err != nil {
+		return nil, err
+	}
+
+	if err := w.checkCleanForMerge(); err != nil {
+		return nil, err
+	}
+
+	committer, err := w.rebaseCommitter(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := w.r.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return nil, err
+	}
+
+	headName := rebaseDetachedHEAD
+	if head.Type() == plumbing.SymbolicReference {
+		headName = head.Target().String()
+	}
+
+	if head, err = w.r.Head(); err != nil {
+		return nil, err
+	}
+
+	onto, err := w.r.resolveToCommitHash(opts.Onto)
+	if err != nil {
+		return nil, err
+	}
+
+	todo := opts.Todo
+	if len(todo) == 0 {
+		if todo, err = w.RebaseTodo(opts); err != nil {
+			return nil, err
+		}
+	}
+
+	state := map[string]string{
+		rebaseHeadNameFile: headName,
+		rebaseOntoFile:     onto.String(),
+		rebaseOrigHeadFile: head.Hash().String(),
+		rebaseDoneFile:     "",
+	}
+
+	for name, content := range state {
+		if err := w.r.writeStateFile(name, content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.writeRebaseTodo(todo); err != nil {
+		return nil, err
+	}
+
+	// HEAD is detached at onto while the commits are replayed
+	if err := w.r.Storer.SetReference(plumbing.NewHashReference(plumbing.HEAD, head.Hash())); err != nil {
+		return nil, err
+	}
+
+	if err := w.checkoutCommit(onto, "rebase (start): checkout "+onto.String(), committer); err != nil {
+		return nil, err
+	}
+
+	return w.runRebase(opts, committer)
+}
+
+// rebaseCommitter returns the committer of the rebased commits, and of the
+// updates of the references made by the rebase.
+func (w *Worktree) rebaseCommitter(opts *RebaseOptions) (*object.Signature, error) {
+	co := &CommitOptions{Author: opts.Committer, Committer: opts.Committer}
+	if err := co.Validate(w.r); err != nil {
+		return nil, err
+	}
+
+	return co.Committer, nil
+}
+
+// RebaseTodo returns the default todo list of the rebase described by opts,
+// picking every commit reachable from HEAD but not from Upstream, oldest
+// first. Merge commits are skipped, as git-rebase does by default.
+func (w *Worktree) RebaseTodo(opts *RebaseOptions) ([]RebaseTodo, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	head, err := w.r.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	headCommit, err := w.r.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	upstream, err := w.r.CommitObject(opts.Upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	commits, err := rebaseCommits(headCommit, upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Autosquash {
+		return autosquash(commits), nil
+	}
+
+	todo := make([]RebaseTodo, len(commits))
+	for i, c := range commits {
+		todo[i] = RebaseTodo{Action: PickRebaseAction, Commit: c.Hash}
+	}
+
+	return todo, nil
+}
+
+// rebaseCommits returns the commits reachable from head but not from
+// upstream, oldest first, following the first parent and skipping the merge
+// commits.
+func rebaseCommits(head, upstream *object.Commit) ([]*object.Commit, error) {
+	bases, err := head.MergeBase(upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := make(map[plumbing.Hash]bool)
+	for _, b := range bases {
+		stop[b.Hash] = true
+	}
+
+	var commits []*object.Commit
+	for c := head; !stop[c.Hash]; {
+		if c.NumParents() > 1 {
+			// the merge base may not be reachable through the first parent
+			reachable, err := c.IsAncestor(upstream)
+			if err != nil {
+				return nil, err
+			}
+
+			if reachable {
+				break
+			}
+		} else {
+			commits = append(commits, c)
+		}
+
+		if c.NumParents() == 0 {
+			break
+		}
+
+		if c, err = c.Parent(0); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+
+	return commits, nil
+}
+
+// autosquash returns a todo list picking the given commits, where the ones
+// with a subject starting with "fixup! " or "squash! " are moved after the
+// commit they refer to, by subject or by hash prefix.
+func autosquash(commits []*object.Commit) []RebaseTodo {
+	var todo []RebaseTodo
+	melded := make(map[plumbing.Hash][]RebaseTodo)
+	var targets []*object.Commit
+	for _, c := range commits {
+		action, target := autosquashTarget(c, targets)
+		if target == nil {
+			targets = append(targets, c)
+			todo = append(todo, RebaseTodo{Action: PickRebaseAction, Commit: c.Hash})
+			continue
+		}
+
+		melded[target.Hash] = append(melded[target.Hash], RebaseTodo{Action: action, Commit: c.Hash})
+	}
+
+	var result []RebaseTodo
+	for _, t := range todo {
+		result = append(result, t)
+		result = append(result, melded[t.Commit]...)
+	}
+
+	return result
+}
+
+func autosquashTarget(c *object.Commit, candidates []*object.Commit) (RebaseAction, *object.Commit) {
+	subject := commitSubject(c.Message)
+
+	var action RebaseAction
+	switch {
+	case strings.HasPrefix(subject, fixupPrefix):
+		action = FixupRebaseAction
+	case strings.HasPrefix(subject, squashPrefix):
+		action = SquashRebaseAction
+	default:
+		return PickRebaseAction, nil
+	}
+
+	// fixup! fixup! foo refers to foo
+	for strings.HasPrefix(subject, fixupPrefix) || strings.HasPrefix(subject, squashPrefix) {
+		subject = strings.TrimPrefix(subject, fixupPrefix)
+		subject = strings.TrimPrefix(subject, squashPrefix)
+	}
+
+	for _, t := range candidates {
+		if commitSubject(t.Message) == subject {
+			return action, t
+		}
+	}
+
+	for _, t := range candidates {
+		if len(subject) >= 4 && strings.HasPrefix(t.Hash.String(), subject) {
+			return action, t
+		}
+	}
+
+	return PickRebaseAction, nil
+}
+
+func commitSubject(msg string) string {
+	return strings.TrimSpace(strings.SplitN(msg, "\n", 2)[0])
+}
+
+// runRebase performs the pending entries of the todo list, finishing the
+// rebase once all of them are done.
+func (w *Worktree) runRebase(opts *RebaseOptions, committer *object.Signature) (*RebaseResult, error) {
+	for {
+		todo, err := w.readRebaseTodo()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(todo) == 0 {
+			break
+		}
+
+		t := todo[0]
+		if err := w.writeRebaseTodo(todo[1:]); err != nil {
+			return nil, err
+		}
+
+		if err := w.appendRebaseDone(t); err != nil {
+			return nil, err
+		}
+
+		res, err := w.applyRebaseTodo(opts, committer, t)
+		if err != nil {
+			return res, err
+		}
+	}
+
+	return w.finishRebase(committer)
+}
+
+func (w *Worktree) applyRebaseTodo(opts *RebaseOptions, committer *object.Signature, t RebaseTodo) (*RebaseResult, error) {
+	head, err := w.r.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t.Action {
+	case DropRebaseAction:
+		return nil, nil
+	case ExecRebaseAction:
+		if opts.Exec == nil {
+			return &RebaseResult{Head: head.Hash()}, ErrMissingRebaseExec
+		}
+
+		return &RebaseResult{Head: head.Hash()}, opts.Exec(w, t.Command)
+	}
+
+	current, err := w.r.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := w.r.CommitObject(t.Commit)
+	if err != nil {
+		return nil, err
+	}
+
+	var bases []*object.Commit
+	if c.NumParents() > 0 {
+		parent, err := c.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+
+		// the commit already applies on top of HEAD, it is reused as it is
+		if t.Action == PickRebaseAction && parent.Hash == current.Hash {
+			return nil, w.checkoutCommit(c.Hash, "rebase (pick): "+commitSubject(c.Message), committer)
+		}
+
+		bases = append(bases, parent)
+	}
+
+	res, err := w.r.mergeCommits(bases, current, c, &MergeTreesOptions{
+		OursLabel:      string(plumbing.HEAD),
+		TheirsLabel:    fmt.Sprintf("%s (%s)", c.Hash.String()[:7], commitSubject(c.Message)),
+		StrategyOption: opts.StrategyOption,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.checkoutMergeResult(res); err != nil {
+		return nil, err
+	}
+
+	msg := c.Message
+	switch t.Action {
+	case SquashRebaseAction:
+		msg = strings.TrimRight(current.Message, "\n") + "\n\n" + c.Message
+	case FixupRebaseAction:
+		msg = current.Message
+	}
+
+	if t.Message != "" {
+		msg = t.Message
+	}
+
+	amend := t.Action == SquashRebaseAction || t.Action == FixupRebaseAction
+	if !res.IsClean() {
+		return &RebaseResult{
+			Head:      current.Hash,
+			Stopped:   c.Hash,
+			Conflicts: res.Conflicts,
+		}, w.writeRebaseStop(c, current, msg, amend)
+	}
+
+	return nil, w.commitRebaseStep(c, current, msg, amend, committer, res.Tree)
+}
+
+// commitRebaseStep commits tree as the result of applying c on top of
+// current, or melded into current if amend.
+func (w *Worktree) commitRebaseStep(c, current *object.Commit, msg string, amend bool, committer *object.Signature, tree plumbing.Hash) error {
+	opts := &CommitOptions{
+		Author:    &c.Author,
+		Committer: committer,
+		Parents:   []plumbing.Hash{current.Hash},
+	}
+
+	if amend {
+		opts.Author = &current.Author
+		opts.Parents = current.ParentHashes
+	} else if tree == current.TreeHash {
+		// the changes are already in HEAD, the commit is dropped
+		return nil
+	}
+
+	h, err := w.buildCommitObject(msg, opts, tree)
+	if err != nil {
+		return err
+	}
+
+	action := PickRebaseAction
+	if amend {
+		action = SquashRebaseAction
+	}
+
+	return w.updateHEAD(h, fmt.Sprintf("rebase (%s): %s", action, commitSubject(msg)), committer)
+}
+
+func (w *Worktree) writeRebaseStop(c, current *object.Commit, msg string, amend bool) error {
+	if err := w.r.writeStateFile(rebaseStoppedFile, c.Hash.String()); err != nil {
+		return err
+	}
+
+	if err := w.writeRebaseMessage(rebaseMessageFile, msg); err != nil {
+		return err
+	}
+
+	if amend {
+		if err := w.r.writeStateFile(rebaseAmendFile, current.Hash.String()); err != nil {
+			return err
+		}
+	}
+
+	return ErrRebaseConflict
+}
+
+func (w *Worktree) removeRebaseStop() error {
+	return w.r.removeStateFile(rebaseStoppedFile, rebaseMessageFile, rebaseAmendFile)
+}
+
+// finishRebase points the rebased branch to HEAD and checks it out.
+func (w *Worktree) finishRebase(committer *object.Signature) (*RebaseResult, error) {
+	head, err := w.r.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	headName, err := w.r.readStateFile(rebaseHeadNameFile)
+	if err != nil {
+		return nil, err
+	}
+
+	origHead, err := w.r.readStateFile(rebaseOrigHeadFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.restoreRebaseHead("finish", strings.TrimSpace(headName), head.Hash(), committer); err != nil {
+		return nil, err
+	}
+
+	orig := plumbing.NewHash(strings.TrimSpace(origHead))
+	if err := w.r.Storer.SetReference(plumbing.NewHashReference(plumbing.OrigHead, orig)); err != nil {
+		return nil, err
+	}
+
+	return &RebaseResult{Head: head.Hash()}, w.r.removeStateFile(rebaseMergeDir)
+}
+
+// restoreRebaseHead points HEAD to the given branch, updated to h, or
+// detached at h. The updates are logged as the given rebase action, made by
+// committer.
+func (w *Worktree) restoreRebaseHead(action, headName string, h plumbing.Hash, committer *object.Signature) error {
+	if headName == rebaseDetachedHEAD {
+		msg := fmt.Sprintf("rebase (%s): returning to %s", action, h)
+		return w.r.setReference(plumbing.NewHashReference(plumbing.HEAD, h), msg, committer)
+	}
+
+	branch := plumbing.ReferenceName(headName)
+	msg := fmt.Sprintf("rebase (%s): %s", action, branch)
+	if err := w.r.setReference(plumbing.NewHashReference(branch, h), msg, committer); err != nil {
+		return err
+	}
+
+	msg = fmt.Sprintf("rebase (%s): returning to %s", action, branch)
+	return w.r.setReference(plumbing.NewSymbolicReference(plumbing.HEAD, branch), msg, committer)
+}
+
+func (w *Worktree) isRebasing() (bool, error) {
+	onto, err := w.r.readStateFile(rebaseOntoFile)
+	return onto != "", err
+}
+
+// checkNoOperationInProgress returns an error if a merge, a rebase, a
+// cherry-pick or a revert is in progress.
+func (w *Worktree) checkNoOperationInProgress() error {
+	rebasing, err := w.isRebasing()
+	if err != nil {
+		return err
+	}
+
+	if rebasing {
+		return ErrRebaseInProgress
+	}
+
+	merging, err := w.isMerging()
+	if err != nil {
+		return err
+	}
+
+	if merging {
+		return ErrMergeInProgress
+	}
+
+	picking, err := w.isPicking()
+	if err != nil {
+		return err
+	}
+
+	if picking {
+		return ErrSequencerInProgress
+	}
+
+	return nil
+}
+
+func (w *Worktree) continueRebase(opts *RebaseOptions) (*RebaseResult, error) {
+	rebasing, err := w.isRebasing()
+	if err != nil {
+		return nil, err
+	}
+
+	if !rebasing {
+		return nil, ErrNoRebaseInProgress
+	}
+
+	committer, err := w.rebaseCommitter(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	stopped, err := w.r.readStateFile(rebaseStoppedFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if stopped != "" {
+		if err := w.commitRebaseStop(committer, plumbing.NewHash(strings.TrimSpace(stopped))); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.removeRebaseStop(); err != nil {
+		return nil, err
+	}
+
+	return w.runRebase(opts, committer)
+}
+
+// commitRebaseStop commits the content of the index, where the conflicts
+// found applying the stopped commit have been resolved.
+func (w *Worktree) commitRebaseStop(committer *object.Signature, stopped plumbing.Hash) error {
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	if err := checkNoUnmergedEntries(idx); err != nil {
+		return err
+	}
+
+	h := &buildTreeHelper{fs: w.Filesystem, s: w.r.Storer}
+	tree, err := h.BuildTree(idx, &CommitOptions{AllowEmptyCommits: true})
+	if err != nil {
+		return err
+	}
+
+	c, err := w.r.CommitObject(stopped)
+	if err != nil {
+		return err
+	}
+
+	head, err := w.r.Head()
+	if err != nil {
+		return err
+	}
+
+	current, err := w.r.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+
+	msg, err := w.r.readStateFile(rebaseMessageFile)
+	if err != nil {
+		return err
+	}
+
+	amend, err := w.r.readStateFile(rebaseAmendFile)
+	if err != nil {
+		return err
+	}
+
+	return w.commitRebaseStep(c, current, msg, amend != "", committer, tree)
+}
+
+func (w *Worktree) skipRebase(opts *RebaseOptions) (*RebaseResult, error) {
+	rebasing, err := w.isRebasing()
+	if err != nil {
+		return nil, err
+	}
+
+	if !rebasing {
+		return nil, ErrNoRebaseInProgress
+	}
+
+	committer, err := w.rebaseCommitter(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.Reset(&ResetOptions{Mode: HardReset}); err != nil {
+		return nil, err
+	}
+
+	if err := w.removeRebaseStop(); err != nil {
+		return nil, err
+	}
+
+	return w.runRebase(opts, committer)
+}
+
+// abortRebase restores the original branch, the index and the worktree to
+// the state previous to the rebase.
+func (w *Worktree) abortRebase() error {
+	rebasing, err := w.isRebasing()
+	if err != nil {
+		return err
+	}
+
+	if !rebasing {
+		return ErrNoRebaseInProgress
+	}
+
+	headName, err := w.r.readStateFile(rebaseHeadNameFile)
+	if err != nil {
+		return err
+	}
+
+	origHead, err := w.r.readStateFile(rebaseOrigHeadFile)
+	if err != nil {
+		return err
+	}
+
+	orig := plumbing.NewHash(strings.TrimSpace(origHead))
+	committer := reflogCommitter(w.r.Storer, nil)
+	if err := w.restoreRebaseHead("abort", strings.TrimSpace(headName), orig, committer); err != nil {
+		return err
+	}
+
+	if err := w.Reset(&ResetOptions{Mode: HardReset, Commit: orig}); err != nil {
+		return err
+	}
+
+	return w.r.removeStateFile(rebaseMergeDir)
+}
+
+func (w *Worktree) readRebaseTodo() ([]RebaseTodo, error) {
+	content, err := w.r.readStateFile(rebaseTodoFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var todo []RebaseTodo
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		t, err := w.parseRebaseTodo(line)
+		if err != nil {
+			return nil, err
+		}
+
+		if !t.Commit.IsZero() {
+			if t.Message, err = w.r.readStateFile(rebaseMessageName(len(todo))); err != nil {
+				return nil, err
+			}
+		}
+
+		todo = append(todo, t)
+	}
+
+	picked, err := w.rebasePicked()
+	if err != nil {
+		return nil, err
+	}
+
+	return todo, checkRebaseTodoPrevious(todo, picked)
+}
+
+// rebasePicked returns true if any of the entries already done picked a
+// commit, so the next entries can squash or fixup into it.
+func (w *Worktree) rebasePicked() (bool, error) {
+	done, err := w.r.readStateFile(rebaseDoneFile)
+	if err != nil {
+		return false, err
+	}
+
+	for _, line := range strings.Split(done, "\n") {
+		switch strings.SplitN(line, " ", 2)[0] {
+		case PickRebaseAction.String(), RewordRebaseAction.String():
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// parseRebaseTodo parses a line of a todo list, like `pick 8ab686e` or
+// `exec make test`. The commit may be abbreviated, as it is in the todo
+// lists written by git.
+func (w *Worktree) parseRebaseTodo(line string) (RebaseTodo, error) {
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) != 2 {
+		return RebaseTodo{}, ErrInvalidRebaseTodo
+	}
+
+	t := RebaseTodo{Action: -1}
+	for i, name := range rebaseActionNames {
+		if parts[0] == name || parts[0] == rebaseActionShortNames[i] {
+			t.Action = RebaseAction(i)
+		}
+	}
+
+	if t.Action == ExecRebaseAction {
+		t.Command = parts[1]
+		return t, t.Validate()
+	}
+
+	fields := strings.Fields(parts[1])
+	if t.Action < 0 || len(fields) == 0 {
+		return RebaseTodo{}, ErrInvalidRebaseTodo
+	}
+
+	h, err := w.resolveRebaseCommit(fields[0])
+	if err != nil {
+		return RebaseTodo{}, err
+	}
+
+	t.Commit = h
+	return t, nil
+}
+
+// resolveRebaseCommit returns the commit the given full or abbreviated hash
+// refers to.
+func (w *Worktree) resolveRebaseCommit(id string) (plumbing.Hash, error) {
+	var commits []plumbing.Hash
+	for _, h := range w.r.resolveHashPrefix(id) {
+		if _, err := w.r.CommitObject(h); err == nil {
+			commits = append(commits, h)
+		}
+	}
+
+	switch len(commits) {
+	case 0:
+		return plumbing.ZeroHash, plumbing.ErrObjectNotFound
+	case 1:
+		return commits[0], nil
+	}
+
+	return plumbing.ZeroHash, ErrAmbiguousRebaseCommit
+}
+
+// writeRebaseTodo writes the todo list, along with the message of each
+// entry having one, stored by the position of the entry as several entries
+// may refer to the same commit.
+func (w *Worktree) writeRebaseTodo(todo []RebaseTodo) error {
+	if err := w.r.removeStateFile(rebaseMessagesDir); err != nil {
+		return err
+	}
+
+	var lines []string
+	for i, t := range todo {
+		lines = append(lines, t.String())
+
+		if t.Message == "" || t.Commit.IsZero() {
+			continue
+		}
+
+		if err := w.writeRebaseMessage(rebaseMessageName(i), t.Message); err != nil {
+			return err
+		}
+	}
+
+	return w.r.writeStateFile(rebaseTodoFile, strings.Join(lines, "\n"))
+}
+
+// rebaseMessageName returns the name of the file with the message of the
+// entry of the todo list at the given position.
+func rebaseMessageName(i int) string {
+	return path.Join(rebaseMessagesDir, strconv.Itoa(i))
+}
+
+func (w *Worktree) appendRebaseDone(t RebaseTodo) error {
+	done, err := w.r.readStateFile(rebaseDoneFile)
+	if err != nil {
+		return err
+	}
+
+	return w.r.writeStateFile(rebaseDoneFile, done+t.String())
+}
+
+// writeRebaseMessage writes a commit message to the state of the rebase, as
+// it is, contrary to writeStateFile.
+func (w *Worktree) writeRebaseMessage(name, msg string) error {
+	return util.WriteFile(w.r.dotGitFilesystem(), name, []byte(msg), 0644)
+}
@@ -0,0 +1,437 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+type RebaseSuite struct{}
+
+var _ = Suite(&RebaseSuite{})
+
+// prepareDivergedBranches creates a repository with a base commit, a branch
+// called `upstream` with a commit on top of it, and master with the given
+// commits on top of base.
+func prepareDivergedBranches(c *C, upstream map[string]string, commits ...rebaseCommit) (*Repository, *Worktree, plumbing.Hash, []plumbing.Hash) {
+	r, w := newMemoryWorktree(c)
+
+	base := commitFiles(c, w, "base", map[string]string{"foo": "a\nb\nc\n"})
+	err := r.Storer.SetReference(plumbing.NewHashReference("refs/heads/upstream", base))
+	c.Assert(err, IsNil)
+
+	var hashes []plumbing.Hash
+	for _, commit := range commits {
+		hashes = append(hashes, commitFiles(c, w, commit.msg, commit.files))
+	}
+
+	err = w.Checkout(&CheckoutOptions{Branch: "refs/heads/upstream"})
+	c.Assert(err, IsNil)
+	up := commitFiles(c, w, "upstream", upstream)
+
+	err = w.Checkout(&CheckoutOptions{Branch: plumbing.Master})
+	c.Assert(err, IsNil)
+
+	return r, w, up, hashes
+}
+
+type rebaseCommit struct {
+	msg   string
+	files map[string]string
+}
+
+// assertHistory checks the messages of the first-parent history of HEAD,
+// from HEAD to the commit after stop.
+func assertHistory(c *C, r *Repository, stop plumbing.Hash, msgs ...string) *object.Commit {
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(head.Hash())
+	c.Assert(err, IsNil)
+
+	var found []string
+	for current := commit; current.Hash != stop; {
+		found = append(found, current.Message)
+		current, err = current.Parent(0)
+		c.Assert(err, IsNil)
+	}
+
+	c.Assert(found, DeepEquals, msgs)
+	return commit
+}
+
+func (s *RebaseSuite) TestRebase(c *C) {
+	r, w, up, hashes := prepareDivergedBranches(c,
+		map[string]string{"up": "up\n"},
+		rebaseCommit{"bar", map[string]string{"bar": "bar\n"}},
+		rebaseCommit{"baz", map[string]string{"baz": "baz\n"}},
+	)
+
+	res, err := w.Rebase(&RebaseOptions{Upstream: up, Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Name(), Equals, plumbing.Master)
+	c.Assert(head.Hash(), Equals, res.Head)
+
+	commit := assertHistory(c, r, up, "baz", "bar")
+	original, err := r.CommitObject(hashes[1])
+	c.Assert(err, IsNil)
+	c.Assert(commit.Author, DeepEquals, original.Author)
+	assertTreeFiles(c, r, commit.TreeHash, map[string]string{
+		"foo": "a\nb\nc\n", "up": "up\n", "bar": "bar\n", "baz": "baz\n",
+	})
+
+	orig, err := r.Reference(plumbing.OrigHead, false)
+	c.Assert(err, IsNil)
+	c.Assert(orig.Hash(), Equals, hashes[1])
+
+	_, err = w.r.dotGitFilesystem().Stat(rebaseMergeDir)
+	c.Assert(err, NotNil)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+}
+
+func (s *RebaseSuite) TestRebaseOnto(c *C) {
+	r, w, up, hashes := prepareDivergedBranches(c,
+		map[string]string{"up": "up\n"},
+		rebaseCommit{"bar", map[string]string{"bar": "bar\n"}},
+		rebaseCommit{"baz", map[string]string{"baz": "baz\n"}},
+	)
+
+	_, err := w.Rebase(&RebaseOptions{Upstream: hashes[0], Onto: up, Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	commit := assertHistory(c, r, up, "baz")
+	assertTreeFiles(c, r, commit.TreeHash, map[string]string{
+		"foo": "a\nb\nc\n", "up": "up\n", "baz": "baz\n",
+	})
+}
+
+func (s *RebaseSuite) TestRebaseConflictContinue(c *C) {
+	r, w, up, hashes := prepareDivergedBranches(c,
+		map[string]string{"foo": "a\nup\nc\n"},
+		rebaseCommit{"foo", map[string]string{"foo": "a\nours\nc\n"}},
+		rebaseCommit{"bar", map[string]string{"bar": "bar\n"}},
+	)
+
+	res, err := w.Rebase(&RebaseOptions{
+		Upstream:  up,
+		Committer: defaultSignature(),
+		Todo: []RebaseTodo{
+			{Action: PickRebaseAction, Commit: hashes[0]},
+			{Action: RewordRebaseAction, Commit: hashes[1], Message: "bar reworded"},
+		},
+	})
+	c.Assert(err, Equals, ErrRebaseConflict)
+	c.Assert(res.Head, Equals, up)
+	c.Assert(res.Stopped, Equals, hashes[0])
+	c.Assert(res.Conflicts, HasLen, 1)
+
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	c.Assert(err, IsNil)
+	c.Assert(head.Type(), Equals, plumbing.HashReference)
+
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.Entries, HasLen, 3)
+	c.Assert(idx.Entries[0].Stage, Equals, index.AncestorMode)
+
+	_, err = w.Rebase(&RebaseOptions{Upstream: up})
+	c.Assert(err, Equals, ErrRebaseInProgress)
+
+	_, err = w.Merge(&MergeOptions{Commit: up})
+	c.Assert(err, Equals, ErrRebaseInProgress)
+
+	_, err = w.Rebase(&RebaseOptions{Continue: true, Committer: defaultSignature()})
+	c.Assert(err, Equals, ErrUnmergedPaths)
+
+	err = util.WriteFile(w.Filesystem, "foo", []byte("a\nresolved\nc\n"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo")
+	c.Assert(err, IsNil)
+
+	_, err = w.Rebase(&RebaseOptions{Continue: true, Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	commit := assertHistory(c, r, up, "bar reworded", "foo")
+	assertTreeFiles(c, r, commit.TreeHash, map[string]string{
+		"foo": "a\nresolved\nc\n", "bar": "bar\n",
+	})
+
+	ref, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(ref.Name(), Equals, plumbing.Master)
+}
+
+func (s *RebaseSuite) TestRebaseSkip(c *C) {
+	r, w, up, _ := prepareDivergedBranches(c,
+		map[string]string{"foo": "a\nup\nc\n"},
+		rebaseCommit{"foo", map[string]string{"foo": "a\nours\nc\n"}},
+		rebaseCommit{"bar", map[string]string{"bar": "bar\n"}},
+	)
+
+	_, err := w.Rebase(&RebaseOptions{Upstream: up, Committer: defaultSignature()})
+	c.Assert(err, Equals, ErrRebaseConflict)
+
+	_, err = w.Rebase(&RebaseOptions{Skip: true, Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	commit := assertHistory(c, r, up, "bar")
+	assertTreeFiles(c, r, commit.TreeHash, map[string]string{
+		"foo": "a\nup\nc\n", "bar": "bar\n",
+	})
+}
+
+func (s *RebaseSuite) TestRebaseAbort(c *C) {
+	r, w, up, hashes := prepareDivergedBranches(c,
+		map[string]string{"foo": "a\nup\nc\n"},
+		rebaseCommit{"bar", map[string]string{"bar": "bar\n"}},
+		rebaseCommit{"foo", map[string]string{"foo": "a\nours\nc\n"}},
+	)
+
+	_, err := w.Rebase(&RebaseOptions{Abort: true})
+	c.Assert(err, Equals, ErrNoRebaseInProgress)
+
+	_, err = w.Rebase(&RebaseOptions{Upstream: up, Committer: defaultSignature()})
+	c.Assert(err, Equals, ErrRebaseConflict)
+
+	_, err = w.Rebase(&RebaseOptions{Abort: true})
+	c.Assert(err, IsNil)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Name(), Equals, plumbing.Master)
+	c.Assert(head.Hash(), Equals, hashes[1])
+
+	content, err := util.ReadFile(w.Filesystem, "foo")
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "a\nours\nc\n")
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+}
+
+func (s *RebaseSuite) TestRebaseTodo(c *C) {
+	r, w, up, hashes := prepareDivergedBranches(c,
+		map[string]string{"up": "up\n"},
+		rebaseCommit{"bar", map[string]string{"bar": "bar\n"}},
+		rebaseCommit{"bar 2", map[string]string{"bar": "bar 2\n"}},
+		rebaseCommit{"bar 3", map[string]string{"bar": "bar 3\n"}},
+		rebaseCommit{"qux", map[string]string{"qux": "qux\n"}},
+		rebaseCommit{"baz", map[string]string{"baz": "baz\n"}},
+	)
+
+	var commands []string
+	_, err := w.Rebase(&RebaseOptions{
+		Upstream:  up,
+		Committer: defaultSignature(),
+		Todo: []RebaseTodo{
+			{Action: RewordRebaseAction, Commit: hashes[0], Message: "reworded"},
+			{Action: SquashRebaseAction, Commit: hashes[1]},
+			{Action: FixupRebaseAction, Commit: hashes[2]},
+			{Action: DropRebaseAction, Commit: hashes[3]},
+			{Action: ExecRebaseAction, Command: "test"},
+			{Action: PickRebaseAction, Commit: hashes[4]},
+		},
+		Exec: func(w *Worktree, command string) error {
+			_, err := w.Filesystem.Stat("bar")
+			c.Assert(err, IsNil)
+
+			commands = append(commands, command)
+			return nil
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(commands, DeepEquals, []string{"test"})
+
+	commit := assertHistory(c, r, up, "baz", "reworded\n\nbar 2")
+	assertTreeFiles(c, r, commit.TreeHash, map[string]string{
+		"foo": "a\nb\nc\n", "up": "up\n", "bar": "bar 3\n", "baz": "baz\n",
+	})
+}
+
+func (s *RebaseSuite) TestRebaseExecError(c *C) {
+	r, w, up, hashes := prepareDivergedBranches(c,
+		map[string]string{"up": "up\n"},
+		rebaseCommit{"bar", map[string]string{"bar": "bar\n"}},
+		rebaseCommit{"baz", map[string]string{"baz": "baz\n"}},
+	)
+
+	errExec := errors.New("exec failed")
+	todo := []RebaseTodo{
+		{Action: PickRebaseAction, Commit: hashes[0]},
+		{Action: ExecRebaseAction, Command: "fail"},
+		{Action: PickRebaseAction, Commit: hashes[1]},
+	}
+
+	_, err := w.Rebase(&RebaseOptions{
+		Upstream:  up,
+		Committer: defaultSignature(),
+		Todo:      todo,
+		Exec:      func(*Worktree, string) error { return errExec },
+	})
+	c.Assert(err, Equals, errExec)
+	assertHistory(c, r, up, "bar")
+
+	_, err = w.Rebase(&RebaseOptions{Continue: true, Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+	assertHistory(c, r, up, "baz", "bar")
+}
+
+func (s *RebaseSuite) TestRebaseAutosquash(c *C) {
+	r, w, up, _ := prepareDivergedBranches(c,
+		map[string]string{"up": "up\n"},
+		rebaseCommit{"bar", map[string]string{"bar": "bar\n"}},
+		rebaseCommit{"baz", map[string]string{"baz": "baz\n"}},
+		rebaseCommit{"fixup! bar", map[string]string{"bar": "bar fixed\n"}},
+		rebaseCommit{"squash! fixup! bar", map[string]string{"bar": "bar squashed\n"}},
+	)
+
+	opts := &RebaseOptions{Upstream: up, Autosquash: true, Committer: defaultSignature()}
+	todo, err := w.RebaseTodo(opts)
+	c.Assert(err, IsNil)
+	c.Assert(todo, HasLen, 4)
+	c.Assert(todo[1].Action, Equals, FixupRebaseAction)
+	c.Assert(todo[2].Action, Equals, SquashRebaseAction)
+
+	_, err = w.Rebase(opts)
+	c.Assert(err, IsNil)
+
+	commit := assertHistory(c, r, up, "baz", "bar\n\nsquash! fixup! bar")
+	assertTreeFiles(c, r, commit.TreeHash, map[string]string{
+		"foo": "a\nb\nc\n", "up": "up\n", "bar": "bar squashed\n", "baz": "baz\n",
+	})
+}
+
+func (s *RebaseSuite) TestParseRebaseTodo(c *C) {
+	_, w, _, hashes := prepareDivergedBranches(c,
+		map[string]string{"up": "up\n"},
+		rebaseCommit{"bar", map[string]string{"bar": "bar\n"}},
+	)
+
+	h := hashes[0]
+	t, err := w.parseRebaseTodo("p " + h.String() + " some subject")
+	c.Assert(err, IsNil)
+	c.Assert(t, DeepEquals, RebaseTodo{Action: PickRebaseAction, Commit: h})
+
+	t, err = w.parseRebaseTodo("pick " + h.String()[:7] + " some subject")
+	c.Assert(err, IsNil)
+	c.Assert(t, DeepEquals, RebaseTodo{Action: PickRebaseAction, Commit: h})
+
+	t, err = w.parseRebaseTodo("exec make test")
+	c.Assert(err, IsNil)
+	c.Assert(t, DeepEquals, RebaseTodo{Action: ExecRebaseAction, Command: "make test"})
+
+	_, err = w.parseRebaseTodo("foo " + h.String())
+	c.Assert(err, Equals, ErrInvalidRebaseTodo)
+
+	_, err = w.parseRebaseTodo("pick")
+	c.Assert(err, Equals, ErrInvalidRebaseTodo)
+
+	_, err = w.parseRebaseTodo("pick 8ab686eafeb1f44702738c8b0f24f2567c36da6d")
+	c.Assert(err, Equals, plumbing.ErrObjectNotFound)
+}
+
+func (s *RebaseSuite) TestParseRebaseTodoAmbiguous(c *C) {
+	_, w := newMemoryWorktree(c)
+
+	// with 17 commits two of them share the first digit of their hash
+	prefixes := make(map[byte]bool)
+	for i := 0; ; i++ {
+		h := commitFiles(c, w, fmt.Sprint(i), map[string]string{"foo": fmt.Sprint(i)})
+		prefix := h.String()[0]
+		if !prefixes[prefix] {
+			prefixes[prefix] = true
+			continue
+		}
+
+		_, err := w.parseRebaseTodo("pick " + string(prefix))
+		c.Assert(err, Equals, ErrAmbiguousRebaseCommit)
+		break
+	}
+}
+
+func (s *RebaseSuite) TestRebaseTodoNoPrevious(c *C) {
+	r, w, up, hashes := prepareDivergedBranches(c,
+		map[string]string{"up": "up\n"},
+		rebaseCommit{"bar", map[string]string{"bar": "bar\n"}},
+		rebaseCommit{"baz", map[string]string{"baz": "baz\n"}},
+	)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+
+	for _, action := range []RebaseAction{SquashRebaseAction, FixupRebaseAction} {
+		_, err = w.Rebase(&RebaseOptions{
+			Upstream:  up,
+			Committer: defaultSignature(),
+			Todo: []RebaseTodo{
+				{Action: ExecRebaseAction, Command: "true"},
+				{Action: action, Commit: hashes[0]},
+				{Action: PickRebaseAction, Commit: hashes[1]},
+			},
+		})
+		c.Assert(err, Equals, ErrRebaseTodoNoPrevious)
+
+		current, err := r.Head()
+		c.Assert(err, IsNil)
+		c.Assert(current, DeepEquals, head)
+	}
+
+	// the entries done are taken into account when reading the todo list
+	err = r.writeStateFile(rebaseTodoFile, "fixup "+hashes[1].String())
+	c.Assert(err, IsNil)
+	_, err = w.readRebaseTodo()
+	c.Assert(err, Equals, ErrRebaseTodoNoPrevious)
+
+	err = r.writeStateFile(rebaseDoneFile, "pick "+hashes[0].String())
+	c.Assert(err, IsNil)
+	todo, err := w.readRebaseTodo()
+	c.Assert(err, IsNil)
+	c.Assert(todo, DeepEquals, []RebaseTodo{{Action: FixupRebaseAction, Commit: hashes[1]}})
+}
+
+func (s *RebaseSuite) TestRebaseSameCommitMessages(c *C) {
+	r, w, up, hashes := prepareDivergedBranches(c,
+		map[string]string{"up": "up\n"},
+		rebaseCommit{"bar", map[string]string{"bar": "bar\n"}},
+	)
+
+	errExec := errors.New("exec failed")
+	_, err := w.Rebase(&RebaseOptions{
+		Upstream:  up,
+		Committer: defaultSignature(),
+		Todo: []RebaseTodo{
+			{Action: RewordRebaseAction, Commit: hashes[0], Message: "one"},
+			{Action: ExecRebaseAction, Command: "stop"},
+			{Action: FixupRebaseAction, Commit: hashes[0], Message: "two"},
+		},
+		Exec: func(*Worktree, string) error { return errExec },
+	})
+	c.Assert(err, Equals, errExec)
+	assertHistory(c, r, up, "one")
+
+	_, err = w.Rebase(&RebaseOptions{Continue: true, Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+	assertHistory(c, r, up, "two")
+}
+
+func (s *RebaseSuite) TestRebaseOptionsValidate(c *C) {
+	c.Assert((&RebaseOptions{}).Validate(), Equals, ErrMissingUpstream)
+	c.Assert((&RebaseOptions{Continue: true, Abort: true}).Validate(), Equals, ErrResumeActionExclusive)
+	c.Assert((&RebaseOptions{
+		Upstream: plumbing.NewHash("8ab686eafeb1f44702738c8b0f24f2567c36da6d"),
+		Todo:     []RebaseTodo{{Action: PickRebaseAction}},
+	}).Validate(), Equals, ErrInvalidRebaseTodo)
+}
@@ -0,0 +1,262 @@
+package git
+
+import (
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/ioutil"
+)
+
+var (
+	// ErrRestorePathspecNoMatch is returned when a pathspec given to restore
+	// doesn't match any path of the source.
+	ErrRestorePathspecNoMatch = errors.New("pathspec did not match any file known to git")
+	// ErrRestoreUnmergedPath is returned restoring the worktree from the
+	// index when a path has unresolved conflicts.
+	ErrRestoreUnmergedPath = errors.New("path is unmerged")
+)
+
+// Restore restores the paths of the index and/or the worktree matching the
+// given pathspecs, as git restore does. HEAD is not modified.
+func (w *Worktree) Restore(opts *RestoreOptions) (err error) {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	filters, err := w.newContentFilters()
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(filters, &err)
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	source, err := w.restoreSource(opts, idx)
+	if err != nil {
+		return err
+	}
+
+	if err := checkRestorePaths(opts.Paths, source, idx); err != nil {
+		return err
+	}
+
+	if opts.Worktree {
+		if err := w.restoreWorktree(opts, source, idx, filters); err != nil {
+			return err
+		}
+	}
+
+	if opts.Staged {
+		restoreIndex(opts.Paths, source, idx)
+	}
+
+	return w.r.Storer.SetIndex(idx)
+}
+
+// restoreSource returns the entries matching the pathspecs of the tree-ish
+// the paths are restored from, keyed by name.
+func (w *Worktree) restoreSource(opts *RestoreOptions, idx *index.Index) (map[string]*index.Entry, error) {
+	source := make(map[string]*index.Entry)
+	if opts.Source == "" && !opts.Staged {
+		for _, e := range idx.Entries {
+			if !matchPathspec(opts.Paths, e.Name) {
+				continue
+			}
+
+			if e.Stage != index.Merged {
+				return nil, ErrRestoreUnmergedPath
+			}
+
+			source[e.Name] = e
+		}
+
+		return source, nil
+	}
+
+	t, err := w.revisionTree(opts.Source)
+	if err != nil || t == nil {
+		return source, err
+	}
+
+	walker := object.NewTreeWalker(t, true, nil)
+	defer walker.Close()
+
+	for {
+		name, e, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if e.Mode == filemode.Dir || !matchPathspec(opts.Paths, name) {
+			continue
+		}
+
+		source[name] = &index.Entry{Name: name, Hash: e.Hash, Mode: e.Mode}
+	}
+
+	return source, nil
+}
+
+// revisionTree returns the tree of the given tree-ish, by default the
+// tree of HEAD, nil if HEAD doesn't exist yet.
+func (w *Worktree) revisionTree(rev plumbing.Revision) (*object.Tree, error) {
+	if rev == "" {
+		head, err := w.r.Head()
+		if err == plumbing.ErrReferenceNotFound {
+			return nil, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return w.getTreeFromCommitHash(head.Hash())
+	}
+
+	h, err := w.r.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := w.r.Object(plumbing.AnyObject, *h)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err = peelRevisionObject(obj, plumbing.TreeObject.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return obj.(*object.Tree), nil
+}
+
+// checkRestorePaths returns ErrRestorePathspecNoMatch if any of the
+// pathspecs matches neither a source entry nor an index entry.
+func checkRestorePaths(pathspec []string, source map[string]*index.Entry, idx *index.Index) error {
+	for _, p := range pathspec {
+		if !matchRestorePath(p, source, idx) {
+			return ErrRestorePathspecNoMatch
+		}
+	}
+
+	return nil
+}
+
+func matchRestorePath(p string, source map[string]*index.Entry, idx *index.Index) bool {
+	for name := range source {
+		if matchPathspec([]string{p}, name) {
+			return true
+		}
+	}
+
+	for _, e := range idx.Entries {
+		if matchPathspec([]string{p}, e.Name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// restoreWorktree writes the source entries to the worktree, converted with
+// the given filters, removing the tracked files matching the pathspecs that
+// are missing in the source. The skip-worktree entries are left alone.
+func (w *Worktree) restoreWorktree(opts *RestoreOptions, source map[string]*index.Entry, idx *index.Index, filters *contentFilters) error {
+	skipped := make(map[string]bool)
+	for _, e := range idx.Entries {
+		if !matchPathspec(opts.Paths, e.Name) {
+			continue
+		}
+
+		if e.SkipWorktree {
+			skipped[e.Name] = true
+			continue
+		}
+
+		if _, ok := source[e.Name]; ok {
+			continue
+		}
+
+		if err := w.removeWorktreeFile(e.Name); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(source))
+	for name := range source {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		e := source[name]
+		if skipped[name] || e.Mode == filemode.Submodule {
+			continue
+		}
+
+		if err := w.restoreFile(e, filters); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreFile writes the blob of the given entry to the worktree, replacing
+// the existing file.
+func (w *Worktree) restoreFile(e *index.Entry, filters *contentFilters) error {
+	blob, err := w.r.BlobObject(e.Hash)
+	if err != nil {
+		return err
+	}
+
+	// the file is deleted to apply perm changes, billy doesn't implement
+	// chmod
+	if err := w.removeWorktreeFile(e.Name); err != nil {
+		return err
+	}
+
+	return w.checkoutFile(object.NewFile(e.Name, e.Mode, blob), filters)
+}
+
+// restoreIndex replaces the index entries matching the pathspecs, at any
+// stage, by the source entries. The skip-worktree bits are kept.
+func restoreIndex(pathspec []string, source map[string]*index.Entry, idx *index.Index) {
+	skipped := make(map[string]bool)
+	entries := idx.Entries[:0]
+	for _, e := range idx.Entries {
+		if !matchPathspec(pathspec, e.Name) {
+			entries = append(entries, e)
+			continue
+		}
+
+		if e.SkipWorktree {
+			skipped[e.Name] = true
+		}
+	}
+
+	for name, e := range source {
+		entries = append(entries, &index.Entry{
+			Name:         name,
+			Hash:         e.Hash,
+			Mode:         e.Mode,
+			SkipWorktree: skipped[name],
+		})
+	}
+
+	idx.Entries = entries
+}
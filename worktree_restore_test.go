@@ -0,0 +1,130 @@
+package git
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+type RestoreSuite struct{}
+
+var _ = Suite(&RestoreSuite{})
+
+func prepareRestore(c *C) (*Repository, *Worktree, plumbing.Hash) {
+	r, w := newMemoryWorktree(c)
+
+	h := commitFiles(c, w, "init", map[string]string{
+		"foo":     "foo\n",
+		"bar":     "bar\n",
+		"dir/baz": "baz\n",
+	})
+
+	commitFiles(c, w, "second", map[string]string{"foo": "foo 2\n", "dir/qux": "qux\n"})
+
+	err := util.WriteFile(w.Filesystem, "foo", []byte("staged\n"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo")
+	c.Assert(err, IsNil)
+
+	for name, content := range map[string]string{"foo": "local\n", "bar": "local\n", "dir/baz": "local\n"} {
+		err = util.WriteFile(w.Filesystem, name, []byte(content), 0644)
+		c.Assert(err, IsNil)
+	}
+
+	return r, w, h
+}
+
+func (s *RestoreSuite) TestRestoreWorktree(c *C) {
+	_, w, _ := prepareRestore(c)
+
+	err := w.Restore(&RestoreOptions{Paths: []string{"foo", "dir"}})
+	c.Assert(err, IsNil)
+	assertWorktreeFiles(c, w, map[string]string{
+		"foo":     "staged\n",
+		"bar":     "local\n",
+		"dir/baz": "baz\n",
+		"dir/qux": "qux\n",
+	})
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo").Staging, Equals, Modified)
+	c.Assert(status.File("foo").Worktree, Equals, Unmodified)
+	c.Assert(status.File("bar").Worktree, Equals, Modified)
+	_, ok := status["dir/baz"]
+	c.Assert(ok, Equals, false)
+}
+
+func (s *RestoreSuite) TestRestoreStaged(c *C) {
+	_, w, _ := prepareRestore(c)
+
+	err := w.Restore(&RestoreOptions{Staged: true, Paths: []string{"*o"}})
+	c.Assert(err, IsNil)
+	assertWorktreeFiles(c, w, map[string]string{"foo": "local\n"})
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo").Staging, Equals, Unmodified)
+	c.Assert(status.File("foo").Worktree, Equals, Modified)
+}
+
+func (s *RestoreSuite) TestRestoreStagedAndWorktree(c *C) {
+	_, w, _ := prepareRestore(c)
+
+	err := w.Restore(&RestoreOptions{Staged: true, Worktree: true, Paths: []string{"."}})
+	c.Assert(err, IsNil)
+	assertWorktreeFiles(c, w, map[string]string{
+		"foo":     "foo 2\n",
+		"bar":     "bar\n",
+		"dir/baz": "baz\n",
+	})
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+}
+
+func (s *RestoreSuite) TestRestoreSource(c *C) {
+	r, w, h := prepareRestore(c)
+
+	err := w.Restore(&RestoreOptions{
+		Source:   plumbing.Revision(h.String()),
+		Staged:   true,
+		Worktree: true,
+		Paths:    []string{"foo", "dir"},
+	})
+	c.Assert(err, IsNil)
+	assertWorktreeFiles(c, w, map[string]string{
+		"foo":     "foo\n",
+		"bar":     "local\n",
+		"dir/baz": "baz\n",
+		"dir/qux": "",
+	})
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo").Staging, Equals, Modified)
+	c.Assert(status.File("foo").Worktree, Equals, Unmodified)
+	c.Assert(status.File("dir/qux").Staging, Equals, Deleted)
+	c.Assert(status.File("bar").Staging, Equals, Unmodified)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash(), Not(Equals), h)
+
+	// only the worktree, from a tree
+	err = w.Restore(&RestoreOptions{Source: "HEAD:dir", Paths: []string{"qux"}})
+	c.Assert(err, IsNil)
+	assertWorktreeFiles(c, w, map[string]string{"qux": "qux\n"})
+}
+
+func (s *RestoreSuite) TestRestoreErrors(c *C) {
+	_, w, _ := prepareRestore(c)
+
+	err := w.Restore(&RestoreOptions{})
+	c.Assert(err, Equals, ErrMissingRestorePaths)
+
+	err = w.Restore(&RestoreOptions{Paths: []string{"missing"}})
+	c.Assert(err, Equals, ErrRestorePathspecNoMatch)
+}
@@ -0,0 +1,721 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	formatcfg "github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var (
+	// ErrSequencerInProgress is returned when a cherry-pick or a revert is
+	// attempted while another one hasn't been concluded or aborted.
+	ErrSequencerInProgress = errors.New("a cherry-pick or revert is already in progress")
+	// ErrNoSequencerInProgress is returned when continuing, skipping or
+	// aborting a cherry-pick or a revert that doesn't exist.
+	ErrNoSequencerInProgress = errors.New("there is no cherry-pick or revert in progress")
+	// ErrMainlineRequired is returned when a merge commit is cherry-picked
+	// or reverted without the Mainline option.
+	ErrMainlineRequired = errors.New("commit is a merge but no mainline was given")
+	// ErrMainlineNotMerge is returned when the Mainline option is used with
+	// a commit that isn't a merge, or it is greater than its parents.
+	ErrMainlineNotMerge = errors.New("mainline was given but commit is not a merge or lacks that parent")
+	// ErrRedundantCommit is returned when the changes of a cherry-picked or
+	// reverted commit are already in HEAD. The sequence stops, and it can be
+	// resumed with Skip, dropping the commit, or with Continue along with
+	// CherryPickOptions.KeepRedundantCommits, committing it anyway.
+	ErrRedundantCommit = errors.New("commit is empty, its changes are already in HEAD")
+)
+
+const (
+	sequencerHeadFile        = sequencerDir + "/head"
+	sequencerTodoFile        = sequencerDir + "/todo"
+	sequencerOptsFile        = sequencerDir + "/opts"
+	sequencerAbortSafetyFile = sequencerDir + "/abort-safety"
+
+	sequencerOptsSection = "options"
+
+	pickSequencerAction   = "pick"
+	revertSequencerAction = "revert"
+)
+
+// SequencerResult is the outcome of a Worktree.CherryPick or a
+// Worktree.Revert.
+type SequencerResult struct {
+	// Head is the commit HEAD points to after the cherry-pick or revert, or
+	// at the point it stopped.
+	Head plumbing.Hash
+	// Stopped is the commit that couldn't be applied or reverted, if the
+	// sequence stopped because of conflicts.
+	Stopped plumbing.Hash
+	// Conflicts found applying or reverting Stopped, sorted by path.
+	Conflicts []*MergeConflict
+}
+
+// CherryPick applies the changes introduced by the given commits on top of
+// HEAD, creating a new commit for each one of them.
+//
+// If a commit can't be applied cleanly the cherry-pick stops, the index
+// contains the stages of the conflicting paths, CHERRY_PICK_HEAD points to
+// the commit and ErrMergeConflict is returned along with the conflicts. Once
+// the conflicts are resolved and added, it can be resumed with
+// CherryPickOptions.Continue, or aborted with CherryPickOptions.Abort. It
+// also stops at the commits whose changes are already in HEAD, returning
+// ErrRedundantCommit, unless CherryPickOptions.KeepRedundantCommits is used.
+func (w *Worktree) CherryPick(opts *CherryPickOptions) (*SequencerResult, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	sq := &sequencer{
+		w:             w,
+		mainline:      opts.Mainline,
+		strategy:      opts.StrategyOption,
+		committer:     opts.Committer,
+		keepRedundant: opts.KeepRedundantCommits,
+	}
+
+	return sq.do(pickSequencerAction, opts.Commits, opts.Continue, opts.Skip, opts.Abort)
+}
+
+// Revert creates, for each one of the given commits, a new commit on top of
+// HEAD reverting the changes it introduced.
+//
+// If a commit can't be reverted cleanly the revert stops, the index contains
+// the stages of the conflicting paths, REVERT_HEAD points to the commit and
+// ErrMergeConflict is returned along with the conflicts. Once the conflicts
+// are resolved and added, it can be resumed with RevertOptions.Continue, or
+// aborted with RevertOptions.Abort. It also stops at the commits whose
+// changes are already reverted in HEAD, returning ErrRedundantCommit.
+func (w *Worktree) Revert(opts *RevertOptions) (*SequencerResult, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	sq := &sequencer{
+		w:         w,
+		mainline:  opts.Mainline,
+		strategy:  opts.StrategyOption,
+		author:    opts.Author,
+		committer: opts.Committer,
+	}
+
+	return sq.do(revertSequencerAction, opts.Commits, opts.Continue, opts.Skip, opts.Abort)
+}
+
+// sequencer applies, or reverts, a list of commits on top of HEAD, keeping
+// its state in the sequencer directory of the git directory.
+type sequencer struct {
+	w             *Worktree
+	mainline      int
+	strategy      MergeStrategyOption
+	author        *object.Signature
+	committer     *object.Signature
+	keepRedundant bool
+}
+
+func (sq *sequencer) do(action string, commits []plumbing.Hash, cont, skip, abort bool) (*SequencerResult, error) {
+	switch {
+	case abort:
+		return nil, sq.abort()
+	case cont:
+		return sq.resume(true)
+	case skip:
+		return sq.resume(false)
+	}
+
+	if err := sq.w.checkNoOperationInProgress(); err != nil {
+		return nil, err
+	}
+
+	if err := sq.w.checkCleanForMerge(); err != nil {
+		return nil, err
+	}
+
+	if err := sq.resolveSignatures(); err != nil {
+		return nil, err
+	}
+
+	head, err := sq.w.r.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	var todo []string
+	for _, h := range commits {
+		c, err := sq.w.r.CommitObject(h)
+		if err != nil {
+			return nil, err
+		}
+
+		todo = append(todo, fmt.Sprintf("%s %s %s", action, h, commitSubject(c.Message)))
+	}
+
+	if err := sq.w.r.writeStateFile(sequencerHeadFile, head.Hash().String()); err != nil {
+		return nil, err
+	}
+
+	if err := sq.writeOpts(); err != nil {
+		return nil, err
+	}
+
+	if err := sq.w.r.writeStateFile(sequencerTodoFile, strings.Join(todo, "\n")); err != nil {
+		return nil, err
+	}
+
+	return sq.run()
+}
+
+// run applies the pending entries of the todo list, removing the state once
+// all of them are done. As git does, the entry being applied is kept at the
+// top of the todo list until it is concluded, so a sequence stopped by
+// go-git can be continued by git and the other way around.
+func (sq *sequencer) run() (*SequencerResult, error) {
+	for {
+		if err := sq.writeAbortSafety(); err != nil {
+			return nil, err
+		}
+
+		todo, err := sq.w.readSequencerTodo()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(todo) == 0 {
+			break
+		}
+
+		action, h, err := sq.parseTodo(todo[0])
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := sq.apply(action, h)
+		if err != nil {
+			return res, err
+		}
+
+		if err := sq.w.r.writeStateFile(sequencerTodoFile, strings.Join(todo[1:], "\n")); err != nil {
+			return nil, err
+		}
+	}
+
+	head, err := sq.w.r.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SequencerResult{Head: head.Hash()}, sq.w.r.removeStateFile(sequencerDir)
+}
+
+// readSequencerTodo returns the lines of the todo list, skipping the blank
+// lines and the comments.
+func (w *Worktree) readSequencerTodo() ([]string, error) {
+	content, err := w.r.readStateFile(sequencerTodoFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var todo []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		todo = append(todo, line)
+	}
+
+	return todo, nil
+}
+
+// parseTodo parses a line of the todo list, like `pick 8ab686e subject`. The
+// commit may be abbreviated, as it is in the todo lists written by git.
+func (sq *sequencer) parseTodo(line string) (string, plumbing.Hash, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return "", plumbing.ZeroHash, fmt.Errorf("invalid sequencer todo line: %q", line)
+	}
+
+	action := fields[0]
+	switch action {
+	case pickSequencerAction, "p":
+		action = pickSequencerAction
+	case revertSequencerAction:
+	default:
+		return "", plumbing.ZeroHash, fmt.Errorf("invalid sequencer action: %q", action)
+	}
+
+	h, err := sq.w.r.ResolveRevision(plumbing.Revision(fields[1]))
+	if err != nil {
+		return "", plumbing.ZeroHash, err
+	}
+
+	return action, *h, nil
+}
+
+// writeOpts writes the options of the sequence to sequencer/opts, in the
+// config format git uses for it.
+func (sq *sequencer) writeOpts() error {
+	cfg := formatcfg.New()
+	if sq.mainline > 0 {
+		cfg.SetOption(sequencerOptsSection, "", "mainline", strconv.Itoa(sq.mainline))
+	}
+
+	switch sq.strategy {
+	case OursStrategyOption:
+		cfg.SetOption(sequencerOptsSection, "", "strategy-option", "ours")
+	case TheirsStrategyOption:
+		cfg.SetOption(sequencerOptsSection, "", "strategy-option", "theirs")
+	}
+
+	if sq.keepRedundant {
+		cfg.SetOption(sequencerOptsSection, "", "keep-redundant-commits", "true")
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := formatcfg.NewEncoder(buf).Encode(cfg); err != nil {
+		return err
+	}
+
+	return sq.w.r.writeStateFile(sequencerOptsFile, buf.String())
+}
+
+// readOpts reads the options of the sequence from sequencer/opts, unless
+// they were given again to resume it.
+func (sq *sequencer) readOpts() error {
+	content, err := sq.w.r.readStateFile(sequencerOptsFile)
+	if err != nil {
+		return err
+	}
+
+	cfg := formatcfg.New()
+	if err := formatcfg.NewDecoder(strings.NewReader(content)).Decode(cfg); err != nil {
+		return err
+	}
+
+	opts := cfg.Section(sequencerOptsSection)
+	if sq.mainline == 0 && opts.HasOption("mainline") {
+		if sq.mainline, err = strconv.Atoi(opts.Option("mainline")); err != nil {
+			return err
+		}
+	}
+
+	if sq.strategy == DefaultStrategyOption {
+		switch opts.Option("strategy-option") {
+		case "ours":
+			sq.strategy = OursStrategyOption
+		case "theirs":
+			sq.strategy = TheirsStrategyOption
+		}
+	}
+
+	if !sq.keepRedundant {
+		sq.keepRedundant = opts.Option("keep-redundant-commits") == "true"
+	}
+
+	return nil
+}
+
+// writeAbortSafety records the current HEAD, git refuses to abort the
+// sequence if HEAD moved since then.
+func (sq *sequencer) writeAbortSafety() error {
+	head, err := sq.w.r.Head()
+	if err != nil {
+		return err
+	}
+
+	return sq.w.r.writeStateFile(sequencerAbortSafetyFile, head.Hash().String())
+}
+
+// resolveSignatures sets the default author and committer of the new
+// commits.
+func (sq *sequencer) resolveSignatures() error {
+	author := sq.author
+	if author == nil {
+		author = sq.committer
+	}
+
+	co := &CommitOptions{Author: author, Committer: sq.committer}
+	if err := co.Validate(sq.w.r); err != nil {
+		return err
+	}
+
+	sq.author, sq.committer = co.Author, co.Committer
+	return nil
+}
+
+func (sq *sequencer) mainlineParent(c *object.Commit) (*object.Commit, error) {
+	mainline := sq.mainline
+	switch {
+	case c.NumParents() > 1 && mainline == 0:
+		return nil, ErrMainlineRequired
+	case mainline > 0 && (c.NumParents() < 2 || mainline > c.NumParents()):
+		return nil, ErrMainlineNotMerge
+	case c.NumParents() == 0:
+		return nil, nil
+	case mainline == 0:
+		mainline = 1
+	}
+
+	return c.Parent(mainline - 1)
+}
+
+// apply applies, or reverts, the given commit on top of HEAD.
+func (sq *sequencer) apply(action string, h plumbing.Hash) (*SequencerResult, error) {
+	head, err := sq.w.r.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := sq.w.r.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := sq.w.r.CommitObject(h)
+	if err != nil {
+		return nil, err
+	}
+
+	parent, err := sq.mainlineParent(c)
+	if err != nil {
+		return nil, err
+	}
+
+	label := fmt.Sprintf("%s (%s)", c.Hash.String()[:7], commitSubject(c.Message))
+	base, theirs := parent, c
+	if action == revertSequencerAction {
+		base, theirs = c, parent
+		label = "parent of " + label
+	}
+
+	var baseTree, theirsTree *object.Tree
+	if base != nil {
+		if baseTree, err = base.Tree(); err != nil {
+			return nil, err
+		}
+	}
+
+	if theirs != nil {
+		if theirsTree, err = theirs.Tree(); err != nil {
+			return nil, err
+		}
+	}
+
+	oursTree, err := current.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := sq.w.r.MergeTrees(baseTree, oursTree, emptyTreeIfNil(theirsTree), &MergeTreesOptions{
+		OursLabel:      string(plumbing.HEAD),
+		TheirsLabel:    label,
+		StrategyOption: sq.strategy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sq.w.checkoutMergeResult(res); err != nil {
+		return nil, err
+	}
+
+	msg := sq.message(action, c, parent)
+	if !res.IsClean() || (res.Tree == current.TreeHash && !sq.keepRedundant) {
+		return &SequencerResult{
+			Head:      current.Hash,
+			Stopped:   c.Hash,
+			Conflicts: res.Conflicts,
+		}, sq.stop(action, c, msg, res.Conflicts)
+	}
+
+	return nil, sq.commit(action, c, current, msg, res.Tree)
+}
+
+// emptyTreeIfNil returns t, or an empty tree if nil, reverting a root commit
+// merges against an empty tree.
+func emptyTreeIfNil(t *object.Tree) *object.Tree {
+	if t == nil {
+		return &object.Tree{}
+	}
+
+	return t
+}
+
+func (sq *sequencer) message(action string, c, parent *object.Commit) string {
+	if action == pickSequencerAction {
+		return c.Message
+	}
+
+	msg := fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %s", commitSubject(c.Message), c.Hash)
+	if c.NumParents() > 1 {
+		msg += fmt.Sprintf(", reversing\nchanges made to %s", parent.Hash)
+	}
+
+	return msg + ".\n"
+}
+
+func (sq *sequencer) headReference(action string) plumbing.ReferenceName {
+	if action == revertSequencerAction {
+		return plumbing.RevertHead
+	}
+
+	return plumbing.CherryPickHead
+}
+
+// stop records the commit where the sequence stopped, because of the given
+// conflicts or, if there isn't any, because the commit is redundant.
+func (sq *sequencer) stop(action string, c *object.Commit, msg string, conflicts []*MergeConflict) error {
+	ref := plumbing.NewHashReference(sq.headReference(action), c.Hash)
+	if err := sq.w.r.Storer.SetReference(ref); err != nil {
+		return err
+	}
+
+	if len(conflicts) > 0 {
+		msg = strings.TrimRight(msg, "\n") + "\n\n# Conflicts:\n"
+		for _, c := range conflicts {
+			msg += "#\t" + c.Path + "\n"
+		}
+	}
+
+	if err := sq.w.r.writeStateFile(mergeMsgFile, msg); err != nil {
+		return err
+	}
+
+	if len(conflicts) == 0 {
+		return ErrRedundantCommit
+	}
+
+	return ErrMergeConflict
+}
+
+// commit creates the commit resulting of applying, or reverting, c on top of
+// current. If tree is the same as the one of current the commit is only
+// created keeping the redundant commits.
+func (sq *sequencer) commit(action string, c, current *object.Commit, msg string, tree plumbing.Hash) error {
+	if tree == current.TreeHash && !sq.keepRedundant {
+		return ErrRedundantCommit
+	}
+
+	opts := &CommitOptions{
+		Author:    sq.author,
+		Committer: sq.committer,
+		Parents:   []plumbing.Hash{current.Hash},
+	}
+
+	if action == pickSequencerAction {
+		opts.Author = &c.Author
+	}
+
+	h, err := sq.w.buildCommitObject(msg, opts, tree)
+	if err != nil {
+		return err
+	}
+
+	name := "cherry-pick"
+	if action == revertSequencerAction {
+		name = "revert"
+	}
+
+	return sq.w.updateHEAD(h, fmt.Sprintf("%s: %s", name, commitSubject(msg)), sq.committer)
+}
+
+// stopped returns the action and the commit where the sequencer stopped
+// because of conflicts, if any.
+func (sq *sequencer) stopped() (string, *object.Commit, error) {
+	for _, action := range []string{pickSequencerAction, revertSequencerAction} {
+		ref, err := sq.w.r.Storer.Reference(sq.headReference(action))
+		if err == plumbing.ErrReferenceNotFound {
+			continue
+		}
+
+		if err != nil {
+			return "", nil, err
+		}
+
+		c, err := sq.w.r.CommitObject(ref.Hash())
+		return action, c, err
+	}
+
+	return "", nil, nil
+}
+
+// resume commits the content of the index if commit is true, or discards it
+// otherwise, and continues with the rest of the todo list.
+func (sq *sequencer) resume(commit bool) (*SequencerResult, error) {
+	action, c, err := sq.stopped()
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := sq.w.r.readStateFile(sequencerHeadFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if c == nil && head == "" {
+		return nil, ErrNoSequencerInProgress
+	}
+
+	if err := sq.readOpts(); err != nil {
+		return nil, err
+	}
+
+	if err := sq.resolveSignatures(); err != nil {
+		return nil, err
+	}
+
+	if c != nil && commit {
+		if err := sq.commitResolved(action, c); err != nil {
+			return nil, err
+		}
+	}
+
+	if c != nil && !commit {
+		if err := sq.w.Reset(&ResetOptions{Mode: HardReset}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := sq.w.removePickState(); err != nil {
+		return nil, err
+	}
+
+	// the entry where the sequence stopped is concluded
+	todo, err := sq.w.readSequencerTodo()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(todo) > 0 {
+		if err := sq.w.r.writeStateFile(sequencerTodoFile, strings.Join(todo[1:], "\n")); err != nil {
+			return nil, err
+		}
+	}
+
+	return sq.run()
+}
+
+// commitResolved commits the content of the index, where the conflicts found
+// applying c have been resolved.
+func (sq *sequencer) commitResolved(action string, c *object.Commit) error {
+	idx, err := sq.w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	if err := checkNoUnmergedEntries(idx); err != nil {
+		return err
+	}
+
+	h := &buildTreeHelper{fs: sq.w.Filesystem, s: sq.w.r.Storer}
+	tree, err := h.BuildTree(idx, &CommitOptions{AllowEmptyCommits: true})
+	if err != nil {
+		return err
+	}
+
+	head, err := sq.w.r.Head()
+	if err != nil {
+		return err
+	}
+
+	current, err := sq.w.r.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+
+	msg, _, err := sq.w.preparedMessage()
+	if err != nil {
+		return err
+	}
+
+	return sq.commit(action, c, current, msg, tree)
+}
+
+// abort restores HEAD, the index and the worktree to the state previous to
+// the cherry-pick or revert.
+func (sq *sequencer) abort() error {
+	_, c, err := sq.stopped()
+	if err != nil {
+		return err
+	}
+
+	head, err := sq.w.r.readStateFile(sequencerHeadFile)
+	if err != nil {
+		return err
+	}
+
+	if c == nil && head == "" {
+		return ErrNoSequencerInProgress
+	}
+
+	opts := &ResetOptions{Mode: HardReset}
+	if head != "" {
+		opts.Commit = plumbing.NewHash(strings.TrimSpace(head))
+	}
+
+	if err := sq.w.Reset(opts); err != nil {
+		return err
+	}
+
+	if err := sq.w.removePickState(); err != nil {
+		return err
+	}
+
+	return sq.w.r.removeStateFile(sequencerDir)
+}
+
+// removePickState removes CHERRY_PICK_HEAD or REVERT_HEAD, and the message
+// prepared for the commit, if a cherry-pick or a revert stopped because of
+// conflicts.
+func (w *Worktree) removePickState() error {
+	for _, name := range []plumbing.ReferenceName{plumbing.CherryPickHead, plumbing.RevertHead} {
+		found, err := w.r.hasReference(name)
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			continue
+		}
+
+		if err := w.r.Storer.RemoveReference(name); err != nil {
+			return err
+		}
+
+		if err := w.r.removeStateFile(mergeMsgFile); err != nil {
+			return err
+		}
+	}
+
+	// the last entry of the todo list is concluded, so it is the sequence
+	todo, err := w.readSequencerTodo()
+	if err != nil || len(todo) > 1 {
+		return err
+	}
+
+	return w.r.removeStateFile(sequencerDir)
+}
+
+// isPicking returns true if a cherry-pick or a revert is in progress.
+func (w *Worktree) isPicking() (bool, error) {
+	head, err := w.r.readStateFile(sequencerHeadFile)
+	if err != nil || head != "" {
+		return head != "", err
+	}
+
+	for _, name := range []plumbing.ReferenceName{plumbing.CherryPickHead, plumbing.RevertHead} {
+		found, err := w.r.hasReference(name)
+		if err != nil || found {
+			return found, err
+		}
+	}
+
+	return false, nil
+}
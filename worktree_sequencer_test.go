@@ -0,0 +1,385 @@
+package git
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+type SequencerSuite struct{}
+
+var _ = Suite(&SequencerSuite{})
+
+func (s *SequencerSuite) TestCherryPick(c *C) {
+	r, w, up, hashes := prepareDivergedBranches(c,
+		map[string]string{"up": "up\n"},
+		rebaseCommit{"bar", map[string]string{"bar": "bar\n"}},
+		rebaseCommit{"baz", map[string]string{"baz": "baz\n"}},
+	)
+
+	err := w.Checkout(&CheckoutOptions{Branch: "refs/heads/upstream"})
+	c.Assert(err, IsNil)
+
+	res, err := w.CherryPick(&CherryPickOptions{Commits: hashes, Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	commit := assertHistory(c, r, up, "baz", "bar")
+	c.Assert(res.Head, Equals, commit.Hash)
+	assertTreeFiles(c, r, commit.TreeHash, map[string]string{
+		"foo": "a\nb\nc\n", "up": "up\n", "bar": "bar\n", "baz": "baz\n",
+	})
+
+	original, err := r.CommitObject(hashes[1])
+	c.Assert(err, IsNil)
+	c.Assert(commit.Author, DeepEquals, original.Author)
+
+	ref, err := r.Reference("refs/heads/upstream", false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, commit.Hash)
+
+	_, err = w.r.dotGitFilesystem().Stat(sequencerDir)
+	c.Assert(err, NotNil)
+}
+
+func (s *SequencerSuite) TestCherryPickConflictContinue(c *C) {
+	r, w, up, hashes := prepareDivergedBranches(c,
+		map[string]string{"foo": "a\nup\nc\n"},
+		rebaseCommit{"foo", map[string]string{"foo": "a\nours\nc\n"}},
+		rebaseCommit{"bar", map[string]string{"bar": "bar\n"}},
+	)
+
+	err := w.Checkout(&CheckoutOptions{Branch: "refs/heads/upstream"})
+	c.Assert(err, IsNil)
+
+	res, err := w.CherryPick(&CherryPickOptions{Commits: hashes, Committer: defaultSignature()})
+	c.Assert(err, Equals, ErrMergeConflict)
+	c.Assert(res.Stopped, Equals, hashes[0])
+	c.Assert(res.Conflicts, HasLen, 1)
+
+	ref, err := r.Reference(plumbing.CherryPickHead, false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, hashes[0])
+
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+	c.Assert(idx.Entries[0].Stage, Equals, index.AncestorMode)
+
+	_, err = w.CherryPick(&CherryPickOptions{Commits: hashes})
+	c.Assert(err, Equals, ErrSequencerInProgress)
+
+	_, err = w.CherryPick(&CherryPickOptions{Continue: true, Committer: defaultSignature()})
+	c.Assert(err, Equals, ErrUnmergedPaths)
+
+	err = util.WriteFile(w.Filesystem, "foo", []byte("a\nresolved\nc\n"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo")
+	c.Assert(err, IsNil)
+
+	_, err = w.CherryPick(&CherryPickOptions{Continue: true, Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	commit := assertHistory(c, r, up, "bar", "foo")
+	assertTreeFiles(c, r, commit.TreeHash, map[string]string{
+		"foo": "a\nresolved\nc\n", "bar": "bar\n",
+	})
+
+	_, err = r.Reference(plumbing.CherryPickHead, false)
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+}
+
+func (s *SequencerSuite) TestCherryPickConflictCommit(c *C) {
+	r, w, up, hashes := prepareDivergedBranches(c,
+		map[string]string{"foo": "a\nup\nc\n"},
+		rebaseCommit{"foo", map[string]string{"foo": "a\nours\nc\n"}},
+	)
+
+	err := w.Checkout(&CheckoutOptions{Branch: "refs/heads/upstream"})
+	c.Assert(err, IsNil)
+
+	_, err = w.CherryPick(&CherryPickOptions{Commits: hashes, Committer: defaultSignature()})
+	c.Assert(err, Equals, ErrMergeConflict)
+
+	err = util.WriteFile(w.Filesystem, "foo", []byte("a\nresolved\nc\n"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo")
+	c.Assert(err, IsNil)
+
+	_, err = w.Commit("", &CommitOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+	assertHistory(c, r, up, "foo")
+
+	picking, err := w.isPicking()
+	c.Assert(err, IsNil)
+	c.Assert(picking, Equals, false)
+}
+
+func (s *SequencerSuite) TestCherryPickGitState(c *C) {
+	r, w, up, hashes := prepareDivergedBranches(c,
+		map[string]string{"foo": "a\nup\nc\n"},
+		rebaseCommit{"foo", map[string]string{"foo": "a\nours\nc\n"}},
+		rebaseCommit{"bar", map[string]string{"bar": "bar\n"}},
+		rebaseCommit{"baz", map[string]string{"baz": "baz\n"}},
+	)
+
+	err := w.Checkout(&CheckoutOptions{Branch: "refs/heads/upstream"})
+	c.Assert(err, IsNil)
+
+	_, err = w.CherryPick(&CherryPickOptions{
+		Commits:   hashes,
+		Committer: defaultSignature(),
+	})
+	c.Assert(err, Equals, ErrMergeConflict)
+
+	todo, err := r.readStateFile(sequencerTodoFile)
+	c.Assert(err, IsNil)
+	c.Assert(todo, Equals, "pick "+hashes[0].String()+" foo\n"+
+		"pick "+hashes[1].String()+" bar\n"+
+		"pick "+hashes[2].String()+" baz\n")
+
+	_, err = r.dotGitFilesystem().Stat(sequencerOptsFile)
+	c.Assert(err, IsNil)
+
+	safety, err := r.readStateFile(sequencerAbortSafetyFile)
+	c.Assert(err, IsNil)
+	c.Assert(safety, Equals, up.String()+"\n")
+
+	// the todo list as git writes it, with abbreviated hashes
+	err = r.writeStateFile(sequencerTodoFile, "pick "+hashes[0].String()[:7]+" foo\n"+
+		"pick "+hashes[2].String()[:7]+" baz\n")
+	c.Assert(err, IsNil)
+
+	_, err = w.CherryPick(&CherryPickOptions{Skip: true, Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	assertHistory(c, r, up, "baz")
+}
+
+func (s *SequencerSuite) TestSequencerOpts(c *C) {
+	_, w, _, _ := prepareDivergedBranches(c, map[string]string{"up": "up\n"})
+
+	sq := &sequencer{w: w, mainline: 2, strategy: TheirsStrategyOption, keepRedundant: true}
+	c.Assert(sq.writeOpts(), IsNil)
+
+	content, err := w.r.readStateFile(sequencerOptsFile)
+	c.Assert(err, IsNil)
+	c.Assert(content, Equals, "[options]\n\tmainline = 2\n\tstrategy-option = theirs\n\tkeep-redundant-commits = true\n")
+
+	sq = &sequencer{w: w}
+	c.Assert(sq.readOpts(), IsNil)
+	c.Assert(sq.mainline, Equals, 2)
+	c.Assert(sq.strategy, Equals, TheirsStrategyOption)
+	c.Assert(sq.keepRedundant, Equals, true)
+}
+
+func (s *SequencerSuite) TestCherryPickAbort(c *C) {
+	r, w, up, hashes := prepareDivergedBranches(c,
+		map[string]string{"foo": "a\nup\nc\n"},
+		rebaseCommit{"bar", map[string]string{"bar": "bar\n"}},
+		rebaseCommit{"foo", map[string]string{"foo": "a\nours\nc\n"}},
+	)
+
+	err := w.Checkout(&CheckoutOptions{Branch: "refs/heads/upstream"})
+	c.Assert(err, IsNil)
+
+	_, err = w.CherryPick(&CherryPickOptions{Abort: true})
+	c.Assert(err, Equals, ErrNoSequencerInProgress)
+
+	_, err = w.CherryPick(&CherryPickOptions{Commits: hashes, Committer: defaultSignature()})
+	c.Assert(err, Equals, ErrMergeConflict)
+
+	_, err = w.CherryPick(&CherryPickOptions{Abort: true})
+	c.Assert(err, IsNil)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash(), Equals, up)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+
+	_, err = r.Reference(plumbing.CherryPickHead, false)
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+}
+
+func (s *SequencerSuite) TestCherryPickSkip(c *C) {
+	r, w, up, hashes := prepareDivergedBranches(c,
+		map[string]string{"foo": "a\nup\nc\n"},
+		rebaseCommit{"foo", map[string]string{"foo": "a\nours\nc\n"}},
+		rebaseCommit{"bar", map[string]string{"bar": "bar\n"}},
+	)
+
+	err := w.Checkout(&CheckoutOptions{Branch: "refs/heads/upstream"})
+	c.Assert(err, IsNil)
+
+	_, err = w.CherryPick(&CherryPickOptions{Commits: hashes, Committer: defaultSignature()})
+	c.Assert(err, Equals, ErrMergeConflict)
+
+	_, err = w.CherryPick(&CherryPickOptions{Skip: true, Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	assertHistory(c, r, up, "bar")
+}
+
+func (s *SequencerSuite) TestCherryPickRedundant(c *C) {
+	r, w, up, hashes := prepareDivergedBranches(c,
+		map[string]string{"up": "up\n"},
+		rebaseCommit{"up", map[string]string{"up": "up\n"}},
+		rebaseCommit{"bar", map[string]string{"bar": "bar\n"}},
+	)
+
+	err := w.Checkout(&CheckoutOptions{Branch: "refs/heads/upstream"})
+	c.Assert(err, IsNil)
+
+	res, err := w.CherryPick(&CherryPickOptions{Commits: hashes, Committer: defaultSignature()})
+	c.Assert(err, Equals, ErrRedundantCommit)
+	c.Assert(res.Head, Equals, up)
+	c.Assert(res.Stopped, Equals, hashes[0])
+	c.Assert(res.Conflicts, HasLen, 0)
+
+	ref, err := r.Reference(plumbing.CherryPickHead, false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, hashes[0])
+
+	_, err = w.CherryPick(&CherryPickOptions{Continue: true, Committer: defaultSignature()})
+	c.Assert(err, Equals, ErrRedundantCommit)
+
+	_, err = w.CherryPick(&CherryPickOptions{Skip: true, Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+	assertHistory(c, r, up, "bar")
+}
+
+func (s *SequencerSuite) TestCherryPickKeepRedundant(c *C) {
+	r, w, up, hashes := prepareDivergedBranches(c,
+		map[string]string{"up": "up\n"},
+		rebaseCommit{"up", map[string]string{"up": "up\n"}},
+		rebaseCommit{"bar", map[string]string{"bar": "bar\n"}},
+	)
+
+	err := w.Checkout(&CheckoutOptions{Branch: "refs/heads/upstream"})
+	c.Assert(err, IsNil)
+
+	_, err = w.CherryPick(&CherryPickOptions{
+		Commits:              hashes,
+		Committer:            defaultSignature(),
+		KeepRedundantCommits: true,
+	})
+	c.Assert(err, IsNil)
+
+	commit := assertHistory(c, r, up, "bar", "up")
+	parent, err := commit.Parent(0)
+	c.Assert(err, IsNil)
+	upstream, err := r.CommitObject(up)
+	c.Assert(err, IsNil)
+	c.Assert(parent.TreeHash, Equals, upstream.TreeHash)
+}
+
+func (s *SequencerSuite) TestCherryPickMainline(c *C) {
+	r, _, _ := (&MergeSuite{}).prepareMerge(c,
+		map[string]string{"foo": "foo\n"},
+		mergeSide{files: map[string]string{"qux": "qux\n"}},
+		mergeSide{files: map[string]string{"bar": "bar\n"}},
+	)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	res, err := w.Merge(&MergeOptions{Reference: "refs/heads/theirs", Author: defaultSignature()})
+	c.Assert(err, IsNil)
+	merge := res.Commit
+
+	base, err := r.CommitObject(merge)
+	c.Assert(err, IsNil)
+	first, err := base.Parent(0)
+	c.Assert(err, IsNil)
+	base, err = first.Parent(0)
+	c.Assert(err, IsNil)
+
+	err = w.Reset(&ResetOptions{Mode: HardReset, Commit: base.Hash})
+	c.Assert(err, IsNil)
+
+	_, err = w.CherryPick(&CherryPickOptions{Commits: []plumbing.Hash{merge}, Committer: defaultSignature()})
+	c.Assert(err, Equals, ErrMainlineRequired)
+
+	_, err = w.CherryPick(&CherryPickOptions{Abort: true})
+	c.Assert(err, IsNil)
+
+	_, err = w.CherryPick(&CherryPickOptions{
+		Commits:   []plumbing.Hash{merge},
+		Mainline:  1,
+		Committer: defaultSignature(),
+	})
+	c.Assert(err, IsNil)
+
+	commit := assertHistory(c, r, base.Hash, "Merge branch 'theirs'")
+	assertTreeFiles(c, r, commit.TreeHash, map[string]string{"foo": "foo\n", "bar": "bar\n"})
+
+	_, err = w.CherryPick(&CherryPickOptions{
+		Commits:   []plumbing.Hash{commit.Hash},
+		Mainline:  1,
+		Committer: defaultSignature(),
+	})
+	c.Assert(err, Equals, ErrMainlineNotMerge)
+}
+
+func (s *SequencerSuite) TestRevert(c *C) {
+	r, w, _, hashes := prepareDivergedBranches(c,
+		map[string]string{"up": "up\n"},
+		rebaseCommit{"bar", map[string]string{"bar": "bar\n"}},
+		rebaseCommit{"baz", map[string]string{"baz": "baz\n", "foo": "a\nb\nbaz\n"}},
+	)
+
+	res, err := w.Revert(&RevertOptions{
+		Commits: []plumbing.Hash{hashes[1], hashes[0]},
+		Author:  defaultSignature(),
+	})
+	c.Assert(err, IsNil)
+
+	commit := assertHistory(c, r, hashes[1],
+		"Revert \"bar\"\n\nThis reverts commit "+hashes[0].String()+".\n",
+		"Revert \"baz\"\n\nThis reverts commit "+hashes[1].String()+".\n",
+	)
+	c.Assert(res.Head, Equals, commit.Hash)
+	c.Assert(commit.Author.Name, Equals, defaultSignature().Name)
+	assertTreeFiles(c, r, commit.TreeHash, map[string]string{"foo": "a\nb\nc\n"})
+}
+
+func (s *SequencerSuite) TestRevertConflict(c *C) {
+	r, w, _, hashes := prepareDivergedBranches(c,
+		map[string]string{"up": "up\n"},
+		rebaseCommit{"foo", map[string]string{"foo": "a\nfoo\nc\n"}},
+		rebaseCommit{"foo again", map[string]string{"foo": "a\nfoo again\nc\n"}},
+	)
+
+	res, err := w.Revert(&RevertOptions{
+		Commits: []plumbing.Hash{hashes[0]},
+		Author:  defaultSignature(),
+	})
+	c.Assert(err, Equals, ErrMergeConflict)
+	c.Assert(res.Stopped, Equals, hashes[0])
+
+	ref, err := r.Reference(plumbing.RevertHead, false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, hashes[0])
+
+	content, err := util.ReadFile(w.Filesystem, "foo")
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "a\n<<<<<<< HEAD\nfoo again\n=======\nb\n>>>>>>> parent of "+
+		hashes[0].String()[:7]+" (foo)\nc\n")
+
+	_, err = w.Revert(&RevertOptions{Abort: true})
+	c.Assert(err, IsNil)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash(), Equals, hashes[1])
+}
+
+func (s *SequencerSuite) TestCherryPickOptionsValidate(c *C) {
+	c.Assert((&CherryPickOptions{}).Validate(), Equals, ErrMissingCommits)
+	c.Assert((&CherryPickOptions{Continue: true}).Validate(), IsNil)
+	c.Assert((&RevertOptions{Skip: true, Abort: true}).Validate(), Equals, ErrResumeActionExclusive)
+	c.Assert((&RevertOptions{Continue: true, Mainline: -1}).Validate(), Equals, ErrInvalidMainline)
+}
@@ -0,0 +1,577 @@
+package git
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/ioutil"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+)
+
+const (
+	sparseCheckoutFile = "info/sparse-checkout"
+
+	// sparseCheckoutRoot are the patterns matching only the files at the
+	// root of the worktree, written when no patterns are given.
+	sparseCheckoutRoot = "/*\n!/*/\n"
+)
+
+var (
+	ErrSparseCheckoutDisabled = errors.New("sparse checkout is not enabled")
+)
+
+// SparseCheckoutInit enables the sparse checkout of the worktree, setting
+// core.sparseCheckout and core.sparseCheckoutCone, and updates the index and
+// the worktree so only the files matching the patterns of the
+// sparse-checkout file are checked out.
+func (w *Worktree) SparseCheckoutInit(opts *SparseCheckoutOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	cfg, err := w.r.Config()
+	if err != nil {
+		return err
+	}
+
+	cfg.Core.SparseCheckout = true
+	cfg.Core.SparseCheckoutCone = !opts.NoCone
+
+	var content string
+	if len(opts.Patterns) != 0 {
+		content = formatSparseCheckout(opts.Patterns, cfg.Core.SparseCheckoutCone)
+	} else {
+		current, err := w.r.readStateFile(sparseCheckoutFile)
+		if err != nil {
+			return err
+		}
+
+		if current == "" {
+			content = sparseCheckoutRoot
+		}
+	}
+
+	return w.updateSparseCheckout(cfg, content)
+}
+
+// SparseCheckoutSet replaces the patterns of the sparse checkout, enabling
+// it in cone mode if it wasn't, and updates the index and the worktree.
+func (w *Worktree) SparseCheckoutSet(patterns []string) error {
+	cfg, err := w.r.Config()
+	if err != nil {
+		return err
+	}
+
+	if !cfg.Core.SparseCheckout {
+		cfg.Core.SparseCheckout = true
+		cfg.Core.SparseCheckoutCone = true
+	}
+
+	if cfg.Core.SparseCheckoutCone {
+		if err := validateConePatterns(patterns); err != nil {
+			return err
+		}
+	}
+
+	content := formatSparseCheckout(patterns, cfg.Core.SparseCheckoutCone)
+	return w.updateSparseCheckout(cfg, content)
+}
+
+// SparseCheckoutAdd adds the given patterns to the ones of the sparse
+// checkout and updates the index and the worktree.
+func (w *Worktree) SparseCheckoutAdd(patterns []string) error {
+	cfg, err := w.r.Config()
+	if err != nil {
+		return err
+	}
+
+	if !cfg.Core.SparseCheckout {
+		return ErrSparseCheckoutDisabled
+	}
+
+	if cfg.Core.SparseCheckoutCone {
+		if err := validateConePatterns(patterns); err != nil {
+			return err
+		}
+	}
+
+	current, err := w.sparseCheckoutPatterns(cfg)
+	if err != nil {
+		return err
+	}
+
+	content := formatSparseCheckout(append(current, patterns...), cfg.Core.SparseCheckoutCone)
+	return w.updateSparseCheckout(cfg, content)
+}
+
+// SparseCheckoutList returns the patterns of the sparse checkout. In cone
+// mode the checked out directories are returned.
+func (w *Worktree) SparseCheckoutList() ([]string, error) {
+	cfg, err := w.r.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	if !cfg.Core.SparseCheckout {
+		return nil, ErrSparseCheckoutDisabled
+	}
+
+	return w.sparseCheckoutPatterns(cfg)
+}
+
+// SparseCheckoutDisable disables the sparse checkout, checking out again all
+// the files of the index. The sparse-checkout file is kept, so the patterns
+// are used again by SparseCheckoutInit.
+func (w *Worktree) SparseCheckoutDisable() error {
+	cfg, err := w.r.Config()
+	if err != nil {
+		return err
+	}
+
+	cfg.Core.SparseCheckout = false
+	return w.updateSparseCheckout(cfg, "")
+}
+
+// updateSparseCheckout writes the given content of the sparse-checkout file,
+// unless it's empty, and the config, and applies the sparse checkout to the
+// index and the worktree.
+func (w *Worktree) updateSparseCheckout(cfg *config.Config, content string) error {
+	if content != "" {
+		if err := w.r.writeStateFile(sparseCheckoutFile, content); err != nil {
+			return err
+		}
+	}
+
+	if err := w.r.Storer.SetConfig(cfg); err != nil {
+		return err
+	}
+
+	return w.applySparseCheckout()
+}
+
+// sparseCheckoutPatterns returns the patterns of the sparse-checkout file,
+// or its directories in cone mode.
+func (w *Worktree) sparseCheckoutPatterns(cfg *config.Config) ([]string, error) {
+	content, err := w.r.readStateFile(sparseCheckoutFile)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := parseSparseCheckout(content)
+	if !cfg.Core.SparseCheckoutCone {
+		return lines, nil
+	}
+
+	m, ok := newConeMatcher(lines)
+	if !ok {
+		return lines, nil
+	}
+
+	return m.Directories(), nil
+}
+
+// sparseCheckoutMatcher returns the matcher of the paths to be checked out,
+// nil if the sparse checkout is not enabled.
+func (w *Worktree) sparseCheckoutMatcher() (sparseMatcher, error) {
+	cfg, err := w.r.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	if !cfg.Core.SparseCheckout {
+		return nil, nil
+	}
+
+	content, err := w.r.readStateFile(sparseCheckoutFile)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := parseSparseCheckout(content)
+	if cfg.Core.SparseCheckoutCone {
+		if m, ok := newConeMatcher(lines); ok {
+			return m, nil
+		}
+	}
+
+	return newPatternMatcher(lines), nil
+}
+
+// applySparseCheckout updates the skip-worktree bits of the index from the
+// sparse-checkout file, removing from the worktree the files not matched
+// anymore and checking out the ones matched again. The files with local
+// changes are kept, as done by git.
+func (w *Worktree) applySparseCheckout() (err error) {
+	m, err := w.sparseCheckoutMatcher()
+	if err != nil {
+		return err
+	}
+
+	filters, err := w.newContentFilters()
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(filters, &err)
+
+	changes, err := w.diffStagingWithWorktree(false, filters)
+	if err != nil {
+		return err
+	}
+
+	modified := make(map[string]bool)
+	for _, ch := range changes {
+		a, err := ch.Action()
+		if err != nil {
+			return err
+		}
+
+		if a == merkletrie.Modify {
+			modified[ch.To.String()] = true
+		}
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	b := newIndexBuilder(idx)
+	for _, e := range idx.Entries {
+		if e.Stage != index.Merged || e.Mode == filemode.Submodule {
+			continue
+		}
+
+		skip := m != nil && !m.Match(e.Name)
+		if skip == e.SkipWorktree {
+			continue
+		}
+
+		if !skip {
+			if err := w.unskipIndexEntry(e, b, filters); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if modified[e.Name] {
+			continue
+		}
+
+		e.SkipWorktree = true
+		if err := w.removeWorktreeFile(e.Name); err != nil {
+			return err
+		}
+	}
+
+	b.Write(idx)
+	return w.r.Storer.SetIndex(idx)
+}
+
+// applySparseCheckoutDirectories sets the skip-worktree bits of the index,
+// from the given directories if any, or from the sparse-checkout file if
+// the sparse checkout is enabled. Otherwise the bits are kept.
+func (w *Worktree) applySparseCheckoutDirectories(idx *index.Index, dirs []string) error {
+	if len(dirs) > 0 {
+		idx.SkipUnless(dirs)
+		return nil
+	}
+
+	m, err := w.sparseCheckoutMatcher()
+	if err != nil || m == nil {
+		return err
+	}
+
+	for _, e := range idx.Entries {
+		if e.Stage == index.Merged && e.Mode != filemode.Submodule {
+			e.SkipWorktree = !m.Match(e.Name)
+		}
+	}
+
+	return nil
+}
+
+// unskipIndexEntry clears the skip-worktree bit of the given entry, writing
+// its blob to the worktree unless the file is already there.
+func (w *Worktree) unskipIndexEntry(e *index.Entry, b *indexBuilder, filters *contentFilters) error {
+	e.SkipWorktree = false
+
+	exists, err := w.fileExists(e.Name)
+	if err != nil || exists {
+		return err
+	}
+
+	blob, err := w.r.BlobObject(e.Hash)
+	if err != nil {
+		return err
+	}
+
+	if err := w.checkoutFile(object.NewFile(e.Name, e.Mode, blob), filters); err != nil {
+		return err
+	}
+
+	return w.addIndexFromFile(e.Name, e.Hash, b)
+}
+
+// removeSkippedFiles removes from the worktree the files of the entries
+// marked as skip-worktree.
+func (w *Worktree) removeSkippedFiles(idx *index.Index) error {
+	for _, e := range idx.Entries {
+		if !e.SkipWorktree {
+			continue
+		}
+
+		if err := w.removeWorktreeFile(e.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeWorktreeFile removes the given file from the worktree, if it exists,
+// and its parent directory if it's left empty.
+func (w *Worktree) removeWorktreeFile(name string) error {
+	exists, err := w.fileExists(name)
+	if err != nil || !exists {
+		return err
+	}
+
+	return rmFileAndDirIfEmpty(w.Filesystem, name)
+}
+
+func (w *Worktree) fileExists(name string) (bool, error) {
+	_, err := w.Filesystem.Lstat(name)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// excludeSkippedChanges drops the changes of the paths marked as
+// skip-worktree in the given index, those files are not expected to be in
+// the worktree.
+func excludeSkippedChanges(changes merkletrie.Changes, idx *index.Index) merkletrie.Changes {
+	skipped := make(map[string]bool)
+	for _, e := range idx.Entries {
+		if e.SkipWorktree {
+			skipped[e.Name] = true
+		}
+	}
+
+	if len(skipped) == 0 {
+		return changes
+	}
+
+	var res merkletrie.Changes
+	for _, ch := range changes {
+		name := ch.To.String()
+		if name == "" {
+			name = ch.From.String()
+		}
+
+		if !skipped[name] {
+			res = append(res, ch)
+		}
+	}
+
+	return res
+}
+
+// withoutSkipWorktree returns a copy of the index with the skip-worktree
+// bits cleared, so the skipped entries are compared as any other entry.
+func withoutSkipWorktree(idx *index.Index) *index.Index {
+	res := *idx
+	res.Entries = make([]*index.Entry, len(idx.Entries))
+	for i, e := range idx.Entries {
+		if e.SkipWorktree {
+			cp := *e
+			cp.SkipWorktree = false
+			e = &cp
+		}
+
+		res.Entries[i] = e
+	}
+
+	return &res
+}
+
+// sparseMatcher matches the paths to be checked out in a sparse checkout.
+type sparseMatcher interface {
+	Match(name string) bool
+}
+
+// patternMatcher is the sparseMatcher of the non-cone mode, where the
+// patterns follow the gitignore format, a matching path is checked out.
+type patternMatcher struct {
+	m gitignore.Matcher
+}
+
+func newPatternMatcher(lines []string) *patternMatcher {
+	var ps []gitignore.Pattern
+	for _, l := range lines {
+		ps = append(ps, gitignore.ParsePattern(l, nil))
+	}
+
+	return &patternMatcher{m: gitignore.NewMatcher(ps)}
+}
+
+func (m *patternMatcher) Match(name string) bool {
+	return m.m.Match(strings.Split(name, "/"), false)
+}
+
+// coneMatcher is the sparseMatcher of the cone mode, it checks out the files
+// at the root, the files inside the recursive directories and the files
+// directly inside their parents.
+type coneMatcher struct {
+	recursive map[string]bool
+	parents   map[string]bool
+}
+
+// newConeMatcher parses the lines of a sparse-checkout file written in cone
+// mode, ok is false if the lines don't follow the cone patterns.
+func newConeMatcher(lines []string) (m *coneMatcher, ok bool) {
+	m = &coneMatcher{
+		recursive: make(map[string]bool),
+		parents:   make(map[string]bool),
+	}
+
+	for _, l := range lines {
+		switch {
+		case l == "/*" || l == "!/*/":
+		case strings.HasPrefix(l, "!/") && strings.HasSuffix(l, "/*/"):
+			dir := l[2 : len(l)-3]
+			if !m.recursive[dir] {
+				return nil, false
+			}
+
+			delete(m.recursive, dir)
+			m.parents[dir] = true
+		case len(l) > 2 && strings.HasPrefix(l, "/") && strings.HasSuffix(l, "/"):
+			dir := l[1 : len(l)-1]
+			if strings.ContainsAny(dir, "*?[") {
+				return nil, false
+			}
+
+			m.recursive[dir] = true
+		default:
+			return nil, false
+		}
+	}
+
+	return m, true
+}
+
+func (m *coneMatcher) Match(name string) bool {
+	dir := path.Dir(name)
+	if dir == "." || m.parents[dir] {
+		return true
+	}
+
+	for ; dir != "."; dir = path.Dir(dir) {
+		if m.recursive[dir] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Directories returns the sorted recursive directories.
+func (m *coneMatcher) Directories() []string {
+	dirs := make([]string, 0, len(m.recursive))
+	for dir := range m.recursive {
+		dirs = append(dirs, dir)
+	}
+
+	sort.Strings(dirs)
+	return dirs
+}
+
+// parseSparseCheckout returns the patterns of a sparse-checkout file,
+// skipping the blank lines and the comments.
+func parseSparseCheckout(content string) []string {
+	var lines []string
+	s := bufio.NewScanner(strings.NewReader(content))
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+
+		lines = append(lines, l)
+	}
+
+	return lines
+}
+
+// formatSparseCheckout returns the content of the sparse-checkout file for
+// the given patterns. In cone mode the patterns are directories, written as
+// the recursive patterns of each one and the patterns of their parents.
+func formatSparseCheckout(patterns []string, cone bool) string {
+	if !cone {
+		return strings.Join(patterns, "\n") + "\n"
+	}
+
+	recursive := make(map[string]bool)
+	for _, p := range patterns {
+		p = path.Clean(strings.Trim(filepath.ToSlash(p), "/"))
+		if p != "." && p != "" {
+			recursive[p] = true
+		}
+	}
+
+	var dirs []string
+	for dir := range recursive {
+		if !hasRecursiveParent(recursive, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	parents := make(map[string]bool)
+	for _, dir := range dirs {
+		for p := path.Dir(dir); p != "."; p = path.Dir(p) {
+			if !parents[p] {
+				parents[p] = true
+				dirs = append(dirs, p)
+			}
+		}
+	}
+
+	sort.Strings(dirs)
+
+	var buf strings.Builder
+	buf.WriteString(sparseCheckoutRoot)
+	for _, dir := range dirs {
+		buf.WriteString("/" + dir + "/\n")
+		if parents[dir] {
+			buf.WriteString("!/" + dir + "/*/\n")
+		}
+	}
+
+	return buf.String()
+}
+
+// hasRecursiveParent returns true if any of the parents of dir is one of the
+// given recursive directories.
+func hasRecursiveParent(recursive map[string]bool, dir string) bool {
+	for p := path.Dir(dir); p != "."; p = path.Dir(p) {
+		if recursive[p] {
+			return true
+		}
+	}
+
+	return false
+}
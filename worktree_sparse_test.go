@@ -0,0 +1,200 @@
+package git
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+type SparseCheckoutSuite struct{}
+
+var _ = Suite(&SparseCheckoutSuite{})
+
+func prepareSparseCheckout(c *C) (*Repository, *Worktree, plumbing.Hash) {
+	r, w := newMemoryWorktree(c)
+
+	h := commitFiles(c, w, "init", map[string]string{
+		"README":    "README\n",
+		"a/x":       "x\n",
+		"a/b/y":     "y\n",
+		"a/b/c/z":   "z\n",
+		"d/w":       "w\n",
+		"d/main.go": "main\n",
+	})
+
+	commitFiles(c, w, "second", map[string]string{"d/w": "modified\n", "d/v": "v\n"})
+	return r, w, h
+}
+
+func assertSkipWorktree(c *C, r *Repository, skipped map[string]bool) {
+	idx, err := r.Storer.Index()
+	c.Assert(err, IsNil)
+
+	for name, skip := range skipped {
+		e, err := idx.Entry(name)
+		c.Assert(err, IsNil)
+		c.Assert(e.SkipWorktree, Equals, skip, Commentf("%s", name))
+	}
+}
+
+func assertClean(c *C, w *Worktree) {
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true, Commentf("%s", status))
+}
+
+func (s *SparseCheckoutSuite) TestSparseCheckoutCone(c *C) {
+	r, w, h := prepareSparseCheckout(c)
+
+	err := w.SparseCheckoutInit(&SparseCheckoutOptions{Patterns: []string{"a/b"}})
+	c.Assert(err, IsNil)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Core.SparseCheckout, Equals, true)
+	c.Assert(cfg.Core.SparseCheckoutCone, Equals, true)
+
+	content, err := util.ReadFile(r.dotGitFilesystem(), "info/sparse-checkout")
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "/*\n!/*/\n/a/\n!/a/*/\n/a/b/\n")
+
+	assertWorktreeFiles(c, w, map[string]string{
+		"README":  "README\n",
+		"a/x":     "x\n",
+		"a/b/y":   "y\n",
+		"a/b/c/z": "z\n",
+		"d/w":     "",
+		"d/v":     "",
+	})
+	assertSkipWorktree(c, r, map[string]bool{"a/x": false, "d/w": true, "d/v": true})
+	assertClean(c, w)
+
+	list, err := w.SparseCheckoutList()
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []string{"a/b"})
+
+	// the patterns are honored by the following checkouts
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	err = w.Checkout(&CheckoutOptions{Hash: h})
+	c.Assert(err, IsNil)
+	assertWorktreeFiles(c, w, map[string]string{"a/b/y": "y\n", "d/w": "", "d/v": ""})
+	err = w.Reset(&ResetOptions{Commit: head.Hash(), Mode: HardReset})
+	c.Assert(err, IsNil)
+	assertWorktreeFiles(c, w, map[string]string{"a/b/y": "y\n", "d/w": "", "d/v": ""})
+	assertSkipWorktree(c, r, map[string]bool{"d/w": true, "d/v": true})
+	assertClean(c, w)
+
+	err = w.SparseCheckoutAdd([]string{"d"})
+	c.Assert(err, IsNil)
+	assertWorktreeFiles(c, w, map[string]string{"d/w": "modified\n", "d/v": "v\n"})
+	assertSkipWorktree(c, r, map[string]bool{"d/w": false, "d/v": false})
+	assertClean(c, w)
+
+	list, err = w.SparseCheckoutList()
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []string{"a/b", "d"})
+
+	err = w.SparseCheckoutSet([]string{"d"})
+	c.Assert(err, IsNil)
+	assertWorktreeFiles(c, w, map[string]string{"README": "README\n", "a/x": "", "a/b/y": "", "d/w": "modified\n"})
+	assertClean(c, w)
+
+	err = w.SparseCheckoutDisable()
+	c.Assert(err, IsNil)
+	assertWorktreeFiles(c, w, map[string]string{"a/x": "x\n", "a/b/y": "y\n", "a/b/c/z": "z\n"})
+	assertSkipWorktree(c, r, map[string]bool{"a/x": false, "a/b/c/z": false})
+	assertClean(c, w)
+
+	_, err = w.SparseCheckoutList()
+	c.Assert(err, Equals, ErrSparseCheckoutDisabled)
+
+	// the patterns are kept and used again by init
+	err = w.SparseCheckoutInit(&SparseCheckoutOptions{})
+	c.Assert(err, IsNil)
+	assertWorktreeFiles(c, w, map[string]string{"a/x": "", "d/w": "modified\n"})
+}
+
+func (s *SparseCheckoutSuite) TestSparseCheckoutNoCone(c *C) {
+	r, w, _ := prepareSparseCheckout(c)
+
+	err := w.SparseCheckoutInit(&SparseCheckoutOptions{
+		NoCone:   true,
+		Patterns: []string{"/*", "!/*/", "*.go"},
+	})
+	c.Assert(err, IsNil)
+
+	assertWorktreeFiles(c, w, map[string]string{
+		"README":    "README\n",
+		"d/main.go": "main\n",
+		"a/x":       "",
+		"d/w":       "",
+	})
+	assertSkipWorktree(c, r, map[string]bool{"d/main.go": false, "d/w": true})
+	assertClean(c, w)
+
+	list, err := w.SparseCheckoutList()
+	c.Assert(err, IsNil)
+	c.Assert(list, DeepEquals, []string{"/*", "!/*/", "*.go"})
+
+	err = w.SparseCheckoutAdd([]string{"/a/b/"})
+	c.Assert(err, IsNil)
+	assertWorktreeFiles(c, w, map[string]string{"a/b/y": "y\n", "a/b/c/z": "z\n", "a/x": ""})
+	assertClean(c, w)
+}
+
+func (s *SparseCheckoutSuite) TestSparseCheckoutDefault(c *C) {
+	_, w, _ := prepareSparseCheckout(c)
+
+	err := w.SparseCheckoutAdd([]string{"a"})
+	c.Assert(err, Equals, ErrSparseCheckoutDisabled)
+
+	err = w.SparseCheckoutInit(&SparseCheckoutOptions{})
+	c.Assert(err, IsNil)
+	assertWorktreeFiles(c, w, map[string]string{"README": "README\n", "a/x": "", "d/w": ""})
+	assertClean(c, w)
+
+	list, err := w.SparseCheckoutList()
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 0)
+}
+
+func (s *SparseCheckoutSuite) TestSparseCheckoutKeepsModified(c *C) {
+	r, w, _ := prepareSparseCheckout(c)
+
+	err := util.WriteFile(w.Filesystem, "d/w", []byte("local\n"), 0644)
+	c.Assert(err, IsNil)
+
+	err = w.SparseCheckoutSet([]string{"a"})
+	c.Assert(err, IsNil)
+	assertWorktreeFiles(c, w, map[string]string{"a/x": "x\n", "d/w": "local\n", "d/v": ""})
+	assertSkipWorktree(c, r, map[string]bool{"d/w": false, "d/v": true})
+}
+
+func (s *SparseCheckoutSuite) TestSparseCheckoutConePattern(c *C) {
+	_, w, _ := prepareSparseCheckout(c)
+
+	err := w.SparseCheckoutSet([]string{"a/*"})
+	c.Assert(err, Equals, ErrSparseCheckoutConePattern)
+
+	err = w.SparseCheckoutInit(&SparseCheckoutOptions{Patterns: []string{"!a"}})
+	c.Assert(err, Equals, ErrSparseCheckoutConePattern)
+}
+
+func (s *SparseCheckoutSuite) TestFormatSparseCheckout(c *C) {
+	content := formatSparseCheckout([]string{"a/b/c", "a", "x/y/", "/x/y/z"}, true)
+	c.Assert(content, Equals, "/*\n!/*/\n/a/\n/x/\n!/x/*/\n/x/y/\n")
+
+	m, ok := newConeMatcher(parseSparseCheckout(content))
+	c.Assert(ok, Equals, true)
+	c.Assert(m.Directories(), DeepEquals, []string{"a", "x/y"})
+	c.Assert(m.Match("README"), Equals, true)
+	c.Assert(m.Match("a/b/c/d"), Equals, true)
+	c.Assert(m.Match("x/foo"), Equals, true)
+	c.Assert(m.Match("x/z/foo"), Equals, false)
+	c.Assert(m.Match("x/y/z/foo"), Equals, true)
+
+	_, ok = newConeMatcher([]string{"/*", "!/*/", "*.go"})
+	c.Assert(ok, Equals, false)
+}
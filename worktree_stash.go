@@ -0,0 +1,613 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/ioutil"
+)
+
+// stashRefName is the reference pointing to the most recent stash, the rest
+// of them are kept in its reflog.
+const stashRefName plumbing.ReferenceName = "refs/stash"
+
+var (
+	// ErrNoLocalChanges occurs when a stash is attempted without changes,
+	// in the index or in the worktree, to be saved.
+	ErrNoLocalChanges = errors.New("no local changes to save")
+	// ErrStashNotFound occurs when the given stash doesn't exist.
+	ErrStashNotFound = errors.New("stash not found")
+	// ErrNotStashCommit occurs when the commit to be applied doesn't have
+	// the layout of a stash.
+	ErrNotStashCommit = errors.New("not a stash-like commit")
+	// ErrStashUntrackedExists occurs when an untracked file saved in a stash
+	// already exists in the worktree.
+	ErrStashUntrackedExists = errors.New("untracked file of the stash already exists")
+	// ErrStashIndexConflict occurs when the index saved in a stash doesn't
+	// apply cleanly, the stash may be applied without restoring the index.
+	ErrStashIndexConflict = errors.New("conflicts in index, try without Index")
+)
+
+// StashEntry is a stash of the stash list.
+type StashEntry struct {
+	// Name is the revision naming the stash, such as `stash@{0}`.
+	Name string
+	// Hash of the stash commit.
+	Hash plumbing.Hash
+	// Message describing the stash.
+	Message string
+	// When the stash was created.
+	When time.Time
+}
+
+// Stash saves the local changes, the ones added to the index and the ones of
+// the tracked files of the worktree, and reverts them to match HEAD.
+//
+// The stash is stored as a commit, whose parents are HEAD, a commit holding
+// the index and, if untracked files are included, a commit holding them.
+// The stash commit is referenced by `refs/stash`, previous stashes are kept
+// in its reflog. The hash of the stash commit is returned.
+func (w *Worktree) Stash(opts *StashOptions) (h plumbing.Hash, err error) {
+	if err := opts.Validate(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	filters, err := w.newContentFilters()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	defer ioutil.CheckClose(filters, &err)
+
+	head, err := w.r.Head()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	headCommit, err := w.r.CommitObject(head.Hash())
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if err := checkNoUnmergedEntries(idx); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	tracked, untracked, err := w.stashPaths(opts, filters)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if len(tracked) == 0 && len(untracked) == 0 {
+		return plumbing.ZeroHash, ErrNoLocalChanges
+	}
+
+	headTree, err := headCommit.Tree()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	indexEntries, err := mergeEntries(headTree)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	worktreeEntries, err := mergeEntries(headTree)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	for _, p := range tracked {
+		delete(indexEntries, p)
+		if e, err := idx.Entry(p); err == nil {
+			indexEntries[p] = &MergeEntry{Path: p, Mode: e.Mode, Hash: e.Hash}
+		}
+
+		if err := w.setWorktreeEntry(worktreeEntries, p, filters); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	co := &CommitOptions{Author: opts.Committer, Committer: opts.Committer, Parents: []plumbing.Hash{headCommit.Hash}}
+	if err := co.Validate(w.r); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	branch := "(no branch)"
+	if head.Name().IsBranch() {
+		branch = head.Name().Short()
+	}
+
+	label := fmt.Sprintf("%s: %s %s", branch, headCommit.Hash.String()[:7], commitSubject(headCommit.Message))
+	indexCommit, err := w.stashCommit(co, "index on "+label, indexEntries, headCommit.Hash)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	parents := []plumbing.Hash{headCommit.Hash, indexCommit}
+	if len(untracked) > 0 {
+		entries := make(map[string]*MergeEntry)
+		for _, p := range untracked {
+			if err := w.setWorktreeEntry(entries, p, filters); err != nil {
+				return plumbing.ZeroHash, err
+			}
+		}
+
+		h, err := w.stashCommit(co, "untracked files on "+label, entries)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		parents = append(parents, h)
+	}
+
+	msg := "WIP on " + label
+	if opts.Message != "" {
+		msg = fmt.Sprintf("On %s: %s", branch, opts.Message)
+	}
+
+	stash, err := w.stashCommit(co, msg, worktreeEntries, parents...)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if err := w.pushStash(stash, co.Committer, msg); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	target, err := mergeEntries(headTree)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if opts.KeepIndex {
+		target = indexEntries
+	}
+
+	return stash, w.checkoutEntries(target, append(tracked, untracked...), filters)
+}
+
+// stashPaths returns the paths of the tracked files with changes, in the
+// index or in the worktree, and the paths of the untracked files to be
+// stashed.
+func (w *Worktree) stashPaths(opts *StashOptions, filters *contentFilters) (tracked, untracked []string, err error) {
+	s, err := w.statusWithFilters(&StatusOptions{}, filters)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for p, fs := range s {
+		if !matchPathspec(opts.Paths, p) {
+			continue
+		}
+
+		if fs.Worktree == Untracked {
+			if opts.IncludeUntracked {
+				untracked = append(untracked, p)
+			}
+
+			continue
+		}
+
+		if fs.Staging != Unmodified || fs.Worktree != Unmodified {
+			tracked = append(tracked, p)
+		}
+	}
+
+	sort.Strings(tracked)
+	sort.Strings(untracked)
+	return tracked, untracked, nil
+}
+
+// matchPathspec returns true if name matches any of the pathspecs, being a
+// match the path itself, one of its parent directories or a glob pattern
+// matching it. As in git, the wildcards of the patterns also match the
+// slashes, so `*.go` matches the files at any depth. An empty pathspec
+// matches any path.
+func matchPathspec(pathspec []string, name string) bool {
+	if len(pathspec) == 0 {
+		return true
+	}
+
+	for _, p := range pathspec {
+		p = strings.TrimSuffix(filepath.ToSlash(p), "/")
+		if p == "" || p == "." || p == name || strings.HasPrefix(name, p+"/") {
+			return true
+		}
+
+		if matchPathspecGlob(p, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchPathspecGlob matches name against the glob pattern of a pathspec.
+// path.Match only handles the slashes as separators, so they are replaced
+// by NUL, which can't be part of a path, for the wildcards to match them.
+func matchPathspecGlob(pattern, name string) bool {
+	ok, _ := path.Match(strings.ReplaceAll(pattern, "/", "\x00"), strings.ReplaceAll(name, "/", "\x00"))
+	return ok
+}
+
+// setWorktreeEntry stores the given file of the worktree and sets it in
+// entries, the path is deleted from entries if the file doesn't exist.
+func (w *Worktree) setWorktreeEntry(entries map[string]*MergeEntry, p string, filters *contentFilters) error {
+	delete(entries, p)
+
+	fi, err := w.Filesystem.Lstat(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	mode, err := filemode.NewFromOSFileMode(fi.Mode())
+	if err != nil {
+		return err
+	}
+
+	h, err := w.copyFileToStorage(p, filters)
+	if err != nil {
+		return err
+	}
+
+	entries[p] = &MergeEntry{Path: p, Mode: mode, Hash: h}
+	return nil
+}
+
+func (w *Worktree) stashCommit(co *CommitOptions, msg string, entries map[string]*MergeEntry, parents ...plumbing.Hash) (plumbing.Hash, error) {
+	tree, err := w.r.buildEntriesTree(entries)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	opts := *co
+	opts.Parents = parents
+	return w.buildCommitObject(msg, &opts, tree)
+}
+
+// checkoutEntries writes the given paths to the index and to the worktree
+// as found in entries, the paths not found in entries are removed.
+func (w *Worktree) checkoutEntries(entries map[string]*MergeEntry, paths []string, filters *contentFilters) error {
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	b := newIndexBuilder(idx)
+	for _, p := range paths {
+		e := entries[p]
+		if e != nil && e.Mode == filemode.Submodule {
+			continue
+		}
+
+		if err := w.checkoutEntry(p, e, filters); err != nil {
+			return err
+		}
+
+		if e == nil {
+			b.Remove(p)
+			continue
+		}
+
+		if err := w.addIndexFromFile(p, e.Hash, b); err != nil {
+			return err
+		}
+	}
+
+	b.Write(idx)
+	return w.r.Storer.SetIndex(idx)
+}
+
+// checkoutEntry writes the given entry to the worktree, if e is nil the file
+// is removed.
+func (w *Worktree) checkoutEntry(p string, e *MergeEntry, filters *contentFilters) error {
+	_, err := w.Filesystem.Lstat(p)
+	switch {
+	case err == nil && e == nil:
+		return rmFileAndDirIfEmpty(w.Filesystem, p)
+	case err == nil:
+		if err := w.Filesystem.Remove(p); err != nil {
+			return err
+		}
+	case !os.IsNotExist(err):
+		return err
+	case e == nil:
+		return nil
+	}
+
+	blob, err := w.r.BlobObject(e.Hash)
+	if err != nil {
+		return err
+	}
+
+	return w.checkoutFile(object.NewFile(p, e.Mode, blob), filters)
+}
+
+// StashList returns the stashes, from the most recent one.
+func (w *Worktree) StashList() ([]*StashEntry, error) {
+	log, err := w.r.reflogStorer().Reflog(stashRefName)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*StashEntry
+	for i := len(log) - 1; i >= 0; i-- {
+		list = append(list, &StashEntry{
+			Name:    fmt.Sprintf("stash@{%d}", len(list)),
+			Hash:    log[i].New,
+			Message: log[i].Message,
+			When:    log[i].Committer.When,
+		})
+	}
+
+	return list, nil
+}
+
+// StashApply applies the changes saved in a stash on top of the current
+// HEAD, the stash is kept in the stash list. The index and the tracked files
+// of the worktree must not contain changes.
+//
+// If the changes conflict with HEAD, the conflicts are left in the index and
+// in the worktree, and ErrMergeConflict is returned.
+func (w *Worktree) StashApply(opts *StashApplyOptions) (err error) {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	list, err := w.StashList()
+	if err != nil {
+		return err
+	}
+
+	if opts.Stash >= len(list) {
+		return ErrStashNotFound
+	}
+
+	stash, err := w.r.CommitObject(list[opts.Stash].Hash)
+	if err != nil {
+		return err
+	}
+
+	if stash.NumParents() < 2 {
+		return ErrNotStashCommit
+	}
+
+	if err := w.checkCleanForMerge(); err != nil {
+		return err
+	}
+
+	trees, err := stashTrees(stash)
+	if err != nil {
+		return err
+	}
+
+	untracked, err := mergeEntries(trees[2])
+	if err != nil {
+		return err
+	}
+
+	for p := range untracked {
+		if _, err := w.Filesystem.Lstat(p); err == nil {
+			return ErrStashUntrackedExists
+		}
+	}
+
+	head, err := w.r.Head()
+	if err != nil {
+		return err
+	}
+
+	headCommit, err := w.r.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+
+	headTree, err := headCommit.Tree()
+	if err != nil {
+		return err
+	}
+
+	mo := &MergeTreesOptions{OursLabel: "Updated upstream", TheirsLabel: "Stashed changes"}
+	var indexRes *MergeTreesResult
+	if opts.Index && trees[1].Hash != trees[0].Hash {
+		indexRes, err = w.r.MergeTrees(trees[0], headTree, trees[1], mo)
+		if err != nil {
+			return err
+		}
+
+		if !indexRes.IsClean() {
+			return ErrStashIndexConflict
+		}
+	}
+
+	stashTree, err := stash.Tree()
+	if err != nil {
+		return err
+	}
+
+	res, err := w.r.MergeTrees(trees[0], headTree, stashTree, mo)
+	if err != nil {
+		return err
+	}
+
+	if err := w.checkoutMergeResult(res); err != nil {
+		return err
+	}
+
+	filters, err := w.newContentFilters()
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(filters, &err)
+
+	for p, e := range untracked {
+		if err := w.checkoutEntry(p, e, filters); err != nil {
+			return err
+		}
+	}
+
+	if !res.IsClean() {
+		return ErrMergeConflict
+	}
+
+	if indexRes != nil {
+		t, err := w.r.TreeObject(indexRes.Tree)
+		if err != nil {
+			return err
+		}
+
+		return w.resetIndex(t, nil)
+	}
+
+	return w.unstageStashedChanges(headTree, res.Tree)
+}
+
+// stashTrees returns the trees of the base, the index and the untracked
+// files of a stash commit, the last one being nil if the stash doesn't
+// include untracked files.
+func stashTrees(stash *object.Commit) ([]*object.Tree, error) {
+	trees := make([]*object.Tree, 3)
+	for i := range trees {
+		if i >= stash.NumParents() {
+			break
+		}
+
+		parent, err := stash.Parent(i)
+		if err != nil {
+			return nil, err
+		}
+
+		if trees[i], err = parent.Tree(); err != nil {
+			return nil, err
+		}
+	}
+
+	return trees, nil
+}
+
+// unstageStashedChanges restores the index entries of the applied stash to
+// the ones of HEAD, except for the new files which are kept in the index.
+func (w *Worktree) unstageStashedChanges(headTree *object.Tree, applied plumbing.Hash) error {
+	t, err := w.r.TreeObject(applied)
+	if err != nil {
+		return err
+	}
+
+	headEntries, err := mergeEntries(headTree)
+	if err != nil {
+		return err
+	}
+
+	appliedEntries, err := mergeEntries(t)
+	if err != nil {
+		return err
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	b := newIndexBuilder(idx)
+	for p, e := range headEntries {
+		if sameMergeEntry(e, appliedEntries[p]) {
+			continue
+		}
+
+		b.Remove(p)
+		b.Add(&index.Entry{Name: p, Mode: e.Mode, Hash: e.Hash})
+	}
+
+	b.Write(idx)
+	return w.r.Storer.SetIndex(idx)
+}
+
+// StashPop applies a stash, as StashApply does, and drops it from the stash
+// list if it was applied without conflicts.
+func (w *Worktree) StashPop(opts *StashApplyOptions) error {
+	if err := w.StashApply(opts); err != nil {
+		return err
+	}
+
+	return w.StashDrop(opts.Stash)
+}
+
+// StashDrop removes the stash at the given position of the stash list,
+// being 0 the most recent one.
+func (w *Worktree) StashDrop(n int) error {
+	rs := w.r.reflogStorer()
+	log, err := rs.Reflog(stashRefName)
+	if err != nil {
+		return err
+	}
+
+	i := len(log) - 1 - n
+	if n < 0 || i < 0 {
+		return ErrStashNotFound
+	}
+
+	if i+1 < len(log) {
+		log[i+1].Old = log[i].Old
+	}
+
+	log = append(log[:i], log[i+1:]...)
+	if len(log) == 0 {
+		if err := w.r.Storer.RemoveReference(stashRefName); err != nil {
+			return err
+		}
+
+		return rs.RemoveReflog(stashRefName)
+	}
+
+	ref := plumbing.NewHashReference(stashRefName, log[len(log)-1].New)
+	if err := w.r.Storer.SetReference(ref); err != nil {
+		return err
+	}
+
+	return rs.SetReflog(stashRefName, log)
+}
+
+// pushStash points refs/stash to the given stash, adding it to the reflog.
+func (w *Worktree) pushStash(h plumbing.Hash, committer *object.Signature, msg string) error {
+	old, err := resolvedHash(w.r.Storer, stashRefName)
+	if err != nil {
+		return err
+	}
+
+	if err := w.r.Storer.SetReference(plumbing.NewHashReference(stashRefName, h)); err != nil {
+		return err
+	}
+
+	return w.r.reflogStorer().AppendReflog(stashRefName, &reflog.Entry{
+		Old: old,
+		New: h,
+		Committer: reflog.Signature{
+			Name:  committer.Name,
+			Email: committer.Email,
+			When:  committer.When,
+		},
+		Message: msg,
+	})
+}
@@ -0,0 +1,318 @@
+package git
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+type StashSuite struct{}
+
+var _ = Suite(&StashSuite{})
+
+func prepareStash(c *C) (*Repository, *Worktree, plumbing.Hash) {
+	r, w := newMemoryWorktree(c)
+
+	h := commitFiles(c, w, "init", map[string]string{"foo": "foo\n", "bar": "bar\n"})
+
+	err := util.WriteFile(w.Filesystem, "foo", []byte("staged\n"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("foo")
+	c.Assert(err, IsNil)
+
+	err = util.WriteFile(w.Filesystem, "bar", []byte("modified\n"), 0644)
+	c.Assert(err, IsNil)
+	err = util.WriteFile(w.Filesystem, "qux", []byte("untracked\n"), 0644)
+	c.Assert(err, IsNil)
+
+	return r, w, h
+}
+
+func assertWorktreeFiles(c *C, w *Worktree, files map[string]string) {
+	for name, content := range files {
+		data, err := util.ReadFile(w.Filesystem, name)
+		if content == "" {
+			c.Assert(err, NotNil, Commentf("%s exists", name))
+			continue
+		}
+
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, content)
+	}
+}
+
+func (s *StashSuite) TestStash(c *C) {
+	r, w, head := prepareStash(c)
+
+	h, err := w.Stash(&StashOptions{Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	stash, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	c.Assert(stash.ParentHashes, HasLen, 2)
+	c.Assert(stash.ParentHashes[0], Equals, head)
+	c.Assert(stash.Message, Equals, "WIP on master: "+head.String()[:7]+" init")
+	assertTreeFiles(c, r, stash.TreeHash, map[string]string{"foo": "staged\n", "bar": "modified\n"})
+
+	indexCommit, err := stash.Parent(1)
+	c.Assert(err, IsNil)
+	c.Assert(indexCommit.Message, Equals, "index on master: "+head.String()[:7]+" init")
+	assertTreeFiles(c, r, indexCommit.TreeHash, map[string]string{"foo": "staged\n", "bar": "bar\n"})
+
+	ref, err := r.Reference(stashRefName, false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, h)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 1)
+	c.Assert(status.File("qux").Worktree, Equals, Untracked)
+	assertWorktreeFiles(c, w, map[string]string{"foo": "foo\n", "bar": "bar\n", "qux": "untracked\n"})
+
+	list, err := w.StashList()
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 1)
+	c.Assert(list[0].Name, Equals, "stash@{0}")
+	c.Assert(list[0].Hash, Equals, h)
+	c.Assert(list[0].Message, Equals, stash.Message)
+
+	_, err = w.Stash(&StashOptions{Committer: defaultSignature()})
+	c.Assert(err, Equals, ErrNoLocalChanges)
+}
+
+func (s *StashSuite) TestStashPop(c *C) {
+	r, w, _ := prepareStash(c)
+
+	_, err := w.Stash(&StashOptions{Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	err = w.StashPop(&StashApplyOptions{})
+	c.Assert(err, IsNil)
+
+	assertWorktreeFiles(c, w, map[string]string{"foo": "staged\n", "bar": "modified\n", "qux": "untracked\n"})
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo").Staging, Equals, Unmodified)
+	c.Assert(status.File("foo").Worktree, Equals, Modified)
+	c.Assert(status.File("bar").Worktree, Equals, Modified)
+
+	list, err := w.StashList()
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 0)
+
+	_, err = r.Reference(stashRefName, false)
+	c.Assert(err, Equals, plumbing.ErrReferenceNotFound)
+}
+
+func (s *StashSuite) TestStashApplyIndex(c *C) {
+	_, w, _ := prepareStash(c)
+
+	_, err := w.Stash(&StashOptions{Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	err = w.StashApply(&StashApplyOptions{Index: true})
+	c.Assert(err, IsNil)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo").Staging, Equals, Modified)
+	c.Assert(status.File("foo").Worktree, Equals, Unmodified)
+	c.Assert(status.File("bar").Staging, Equals, Unmodified)
+	c.Assert(status.File("bar").Worktree, Equals, Modified)
+
+	list, err := w.StashList()
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 1)
+}
+
+func (s *StashSuite) TestStashApplyNewFileStaysStaged(c *C) {
+	_, w, _ := prepareStash(c)
+
+	_, err := w.Add("qux")
+	c.Assert(err, IsNil)
+
+	_, err = w.Stash(&StashOptions{Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+	assertWorktreeFiles(c, w, map[string]string{"qux": ""})
+
+	err = w.StashApply(&StashApplyOptions{})
+	c.Assert(err, IsNil)
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("qux").Staging, Equals, Added)
+	c.Assert(status.File("foo").Staging, Equals, Unmodified)
+}
+
+func (s *StashSuite) TestStashIncludeUntracked(c *C) {
+	r, w, _ := prepareStash(c)
+
+	h, err := w.Stash(&StashOptions{IncludeUntracked: true, Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	stash, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	c.Assert(stash.ParentHashes, HasLen, 3)
+
+	untracked, err := stash.Parent(2)
+	c.Assert(err, IsNil)
+	c.Assert(untracked.ParentHashes, HasLen, 0)
+	assertTreeFiles(c, r, untracked.TreeHash, map[string]string{"qux": "untracked\n"})
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+
+	err = util.WriteFile(w.Filesystem, "qux", []byte("other\n"), 0644)
+	c.Assert(err, IsNil)
+	err = w.StashApply(&StashApplyOptions{})
+	c.Assert(err, Equals, ErrStashUntrackedExists)
+
+	err = w.Filesystem.Remove("qux")
+	c.Assert(err, IsNil)
+	err = w.StashPop(&StashApplyOptions{})
+	c.Assert(err, IsNil)
+
+	assertWorktreeFiles(c, w, map[string]string{"foo": "staged\n", "bar": "modified\n", "qux": "untracked\n"})
+	status, err = w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("qux").Worktree, Equals, Untracked)
+}
+
+func (s *StashSuite) TestStashKeepIndex(c *C) {
+	_, w, _ := prepareStash(c)
+
+	_, err := w.Stash(&StashOptions{KeepIndex: true, Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	assertWorktreeFiles(c, w, map[string]string{"foo": "staged\n", "bar": "bar\n"})
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo").Staging, Equals, Modified)
+	c.Assert(status.File("foo").Worktree, Equals, Unmodified)
+	_, ok := status["bar"]
+	c.Assert(ok, Equals, false)
+}
+
+func (s *StashSuite) TestStashPaths(c *C) {
+	r, w, head := prepareStash(c)
+
+	h, err := w.Stash(&StashOptions{Paths: []string{"b*"}, Message: "only bar", Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	stash, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	c.Assert(stash.Message, Equals, "On master: only bar")
+
+	headCommit, err := r.CommitObject(head)
+	c.Assert(err, IsNil)
+
+	indexCommit, err := stash.Parent(1)
+	c.Assert(err, IsNil)
+	c.Assert(indexCommit.TreeHash, Equals, headCommit.TreeHash)
+	assertTreeFiles(c, r, stash.TreeHash, map[string]string{"foo": "foo\n", "bar": "modified\n"})
+
+	assertWorktreeFiles(c, w, map[string]string{"foo": "staged\n", "bar": "bar\n"})
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo").Staging, Equals, Modified)
+}
+
+func (s *StashSuite) TestStashPathsNested(c *C) {
+	r, w, _ := prepareStash(c)
+
+	err := util.WriteFile(w.Filesystem, "dir/sub/foo", []byte("nested\n"), 0644)
+	c.Assert(err, IsNil)
+	_, err = w.Add("dir/sub/foo")
+	c.Assert(err, IsNil)
+
+	h, err := w.Stash(&StashOptions{Paths: []string{"*foo"}, Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	stash, err := r.CommitObject(h)
+	c.Assert(err, IsNil)
+	assertTreeFiles(c, r, stash.TreeHash, map[string]string{
+		"foo": "staged\n", "bar": "bar\n", "dir/sub/foo": "nested\n",
+	})
+
+	assertWorktreeFiles(c, w, map[string]string{"foo": "foo\n", "bar": "modified\n"})
+}
+
+func (s *StashSuite) TestStashListAndDrop(c *C) {
+	r, w, _ := prepareStash(c)
+
+	first, err := w.Stash(&StashOptions{Message: "first", Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	err = util.WriteFile(w.Filesystem, "bar", []byte("second\n"), 0644)
+	c.Assert(err, IsNil)
+	second, err := w.Stash(&StashOptions{Message: "second", Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	list, err := w.StashList()
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 2)
+	c.Assert(list[0].Hash, Equals, second)
+	c.Assert(list[0].Message, Equals, "On master: second")
+	c.Assert(list[1].Name, Equals, "stash@{1}")
+	c.Assert(list[1].Hash, Equals, first)
+
+	err = w.StashDrop(2)
+	c.Assert(err, Equals, ErrStashNotFound)
+
+	err = w.StashDrop(0)
+	c.Assert(err, IsNil)
+
+	ref, err := r.Reference(stashRefName, false)
+	c.Assert(err, IsNil)
+	c.Assert(ref.Hash(), Equals, first)
+
+	list, err = w.StashList()
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 1)
+	c.Assert(list[0].Name, Equals, "stash@{0}")
+	c.Assert(list[0].Hash, Equals, first)
+
+	err = w.StashApply(&StashApplyOptions{Stash: 1})
+	c.Assert(err, Equals, ErrStashNotFound)
+}
+
+func (s *StashSuite) TestStashApplyConflict(c *C) {
+	_, w, _ := prepareStash(c)
+
+	_, err := w.Stash(&StashOptions{Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	commitFiles(c, w, "bar", map[string]string{"bar": "committed\n"})
+
+	err = w.StashPop(&StashApplyOptions{})
+	c.Assert(err, Equals, ErrMergeConflict)
+
+	data, err := util.ReadFile(w.Filesystem, "bar")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "<<<<<<< Updated upstream\ncommitted\n=======\nmodified\n>>>>>>> Stashed changes\n")
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.File("bar").Staging, Equals, UpdatedButUnmerged)
+
+	list, err := w.StashList()
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 1)
+}
+
+func (s *StashSuite) TestStashApplyDirtyWorktree(c *C) {
+	_, w, _ := prepareStash(c)
+
+	_, err := w.Stash(&StashOptions{Committer: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	err = util.WriteFile(w.Filesystem, "foo", []byte("dirty\n"), 0644)
+	c.Assert(err, IsNil)
+
+	err = w.StashApply(&StashApplyOptions{})
+	c.Assert(err, Equals, ErrWorktreeNotClean)
+}
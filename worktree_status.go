@@ -33,6 +33,25 @@ var (
 
 // Status returns the working tree status.
 func (w *Worktree) Status() (Status, error) {
+	return w.StatusWithOptions(StatusOptions{})
+}
+
+// StatusWithOptions returns the working tree status, limited and reported as
+// defined by the given options.
+func (w *Worktree) StatusWithOptions(o StatusOptions) (s Status, err error) {
+	filters, err := w.newContentFilters()
+	if err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(filters, &err)
+
+	return w.statusWithFilters(&o, filters)
+}
+
+// statusWithFilters returns the working tree status as StatusWithOptions
+// does, converting the files with the given filters.
+func (w *Worktree) statusWithFilters(o *StatusOptions, filters *contentFilters) (Status, error) {
 	var hash plumbing.Hash
 
 	ref, err := w.r.Head()
@@ -44,13 +63,23 @@ func (w *Worktree) Status() (Status, error) {
 		hash = ref.Hash()
 	}
 
-	return w.status(hash)
+	return w.status(hash, o, filters)
 }
 
-func (w *Worktree) status(commit plumbing.Hash) (Status, error) {
+func (w *Worktree) status(commit plumbing.Hash, o *StatusOptions, filters *contentFilters) (Status, error) {
 	s := make(Status)
 
-	left, err := w.diffCommitWithStaging(commit, false)
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := w.commitTree(commit)
+	if err != nil {
+		return nil, err
+	}
+
+	left, right, err := w.statusChanges(t, idx, o, filters)
 	if err != nil {
 		return nil, err
 	}
@@ -74,18 +103,46 @@ func (w *Worktree) status(commit plumbing.Hash) (Status, error) {
 		}
 	}
 
-	right, err := w.diffStagingWithWorktree(false)
-	if err != nil {
-		return nil, err
+	if o.Renames {
+		if err := w.detectStatusRenames(s, t, idx); err != nil {
+			return nil, err
+		}
+	}
+
+	m := w.ignoreMatcher()
+
+	var tracked map[string]bool
+	if o.Untracked == NormalUntrackedFiles {
+		tracked = trackedDirectories(idx)
 	}
 
+	var ignored []string
 	for _, ch := range right {
 		a, err := ch.Action()
 		if err != nil {
 			return nil, err
 		}
 
-		fs := s.File(nameFromAction(&ch))
+		if m != nil && isIgnoredChange(m, ch) {
+			if o.Ignored && a == merkletrie.Insert {
+				ignored = append(ignored, ch.To.String())
+			}
+
+			continue
+		}
+
+		name := nameFromAction(&ch)
+		if a == merkletrie.Insert {
+			if o.Untracked == NoUntrackedFiles {
+				continue
+			}
+
+			if tracked != nil {
+				name = untrackedName(name, tracked)
+			}
+		}
+
+		fs := s.File(name)
 		if fs.Staging == Untracked {
 			fs.Staging = Unmodified
 		}
@@ -101,9 +158,289 @@ func (w *Worktree) status(commit plumbing.Hash) (Status, error) {
 		}
 	}
 
+	for _, name := range ignored {
+		if tracked != nil {
+			dir := untrackedName(name, tracked)
+			if fs, ok := s[dir]; !ok || fs.Worktree == Ignored {
+				name = dir
+			}
+		}
+
+		s[name] = &FileStatus{Staging: Ignored, Worktree: Ignored}
+	}
+
+	for _, e := range idx.Entries {
+		if e.Stage != index.Merged && matchPathspec(o.Paths, e.Name) {
+			fs := s.File(e.Name)
+			fs.Staging = UpdatedButUnmerged
+			fs.Worktree = UpdatedButUnmerged
+		}
+	}
+
 	return s, nil
 }
 
+// statusChanges returns the changes between the given tree and the index,
+// and between the index and the worktree, walking only the paths matching
+// the pathspecs of the options.
+func (w *Worktree) statusChanges(t *object.Tree, idx *index.Index, o *StatusOptions, filters *contentFilters) (left, right merkletrie.Changes, err error) {
+	keep := pathspecFilter(o.Paths)
+
+	var from noder.Noder
+	if t != nil {
+		from = newFilterNoder(object.NewTreeRootNode(t), keep)
+	}
+
+	unskipped := withoutSkipWorktree(idx)
+	staging := newFilterNoder(mindex.NewRootNode(unskipped), keep)
+	left, err = merkletrie.DiffTree(from, staging, diffTreeIsEquals)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	submodules, err := w.getSubmodulesStatus()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// without untracked files only the tracked paths are walked
+	fsKeep := keep
+	if o.Untracked == NoUntrackedFiles {
+		fsKeep = trackedFilter(idx, keep)
+	}
+
+	cache, err := w.newStatusCache(idx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := filesystem.Options{Convert: filters.normalize, Converts: filters.converts}
+	if cache != nil {
+		opts.Cache = cache
+	}
+
+	staging = newFilterNoder(mindex.NewRootNode(unskipped), keep)
+	worktree := newFilterNoder(filesystem.NewRootNodeWithOptions(w.Filesystem, submodules, opts), fsKeep)
+	right, err = merkletrie.DiffTree(staging, worktree, diffTreeIsEquals)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	right = excludeSkippedChanges(right, idx)
+	if cache != nil && cache.update(idx, right, o) {
+		if err := w.r.Storer.SetIndex(idx); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return left, right, nil
+}
+
+// detectStatusRenames replaces the deleted and added files of the staging
+// area by renames, comparing the tree of HEAD with the index.
+func (w *Worktree) detectStatusRenames(s Status, t *object.Tree, idx *index.Index) error {
+	storerTree, err := w.emptyTree()
+	if err != nil {
+		return err
+	}
+
+	entries := make(map[string]*index.Entry, len(idx.Entries))
+	for _, e := range idx.Entries {
+		entries[e.Name] = e
+	}
+
+	var changes object.Changes
+	for name, fs := range s {
+		switch fs.Staging {
+		case Deleted:
+			e, err := t.FindEntry(name)
+			if err != nil {
+				return err
+			}
+
+			changes = append(changes, &object.Change{
+				From: object.ChangeEntry{Name: name, Tree: t, TreeEntry: *e},
+			})
+		case Added:
+			e, ok := entries[name]
+			if !ok {
+				continue
+			}
+
+			changes = append(changes, &object.Change{
+				To: object.ChangeEntry{Name: name, Tree: storerTree, TreeEntry: object.TreeEntry{
+					Name: path.Base(name),
+					Mode: e.Mode,
+					Hash: e.Hash,
+				}},
+			})
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	changes, err = object.DetectRenames(changes, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, ch := range changes {
+		if ch.From.Name == "" || ch.To.Name == "" {
+			continue
+		}
+
+		delete(s, ch.From.Name)
+		fs := s.File(ch.To.Name)
+		fs.Staging = Renamed
+		fs.Extra = ch.From.Name
+	}
+
+	return nil
+}
+
+// emptyTree returns an empty tree bound to the object storer of the
+// repository, used to read the blobs of the index.
+func (w *Worktree) emptyTree() (*object.Tree, error) {
+	obj := w.r.Storer.NewEncodedObject()
+	obj.SetType(plumbing.TreeObject)
+	return object.DecodeTree(w.r.Storer, obj)
+}
+
+// commitTree returns the tree of the given commit, nil if the hash is zero.
+func (w *Worktree) commitTree(commit plumbing.Hash) (*object.Tree, error) {
+	if commit.IsZero() {
+		return nil, nil
+	}
+
+	return w.getTreeFromCommitHash(commit)
+}
+
+// untrackedName returns the name reporting the given untracked file, being
+// its topmost parent directory without tracked files, ending with a slash,
+// or the file itself.
+func untrackedName(name string, tracked map[string]bool) string {
+	for i := 0; i < len(name); i++ {
+		if name[i] == '/' && !tracked[name[:i]] {
+			return name[:i+1]
+		}
+	}
+
+	return name
+}
+
+// trackedDirectories returns the directories containing any of the entries
+// of the index.
+func trackedDirectories(idx *index.Index) map[string]bool {
+	dirs := make(map[string]bool)
+	for _, e := range idx.Entries {
+		for dir := path.Dir(e.Name); dir != "." && !dirs[dir]; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+
+	return dirs
+}
+
+// trackedFilter returns a filter keeping only the paths of the index and
+// their directories, and accepted by keep if not nil.
+func trackedFilter(idx *index.Index, keep func(string, bool) bool) func(string, bool) bool {
+	dirs := trackedDirectories(idx)
+	files := make(map[string]bool, len(idx.Entries))
+	for _, e := range idx.Entries {
+		files[e.Name] = true
+	}
+
+	return func(name string, isDir bool) bool {
+		if keep != nil && !keep(name, isDir) {
+			return false
+		}
+
+		return files[name] || isDir && dirs[name]
+	}
+}
+
+// pathspecFilter returns a filter keeping the paths matching the given
+// pathspecs and the directories that can contain them, nil if the pathspec
+// is empty.
+func pathspecFilter(pathspec []string) func(string, bool) bool {
+	if len(pathspec) == 0 {
+		return nil
+	}
+
+	return func(name string, isDir bool) bool {
+		if matchPathspec(pathspec, name) {
+			return true
+		}
+
+		return isDir && pathspecMayMatch(pathspec, name)
+	}
+}
+
+// pathspecMayMatch returns true if the given directory can contain paths
+// matching any of the pathspecs. The wildcards match the slashes, so any
+// directory starting like the part of a pattern before its first wildcard
+// may contain matching paths.
+func pathspecMayMatch(pathspec []string, dir string) bool {
+	dir += "/"
+	for _, p := range pathspec {
+		p = filepath.ToSlash(p)
+		if i := strings.IndexAny(p, "*?[\\"); i >= 0 {
+			prefix := p[:i]
+			if strings.HasPrefix(dir, prefix) || strings.HasPrefix(prefix, dir) {
+				return true
+			}
+
+			continue
+		}
+
+		if strings.HasPrefix(p, dir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filterNoder is a noder.Noder walking only the children accepted by keep,
+// used to prune the directories not needed by a diff.
+type filterNoder struct {
+	noder.Noder
+	path string
+	keep func(path string, isDir bool) bool
+}
+
+func newFilterNoder(n noder.Noder, keep func(string, bool) bool) noder.Noder {
+	if keep == nil {
+		return n
+	}
+
+	return &filterNoder{Noder: n, keep: keep}
+}
+
+func (n *filterNoder) Children() ([]noder.Noder, error) {
+	children, err := n.Noder.Children()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]noder.Noder, 0, len(children))
+	for _, c := range children {
+		p := path.Join(n.path, c.Name())
+		if n.keep(p, c.IsDir()) {
+			res = append(res, &filterNoder{Noder: c, path: p, keep: n.keep})
+		}
+	}
+
+	return res, nil
+}
+
+func (n *filterNoder) NumChildren() (int, error) {
+	children, err := n.Children()
+	return len(children), err
+}
+
 func nameFromAction(ch *merkletrie.Change) string {
 	name := ch.To.String()
 	if name == "" {
@@ -113,21 +450,23 @@ func nameFromAction(ch *merkletrie.Change) string {
 	return name
 }
 
-func (w *Worktree) diffStagingWithWorktree(reverse bool) (merkletrie.Changes, error) {
+func (w *Worktree) diffStagingWithWorktree(reverse bool, filters *contentFilters) (c merkletrie.Changes, err error) {
 	idx, err := w.r.Storer.Index()
 	if err != nil {
 		return nil, err
 	}
 
-	from := mindex.NewRootNode(idx)
+	from := mindex.NewRootNode(withoutSkipWorktree(idx))
 	submodules, err := w.getSubmodulesStatus()
 	if err != nil {
 		return nil, err
 	}
 
-	to := filesystem.NewRootNode(w.Filesystem, submodules)
+	to := filesystem.NewRootNodeWithOptions(w.Filesystem, submodules, filesystem.Options{
+		Convert:  filters.normalize,
+		Converts: filters.converts,
+	})
 
-	var c merkletrie.Changes
 	if reverse {
 		c, err = merkletrie.DiffTree(to, from, diffTreeIsEquals)
 	} else {
@@ -138,43 +477,58 @@ func (w *Worktree) diffStagingWithWorktree(reverse bool) (merkletrie.Changes, er
 		return nil, err
 	}
 
+	c = excludeSkippedChanges(c, idx)
 	return w.excludeIgnoredChanges(c), nil
 }
 
 func (w *Worktree) excludeIgnoredChanges(changes merkletrie.Changes) merkletrie.Changes {
+	m := w.ignoreMatcher()
+	if m == nil {
+		return changes
+	}
+
+	var res merkletrie.Changes
+	for _, ch := range changes {
+		if !isIgnoredChange(m, ch) {
+			res = append(res, ch)
+		}
+	}
+	return res
+}
+
+// ignoreMatcher returns the matcher of the gitignore patterns of the
+// worktree and its Excludes, nil if there isn't any pattern.
+func (w *Worktree) ignoreMatcher() gitignore.Matcher {
 	patterns, err := gitignore.ReadPatterns(w.Filesystem, nil)
 	if err != nil {
-		return changes
+		return nil
 	}
 
 	patterns = append(patterns, w.Excludes...)
 
 	if len(patterns) == 0 {
-		return changes
+		return nil
 	}
 
-	m := gitignore.NewMatcher(patterns)
+	return gitignore.NewMatcher(patterns)
+}
 
-	var res merkletrie.Changes
-	for _, ch := range changes {
-		var path []string
-		for _, n := range ch.To {
+func isIgnoredChange(m gitignore.Matcher, ch merkletrie.Change) bool {
+	var path []string
+	for _, n := range ch.To {
+		path = append(path, n.Name())
+	}
+	if len(path) == 0 {
+		for _, n := range ch.From {
 			path = append(path, n.Name())
 		}
-		if len(path) == 0 {
-			for _, n := range ch.From {
-				path = append(path, n.Name())
-			}
-		}
-		if len(path) != 0 {
-			isDir := (len(ch.To) > 0 && ch.To.IsDir()) || (len(ch.From) > 0 && ch.From.IsDir())
-			if m.Match(path, isDir) {
-				continue
-			}
-		}
-		res = append(res, ch)
 	}
-	return res
+	if len(path) == 0 {
+		return false
+	}
+
+	isDir := (len(ch.To) > 0 && ch.To.IsDir()) || (len(ch.From) > 0 && ch.From.IsDir())
+	return m.Match(path, isDir)
 }
 
 func (w *Worktree) getSubmodulesStatus() (map[string]plumbing.Hash, error) {
@@ -202,23 +556,6 @@ func (w *Worktree) getSubmodulesStatus() (map[string]plumbing.Hash, error) {
 	return o, nil
 }
 
-func (w *Worktree) diffCommitWithStaging(commit plumbing.Hash, reverse bool) (merkletrie.Changes, error) {
-	var t *object.Tree
-	if !commit.IsZero() {
-		c, err := w.r.CommitObject(commit)
-		if err != nil {
-			return nil, err
-		}
-
-		t, err = c.Tree()
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	return w.diffTreeWithStaging(t, reverse)
-}
-
 func (w *Worktree) diffTreeWithStaging(t *object.Tree, reverse bool) (merkletrie.Changes, error) {
 	var from noder.Noder
 	if t != nil {
@@ -230,7 +567,7 @@ func (w *Worktree) diffTreeWithStaging(t *object.Tree, reverse bool) (merkletrie
 		return nil, err
 	}
 
-	to := mindex.NewRootNode(idx)
+	to := mindex.NewRootNode(withoutSkipWorktree(idx))
 
 	if reverse {
 		return merkletrie.DiffTree(to, from, diffTreeIsEquals)
@@ -269,7 +606,7 @@ func (w *Worktree) Add(path string) (plumbing.Hash, error) {
 	return w.doAdd(path, make([]gitignore.Pattern, 0))
 }
 
-func (w *Worktree) doAddDirectory(idx *index.Index, s Status, directory string, ignorePattern []gitignore.Pattern) (added bool, err error) {
+func (w *Worktree) doAddDirectory(idx *index.Index, s Status, directory string, ignorePattern []gitignore.Pattern, filters *contentFilters) (added bool, err error) {
 	if len(ignorePattern) > 0 {
 		m := gitignore.NewMatcher(ignorePattern)
 		matchPath := strings.Split(directory, string(os.PathSeparator))
@@ -285,7 +622,7 @@ func (w *Worktree) doAddDirectory(idx *index.Index, s Status, directory string,
 		}
 
 		var a bool
-		a, _, err = w.doAddFile(idx, s, name, ignorePattern)
+		a, _, err = w.doAddFile(idx, s, name, ignorePattern, filters)
 		if err != nil {
 			return
 		}
@@ -344,8 +681,15 @@ func (w *Worktree) AddWithOptions(opts *AddOptions) error {
 	return err
 }
 
-func (w *Worktree) doAdd(path string, ignorePattern []gitignore.Pattern) (plumbing.Hash, error) {
-	s, err := w.Status()
+func (w *Worktree) doAdd(path string, ignorePattern []gitignore.Pattern) (h plumbing.Hash, err error) {
+	filters, err := w.newContentFilters()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	defer ioutil.CheckClose(filters, &err)
+
+	s, err := w.statusWithFilters(&StatusOptions{}, filters)
 	if err != nil {
 		return plumbing.ZeroHash, err
 	}
@@ -355,14 +699,13 @@ func (w *Worktree) doAdd(path string, ignorePattern []gitignore.Pattern) (plumbi
 		return plumbing.ZeroHash, err
 	}
 
-	var h plumbing.Hash
 	var added bool
 
 	fi, err := w.Filesystem.Lstat(path)
 	if err != nil || !fi.IsDir() {
-		added, h, err = w.doAddFile(idx, s, path, ignorePattern)
+		added, h, err = w.doAddFile(idx, s, path, ignorePattern, filters)
 	} else {
-		added, err = w.doAddDirectory(idx, s, path, ignorePattern)
+		added, err = w.doAddDirectory(idx, s, path, ignorePattern, filters)
 	}
 
 	if err != nil {
@@ -379,8 +722,15 @@ func (w *Worktree) doAdd(path string, ignorePattern []gitignore.Pattern) (plumbi
 // AddGlob adds all paths, matching pattern, to the index. If pattern matches a
 // directory path, all directory contents are added to the index recursively. No
 // error is returned if all matching paths are already staged in index.
-func (w *Worktree) AddGlob(pattern string) error {
+func (w *Worktree) AddGlob(pattern string) (err error) {
 	// TODO(mcuadros): deprecate in favor of AddWithOption in v6.
+	filters, err := w.newContentFilters()
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(filters, &err)
+
 	files, err := util.Glob(w.Filesystem, pattern)
 	if err != nil {
 		return err
@@ -390,7 +740,7 @@ func (w *Worktree) AddGlob(pattern string) error {
 		return ErrGlobNoMatches
 	}
 
-	s, err := w.Status()
+	s, err := w.statusWithFilters(&StatusOptions{}, filters)
 	if err != nil {
 		return err
 	}
@@ -409,9 +759,9 @@ func (w *Worktree) AddGlob(pattern string) error {
 
 		var added bool
 		if fi.IsDir() {
-			added, err = w.doAddDirectory(idx, s, file, make([]gitignore.Pattern, 0))
+			added, err = w.doAddDirectory(idx, s, file, make([]gitignore.Pattern, 0), filters)
 		} else {
-			added, _, err = w.doAddFile(idx, s, file, make([]gitignore.Pattern, 0))
+			added, _, err = w.doAddFile(idx, s, file, make([]gitignore.Pattern, 0), filters)
 		}
 
 		if err != nil {
@@ -432,7 +782,7 @@ func (w *Worktree) AddGlob(pattern string) error {
 
 // doAddFile create a new blob from path and update the index, added is true if
 // the file added is different from the index.
-func (w *Worktree) doAddFile(idx *index.Index, s Status, path string, ignorePattern []gitignore.Pattern) (added bool, h plumbing.Hash, err error) {
+func (w *Worktree) doAddFile(idx *index.Index, s Status, path string, ignorePattern []gitignore.Pattern, filters *contentFilters) (added bool, h plumbing.Hash, err error) {
 	if s.File(path).Worktree == Unmodified {
 		return false, h, nil
 	}
@@ -445,7 +795,7 @@ func (w *Worktree) doAddFile(idx *index.Index, s Status, path string, ignorePatt
 		}
 	}
 
-	h, err = w.copyFileToStorage(path)
+	h, err = w.copyFileToStorage(path, filters)
 	if err != nil {
 		if os.IsNotExist(err) {
 			added = true
@@ -462,7 +812,7 @@ func (w *Worktree) doAddFile(idx *index.Index, s Status, path string, ignorePatt
 	return true, h, err
 }
 
-func (w *Worktree) copyFileToStorage(path string) (hash plumbing.Hash, err error) {
+func (w *Worktree) copyFileToStorage(path string, filters *contentFilters) (hash plumbing.Hash, err error) {
 	fi, err := w.Filesystem.Lstat(path)
 	if err != nil {
 		return plumbing.ZeroHash, err
@@ -482,7 +832,7 @@ func (w *Worktree) copyFileToStorage(path string) (hash plumbing.Hash, err error
 	if fi.Mode()&os.ModeSymlink != 0 {
 		err = w.fillEncodedObjectFromSymlink(writer, path, fi)
 	} else {
-		err = w.fillEncodedObjectFromFile(writer, path, fi)
+		err = w.fillEncodedObjectFromFile(writer, path, fi, filters)
 	}
 
 	if err != nil {
@@ -492,7 +842,12 @@ func (w *Worktree) copyFileToStorage(path string) (hash plumbing.Hash, err error
 	return w.r.Storer.SetEncodedObject(obj)
 }
 
-func (w *Worktree) fillEncodedObjectFromFile(dst io.Writer, path string, fi os.FileInfo) (err error) {
+func (w *Worktree) fillEncodedObjectFromFile(dst io.Writer, path string, fi os.FileInfo, filters *contentFilters) (err error) {
+	converts, err := filters.converts(path)
+	if err != nil {
+		return err
+	}
+
 	src, err := w.Filesystem.Open(path)
 	if err != nil {
 		return err
@@ -500,11 +855,12 @@ func (w *Worktree) fillEncodedObjectFromFile(dst io.Writer, path string, fi os.F
 
 	defer ioutil.CheckClose(src, &err)
 
-	if _, err := io.Copy(dst, src); err != nil {
+	if !converts {
+		_, err = io.Copy(dst, src)
 		return err
 	}
 
-	return err
+	return filters.toObject(path, dst, src)
 }
 
 func (w *Worktree) fillEncodedObjectFromSymlink(dst io.Writer, path string, fi os.FileInfo) error {
@@ -527,6 +883,12 @@ func (w *Worktree) addOrUpdateFileToIndex(idx *index.Index, filename string, h p
 		return w.doAddFileToIndex(idx, filename, h)
 	}
 
+	// adding an unmerged path resolves the conflict, replacing its stages
+	if e.Stage != index.Merged {
+		removeIndexEntries(idx, filename)
+		return w.doAddFileToIndex(idx, filename, h)
+	}
+
 	return w.doUpdateFileToIndex(e, filename, h)
 }
 
@@ -638,6 +1000,10 @@ func (w *Worktree) deleteFromIndex(idx *index.Index, path string) (plumbing.Hash
 		return plumbing.ZeroHash, err
 	}
 
+	if e.Stage != index.Merged {
+		removeIndexEntries(idx, path)
+	}
+
 	return e.Hash, nil
 }
 
@@ -133,6 +133,205 @@ func (s *WorktreeSuite) TestPullNonFastForward(c *C) {
 	c.Assert(err, Equals, ErrNonFastForwardUpdate)
 }
 
+// prepareDivergedPull returns a clone whose master branch diverged from the
+// one of its origin, each of them modifying the given files.
+func (s *WorktreeSuite) prepareDivergedPull(c *C, server, local map[string]string) (r *Repository, remoteHash, localHash plumbing.Hash, clean func()) {
+	url, cleanURL := s.TemporalDir()
+	dir, cleanDir := s.TemporalDir()
+	clean = func() { cleanURL(); cleanDir() }
+
+	path := fixtures.Basic().ByTag("worktree").One().Worktree().Root()
+	sr, err := PlainClone(url, false, &CloneOptions{URL: path})
+	c.Assert(err, IsNil)
+
+	r, err = PlainClone(dir, false, &CloneOptions{URL: url})
+	c.Assert(err, IsNil)
+
+	commit := func(r *Repository, root, msg string, files map[string]string) plumbing.Hash {
+		w, err := r.Worktree()
+		c.Assert(err, IsNil)
+
+		for name, content := range files {
+			err = ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644)
+			c.Assert(err, IsNil)
+			_, err = w.Add(name)
+			c.Assert(err, IsNil)
+		}
+
+		h, err := w.Commit(msg, &CommitOptions{Author: defaultSignature()})
+		c.Assert(err, IsNil)
+		return h
+	}
+
+	return r, commit(sr, url, "server", server), commit(r, dir, "local", local), clean
+}
+
+func (s *WorktreeSuite) TestPullNonFastForwardMerge(c *C) {
+	r, remoteHash, localHash, clean := s.prepareDivergedPull(c,
+		map[string]string{"foo": "foo"},
+		map[string]string{"bar": "bar"},
+	)
+	defer clean()
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	err = w.Pull(&PullOptions{Mode: MergePull, Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(head.Hash())
+	c.Assert(err, IsNil)
+	c.Assert(commit.ParentHashes, DeepEquals, []plumbing.Hash{localHash, remoteHash})
+	c.Assert(strings.HasPrefix(commit.Message, "Merge branch 'master' of "), Equals, true)
+
+	for _, name := range []string{"foo", "bar"} {
+		_, err = w.Filesystem.Stat(name)
+		c.Assert(err, IsNil)
+	}
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+}
+
+func (s *WorktreeSuite) TestPullNonFastForwardMergeConflict(c *C) {
+	r, remoteHash, _, clean := s.prepareDivergedPull(c,
+		map[string]string{"foo": "foo\n"},
+		map[string]string{"foo": "bar\n"},
+	)
+	defer clean()
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	err = w.Pull(&PullOptions{Mode: MergePull, Author: defaultSignature()})
+	c.Assert(err, Equals, ErrMergeConflict)
+
+	mergeHead, err := r.Reference(plumbing.MergeHead, false)
+	c.Assert(err, IsNil)
+	c.Assert(mergeHead.Hash(), Equals, remoteHash)
+}
+
+func (s *WorktreeSuite) TestPullNonFastForwardRebase(c *C) {
+	r, remoteHash, localHash, clean := s.prepareDivergedPull(c,
+		map[string]string{"foo": "foo"},
+		map[string]string{"bar": "bar"},
+	)
+	defer clean()
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	err = w.Pull(&PullOptions{Mode: RebasePull, Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Name(), Equals, plumbing.Master)
+
+	commit, err := r.CommitObject(head.Hash())
+	c.Assert(err, IsNil)
+	c.Assert(commit.ParentHashes, DeepEquals, []plumbing.Hash{remoteHash})
+	c.Assert(commit.Message, Equals, "local")
+
+	orig, err := r.Reference(plumbing.OrigHead, false)
+	c.Assert(err, IsNil)
+	c.Assert(orig.Hash(), Equals, localHash)
+
+	for _, name := range []string{"foo", "bar"} {
+		_, err = w.Filesystem.Stat(name)
+		c.Assert(err, IsNil)
+	}
+}
+
+func (s *WorktreeSuite) TestPullNonFastForwardRebaseConflict(c *C) {
+	r, _, localHash, clean := s.prepareDivergedPull(c,
+		map[string]string{"foo": "foo\n"},
+		map[string]string{"foo": "bar\n"},
+	)
+	defer clean()
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	err = w.Pull(&PullOptions{Mode: RebasePull, Author: defaultSignature()})
+	c.Assert(err, Equals, ErrRebaseConflict)
+
+	_, err = w.Rebase(&RebaseOptions{Abort: true})
+	c.Assert(err, IsNil)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Name(), Equals, plumbing.Master)
+	c.Assert(head.Hash(), Equals, localHash)
+}
+
+func (s *WorktreeSuite) TestPullModeFromConfig(c *C) {
+	r, remoteHash, _, clean := s.prepareDivergedPull(c,
+		map[string]string{"foo": "foo"},
+		map[string]string{"bar": "bar"},
+	)
+	defer clean()
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+	cfg.Pull.Rebase = "true"
+	c.Assert(r.SetConfig(cfg), IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	err = w.Pull(&PullOptions{Author: defaultSignature()})
+	c.Assert(err, IsNil)
+
+	head, err := r.Head()
+	c.Assert(err, IsNil)
+
+	commit, err := r.CommitObject(head.Hash())
+	c.Assert(err, IsNil)
+	c.Assert(commit.ParentHashes, DeepEquals, []plumbing.Hash{remoteHash})
+}
+
+func (s *WorktreeSuite) TestPullMode(c *C) {
+	r, _ := Init(memory.NewStorage(), memfs.New())
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	cfg, err := r.Config()
+	c.Assert(err, IsNil)
+
+	for _, t := range []struct {
+		rebase, branchRebase, ff string
+		mode                     PullMode
+		noFastForward            bool
+	}{
+		{"", "", "", FastForwardOnlyPull, false},
+		{"", "", "only", FastForwardOnlyPull, false},
+		{"", "", "false", MergePull, true},
+		{"false", "", "", MergePull, false},
+		{"true", "", "only", RebasePull, false},
+		{"true", "false", "", MergePull, false},
+		{"", "interactive", "", RebasePull, false},
+	} {
+		cfg.Pull.Rebase = t.rebase
+		cfg.Pull.FastForward = t.ff
+		cfg.Branches["master"] = &config.Branch{Name: "master", Rebase: t.branchRebase}
+		c.Assert(r.SetConfig(cfg), IsNil)
+
+		mode, noFastForward, err := w.pullMode(&PullOptions{})
+		c.Assert(err, IsNil)
+		c.Assert(mode, Equals, t.mode, Commentf("%+v", t))
+		c.Assert(noFastForward, Equals, t.noFastForward, Commentf("%+v", t))
+	}
+
+	mode, _, err := w.pullMode(&PullOptions{Mode: MergePull})
+	c.Assert(err, IsNil)
+	c.Assert(mode, Equals, MergePull)
+}
+
 func (s *WorktreeSuite) TestPullUpdateReferencesIfNeeded(c *C) {
 	r, _ := Init(memory.NewStorage(), memfs.New())
 	r.CreateRemote(&config.RemoteConfig{
@@ -446,6 +645,10 @@ func (s *WorktreeSuite) TestCheckoutSparse(c *C) {
 		}
 		c.Assert(oneOfSparseCheckoutDirs, Equals, true)
 	}
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
 }
 
 func (s *WorktreeSuite) TestFilenameNormalization(c *C) {
@@ -1181,6 +1384,131 @@ func (s *WorktreeSuite) TestStatusDeleted(c *C) {
 	c.Assert(status.File(".gitignore").Worktree, Equals, Deleted)
 }
 
+func (s *WorktreeSuite) TestStatusWithOptionsUntracked(c *C) {
+	_, w := newMemoryWorktree(c)
+
+	commitFiles(c, w, "init", map[string]string{"tracked/a": "a\n"})
+	for _, name := range []string{"tracked/new", "untracked/x/y", "untracked/z", "root"} {
+		err := util.WriteFile(w.Filesystem, name, []byte(name), 0644)
+		c.Assert(err, IsNil)
+	}
+
+	status, err := w.StatusWithOptions(StatusOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 4)
+	c.Assert(status.IsUntracked("untracked/x/y"), Equals, true)
+	c.Assert(status.IsUntracked("untracked/z"), Equals, true)
+
+	status, err = w.StatusWithOptions(StatusOptions{Untracked: NormalUntrackedFiles})
+	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 3)
+	c.Assert(status.IsUntracked("untracked/"), Equals, true)
+	c.Assert(status.IsUntracked("tracked/new"), Equals, true)
+	c.Assert(status.IsUntracked("root"), Equals, true)
+
+	err = util.WriteFile(w.Filesystem, "tracked/a", []byte("modified\n"), 0644)
+	c.Assert(err, IsNil)
+
+	status, err = w.StatusWithOptions(StatusOptions{Untracked: NoUntrackedFiles})
+	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 1)
+	c.Assert(status.File("tracked/a").Worktree, Equals, Modified)
+}
+
+func (s *WorktreeSuite) TestStatusWithOptionsIgnored(c *C) {
+	_, w := newMemoryWorktree(c)
+
+	commitFiles(c, w, "init", map[string]string{".gitignore": "*.log\nbuild/\n"})
+	for _, name := range []string{"a.log", "build/out", "build/x/y", "foo"} {
+		err := util.WriteFile(w.Filesystem, name, []byte(name), 0644)
+		c.Assert(err, IsNil)
+	}
+
+	status, err := w.StatusWithOptions(StatusOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 1)
+	c.Assert(status.IsUntracked("foo"), Equals, true)
+
+	status, err = w.StatusWithOptions(StatusOptions{Ignored: true})
+	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 4)
+	c.Assert(status.File("a.log").Worktree, Equals, Ignored)
+	c.Assert(status.File("build/x/y").Worktree, Equals, Ignored)
+
+	status, err = w.StatusWithOptions(StatusOptions{Ignored: true, Untracked: NormalUntrackedFiles})
+	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 3)
+	c.Assert(status.File("build/").Worktree, Equals, Ignored)
+	c.Assert(status.String(), Matches, "(?s).*!! a\\.log\n.*")
+}
+
+func (s *WorktreeSuite) TestStatusWithOptionsPaths(c *C) {
+	_, w := newMemoryWorktree(c)
+
+	commitFiles(c, w, "init", map[string]string{
+		"sub/a.txt":   "a\n",
+		"sub/b.go":    "b\n",
+		"other/c.txt": "c\n",
+	})
+
+	for _, name := range []string{"sub/a.txt", "sub/b.go", "sub/new.txt", "other/c.txt", "other/new.txt"} {
+		err := util.WriteFile(w.Filesystem, name, []byte("modified\n"), 0644)
+		c.Assert(err, IsNil)
+	}
+
+	_, err := w.Add("other/new.txt")
+	c.Assert(err, IsNil)
+
+	status, err := w.StatusWithOptions(StatusOptions{Paths: []string{"sub"}})
+	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 3)
+	c.Assert(status.File("sub/a.txt").Worktree, Equals, Modified)
+	c.Assert(status.IsUntracked("sub/new.txt"), Equals, true)
+
+	status, err = w.StatusWithOptions(StatusOptions{Paths: []string{"*/*.txt"}})
+	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 4)
+	c.Assert(status.File("other/new.txt").Staging, Equals, Added)
+
+	status, err = w.StatusWithOptions(StatusOptions{Paths: []string{"other/c.txt"}})
+	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 1)
+	c.Assert(status.File("other/c.txt").Worktree, Equals, Modified)
+
+	// the wildcards match the slashes, as in git
+	status, err = w.StatusWithOptions(StatusOptions{Paths: []string{"*.go"}})
+	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 1)
+	c.Assert(status.File("sub/b.go").Worktree, Equals, Modified)
+}
+
+func (s *WorktreeSuite) TestStatusWithOptionsRenames(c *C) {
+	_, w := newMemoryWorktree(c)
+
+	commitFiles(c, w, "init", map[string]string{
+		"foo": strings.Repeat("foo\n", 20),
+		"qux": "qux\n",
+	})
+
+	_, err := w.Move("foo", "bar")
+	c.Assert(err, IsNil)
+	_, err = w.Remove("qux")
+	c.Assert(err, IsNil)
+
+	status, err := w.StatusWithOptions(StatusOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(status.File("foo").Staging, Equals, Deleted)
+	c.Assert(status.File("bar").Staging, Equals, Added)
+
+	status, err = w.StatusWithOptions(StatusOptions{Renames: true})
+	c.Assert(err, IsNil)
+	c.Assert(status, HasLen, 2)
+	c.Assert(status.File("bar").Staging, Equals, Renamed)
+	c.Assert(status.File("bar").Extra, Equals, "foo")
+	c.Assert(status.File("qux").Staging, Equals, Deleted)
+	c.Assert(strings.Contains(status.String(), "R  foo -> bar\n"), Equals, true)
+}
+
 func (s *WorktreeSuite) TestSubmodule(c *C) {
 	path := fixtures.ByTag("submodule").One().Worktree().Root()
 	r, err := PlainOpen(path)
@@ -0,0 +1,639 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/filesystem/dotgit"
+)
+
+const (
+	worktreesPath         = "worktrees"
+	worktreeGitDirFile    = "gitdir"
+	worktreeCommonDirFile = "commondir"
+	worktreeLockedFile    = "locked"
+)
+
+var (
+	// ErrWorktreesNotSupported is returned managing the linked worktrees of
+	// a repository whose storage isn't based on a filesystem.
+	ErrWorktreesNotSupported = errors.New("linked worktrees are only supported by filesystem storages")
+	// ErrWorktreeNotFound is returned when there is no linked worktree with
+	// the given name.
+	ErrWorktreeNotFound = errors.New("worktree not found")
+	// ErrWorktreeExists is returned adding a worktree at a path that isn't
+	// empty, or with the name of an existing one.
+	ErrWorktreeExists = errors.New("worktree already exists")
+	// ErrWorktreeBranchCheckedOut is returned adding a worktree for a branch
+	// checked out in another worktree.
+	ErrWorktreeBranchCheckedOut = errors.New("branch is already checked out in another worktree")
+	// ErrWorktreeLocked is returned removing or locking a locked worktree.
+	ErrWorktreeLocked = errors.New("worktree is locked")
+	// ErrWorktreeNotLocked is returned unlocking a worktree that isn't
+	// locked.
+	ErrWorktreeNotLocked = errors.New("worktree is not locked")
+	// ErrWorktreeInvalid is returned removing a worktree whose directory
+	// doesn't link back to its administrative files.
+	ErrWorktreeInvalid = errors.New("worktree does not point back to the repository")
+)
+
+// LinkedWorktree describes a worktree of a repository, the main one or a
+// linked one, as listed by `git worktree list`.
+type LinkedWorktree struct {
+	// Name is the name of the directory of the worktree inside
+	// .git/worktrees, empty for the main worktree.
+	Name string
+	// Path is the absolute path of the worktree. For a bare repository the
+	// main worktree is the repository itself.
+	Path string
+	// Bare is true if the main worktree is a bare repository.
+	Bare bool
+	// Branch is the branch checked out in the worktree, empty if its HEAD
+	// is detached.
+	Branch plumbing.ReferenceName
+	// Head is the commit checked out in the worktree, zero if the branch
+	// has no commits yet.
+	Head plumbing.Hash
+	// Locked is true if the worktree is locked, so it can't be pruned,
+	// moved or removed.
+	Locked bool
+	// LockReason is the reason given when the worktree was locked.
+	LockReason string
+	// Prunable is true if the directory of the worktree doesn't exist
+	// anymore, so it would be removed by Repository.PruneWorktrees.
+	Prunable bool
+}
+
+// AddWorktree creates a linked worktree at the given path, sharing the
+// objects, references and config of the repository, and checks out the
+// branch or commit given by the options, as `git worktree add` does. The
+// returned Repository is the one of the new worktree.
+//
+// The administrative files of the worktree are stored in
+// .git/worktrees/<name>, only filesystem based storages are supported.
+func (r *Repository) AddWorktree(path string, o *AddWorktreeOptions) (*Repository, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	common, err := r.commonDotGit()
+	if err != nil {
+		return nil, err
+	}
+
+	if path, err = filepath.Abs(path); err != nil {
+		return nil, err
+	}
+
+	if err := checkWorktreePath(path); err != nil {
+		return nil, err
+	}
+
+	head, commit, err := r.addWorktreeHead(path, o)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := newWorktreeName(common, path, o.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	admin := common.Join(worktreesPath, name)
+	lr, err := r.addWorktree(common, admin, path, head, commit, o)
+	if err != nil {
+		// as git does, the administrative files and the worktree are
+		// removed, the path being either missing or empty beforehand.
+		_ = util.RemoveAll(common, admin)
+		_ = os.RemoveAll(path)
+		return nil, err
+	}
+
+	return lr, nil
+}
+
+// addWorktree writes the administrative files of a new worktree, in admin,
+// and checks out commit in it.
+func (r *Repository) addWorktree(common billy.Filesystem, admin, path string, head *plumbing.Reference, commit plumbing.Hash, o *AddWorktreeOptions) (*Repository, error) {
+	files := map[string]string{
+		worktreeGitDirFile:    filepath.Join(path, GitDirName) + "\n",
+		worktreeCommonDirFile: "../..\n",
+	}
+
+	if o.Lock {
+		files[worktreeLockedFile] = o.LockReason
+	}
+
+	for file, content := range files {
+		if err := util.WriteFile(common, common.Join(admin, file), []byte(content), 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	wt := osfs.New(path)
+	gitdir := fmt.Sprintf("gitdir: %s\n", filepath.Join(common.Root(), admin))
+	if err := util.WriteFile(wt, GitDirName, []byte(gitdir), 0644); err != nil {
+		return nil, err
+	}
+
+	s, err := worktreeStorage(common, admin)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.SetReference(head); err != nil {
+		return nil, err
+	}
+
+	lr, err := Open(s, wt)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := lr.Worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.Reset(&ResetOptions{Commit: commit, Mode: HardReset}); err != nil {
+		return nil, err
+	}
+
+	return lr, nil
+}
+
+// checkWorktreePath checks the path of a new worktree is either missing or
+// an empty directory.
+func checkWorktreePath(path string) error {
+	entries, err := osfs.New(path).ReadDir("")
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(entries) != 0 {
+		return ErrWorktreeExists
+	}
+
+	return nil
+}
+
+// addWorktreeHead returns the HEAD of a new worktree and the commit to check
+// out in it, creating the branch if needed.
+func (r *Repository) addWorktreeHead(path string, o *AddWorktreeOptions) (*plumbing.Reference, plumbing.Hash, error) {
+	commit := o.Commit
+	from := commit.String()
+	if commit.IsZero() {
+		head, err := r.Head()
+		if err != nil {
+			return nil, plumbing.ZeroHash, err
+		}
+
+		commit, from = head.Hash(), string(plumbing.HEAD)
+	}
+
+	if o.Detach {
+		return plumbing.NewHashReference(plumbing.HEAD, commit), commit, nil
+	}
+
+	branch := o.Branch
+	if branch == "" {
+		branch = plumbing.NewBranchReferenceName(filepath.Base(path))
+	}
+
+	ref, err := r.Storer.Reference(branch)
+	switch {
+	case err == nil && o.Create:
+		return nil, plumbing.ZeroHash, ErrBranchExists
+	case err == nil:
+		commit = ref.Hash()
+		if !o.Force {
+			if err := r.checkBranchNotCheckedOut(branch); err != nil {
+				return nil, plumbing.ZeroHash, err
+			}
+		}
+	case err == plumbing.ErrReferenceNotFound && (o.Create || o.Branch == ""):
+		err = r.setReference(plumbing.NewHashReference(branch, commit), "branch: Created from "+from, reflogCommitter(r.Storer, nil))
+		if err != nil {
+			return nil, plumbing.ZeroHash, err
+		}
+	case err == plumbing.ErrReferenceNotFound:
+		return nil, plumbing.ZeroHash, ErrBranchNotFound
+	default:
+		return nil, plumbing.ZeroHash, err
+	}
+
+	return plumbing.NewSymbolicReference(plumbing.HEAD, branch), commit, nil
+}
+
+func (r *Repository) checkBranchNotCheckedOut(branch plumbing.ReferenceName) error {
+	worktrees, err := r.Worktrees()
+	if err != nil {
+		return err
+	}
+
+	for _, wt := range worktrees {
+		if !wt.Bare && !wt.Prunable && wt.Branch == branch {
+			return ErrWorktreeBranchCheckedOut
+		}
+	}
+
+	return nil
+}
+
+// newWorktreeName returns the name of the directory of a new worktree in
+// .git/worktrees, the base name of the path being made unique if no name
+// is given.
+func newWorktreeName(common billy.Filesystem, path, name string) (string, error) {
+	if name != "" {
+		if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+			return "", fmt.Errorf("invalid worktree name %q", name)
+		}
+
+		if _, err := common.Stat(common.Join(worktreesPath, name)); err == nil {
+			return "", ErrWorktreeExists
+		}
+
+		return name, nil
+	}
+
+	base := filepath.Base(path)
+	name = base
+	for i := 1; ; i++ {
+		_, err := common.Stat(common.Join(worktreesPath, name))
+		if os.IsNotExist(err) {
+			return name, nil
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+}
+
+// Worktrees returns the worktrees of the repository, the main one being the
+// first, as `git worktree list` does.
+func (r *Repository) Worktrees() ([]*LinkedWorktree, error) {
+	common, err := r.commonDotGit()
+	if err != nil {
+		return nil, err
+	}
+
+	main, err := r.mainWorktree(common)
+	if err != nil {
+		return nil, err
+	}
+
+	worktrees := []*LinkedWorktree{main}
+	entries, err := common.ReadDir(worktreesPath)
+	if os.IsNotExist(err) {
+		return worktrees, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		wt, err := readLinkedWorktree(common, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		worktrees = append(worktrees, wt)
+	}
+
+	return worktrees, nil
+}
+
+func (r *Repository) mainWorktree(common billy.Filesystem) (*LinkedWorktree, error) {
+	cfg, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	wt := &LinkedWorktree{Path: common.Root(), Bare: cfg.Core.IsBare}
+	if !wt.Bare {
+		wt.Path = filepath.Dir(common.Root())
+		if p := cfg.Core.Worktree; p != "" {
+			wt.Path = p
+			if !filepath.IsAbs(p) {
+				wt.Path = filepath.Join(common.Root(), p)
+			}
+		}
+	}
+
+	s := filesystem.NewStorage(common, cache.NewObjectLRUDefault())
+	return wt, readWorktreeHead(s, wt)
+}
+
+func readLinkedWorktree(common billy.Filesystem, name string) (*LinkedWorktree, error) {
+	admin := common.Join(worktreesPath, name)
+	wt := &LinkedWorktree{Name: name, Prunable: true}
+
+	gitdir, err := util.ReadFile(common, common.Join(admin, worktreeGitDirFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err == nil {
+		p := strings.TrimSpace(string(gitdir))
+		wt.Path = filepath.Dir(p)
+		if _, err := os.Stat(p); err == nil {
+			wt.Prunable = false
+		}
+	}
+
+	reason, err := util.ReadFile(common, common.Join(admin, worktreeLockedFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err == nil {
+		wt.Locked, wt.LockReason = true, strings.TrimSpace(string(reason))
+	}
+
+	s, err := worktreeStorage(common, admin)
+	if err != nil {
+		return nil, err
+	}
+
+	return wt, readWorktreeHead(s, wt)
+}
+
+// readWorktreeHead fills the Branch and Head of wt from its HEAD.
+func readWorktreeHead(s storer.ReferenceStorer, wt *LinkedWorktree) error {
+	head, err := s.Reference(plumbing.HEAD)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if head.Type() == plumbing.SymbolicReference {
+		wt.Branch = head.Target()
+	}
+
+	ref, err := storer.ResolveReference(s, plumbing.HEAD)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	wt.Head = ref.Hash()
+	return nil
+}
+
+// RemoveWorktree removes the linked worktree with the given name, its
+// directory and its administrative files, as `git worktree remove` does.
+// Worktrees with local changes or untracked files, and locked worktrees,
+// are only removed if RemoveWorktreeOptions.Force is set.
+func (r *Repository) RemoveWorktree(name string, o *RemoveWorktreeOptions) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	common, wt, err := r.linkedWorktree(name)
+	if err != nil {
+		return err
+	}
+
+	if wt.Locked && !o.Force {
+		return ErrWorktreeLocked
+	}
+
+	if !wt.Prunable {
+		if err := validateWorktree(common, wt); err != nil {
+			return err
+		}
+
+		if !o.Force {
+			if err := checkWorktreeClean(wt.Path); err != nil {
+				return err
+			}
+		}
+
+		if err := os.RemoveAll(wt.Path); err != nil {
+			return err
+		}
+	}
+
+	return util.RemoveAll(common, common.Join(worktreesPath, name))
+}
+
+// validateWorktree checks the .git file of the directory of the linked
+// worktree points back to its administrative files, as git does before
+// removing it, so a stale or edited gitdir file doesn't lead to remove any
+// other directory.
+func validateWorktree(common billy.Filesystem, wt *LinkedWorktree) error {
+	if !filepath.IsAbs(wt.Path) {
+		return ErrWorktreeInvalid
+	}
+
+	fs := osfs.New(wt.Path)
+	fi, err := fs.Lstat(GitDirName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrWorktreeInvalid
+		}
+
+		return err
+	}
+
+	if !fi.Mode().IsRegular() {
+		return ErrWorktreeInvalid
+	}
+
+	content, err := util.ReadFile(fs, GitDirName)
+	if err != nil {
+		return err
+	}
+
+	line := strings.TrimSpace(string(content))
+	if !strings.HasPrefix(line, "gitdir: ") {
+		return ErrWorktreeInvalid
+	}
+
+	gitdir := strings.TrimPrefix(line, "gitdir: ")
+	if !filepath.IsAbs(gitdir) {
+		gitdir = filepath.Join(wt.Path, gitdir)
+	}
+
+	linked, err := os.Stat(gitdir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrWorktreeInvalid
+		}
+
+		return err
+	}
+
+	admin, err := os.Stat(filepath.Join(common.Root(), worktreesPath, wt.Name))
+	if err != nil {
+		return err
+	}
+
+	if !os.SameFile(linked, admin) {
+		return ErrWorktreeInvalid
+	}
+
+	return nil
+}
+
+func checkWorktreeClean(path string) error {
+	lr, err := PlainOpenWithOptions(path, &PlainOpenOptions{EnableDotGitCommonDir: true})
+	if err != nil {
+		return err
+	}
+
+	w, err := lr.Worktree()
+	if err != nil {
+		return err
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return err
+	}
+
+	if !status.IsClean() {
+		return ErrWorktreeNotClean
+	}
+
+	return nil
+}
+
+// LockWorktree locks the linked worktree with the given name, so it can't
+// be pruned or removed, as `git worktree lock` does. It's useful for
+// worktrees on removable devices or network shares.
+func (r *Repository) LockWorktree(name, reason string) error {
+	common, wt, err := r.linkedWorktree(name)
+	if err != nil {
+		return err
+	}
+
+	if wt.Locked {
+		return ErrWorktreeLocked
+	}
+
+	file := common.Join(worktreesPath, name, worktreeLockedFile)
+	return util.WriteFile(common, file, []byte(reason), 0644)
+}
+
+// UnlockWorktree unlocks the linked worktree with the given name, see
+// LockWorktree.
+func (r *Repository) UnlockWorktree(name string) error {
+	common, wt, err := r.linkedWorktree(name)
+	if err != nil {
+		return err
+	}
+
+	if !wt.Locked {
+		return ErrWorktreeNotLocked
+	}
+
+	return common.Remove(common.Join(worktreesPath, name, worktreeLockedFile))
+}
+
+// PruneWorktrees removes the administrative files of the linked worktrees
+// whose directory doesn't exist anymore, unless they are locked, as
+// `git worktree prune` does.
+func (r *Repository) PruneWorktrees() error {
+	worktrees, err := r.Worktrees()
+	if err != nil {
+		return err
+	}
+
+	common, err := r.commonDotGit()
+	if err != nil {
+		return err
+	}
+
+	for _, wt := range worktrees {
+		if wt.Name == "" || !wt.Prunable || wt.Locked {
+			continue
+		}
+
+		if err := util.RemoveAll(common, common.Join(worktreesPath, wt.Name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// linkedWorktree returns the linked worktree with the given name.
+func (r *Repository) linkedWorktree(name string) (billy.Filesystem, *LinkedWorktree, error) {
+	common, err := r.commonDotGit()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return nil, nil, ErrWorktreeNotFound
+	}
+
+	if _, err := common.Stat(common.Join(worktreesPath, name)); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, ErrWorktreeNotFound
+		}
+
+		return nil, nil, err
+	}
+
+	wt, err := readLinkedWorktree(common, name)
+	return common, wt, err
+}
+
+// commonDotGit returns the filesystem of the git directory shared by all
+// the worktrees of the repository.
+func (r *Repository) commonDotGit() (billy.Filesystem, error) {
+	fsBased, ok := r.Storer.(interface{ Filesystem() billy.Filesystem })
+	if !ok {
+		return nil, ErrWorktreesNotSupported
+	}
+
+	dot := fsBased.Filesystem()
+	common, err := dotGitCommonDirectory(dot)
+	if err != nil || common == nil {
+		return dot, err
+	}
+
+	return common, nil
+}
+
+// worktreeStorage returns the storage of the linked worktree whose
+// administrative files are in the given directory of common.
+func worktreeStorage(common billy.Filesystem, admin string) (*filesystem.Storage, error) {
+	dot, err := common.Chroot(admin)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := dotgit.NewRepositoryFilesystem(dot, common)
+	return filesystem.NewStorage(fs, cache.NewObjectLRUDefault()), nil
+}
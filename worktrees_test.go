@@ -0,0 +1,278 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	. "gopkg.in/check.v1"
+)
+
+type WorktreesSuite struct {
+	BaseSuite
+}
+
+var _ = Suite(&WorktreesSuite{})
+
+func (s *WorktreesSuite) prepareRepository(c *C) (r *Repository, dir string, h plumbing.Hash, clean func()) {
+	dir, clean = s.TemporalDir()
+
+	r, err := PlainInit(filepath.Join(dir, "main"), false)
+	c.Assert(err, IsNil)
+
+	w, err := r.Worktree()
+	c.Assert(err, IsNil)
+
+	h = commitFiles(c, w, "init", map[string]string{"foo": "foo\n"})
+	return r, dir, h, clean
+}
+
+func (s *WorktreesSuite) TestAddWorktree(c *C) {
+	r, dir, h, clean := s.prepareRepository(c)
+	defer clean()
+
+	path := filepath.Join(dir, "feature")
+	lr, err := r.AddWorktree(path, &AddWorktreeOptions{})
+	c.Assert(err, IsNil)
+
+	branch, err := r.Reference("refs/heads/feature", false)
+	c.Assert(err, IsNil)
+	c.Assert(branch.Hash(), Equals, h)
+
+	head, err := lr.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Name(), Equals, plumbing.ReferenceName("refs/heads/feature"))
+
+	w, err := lr.Worktree()
+	c.Assert(err, IsNil)
+	assertWorktreeFiles(c, w, map[string]string{"foo": "foo\n"})
+
+	status, err := w.Status()
+	c.Assert(err, IsNil)
+	c.Assert(status.IsClean(), Equals, true)
+
+	commit := commitFiles(c, w, "feature", map[string]string{"bar": "bar\n"})
+
+	branch, err = r.Reference("refs/heads/feature", false)
+	c.Assert(err, IsNil)
+	c.Assert(branch.Hash(), Equals, commit)
+
+	head, err = r.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Name(), Equals, plumbing.Master)
+	c.Assert(head.Hash(), Equals, h)
+
+	opened, err := PlainOpenWithOptions(path, &PlainOpenOptions{EnableDotGitCommonDir: true})
+	c.Assert(err, IsNil)
+	head, err = opened.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Hash(), Equals, commit)
+
+	worktrees, err := r.Worktrees()
+	c.Assert(err, IsNil)
+	c.Assert(worktrees, HasLen, 2)
+	c.Assert(worktrees[0].Name, Equals, "")
+	c.Assert(worktrees[0].Path, Equals, filepath.Join(dir, "main"))
+	c.Assert(worktrees[0].Branch, Equals, plumbing.Master)
+	c.Assert(worktrees[0].Head, Equals, h)
+	c.Assert(worktrees[1].Name, Equals, "feature")
+	c.Assert(worktrees[1].Path, Equals, path)
+	c.Assert(worktrees[1].Branch, Equals, plumbing.ReferenceName("refs/heads/feature"))
+	c.Assert(worktrees[1].Head, Equals, commit)
+	c.Assert(worktrees[1].Prunable, Equals, false)
+
+	listed, err := lr.Worktrees()
+	c.Assert(err, IsNil)
+	c.Assert(listed, DeepEquals, worktrees)
+}
+
+func (s *WorktreesSuite) TestAddWorktreeBranch(c *C) {
+	r, dir, h, clean := s.prepareRepository(c)
+	defer clean()
+
+	_, err := r.AddWorktree(filepath.Join(dir, "other"), &AddWorktreeOptions{Branch: plumbing.Master})
+	c.Assert(err, Equals, ErrWorktreeBranchCheckedOut)
+
+	_, err = r.AddWorktree(filepath.Join(dir, "other"), &AddWorktreeOptions{Branch: "refs/heads/foo"})
+	c.Assert(err, Equals, ErrBranchNotFound)
+
+	_, err = r.AddWorktree(filepath.Join(dir, "other"), &AddWorktreeOptions{Branch: plumbing.Master, Create: true})
+	c.Assert(err, Equals, ErrBranchExists)
+
+	lr, err := r.AddWorktree(filepath.Join(dir, "other"), &AddWorktreeOptions{
+		Name:   "foo",
+		Branch: "refs/heads/foo",
+		Create: true,
+	})
+	c.Assert(err, IsNil)
+
+	head, err := lr.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Name(), Equals, plumbing.ReferenceName("refs/heads/foo"))
+	c.Assert(head.Hash(), Equals, h)
+
+	_, err = r.AddWorktree(filepath.Join(dir, "another"), &AddWorktreeOptions{Branch: "refs/heads/foo"})
+	c.Assert(err, Equals, ErrWorktreeBranchCheckedOut)
+
+	_, err = r.AddWorktree(filepath.Join(dir, "other"), &AddWorktreeOptions{Detach: true})
+	c.Assert(err, Equals, ErrWorktreeExists)
+
+	lr, err = r.AddWorktree(filepath.Join(dir, "detached"), &AddWorktreeOptions{Detach: true})
+	c.Assert(err, IsNil)
+
+	head, err = lr.Head()
+	c.Assert(err, IsNil)
+	c.Assert(head.Name(), Equals, plumbing.HEAD)
+	c.Assert(head.Hash(), Equals, h)
+
+	worktrees, err := r.Worktrees()
+	c.Assert(err, IsNil)
+	c.Assert(worktrees, HasLen, 3)
+	c.Assert(worktrees[1].Name, Equals, "detached")
+	c.Assert(worktrees[1].Branch, Equals, plumbing.ReferenceName(""))
+	c.Assert(worktrees[2].Name, Equals, "foo")
+}
+
+func (s *WorktreesSuite) TestAddWorktreeError(c *C) {
+	r, dir, _, clean := s.prepareRepository(c)
+	defer clean()
+
+	path := filepath.Join(dir, "feature")
+	_, err := r.AddWorktree(path, &AddWorktreeOptions{
+		Commit: plumbing.NewHash("0123456789012345678901234567890123456789"),
+		Detach: true,
+	})
+	c.Assert(err, NotNil)
+
+	_, err = os.Stat(path)
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	_, err = os.Stat(filepath.Join(dir, "main", GitDirName, worktreesPath, "feature"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	worktrees, err := r.Worktrees()
+	c.Assert(err, IsNil)
+	c.Assert(worktrees, HasLen, 1)
+}
+
+func (s *WorktreesSuite) TestAddWorktreeNotSupported(c *C) {
+	r, err := Init(memory.NewStorage(), memfs.New())
+	c.Assert(err, IsNil)
+
+	_, err = r.AddWorktree("foo", &AddWorktreeOptions{})
+	c.Assert(err, Equals, ErrWorktreesNotSupported)
+}
+
+func (s *WorktreesSuite) TestRemoveWorktree(c *C) {
+	r, dir, _, clean := s.prepareRepository(c)
+	defer clean()
+
+	path := filepath.Join(dir, "feature")
+	lr, err := r.AddWorktree(path, &AddWorktreeOptions{Lock: true, LockReason: "usb drive"})
+	c.Assert(err, IsNil)
+
+	worktrees, err := r.Worktrees()
+	c.Assert(err, IsNil)
+	c.Assert(worktrees[1].Locked, Equals, true)
+	c.Assert(worktrees[1].LockReason, Equals, "usb drive")
+
+	err = r.RemoveWorktree("feature", &RemoveWorktreeOptions{})
+	c.Assert(err, Equals, ErrWorktreeLocked)
+
+	err = r.LockWorktree("feature", "")
+	c.Assert(err, Equals, ErrWorktreeLocked)
+
+	err = r.UnlockWorktree("feature")
+	c.Assert(err, IsNil)
+
+	err = r.UnlockWorktree("feature")
+	c.Assert(err, Equals, ErrWorktreeNotLocked)
+
+	w, err := lr.Worktree()
+	c.Assert(err, IsNil)
+	err = util.WriteFile(w.Filesystem, "qux", []byte("qux\n"), 0644)
+	c.Assert(err, IsNil)
+
+	err = r.RemoveWorktree("feature", &RemoveWorktreeOptions{})
+	c.Assert(err, Equals, ErrWorktreeNotClean)
+
+	err = r.RemoveWorktree("feature", &RemoveWorktreeOptions{Force: true})
+	c.Assert(err, IsNil)
+
+	_, err = os.Stat(path)
+	c.Assert(os.IsNotExist(err), Equals, true)
+	_, err = os.Stat(filepath.Join(dir, "main", ".git", "worktrees", "feature"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	err = r.RemoveWorktree("feature", &RemoveWorktreeOptions{})
+	c.Assert(err, Equals, ErrWorktreeNotFound)
+
+	_, err = r.Reference("refs/heads/feature", false)
+	c.Assert(err, IsNil)
+}
+
+func (s *WorktreesSuite) TestRemoveWorktreeInvalid(c *C) {
+	r, dir, _, clean := s.prepareRepository(c)
+	defer clean()
+
+	_, err := r.AddWorktree(filepath.Join(dir, "feature"), &AddWorktreeOptions{})
+	c.Assert(err, IsNil)
+
+	other := filepath.Join(dir, "other")
+	_, err = PlainInit(other, false)
+	c.Assert(err, IsNil)
+
+	// the gitdir file is edited to point to another repository
+	gitdir := filepath.Join(dir, "main", ".git", "worktrees", "feature", "gitdir")
+	err = ioutil.WriteFile(gitdir, []byte(filepath.Join(other, ".git")+"\n"), 0644)
+	c.Assert(err, IsNil)
+
+	err = r.RemoveWorktree("feature", &RemoveWorktreeOptions{Force: true})
+	c.Assert(err, Equals, ErrWorktreeInvalid)
+
+	_, err = os.Stat(filepath.Join(other, ".git"))
+	c.Assert(err, IsNil)
+}
+
+func (s *WorktreesSuite) TestPruneWorktrees(c *C) {
+	r, dir, _, clean := s.prepareRepository(c)
+	defer clean()
+
+	for _, name := range []string{"foo", "bar", "qux"} {
+		_, err := r.AddWorktree(filepath.Join(dir, name), &AddWorktreeOptions{})
+		c.Assert(err, IsNil)
+	}
+
+	err := r.LockWorktree("bar", "")
+	c.Assert(err, IsNil)
+
+	c.Assert(os.RemoveAll(filepath.Join(dir, "foo")), IsNil)
+	c.Assert(os.RemoveAll(filepath.Join(dir, "bar")), IsNil)
+
+	worktrees, err := r.Worktrees()
+	c.Assert(err, IsNil)
+	c.Assert(worktrees, HasLen, 4)
+	c.Assert(worktrees[1].Name, Equals, "bar")
+	c.Assert(worktrees[1].Prunable, Equals, true)
+	c.Assert(worktrees[2].Name, Equals, "foo")
+	c.Assert(worktrees[2].Prunable, Equals, true)
+	c.Assert(worktrees[3].Prunable, Equals, false)
+
+	err = r.PruneWorktrees()
+	c.Assert(err, IsNil)
+
+	worktrees, err = r.Worktrees()
+	c.Assert(err, IsNil)
+	c.Assert(worktrees, HasLen, 3)
+	c.Assert(worktrees[1].Name, Equals, "bar")
+	c.Assert(worktrees[2].Name, Equals, "qux")
+
+	// the branch of a pruned worktree can be checked out again
+	_, err = r.AddWorktree(filepath.Join(dir, "foo"), &AddWorktreeOptions{})
+	c.Assert(err, IsNil)
+}